@@ -0,0 +1,69 @@
+package buffer
+
+import "strings"
+
+// ColumnSpan is the part of one line covered by a block selection: runes
+// [From, To) of Line. Pad is how many spaces text inserted at From needs
+// in front of it to reach the block, for lines that end left of it.
+type ColumnSpan struct {
+	Line, From, To, Pad int
+}
+
+// SpansText returns the text of each span.
+func (b *Buffer) SpansText(spans []ColumnSpan) []string {
+	texts := make([]string, len(spans))
+	for i, s := range spans {
+		texts[i] = runeSlice(b.Line(s.Line), s.From, s.To)
+	}
+	return texts
+}
+
+// ReplaceSpans replaces each span with its text, texts[i] for span i, or
+// texts[0] for every span when there is only one. Spans past the last line
+// add lines. It is a single undo step.
+func (b *Buffer) ReplaceSpans(spans []ColumnSpan, texts []string) {
+	if len(spans) == 0 || len(texts) == 0 {
+		return
+	}
+	groupID := b.Undo.NewGroup()
+	before := b.Cursor
+
+	last := b.LineCount() - 1
+	maxLine := last
+	for _, s := range spans {
+		if s.Line > maxLine {
+			maxLine = s.Line
+		}
+	}
+	if maxLine > last {
+		pos := Cursor{Line: last, Col: RuneLen(b.Line(last))}
+		newlines := strings.Repeat("\n", maxLine-last)
+		added := make([]string, maxLine-last)
+		b.InsertLines(last+1, added...)
+		b.Undo.PushGrouped(Operation{Type: OpInsert, Pos: pos, Text: newlines, Before: before}, groupID)
+	}
+
+	for i, s := range spans {
+		text := texts[0]
+		if len(texts) > 1 {
+			if i >= len(texts) {
+				break
+			}
+			text = texts[i]
+		}
+		line := b.Line(s.Line)
+		pos := Cursor{Line: s.Line, Col: s.From}
+		if s.To > s.From {
+			deleted := runeSlice(line, s.From, s.To)
+			line = runeSliceTo(line, s.From) + runeSliceFrom(line, s.To)
+			b.Undo.PushGrouped(Operation{Type: OpDelete, Pos: pos, Text: deleted, Before: before}, groupID)
+		}
+		if text != "" {
+			text = strings.Repeat(" ", s.Pad) + text
+			line = runeInsert(line, s.From, text)
+			b.Undo.PushGrouped(Operation{Type: OpInsert, Pos: pos, Text: text, Before: before}, groupID)
+		}
+		b.SetLine(s.Line, line)
+	}
+	b.Dirty = true
+}
@@ -1,7 +1,6 @@
 package buffer
 
 import (
-	"fmt"
 	"os"
 	"sort"
 	"strings"
@@ -60,27 +59,32 @@ func runeInsert(s string, col int, text string) string {
 }
 
 type Buffer struct {
-	Lines              []string
-	Path               string
-	Cursor             Cursor
-	Selection          *Selection
-	Dirty              bool
-	ExternallyModified bool // File was modified externally while buffer has unsaved changes
-	Undo               *UndoStack
-	Language           string
-	ReadOnly           bool
-	IsBinary           bool
-	TabSize            int
-	LastSaveTime       time.Time   // Track when file was last saved
-	FileSize           int64       // File size in bytes at load time
-	LineEnding         string      // "LF" or "CRLF" — detected from file, preserved on save
-	UseTabs            bool        // Use real tabs instead of spaces
-	AutoCloseEnabled   bool        // Enable automatic closing pairs
-	Pasting            bool        // True during bracketed paste (suppresses auto-indent/auto-close)
-	Encoding           string      // Detected encoding (UTF-8, Latin-1, etc.)
-	HasBOM             bool        // File had UTF-8 BOM
-	ExtraCursors       []Cursor    // additional cursors for multi-cursor editing
-	FoldedLines        map[int]int // maps fold start line -> fold end line (exclusive)
+	Path                string
+	UntitledID          string // names the backup of a buffer with no Path
+	Cursor              Cursor
+	Selection           *Selection
+	Block               *Block // rectangular selection; nil when there is none
+	Dirty               bool
+	ExternallyModified  bool // File was modified externally while buffer has unsaved changes
+	Undo                *UndoStack
+	Language            string
+	ReadOnly            bool
+	IsBinary            bool
+	TabSize             int
+	LastSaveTime        time.Time     // Track when file was last saved
+	FileSize            int64         // File size in bytes at load time
+	LineEnding          string        // "LF", "CRLF" or "CR" — the file's most common, used on save
+	MixedLineEndings    bool          // Some lines end differently from LineEnding
+	PreserveLineEndings bool          // Save mixed endings line by line instead of converting them
+	UseTabs             bool          // Use real tabs instead of spaces
+	MaxLineLength       int           // Ruler column from .editorconfig max_line_length, 0 for none
+	AutoCloseEnabled    bool          // Enable automatic closing pairs
+	Pasting             bool          // True during bracketed paste (suppresses auto-indent/auto-close)
+	Encoding            string        // Detected encoding (UTF-8, Latin-1, etc.)
+	ForcedEncoding      string        // Encoding chosen with Reopen with Encoding; reloads keep it
+	HasBOM              bool          // File had UTF-8 BOM
+	ExtraCursors        []ExtraCursor // additional cursors for multi-cursor editing
+	FoldedLines         map[int]int   // maps fold start line -> fold end line (exclusive)
 
 	// Auto-close bracket swallowing state.
 	// Tracks an ordered list of auto-inserted closers that are still pending
@@ -88,30 +92,55 @@ type Buffer struct {
 	autoClosePending []rune
 	autoClosePos     Cursor
 
-	savedSnapshot string
+	// text holds the lines; saved is the text as last loaded or saved. The
+	// rope shares unchanged subtrees between versions, so keeping saved
+	// around is cheap and comparing them rarely has to look at every line.
+	text  *rope
+	saved *rope
+
+	// version counts changes to the text, see Version.
+	version int
+
+	// large serves the lines instead of text for files opened in large-file
+	// mode. Such buffers are read-only.
+	large *LargeFile
+
+	// lineEndingChanged is set when the line endings were converted since
+	// the last save, which dirties the buffer without changing the text.
+	lineEndingChanged bool
+
+	// follow is set while the buffer follows appends to its file.
+	follow *followState
 }
 
 func NewBuffer(tabSize int) *Buffer {
+	text := newRope([]string{""})
 	return &Buffer{
-		Lines:            []string{""},
 		Undo:             NewUndoStack(),
 		TabSize:          tabSize,
 		LineEnding:       "LF",
 		AutoCloseEnabled: true,
 		FoldedLines:      make(map[int]int),
-		savedSnapshot:    "",
+		text:             text,
+		saved:            text,
 	}
 }
 
 func NewBufferFromFile(path string, tabSize int) (*Buffer, error) {
+	return NewBufferFromFileEncoding(path, tabSize, "")
+}
+
+// NewBufferFromFileEncoding loads path decoded from encoding, one of
+// Encodings. An empty encoding is detected from the content.
+func NewBufferFromFileEncoding(path string, tabSize int, encoding string) (*Buffer, error) {
 	// Check if file exists
 	info, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// File doesn't exist - create a new buffer with this path
 			// Detect language from extension even though file doesn't exist
-			return &Buffer{
-				Lines:            []string{""},
+			text := newRope([]string{""})
+			b := &Buffer{
 				Path:             path,
 				Undo:             NewUndoStack(),
 				TabSize:          tabSize,
@@ -120,29 +149,32 @@ func NewBufferFromFile(path string, tabSize int) (*Buffer, error) {
 				AutoCloseEnabled: true,
 				Encoding:         "UTF-8",
 				FoldedLines:      make(map[int]int),
-				savedSnapshot:    "",
-			}, nil
+				text:             text,
+				saved:            text,
+			}
+			if encoding != "" {
+				b.SetEncoding(encoding)
+				b.ForcedEncoding = encoding
+			}
+			return b, nil
 		}
 		return nil, err
 	}
 
-	// File exists - check size before reading
-	if info.Size() > 100*1024*1024 { // 100MB
-		return nil, fmt.Errorf("file too large (%d MB), max supported is 100 MB", info.Size()/(1024*1024))
-	}
-
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	// Binary file detection: check first 8KB for null bytes
+	// Binary file detection: check first 8KB for null bytes, which UTF-16
+	// text is full of
 	checkLen := len(data)
 	if checkLen > 8192 {
 		checkLen = 8192
 	}
 	isBinary := false
-	for i := 0; i < checkLen; i++ {
+	utf16 := strings.HasPrefix(encoding, "UTF-16") || encoding == "" && hasUTF16BOM(data)
+	for i := 0; i < checkLen && !utf16; i++ {
 		if data[i] == 0 {
 			isBinary = true
 			break
@@ -150,44 +182,35 @@ func NewBufferFromFile(path string, tabSize int) (*Buffer, error) {
 	}
 
 	// Encoding detection
-	encoding := detectEncoding(data)
-
-	// Strip UTF-8 BOM if present
-	hasBOM := false
-	if len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
-		data = data[3:]
-		hasBOM = true
+	forced := encoding
+	if encoding == "" {
+		encoding = detectEncoding(data, isBinary)
 	}
+	hasBOM := encoding == "UTF-8 BOM"
 
-	// Decode non-UTF-8 encodings to UTF-8 for internal use
-	if encoding == "Latin-1" {
-		// Convert Latin-1 bytes to UTF-8
-		runes := make([]rune, len(data))
-		for i, b := range data {
-			runes[i] = rune(b)
-		}
-		data = []byte(string(runes))
-	}
+	// Decode to UTF-8 for internal use
+	data = []byte(decodeText(data, encoding))
 
-	// Line ending detection: check for CRLF before normalizing
-	lineEnding := "LF"
-	if strings.Contains(string(data), "\r\n") {
-		lineEnding = "CRLF"
+	// Split at any line break, noting lines that end differently from the
+	// rest
+	lines, eols, lineEnding := splitLines(string(data))
+	mixed := false
+	for len(lines) > 1 && lines[len(lines)-1] == "" {
+		// Trailing newlines are left out; saving adds one back
+		lines = lines[:len(lines)-1]
 	}
-
-	content := string(data)
-	content = strings.ReplaceAll(content, "\r\n", "\n")
-	content = strings.TrimRight(content, "\n")
-	lines := strings.Split(content, "\n")
-	if len(lines) == 0 {
-		lines = []string{""}
+	for _, eol := range eols[:len(lines)] {
+		mixed = mixed || eol != ""
 	}
 
 	// Auto-detect indentation from file content
 	detectedTabSize, detectedUseTabs := DetectIndentation(lines)
 
+	text := newRope(lines)
+	if mixed {
+		text = newRopeEOL(lines, eols)
+	}
 	return &Buffer{
-		Lines:            lines,
 		Path:             path,
 		Undo:             NewUndoStack(),
 		TabSize:          detectedTabSize,
@@ -196,16 +219,45 @@ func NewBufferFromFile(path string, tabSize int) (*Buffer, error) {
 		IsBinary:         isBinary,
 		FileSize:         info.Size(),
 		LineEnding:       lineEnding,
+		MixedLineEndings: mixed,
 		AutoCloseEnabled: true,
 		Encoding:         encoding,
+		ForcedEncoding:   forced,
 		HasBOM:           hasBOM,
 		FoldedLines:      make(map[int]int),
-		savedSnapshot:    strings.Join(lines, "\n"),
+		text:             text,
+		saved:            text,
+	}, nil
+}
+
+// NewLargeFileBuffer opens path in large-file mode: a read-only buffer whose
+// lines are read from disk on demand and indexed in the background. notify
+// is called from the indexing goroutine as it progresses.
+func NewLargeFileBuffer(path string, tabSize int, notify func()) (*Buffer, error) {
+	lf, err := OpenLargeFile(path, notify)
+	if err != nil {
+		return nil, err
+	}
+	text := newRope([]string{""})
+	return &Buffer{
+		Path:        path,
+		Undo:        NewUndoStack(),
+		TabSize:     tabSize,
+		ReadOnly:    true,
+		FileSize:    lf.Size(),
+		LineEnding:  lf.lineEnding(),
+		Encoding:    "UTF-8",
+		FoldedLines: make(map[int]int),
+		text:        text,
+		saved:       text,
+		large:       lf,
 	}, nil
 }
 
 // detectEncoding checks BOM and validates UTF-8 to determine file encoding.
-func detectEncoding(data []byte) string {
+// Text in other encodings is told apart by detectLegacyEncoding; binary
+// files are only ever UTF-8 or Latin-1.
+func detectEncoding(data []byte, binary bool) string {
 	// Check BOM
 	if len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
 		return "UTF-8 BOM"
@@ -222,7 +274,14 @@ func detectEncoding(data []byte) string {
 	if isValidUTF8(data) {
 		return "UTF-8"
 	}
-	return "Latin-1"
+	if binary {
+		return "Latin-1"
+	}
+	return detectLegacyEncoding(data)
+}
+
+func hasUTF16BOM(data []byte) bool {
+	return len(data) >= 2 && (data[0] == 0xFF && data[1] == 0xFE || data[0] == 0xFE && data[1] == 0xFF)
 }
 
 func isValidUTF8(data []byte) bool {
@@ -336,33 +395,43 @@ func (b *Buffer) Save() error {
 // When insertFinalNewline is enabled, output is normalized to exactly one
 // trailing newline on disk.
 func (b *Buffer) BuildSaveContent(trimTrailing, insertFinalNewline bool) string {
-	lines := make([]string, len(b.Lines))
-	copy(lines, b.Lines)
-
 	if trimTrailing {
-		for i, line := range lines {
-			lines[i] = strings.TrimRight(line, " \t")
+		for i := 0; i < b.text.Len(); i++ {
+			line := b.text.line(i).text
+			if trimmed := strings.TrimRight(line, " \t"); trimmed != line {
+				b.SetLine(i, trimmed)
+			}
 		}
 	}
 
 	if insertFinalNewline {
-		for len(lines) > 0 && lines[len(lines)-1] == "" {
-			lines = lines[:len(lines)-1]
+		n := b.text.Len()
+		last := n
+		for last > 0 && b.text.line(last-1).text == "" {
+			last--
 		}
-		lines = append(lines, "")
+		b.ReplaceLines(last, n, "")
 	}
 
-	eol := "\n"
-	if b.LineEnding == "CRLF" {
-		eol = "\r\n"
-	}
-
-	content := strings.Join(lines, eol)
-	if insertFinalNewline && len(lines) == 1 && lines[0] == "" {
+	eol := lineBreak(b.LineEnding)
+	n := b.text.Len()
+	var sb strings.Builder
+	sb.Grow(b.text.runes + n*len(eol))
+	b.text.each(0, n, func(i int, l ropeLine) bool {
+		sb.WriteString(l.text)
+		if i < n-1 {
+			if b.PreserveLineEndings && l.eol != "" {
+				sb.WriteString(l.eol)
+			} else {
+				sb.WriteString(eol)
+			}
+		}
+		return true
+	})
+	content := sb.String()
+	if insertFinalNewline && n == 1 {
 		content = eol
 	}
-
-	b.Lines = lines
 	return content
 }
 
@@ -374,58 +443,210 @@ func (b *Buffer) SaveWithOptions(trimTrailing, insertFinalNewline bool) error {
 
 	content := b.BuildSaveContent(trimTrailing, insertFinalNewline)
 
-	var outBytes []byte
-
-	// Re-add BOM if originally present
-	if b.HasBOM {
-		outBytes = append([]byte{0xEF, 0xBB, 0xBF}, []byte(content)...)
-	} else if b.Encoding == "Latin-1" {
-		// Convert UTF-8 back to Latin-1
-		latin1 := make([]byte, 0, len(content))
-		for _, r := range content {
-			if r <= 0xFF {
-				latin1 = append(latin1, byte(r))
-			} else {
-				latin1 = append(latin1, '?') // chars outside Latin-1 range
-			}
-		}
-		outBytes = latin1
-	} else {
-		outBytes = []byte(content)
-	}
+	outBytes := b.EncodeContent(content)
 
 	err := os.WriteFile(b.Path, outBytes, 0644)
 	if err == nil {
 		b.MarkSaved()
 		b.LastSaveTime = time.Now()
+		if b.follow != nil {
+			b.StartFollow()
+		}
 	}
 	return err
 }
 
-func (b *Buffer) currentSnapshot() string {
-	return strings.Join(b.Lines, "\n")
+// LineCount returns the number of lines, which is always at least one.
+func (b *Buffer) LineCount() int {
+	if b.large != nil {
+		return b.large.LineCount()
+	}
+	return b.text.Len()
+}
+
+// Line returns line i, or "" when i is out of range.
+func (b *Buffer) Line(i int) string {
+	if b.large != nil {
+		return b.large.Line(i)
+	}
+	if i < 0 || i >= b.text.Len() {
+		return ""
+	}
+	return b.text.line(i).text
+}
+
+// Lines returns a copy of every line. It costs O(file); prefer Line and
+// LineCount, or LinesRange for a window.
+func (b *Buffer) Lines() []string {
+	return b.LinesRange(0, b.text.Len())
+}
+
+// LinesRange returns a copy of lines [from, to), clamped to the buffer.
+func (b *Buffer) LinesRange(from, to int) []string {
+	if from < 0 {
+		from = 0
+	}
+	if n := b.LineCount(); to > n {
+		to = n
+	}
+	if from >= to {
+		return nil
+	}
+	if b.large != nil {
+		lines := make([]string, 0, to-from)
+		for i := from; i < to; i++ {
+			lines = append(lines, b.large.Line(i))
+		}
+		return lines
+	}
+	lines := make([]string, 0, to-from)
+	b.text.each(from, to, func(_ int, l ropeLine) bool {
+		lines = append(lines, l.text)
+		return true
+	})
+	return lines
+}
+
+// Text returns the whole buffer joined with "\n".
+func (b *Buffer) Text() string {
+	if b.large != nil {
+		return strings.Join(b.Lines(), "\n")
+	}
+	var sb strings.Builder
+	sb.Grow(b.text.runes + b.text.count)
+	b.text.each(0, b.text.count, func(i int, l ropeLine) bool {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(l.text)
+		return true
+	})
+	return sb.String()
+}
+
+// SetLine replaces line i, which must be in range. The line keeps its line
+// break.
+func (b *Buffer) SetLine(i int, s string) {
+	l := newRopeLine(s)
+	l.eol = b.text.line(i).eol
+	b.text = b.text.set(i, l)
+	b.version++
+}
+
+// SetLines replaces the whole text. An empty slice leaves one empty line.
+func (b *Buffer) SetLines(lines []string) {
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+	b.text = newRope(lines)
+	b.version++
+}
+
+// ReplaceLines replaces lines [from, to) with lines. Removing every line
+// leaves one empty line. The new lines keep the line breaks of those they
+// replace, the last one taking the last replaced line's, so editing a
+// mixed-ending file only changes the breaks it touches. Inserted lines take
+// the break of the line above them.
+func (b *Buffer) ReplaceLines(from, to int, lines ...string) {
+	var eols []string
+	b.text.each(from, to, func(_ int, l ropeLine) bool {
+		eols = append(eols, l.eol)
+		return true
+	})
+	if len(eols) == 0 && from > 0 && from <= b.text.Len() {
+		eols = append(eols, b.text.line(from-1).eol)
+	}
+	repl := make([]ropeLine, len(lines))
+	for i, s := range lines {
+		repl[i] = newRopeLine(s)
+		if len(eols) > 0 {
+			repl[i].eol = eols[min(i, len(eols)-1)]
+		}
+	}
+	if n := len(repl); n > 0 && len(eols) > 0 {
+		repl[n-1].eol = eols[len(eols)-1]
+	}
+	b.text = b.text.replace(from, to, repl)
+	if b.text == nil {
+		b.text = newRope([]string{""})
+	}
+	b.version++
+}
+
+// Version counts the changes made to the text: every edit, undo and redo
+// raises it, while line ending conversions, which leave the lines alone,
+// don't. It starts at 0 when the buffer is made.
+func (b *Buffer) Version() int {
+	return b.version
+}
+
+// InsertLines inserts lines before line at.
+func (b *Buffer) InsertLines(at int, lines ...string) {
+	b.ReplaceLines(at, at, lines...)
+}
+
+// DeleteLines removes lines [from, to).
+func (b *Buffer) DeleteLines(from, to int) {
+	b.ReplaceLines(from, to)
+}
+
+// Offset returns the rune offset of pos from the start of the buffer, with
+// each line break counting as one rune. Large-file buffers keep no rune
+// index, so there it is only the column.
+func (b *Buffer) Offset(pos Cursor) int {
+	pos = b.clampPos(pos)
+	return b.text.offset(pos.Line) + pos.Col
+}
+
+// PosAt is the inverse of Offset.
+func (b *Buffer) PosAt(offset int) Cursor {
+	if offset < 0 {
+		offset = 0
+	}
+	line, start := b.text.lineAt(offset)
+	return b.clampPos(Cursor{Line: line, Col: offset - start})
+}
+
+// RuneCount returns the number of runes in the buffer, counting line breaks.
+func (b *Buffer) RuneCount() int {
+	return b.text.runes + b.text.count - 1
+}
+
+// Large returns the file behind a buffer opened in large-file mode, or nil.
+func (b *Buffer) Large() *LargeFile {
+	return b.large
+}
+
+// Close releases the file held open by a large-file buffer.
+func (b *Buffer) Close() {
+	if b.large != nil {
+		b.large.Close()
+	}
 }
 
 func (b *Buffer) MarkSaved() {
-	b.savedSnapshot = b.currentSnapshot()
+	if b.MixedLineEndings && !b.PreserveLineEndings {
+		// The file now has LineEnding throughout
+		b.clearLineEnds()
+		b.MixedLineEndings = false
+	}
+	b.saved = b.text
 	b.Dirty = false
+	b.lineEndingChanged = false
 }
 
 func (b *Buffer) RecomputeDirty() {
-	b.Dirty = b.currentSnapshot() != b.savedSnapshot
+	b.Dirty = b.lineEndingChanged || !ropesEqual(b.text, b.saved)
 }
 
 func (b *Buffer) clampCursor() {
-	if len(b.Lines) == 0 {
-		b.Lines = []string{""}
-	}
 	if b.Cursor.Line < 0 {
 		b.Cursor.Line = 0
 	}
-	if b.Cursor.Line >= len(b.Lines) {
-		b.Cursor.Line = len(b.Lines) - 1
+	if b.Cursor.Line >= b.LineCount() {
+		b.Cursor.Line = b.LineCount() - 1
 	}
-	lineLen := RuneLen(b.Lines[b.Cursor.Line])
+	lineLen := RuneLen(b.Line(b.Cursor.Line))
 	if b.Cursor.Col < 0 {
 		b.Cursor.Col = 0
 	}
@@ -443,7 +664,7 @@ func (b *Buffer) ClearAutoClose() {
 func (b *Buffer) InsertChar(ch rune) {
 	b.deleteSelectionIfAny()
 	b.clampCursor()
-	line := b.Lines[b.Cursor.Line]
+	line := b.Line(b.Cursor.Line)
 	before := b.Cursor
 	inAutoCloseContext := len(b.autoClosePending) > 0 &&
 		b.Cursor.Line == b.autoClosePos.Line && b.Cursor.Col == b.autoClosePos.Col
@@ -475,7 +696,7 @@ func (b *Buffer) InsertChar(ch rune) {
 	if b.AutoCloseEnabled && !b.Pasting && b.Language != "" && b.Language != "Text" {
 		if closeCh, ok := pairs[ch]; ok {
 			text := string(ch) + string(closeCh)
-			b.Lines[b.Cursor.Line] = runeInsert(line, b.Cursor.Col, text)
+			b.SetLine(b.Cursor.Line, runeInsert(line, b.Cursor.Col, text))
 			b.Cursor.Col++
 			b.Dirty = true
 			b.Undo.Push(Operation{Type: OpInsert, Pos: before, Text: text, Before: before})
@@ -498,7 +719,7 @@ func (b *Buffer) InsertChar(ch rune) {
 				}
 			}
 			text := string(ch) + string(ch)
-			b.Lines[b.Cursor.Line] = runeInsert(line, b.Cursor.Col, text)
+			b.SetLine(b.Cursor.Line, runeInsert(line, b.Cursor.Col, text))
 			b.Cursor.Col++
 			b.Dirty = true
 			b.Undo.Push(Operation{Type: OpInsert, Pos: before, Text: text, Before: before})
@@ -516,7 +737,7 @@ func (b *Buffer) InsertChar(ch rune) {
 
 noAutoClose:
 	text := string(ch)
-	b.Lines[b.Cursor.Line] = runeInsert(line, b.Cursor.Col, text)
+	b.SetLine(b.Cursor.Line, runeInsert(line, b.Cursor.Col, text))
 	b.Cursor.Col++ // one rune inserted = advance by 1
 	if inAutoCloseContext && len(b.autoClosePending) > 0 {
 		b.autoClosePos = b.Cursor
@@ -542,9 +763,9 @@ func (b *Buffer) InsertTab() {
 	b.clampCursor()
 	inAutoCloseContext := len(b.autoClosePending) > 0 &&
 		b.Cursor.Line == b.autoClosePos.Line && b.Cursor.Col == b.autoClosePos.Col
-	line := b.Lines[b.Cursor.Line]
+	line := b.Line(b.Cursor.Line)
 	before := b.Cursor
-	b.Lines[b.Cursor.Line] = runeInsert(line, b.Cursor.Col, tabString)
+	b.SetLine(b.Cursor.Line, runeInsert(line, b.Cursor.Col, tabString))
 	if b.UseTabs {
 		b.Cursor.Col += 1
 	} else {
@@ -561,7 +782,7 @@ func (b *Buffer) InsertNewline() {
 	b.deleteSelectionIfAny()
 	b.autoClosePending = nil
 	b.clampCursor()
-	line := b.Lines[b.Cursor.Line]
+	line := b.Line(b.Cursor.Line)
 	before := b.Cursor
 
 	// Auto-indent: copy leading whitespace from current line (skip when pasting)
@@ -592,12 +813,9 @@ func (b *Buffer) InsertNewline() {
 	}
 
 	rest := runeSliceFrom(line, b.Cursor.Col)
-	b.Lines[b.Cursor.Line] = runeSliceTo(line, b.Cursor.Col)
 	newLine := indent + extraIndent + rest
-	// Insert new line after current
-	b.Lines = append(b.Lines, "")
-	copy(b.Lines[b.Cursor.Line+2:], b.Lines[b.Cursor.Line+1:])
-	b.Lines[b.Cursor.Line+1] = newLine
+	// Split the current line in two
+	b.ReplaceLines(b.Cursor.Line, b.Cursor.Line+1, runeSliceTo(line, b.Cursor.Col), newLine)
 	b.Cursor.Line++
 	b.Cursor.Col = RuneLen(indent) + RuneLen(extraIndent)
 	b.Dirty = true
@@ -611,7 +829,7 @@ func (b *Buffer) Backspace() {
 	}
 	b.clampCursor()
 	if b.Cursor.Col > 0 {
-		line := b.Lines[b.Cursor.Line]
+		line := b.Line(b.Cursor.Line)
 		before := b.Cursor
 		inAutoCloseContext := len(b.autoClosePending) > 0 &&
 			b.Cursor.Line == b.autoClosePos.Line && b.Cursor.Col == b.autoClosePos.Col
@@ -620,7 +838,7 @@ func (b *Buffer) Backspace() {
 			openCh, ok := openingFor(closeCh)
 			if ok && runeAtIndex(line, b.Cursor.Col-1) == openCh && runeAtIndex(line, b.Cursor.Col) == closeCh {
 				deleted := string(openCh) + string(closeCh)
-				b.Lines[b.Cursor.Line] = runeSliceTo(line, b.Cursor.Col-1) + runeSliceFrom(line, b.Cursor.Col+1)
+				b.SetLine(b.Cursor.Line, runeSliceTo(line, b.Cursor.Col-1)+runeSliceFrom(line, b.Cursor.Col+1))
 				b.Cursor.Col--
 				b.autoClosePending = b.autoClosePending[1:]
 				b.autoClosePos = b.Cursor
@@ -630,7 +848,7 @@ func (b *Buffer) Backspace() {
 			}
 		}
 		deleted := string(runeAtIndex(line, b.Cursor.Col-1))
-		b.Lines[b.Cursor.Line] = runeSliceTo(line, b.Cursor.Col-1) + runeSliceFrom(line, b.Cursor.Col)
+		b.SetLine(b.Cursor.Line, runeSliceTo(line, b.Cursor.Col-1)+runeSliceFrom(line, b.Cursor.Col))
 		b.Cursor.Col--
 		if inAutoCloseContext && len(b.autoClosePending) > 0 {
 			b.autoClosePos = b.Cursor
@@ -639,9 +857,9 @@ func (b *Buffer) Backspace() {
 		b.Undo.Push(Operation{Type: OpDelete, Pos: b.Cursor, Text: deleted, Before: before})
 	} else if b.Cursor.Line > 0 {
 		before := b.Cursor
-		prevLen := RuneLen(b.Lines[b.Cursor.Line-1])
-		b.Lines[b.Cursor.Line-1] += b.Lines[b.Cursor.Line]
-		b.Lines = append(b.Lines[:b.Cursor.Line], b.Lines[b.Cursor.Line+1:]...)
+		prev := b.Line(b.Cursor.Line - 1)
+		prevLen := RuneLen(prev)
+		b.ReplaceLines(b.Cursor.Line-1, b.Cursor.Line+1, prev+b.Line(b.Cursor.Line))
 		b.Cursor.Line--
 		b.Cursor.Col = prevLen
 		b.autoClosePending = nil
@@ -656,23 +874,22 @@ func (b *Buffer) Delete() {
 		return
 	}
 	b.clampCursor()
-	line := b.Lines[b.Cursor.Line]
+	line := b.Line(b.Cursor.Line)
 	if b.Cursor.Col < RuneLen(line) {
 		before := b.Cursor
 		deletedRune := runeAtIndex(line, b.Cursor.Col)
 		deleted := string(deletedRune)
 		inAutoCloseContext := len(b.autoClosePending) > 0 &&
 			b.Cursor.Line == b.autoClosePos.Line && b.Cursor.Col == b.autoClosePos.Col
-		b.Lines[b.Cursor.Line] = runeSliceTo(line, b.Cursor.Col) + runeSliceFrom(line, b.Cursor.Col+1)
+		b.SetLine(b.Cursor.Line, runeSliceTo(line, b.Cursor.Col)+runeSliceFrom(line, b.Cursor.Col+1))
 		if inAutoCloseContext && len(b.autoClosePending) > 0 && deletedRune == b.autoClosePending[0] {
 			b.autoClosePending = b.autoClosePending[1:]
 		}
 		b.Dirty = true
 		b.Undo.Push(Operation{Type: OpDelete, Pos: b.Cursor, Text: deleted, Before: before})
-	} else if b.Cursor.Line < len(b.Lines)-1 {
+	} else if b.Cursor.Line < b.LineCount()-1 {
 		before := b.Cursor
-		b.Lines[b.Cursor.Line] += b.Lines[b.Cursor.Line+1]
-		b.Lines = append(b.Lines[:b.Cursor.Line+1], b.Lines[b.Cursor.Line+2:]...)
+		b.ReplaceLines(b.Cursor.Line, b.Cursor.Line+2, line+b.Line(b.Cursor.Line+1))
 		b.autoClosePending = nil
 		b.Dirty = true
 		b.Undo.Push(Operation{Type: OpDelete, Pos: b.Cursor, Text: "\n", Before: before})
@@ -698,11 +915,11 @@ func (b *Buffer) DeleteSelection() {
 
 	if sel.Start.Line == sel.End.Line {
 		// Single-line selection - validate bounds
-		if sel.Start.Line < 0 || sel.Start.Line >= len(b.Lines) {
+		if sel.Start.Line < 0 || sel.Start.Line >= b.LineCount() {
 			b.Selection = nil
 			return
 		}
-		line := b.Lines[sel.Start.Line]
+		line := b.Line(sel.Start.Line)
 		rl := RuneLen(line)
 
 		// Clamp selection bounds to line length (rune-based)
@@ -721,17 +938,17 @@ func (b *Buffer) DeleteSelection() {
 			endCol = 0
 		}
 
-		b.Lines[sel.Start.Line] = runeSliceTo(line, startCol) + runeSliceFrom(line, endCol)
+		b.SetLine(sel.Start.Line, runeSliceTo(line, startCol)+runeSliceFrom(line, endCol))
 	} else {
 		// Multi-line selection - validate bounds
-		if sel.Start.Line < 0 || sel.Start.Line >= len(b.Lines) ||
-			sel.End.Line < 0 || sel.End.Line >= len(b.Lines) {
+		if sel.Start.Line < 0 || sel.Start.Line >= b.LineCount() ||
+			sel.End.Line < 0 || sel.End.Line >= b.LineCount() {
 			b.Selection = nil
 			return
 		}
 
-		firstLine := b.Lines[sel.Start.Line]
-		lastLine := b.Lines[sel.End.Line]
+		firstLine := b.Line(sel.Start.Line)
+		lastLine := b.Line(sel.End.Line)
 
 		// Clamp to line lengths (rune-based)
 		startCol := sel.Start.Col
@@ -749,8 +966,7 @@ func (b *Buffer) DeleteSelection() {
 			endCol = 0
 		}
 
-		b.Lines[sel.Start.Line] = runeSliceTo(firstLine, startCol) + runeSliceFrom(lastLine, endCol)
-		b.Lines = append(b.Lines[:sel.Start.Line+1], b.Lines[sel.End.Line+1:]...)
+		b.ReplaceLines(sel.Start.Line, sel.End.Line+1, runeSliceTo(firstLine, startCol)+runeSliceFrom(lastLine, endCol))
 	}
 
 	b.Cursor = sel.Start
@@ -767,13 +983,13 @@ func (b *Buffer) GetSelectedText() string {
 	sel := *b.Selection
 
 	// Validate line bounds
-	if sel.Start.Line < 0 || sel.Start.Line >= len(b.Lines) ||
-		sel.End.Line < 0 || sel.End.Line >= len(b.Lines) {
+	if sel.Start.Line < 0 || sel.Start.Line >= b.LineCount() ||
+		sel.End.Line < 0 || sel.End.Line >= b.LineCount() {
 		return ""
 	}
 
 	if sel.Start.Line == sel.End.Line {
-		line := b.Lines[sel.Start.Line]
+		line := b.Line(sel.Start.Line)
 		rl := RuneLen(line)
 
 		// Clamp column bounds (rune-based)
@@ -796,7 +1012,7 @@ func (b *Buffer) GetSelectedText() string {
 	}
 
 	var sb strings.Builder
-	firstLine := b.Lines[sel.Start.Line]
+	firstLine := b.Line(sel.Start.Line)
 	startCol := sel.Start.Col
 	if startCol > RuneLen(firstLine) {
 		startCol = RuneLen(firstLine)
@@ -808,11 +1024,11 @@ func (b *Buffer) GetSelectedText() string {
 
 	for i := sel.Start.Line + 1; i < sel.End.Line; i++ {
 		sb.WriteByte('\n')
-		sb.WriteString(b.Lines[i])
+		sb.WriteString(b.Line(i))
 	}
 
 	sb.WriteByte('\n')
-	lastLine := b.Lines[sel.End.Line]
+	lastLine := b.Line(sel.End.Line)
 	endCol := sel.End.Col
 	if endCol > RuneLen(lastLine) {
 		endCol = RuneLen(lastLine)
@@ -834,7 +1050,7 @@ func (b *Buffer) InsertText(text string) {
 
 	lines := strings.Split(text, "\n")
 	if len(lines) == 1 {
-		line := b.Lines[b.Cursor.Line]
+		line := b.Line(b.Cursor.Line)
 		// Extra safety: validate cursor column (rune-based)
 		rl := RuneLen(line)
 		if b.Cursor.Col > rl {
@@ -843,13 +1059,13 @@ func (b *Buffer) InsertText(text string) {
 		if b.Cursor.Col < 0 {
 			b.Cursor.Col = 0
 		}
-		b.Lines[b.Cursor.Line] = runeInsert(line, b.Cursor.Col, text)
+		b.SetLine(b.Cursor.Line, runeInsert(line, b.Cursor.Col, text))
 		b.Cursor.Col += RuneLen(text)
 		if inAutoCloseContext && len(b.autoClosePending) > 0 {
 			b.autoClosePos = b.Cursor
 		}
 	} else {
-		line := b.Lines[b.Cursor.Line]
+		line := b.Line(b.Cursor.Line)
 		// Extra safety: validate cursor column (rune-based)
 		rl := RuneLen(line)
 		if b.Cursor.Col > rl {
@@ -859,17 +1075,11 @@ func (b *Buffer) InsertText(text string) {
 			b.Cursor.Col = 0
 		}
 		rest := runeSliceFrom(line, b.Cursor.Col)
-		b.Lines[b.Cursor.Line] = runeSliceTo(line, b.Cursor.Col) + lines[0]
-
-		newLines := make([]string, len(lines)-1)
-		for i := 1; i < len(lines); i++ {
-			newLines[i-1] = lines[i]
-		}
+		newLines := make([]string, len(lines))
+		copy(newLines, lines)
+		newLines[0] = runeSliceTo(line, b.Cursor.Col) + lines[0]
 		newLines[len(newLines)-1] += rest
-
-		after := b.Lines[b.Cursor.Line+1:]
-		b.Lines = append(b.Lines[:b.Cursor.Line+1], newLines...)
-		b.Lines = append(b.Lines, after...)
+		b.ReplaceLines(b.Cursor.Line, b.Cursor.Line+1, newLines...)
 
 		b.Cursor.Line += len(lines) - 1
 		b.Cursor.Col = RuneLen(lines[len(lines)-1])
@@ -893,7 +1103,7 @@ func (b *Buffer) IndentSelection() {
 	if b.Selection == nil {
 		// No selection - indent current line (VSCode behavior)
 		b.clampCursor()
-		b.Lines[b.Cursor.Line] = indentString + b.Lines[b.Cursor.Line]
+		b.SetLine(b.Cursor.Line, indentString+b.Line(b.Cursor.Line))
 		if b.UseTabs {
 			b.Cursor.Col += 1
 		} else {
@@ -907,13 +1117,13 @@ func (b *Buffer) IndentSelection() {
 	// Has selection - indent all selected lines
 	sel := *b.Selection
 	// Validate selection bounds
-	if sel.Start.Line < 0 || sel.Start.Line >= len(b.Lines) ||
-		sel.End.Line < 0 || sel.End.Line >= len(b.Lines) {
+	if sel.Start.Line < 0 || sel.Start.Line >= b.LineCount() ||
+		sel.End.Line < 0 || sel.End.Line >= b.LineCount() {
 		b.Selection = nil
 		return
 	}
 	for i := sel.Start.Line; i <= sel.End.Line; i++ {
-		b.Lines[i] = indentString + b.Lines[i]
+		b.SetLine(i, indentString+b.Line(i))
 	}
 	if b.UseTabs {
 		b.Selection.Start.Col += 1
@@ -934,12 +1144,12 @@ func (b *Buffer) DedentSelection() {
 	if b.Selection == nil {
 		// No selection - dedent current line (VSCode behavior)
 		b.clampCursor()
-		line := b.Lines[b.Cursor.Line]
+		line := b.Line(b.Cursor.Line)
 		removed := 0
 
 		// Handle tab character
 		if len(line) > 0 && line[0] == '\t' {
-			b.Lines[b.Cursor.Line] = line[1:]
+			b.SetLine(b.Cursor.Line, line[1:])
 			if b.Cursor.Col > 0 {
 				b.Cursor.Col--
 			}
@@ -953,7 +1163,7 @@ func (b *Buffer) DedentSelection() {
 			removed++
 		}
 		if removed > 0 {
-			b.Lines[b.Cursor.Line] = line[removed:]
+			b.SetLine(b.Cursor.Line, line[removed:])
 			if b.Cursor.Col >= removed {
 				b.Cursor.Col -= removed
 			} else {
@@ -968,18 +1178,18 @@ func (b *Buffer) DedentSelection() {
 	// Has selection - dedent all selected lines
 	sel := *b.Selection
 	// Validate selection bounds
-	if sel.Start.Line < 0 || sel.Start.Line >= len(b.Lines) ||
-		sel.End.Line < 0 || sel.End.Line >= len(b.Lines) {
+	if sel.Start.Line < 0 || sel.Start.Line >= b.LineCount() ||
+		sel.End.Line < 0 || sel.End.Line >= b.LineCount() {
 		b.Selection = nil
 		return
 	}
 	for i := sel.Start.Line; i <= sel.End.Line; i++ {
-		line := b.Lines[i]
+		line := b.Line(i)
 		removed := 0
 
 		// Handle tab character
 		if len(line) > 0 && line[0] == '\t' {
-			b.Lines[i] = line[1:]
+			b.SetLine(i, line[1:])
 			removed = 1
 			if i == sel.Start.Line && b.Selection.Start.Col >= removed {
 				b.Selection.Start.Col -= removed
@@ -1004,7 +1214,7 @@ func (b *Buffer) DedentSelection() {
 			removed++
 		}
 		if removed > 0 {
-			b.Lines[i] = line[removed:]
+			b.SetLine(i, line[removed:])
 			if i == sel.Start.Line && b.Selection.Start.Col >= removed {
 				b.Selection.Start.Col -= removed
 			} else if i == sel.Start.Line {
@@ -1029,12 +1239,8 @@ func (b *Buffer) DedentSelection() {
 func (b *Buffer) DuplicateLine() {
 	b.clampCursor()
 	before := b.Cursor
-	line := b.Lines[b.Cursor.Line]
-	newLines := make([]string, len(b.Lines)+1)
-	copy(newLines, b.Lines[:b.Cursor.Line+1])
-	newLines[b.Cursor.Line+1] = line
-	copy(newLines[b.Cursor.Line+2:], b.Lines[b.Cursor.Line+1:])
-	b.Lines = newLines
+	line := b.Line(b.Cursor.Line)
+	b.InsertLines(b.Cursor.Line+1, line)
 	b.Cursor.Line++
 	b.Dirty = true
 	b.Undo.Push(Operation{Type: OpInsert, Pos: Cursor{Line: b.Cursor.Line, Col: 0}, Text: line + "\n", Before: before})
@@ -1050,7 +1256,7 @@ func (b *Buffer) MoveLineUp() {
 	currentLine := b.Cursor.Line
 
 	// Swap current line with previous line
-	b.Lines[currentLine], b.Lines[currentLine-1] = b.Lines[currentLine-1], b.Lines[currentLine]
+	b.ReplaceLines(currentLine-1, currentLine+1, b.Line(currentLine), b.Line(currentLine-1))
 
 	// Move cursor up with the line
 	b.Cursor.Line--
@@ -1061,7 +1267,7 @@ func (b *Buffer) MoveLineUp() {
 
 func (b *Buffer) MoveLineDown() {
 	b.clampCursor()
-	if b.Cursor.Line >= len(b.Lines)-1 {
+	if b.Cursor.Line >= b.LineCount()-1 {
 		return // Already at bottom
 	}
 
@@ -1069,7 +1275,7 @@ func (b *Buffer) MoveLineDown() {
 	currentLine := b.Cursor.Line
 
 	// Swap current line with next line
-	b.Lines[currentLine], b.Lines[currentLine+1] = b.Lines[currentLine+1], b.Lines[currentLine]
+	b.ReplaceLines(currentLine, currentLine+2, b.Line(currentLine+1), b.Line(currentLine))
 
 	// Move cursor down with the line
 	b.Cursor.Line++
@@ -1088,7 +1294,7 @@ func (b *Buffer) ToggleLineComment(commentStr string) {
 	}
 
 	// Validate bounds
-	if startLine < 0 || startLine >= len(b.Lines) || endLine < 0 || endLine >= len(b.Lines) {
+	if startLine < 0 || startLine >= b.LineCount() || endLine < 0 || endLine >= b.LineCount() {
 		b.Selection = nil
 		return
 	}
@@ -1097,7 +1303,7 @@ func (b *Buffer) ToggleLineComment(commentStr string) {
 	allCommented := true
 	prefix := commentStr + " "
 	for i := startLine; i <= endLine; i++ {
-		trimmed := strings.TrimLeft(b.Lines[i], " \t")
+		trimmed := strings.TrimLeft(b.Line(i), " \t")
 		if trimmed != "" && !strings.HasPrefix(trimmed, commentStr) {
 			allCommented = false
 			break
@@ -1108,20 +1314,20 @@ func (b *Buffer) ToggleLineComment(commentStr string) {
 	if allCommented {
 		// Uncomment
 		for i := startLine; i <= endLine; i++ {
-			idx := strings.Index(b.Lines[i], commentStr)
+			idx := strings.Index(b.Line(i), commentStr)
 			if idx >= 0 {
 				end := idx + len(commentStr)
-				if end < len(b.Lines[i]) && b.Lines[i][end] == ' ' {
+				if end < len(b.Line(i)) && b.Line(i)[end] == ' ' {
 					end++
 				}
-				b.Lines[i] = b.Lines[i][:idx] + b.Lines[i][end:]
+				b.SetLine(i, b.Line(i)[:idx]+b.Line(i)[end:])
 			}
 		}
 	} else {
 		// Comment
 		for i := startLine; i <= endLine; i++ {
-			if strings.TrimSpace(b.Lines[i]) != "" {
-				b.Lines[i] = prefix + b.Lines[i]
+			if strings.TrimSpace(b.Line(i)) != "" {
+				b.SetLine(i, prefix+b.Line(i))
 			}
 		}
 	}
@@ -1130,23 +1336,23 @@ func (b *Buffer) ToggleLineComment(commentStr string) {
 }
 
 func (b *Buffer) SelectAll() {
-	if len(b.Lines) == 0 {
+	if b.LineCount() == 0 {
 		return
 	}
-	lastLine := len(b.Lines) - 1
+	lastLine := b.LineCount() - 1
 	sel := NewSelection(
 		Cursor{Line: 0, Col: 0},
-		Cursor{Line: lastLine, Col: RuneLen(b.Lines[lastLine])},
+		Cursor{Line: lastLine, Col: RuneLen(b.Line(lastLine))},
 	)
 	b.Selection = &sel
 	b.Cursor = sel.End
 }
 
 func (b *Buffer) WordAt(line, col int) (start, end int) {
-	if line < 0 || line >= len(b.Lines) {
+	if line < 0 || line >= b.LineCount() {
 		return col, col
 	}
-	l := b.Lines[line]
+	l := b.Line(line)
 	runes := []rune(l)
 	if col >= len(runes) {
 		return len(runes), len(runes)
@@ -1215,11 +1421,11 @@ func (b *Buffer) MoveWordLeft() {
 	if b.Cursor.Col == 0 {
 		if b.Cursor.Line > 0 {
 			b.Cursor.Line--
-			b.Cursor.Col = RuneLen(b.Lines[b.Cursor.Line])
+			b.Cursor.Col = RuneLen(b.Line(b.Cursor.Line))
 		}
 		return
 	}
-	runes := []rune(b.Lines[b.Cursor.Line])
+	runes := []rune(b.Line(b.Cursor.Line))
 	col := b.Cursor.Col - 1
 	// Skip whitespace
 	for col > 0 && charClass(runes[col]) == 0 {
@@ -1237,9 +1443,9 @@ func (b *Buffer) MoveWordLeft() {
 
 func (b *Buffer) MoveWordRight() {
 	b.clampCursor()
-	runes := []rune(b.Lines[b.Cursor.Line])
+	runes := []rune(b.Line(b.Cursor.Line))
 	if b.Cursor.Col >= len(runes) {
-		if b.Cursor.Line < len(b.Lines)-1 {
+		if b.Cursor.Line < b.LineCount()-1 {
 			b.Cursor.Line++
 			b.Cursor.Col = 0
 		}
@@ -1289,7 +1495,7 @@ func (b *Buffer) DeleteWordBackward() {
 		return
 	}
 
-	runes := []rune(b.Lines[b.Cursor.Line])
+	runes := []rune(b.Line(b.Cursor.Line))
 	startCol := b.Cursor.Col
 	col := b.Cursor.Col - 1
 
@@ -1312,7 +1518,7 @@ func (b *Buffer) DeleteWordBackward() {
 	if col < startCol {
 		before := b.Cursor
 		deleted := string(runes[col:startCol])
-		b.Lines[b.Cursor.Line] = string(runes[:col]) + string(runes[startCol:])
+		b.SetLine(b.Cursor.Line, string(runes[:col])+string(runes[startCol:]))
 		b.Cursor.Col = col
 		b.Dirty = true
 		b.Undo.Push(Operation{Type: OpDelete, Pos: b.Cursor, Text: deleted, Before: before})
@@ -1326,7 +1532,7 @@ func (b *Buffer) DeleteWordForward() {
 	}
 	b.clampCursor()
 
-	runes := []rune(b.Lines[b.Cursor.Line])
+	runes := []rune(b.Line(b.Cursor.Line))
 
 	// If at end of line, join with next line (like Delete key)
 	if b.Cursor.Col >= len(runes) {
@@ -1360,146 +1566,99 @@ func (b *Buffer) DeleteWordForward() {
 	if col > startCol {
 		before := b.Cursor
 		deleted := string(runes[startCol:col])
-		b.Lines[b.Cursor.Line] = string(runes[:startCol]) + string(runes[col:])
+		b.SetLine(b.Cursor.Line, string(runes[:startCol])+string(runes[col:]))
 		b.Dirty = true
 		b.Undo.Push(Operation{Type: OpDelete, Pos: b.Cursor, Text: deleted, Before: before})
 	}
 }
 
+// ApplyUndo undoes the edit that led to the current state of the undo tree.
 func (b *Buffer) ApplyUndo() {
-	op, ok := b.Undo.PopUndo()
+	ops, ok := b.Undo.undo()
 	if !ok {
 		return
 	}
-
-	// PopUndo already moved all grouped ops to redo stack.
-	// We need to apply inversions for all ops in the group.
-	// The first popped op is the most recent; grouped ops are in redo stack
-	// in reverse order (most recent first).
-	if op.Group != 0 {
-		// Collect the popped group from redo tail (oldest -> newest).
-		groupOps := b.groupOpsFromRedoTail(op.Group)
-		if len(groupOps) == 0 {
-			b.applyInverse(op)
-			return
-		}
-		// groupOps is oldest -> newest; undo must apply newest -> oldest.
-		for i := len(groupOps) - 1; i >= 0; i-- {
-			b.applyInverseNoState(groupOps[i])
-		}
-		// Restore cursor to earliest op's before position.
-		b.Cursor = groupOps[0].Before
-	} else {
-		b.applyInverse(op)
-		return
+	for i := len(ops) - 1; i >= 0; i-- {
+		b.applyInverseNoState(ops[i])
 	}
+	// Restore cursor to earliest op's before position.
+	b.Cursor = ops[0].Before
+	b.restoreCursors(ops[0].Cursors)
 	b.Selection = nil
 	b.Dirty = true
 }
 
+// ApplyRedo redoes the edit last undone from the current state.
 func (b *Buffer) ApplyRedo() {
-	op, ok := b.Undo.PopRedo()
+	ops, ok := b.Undo.redo()
 	if !ok {
 		return
 	}
-
-	if op.Group != 0 {
-		// Collect the popped group from undo tail (newest -> oldest).
-		groupOps := b.groupOpsFromUndoTail(op.Group)
-		if len(groupOps) == 0 {
-			b.applyForward(op)
-			return
+	var cursor Cursor
+	for _, op := range ops {
+		b.applyForwardNoState(op)
+		switch op.Type {
+		case OpInsert:
+			cursor = b.posAfterInsert(op.Pos, op.Text)
+		case OpDelete:
+			cursor = op.Pos
+		case OpLineEndings:
+			cursor = op.Before
 		}
-		// Apply in chronological order (oldest -> newest).
-		var cursor Cursor
-		for i := len(groupOps) - 1; i >= 0; i-- {
-			gop := groupOps[i]
-			b.applyForwardNoState(gop)
-			switch gop.Type {
-			case OpInsert:
-				cursor = b.posAfterInsert(gop.Pos, gop.Text)
-			case OpDelete:
-				cursor = gop.Pos
-			}
-		}
-		b.Cursor = cursor
-	} else {
-		b.applyForward(op)
-		return
 	}
+	b.Cursor = cursor
+	b.restoreCursors(ops[0].CursorsAfter)
 	b.Selection = nil
 	b.Dirty = true
 }
 
-// groupOpsFromRedoTail returns contiguous operations at redo tail with groupID.
-// Result order is oldest -> newest.
-func (b *Buffer) groupOpsFromRedoTail(groupID int) []Operation {
-	var ops []Operation
-	for i := len(b.Undo.redos) - 1; i >= 0; i-- {
-		if b.Undo.redos[i].Group != groupID {
-			break
-		}
-		ops = append(ops, b.Undo.redos[i])
+// GoToUndoState undoes and redoes edits until the text is that of the undo
+// tree state with the given ID, on whatever branch. It reports whether
+// there is such a state.
+func (b *Buffer) GoToUndoState(id int) bool {
+	target := b.Undo.find(id)
+	if target == nil {
+		return false
 	}
-	return ops
-}
-
-// groupOpsFromUndoTail returns contiguous operations at undo tail with groupID.
-// Result order is newest -> oldest.
-func (b *Buffer) groupOpsFromUndoTail(groupID int) []Operation {
-	var ops []Operation
-	for i := len(b.Undo.undos) - 1; i >= 0; i-- {
-		if b.Undo.undos[i].Group != groupID {
-			break
-		}
-		ops = append(ops, b.Undo.undos[i])
+	above := make(map[*undoState]bool)
+	for s := target; s != nil; s = s.parent {
+		above[s] = true
 	}
-	return ops
-}
-
-func (b *Buffer) applyInverseNoState(op Operation) {
-	switch op.Type {
-	case OpInsert:
-		b.removeText(op.Pos, op.Text)
-	case OpDelete:
-		b.insertTextAt(op.Pos, op.Text)
+	for !above[b.Undo.cur] {
+		b.ApplyUndo()
 	}
-}
-
-func (b *Buffer) applyForwardNoState(op Operation) {
-	switch op.Type {
-	case OpInsert:
-		b.insertTextAt(op.Pos, op.Text)
-	case OpDelete:
-		b.removeText(op.Pos, op.Text)
+	var path []*undoState
+	for s := target; s != b.Undo.cur; s = s.parent {
+		path = append(path, s)
 	}
+	for i := len(path) - 1; i >= 0; i-- {
+		path[i].parent.redo = path[i]
+		b.ApplyRedo()
+	}
+	b.RecomputeDirty()
+	return true
 }
 
-func (b *Buffer) applyInverse(op Operation) {
+func (b *Buffer) applyInverseNoState(op Operation) {
 	switch op.Type {
 	case OpInsert:
-		// Inverse of insert is delete
 		b.removeText(op.Pos, op.Text)
 	case OpDelete:
-		// Inverse of delete is insert
 		b.insertTextAt(op.Pos, op.Text)
+	case OpLineEndings:
+		b.undoLineEndings(op.Endings)
 	}
-	b.Cursor = op.Before
-	b.Selection = nil
-	b.Dirty = true
 }
 
-func (b *Buffer) applyForward(op Operation) {
+func (b *Buffer) applyForwardNoState(op Operation) {
 	switch op.Type {
 	case OpInsert:
 		b.insertTextAt(op.Pos, op.Text)
-		b.Cursor = b.posAfterInsert(op.Pos, op.Text)
 	case OpDelete:
 		b.removeText(op.Pos, op.Text)
-		b.Cursor = op.Pos
+	case OpLineEndings:
+		b.setLineEndings(op.Endings.To, nil)
 	}
-	b.Selection = nil
-	b.Dirty = true
 }
 
 func (b *Buffer) insertTextAt(pos Cursor, text string) {
@@ -1507,10 +1666,10 @@ func (b *Buffer) insertTextAt(pos Cursor, text string) {
 		return
 	}
 	// Validate position
-	if pos.Line >= len(b.Lines) {
+	if pos.Line >= b.LineCount() {
 		return
 	}
-	line := b.Lines[pos.Line]
+	line := b.Line(pos.Line)
 	rl := RuneLen(line)
 	if pos.Col > rl {
 		pos.Col = rl
@@ -1518,21 +1677,12 @@ func (b *Buffer) insertTextAt(pos Cursor, text string) {
 
 	lines := strings.Split(text, "\n")
 	if len(lines) == 1 {
-		b.Lines[pos.Line] = runeInsert(line, pos.Col, text)
+		b.SetLine(pos.Line, runeInsert(line, pos.Col, text))
 	} else {
 		rest := runeSliceFrom(line, pos.Col)
-		b.Lines[pos.Line] = runeSliceTo(line, pos.Col) + lines[0]
-
-		newLines := make([]string, len(lines)-1)
-		for i := 1; i < len(lines); i++ {
-			newLines[i-1] = lines[i]
-		}
-		newLines[len(newLines)-1] += rest
-
-		after := make([]string, len(b.Lines)-pos.Line-1)
-		copy(after, b.Lines[pos.Line+1:])
-		b.Lines = append(b.Lines[:pos.Line+1], newLines...)
-		b.Lines = append(b.Lines, after...)
+		lines[0] = runeSliceTo(line, pos.Col) + lines[0]
+		lines[len(lines)-1] += rest
+		b.ReplaceLines(pos.Line, pos.Line+1, lines...)
 	}
 }
 
@@ -1540,10 +1690,10 @@ func (b *Buffer) removeText(pos Cursor, text string) {
 	if len(text) == 0 {
 		return
 	}
-	if pos.Line >= len(b.Lines) {
+	if pos.Line >= b.LineCount() {
 		return
 	}
-	line := b.Lines[pos.Line]
+	line := b.Line(pos.Line)
 	rl := RuneLen(line)
 	if pos.Col > rl {
 		pos.Col = rl
@@ -1555,21 +1705,20 @@ func (b *Buffer) removeText(pos Cursor, text string) {
 		if end > rl {
 			end = rl
 		}
-		b.Lines[pos.Line] = runeSliceTo(line, pos.Col) + runeSliceFrom(line, end)
+		b.SetLine(pos.Line, runeSliceTo(line, pos.Col)+runeSliceFrom(line, end))
 	} else {
 		firstPart := runeSliceTo(line, pos.Col)
 		lastLineIdx := pos.Line + len(lines) - 1
-		if lastLineIdx >= len(b.Lines) {
-			lastLineIdx = len(b.Lines) - 1
+		if lastLineIdx >= b.LineCount() {
+			lastLineIdx = b.LineCount() - 1
 		}
 		lastLineRuneLen := RuneLen(lines[len(lines)-1])
-		lastLine := b.Lines[lastLineIdx]
+		lastLine := b.Line(lastLineIdx)
 		lastPart := ""
 		if lastLineRuneLen < RuneLen(lastLine) {
 			lastPart = runeSliceFrom(lastLine, lastLineRuneLen)
 		}
-		b.Lines[pos.Line] = firstPart + lastPart
-		b.Lines = append(b.Lines[:pos.Line+1], b.Lines[lastLineIdx+1:]...)
+		b.ReplaceLines(pos.Line, lastLineIdx+1, firstPart+lastPart)
 	}
 }
 
@@ -1586,10 +1735,10 @@ func (b *Buffer) posAfterInsert(pos Cursor, text string) Cursor {
 
 // ReplaceAt replaces `length` runes at the given position with `replacement`.
 func (b *Buffer) ReplaceAt(line, col, length int, replacement string) {
-	if line < 0 || line >= len(b.Lines) {
+	if line < 0 || line >= b.LineCount() {
 		return
 	}
-	l := b.Lines[line]
+	l := b.Line(line)
 	rl := RuneLen(l)
 	end := col + length
 	if end > rl {
@@ -1597,7 +1746,7 @@ func (b *Buffer) ReplaceAt(line, col, length int, replacement string) {
 	}
 	before := b.Cursor
 	oldText := runeSlice(l, col, end)
-	b.Lines[line] = runeSliceTo(l, col) + replacement + runeSliceFrom(l, end)
+	b.SetLine(line, runeSliceTo(l, col)+replacement+runeSliceFrom(l, end))
 	b.Dirty = true
 	// Record as delete+insert for undo
 	b.Undo.Push(Operation{Type: OpDelete, Pos: Cursor{Line: line, Col: col}, Text: oldText, Before: before})
@@ -1612,11 +1761,11 @@ func (b *Buffer) WrapSelectionWith(ch rune) bool {
 	if sel.Start.Line != sel.End.Line {
 		return false
 	}
-	if sel.Start.Line < 0 || sel.Start.Line >= len(b.Lines) {
+	if sel.Start.Line < 0 || sel.Start.Line >= b.LineCount() {
 		return false
 	}
 
-	line := b.Lines[sel.Start.Line]
+	line := b.Line(sel.Start.Line)
 	rl := RuneLen(line)
 	startCol := sel.Start.Col
 	endCol := sel.End.Col
@@ -1639,7 +1788,7 @@ func (b *Buffer) WrapSelectionWith(ch rune) bool {
 	before := b.Cursor
 	original := runeSlice(line, startCol, endCol)
 	wrapped := string(ch) + original + string(ch)
-	b.Lines[sel.Start.Line] = runeSliceTo(line, startCol) + wrapped + runeSliceFrom(line, endCol)
+	b.SetLine(sel.Start.Line, runeSliceTo(line, startCol)+wrapped+runeSliceFrom(line, endCol))
 	b.Cursor = Cursor{Line: sel.Start.Line, Col: startCol + RuneLen(wrapped)}
 	b.Selection = nil
 	b.autoClosePending = nil
@@ -1658,8 +1807,8 @@ func (b *Buffer) ReplaceAll(find, replacement string) int {
 	count := 0
 	findLower := strings.ToLower(find)
 	// Process lines from bottom to top to preserve positions
-	for i := len(b.Lines) - 1; i >= 0; i-- {
-		line := b.Lines[i]
+	for i := b.LineCount() - 1; i >= 0; i-- {
+		line := b.Line(i)
 		lower := strings.ToLower(line)
 		// Find all occurrences in this line, from right to left
 		idx := len(lower)
@@ -1668,8 +1817,8 @@ func (b *Buffer) ReplaceAll(find, replacement string) int {
 			if pos < 0 {
 				break
 			}
-			b.Lines[i] = b.Lines[i][:pos] + replacement + b.Lines[i][pos+len(find):]
-			lower = strings.ToLower(b.Lines[i])
+			b.SetLine(i, b.Line(i)[:pos]+replacement+b.Line(i)[pos+len(find):])
+			lower = strings.ToLower(b.Line(i))
 			idx = pos
 			count++
 		}
@@ -1709,7 +1858,8 @@ func (b *Buffer) IsHiddenByFold(line int) bool {
 
 // FindFoldRange finds the foldable range at the given line based on indentation.
 func (b *Buffer) FindFoldRange(line int) (int, int) {
-	if line < 0 || line >= len(b.Lines) {
+	// Large files skip fold discovery; it may scan far ahead
+	if b.large != nil || line < 0 || line >= b.LineCount() {
 		return -1, -1
 	}
 
@@ -1719,7 +1869,7 @@ func (b *Buffer) FindFoldRange(line int) (int, int) {
 	}
 
 	endLine := line
-	for i := line + 1; i < len(b.Lines); i++ {
+	for i := line + 1; i < b.LineCount(); i++ {
 		indent := b.lineIndent(i)
 		if indent < 0 {
 			continue // skip empty lines
@@ -1737,11 +1887,11 @@ func (b *Buffer) FindFoldRange(line int) (int, int) {
 }
 
 func (b *Buffer) lineIndent(line int) int {
-	if line < 0 || line >= len(b.Lines) || len(strings.TrimSpace(b.Lines[line])) == 0 {
+	if line < 0 || line >= b.LineCount() || len(strings.TrimSpace(b.Line(line))) == 0 {
 		return -1
 	}
 	indent := 0
-	for _, ch := range b.Lines[line] {
+	for _, ch := range b.Line(line) {
 		if ch == ' ' {
 			indent++
 		} else if ch == '\t' {
@@ -1777,7 +1927,7 @@ func (b *Buffer) FoldedLineCount(line int) int {
 // AddCursorAt adds an extra cursor at the given position
 func (b *Buffer) AddCursorAt(line, col int) {
 	// Validate bounds
-	if line < 0 || line >= len(b.Lines) {
+	if line < 0 || line >= b.LineCount() {
 		return
 	}
 
@@ -1792,14 +1942,14 @@ func (b *Buffer) AddCursorAt(line, col int) {
 	}
 
 	// Clamp column to line length
-	if col > RuneLen(b.Lines[line]) {
-		col = RuneLen(b.Lines[line])
+	if col > RuneLen(b.Line(line)) {
+		col = RuneLen(b.Line(line))
 	}
 	if col < 0 {
 		col = 0
 	}
 
-	b.ExtraCursors = append(b.ExtraCursors, Cursor{Line: line, Col: col})
+	b.ExtraCursors = append(b.ExtraCursors, ExtraCursor{Cursor: Cursor{Line: line, Col: col}})
 }
 
 // ClearExtraCursors removes all extra cursors
@@ -1812,237 +1962,13 @@ func (b *Buffer) HasExtraCursors() bool {
 	return len(b.ExtraCursors) > 0
 }
 
-// allCursorsSorted returns pointers to all cursors sorted by position (top-left first)
-func (b *Buffer) allCursorsSorted() []*Cursor {
-	result := make([]*Cursor, 0, 1+len(b.ExtraCursors))
-	result = append(result, &b.Cursor)
-	for i := range b.ExtraCursors {
-		result = append(result, &b.ExtraCursors[i])
-	}
-	sort.Slice(result, func(i, j int) bool {
-		if result[i].Line != result[j].Line {
-			return result[i].Line < result[j].Line
-		}
-		return result[i].Col < result[j].Col
-	})
-	return result
-}
-
-// InsertCharMulti inserts a character at all cursor positions
-func (b *Buffer) InsertCharMulti(ch rune) {
-	allCursors := b.allCursorsSorted()
-	text := string(ch)
-	groupID := b.Undo.NewGroup()
-
-	// Process from bottom-right to top-left to preserve positions
-	for i := len(allCursors) - 1; i >= 0; i-- {
-		pos := allCursors[i]
-		if pos.Line < 0 || pos.Line >= len(b.Lines) {
-			continue
-		}
-		line := b.Lines[pos.Line]
-		col := pos.Col
-		if col > RuneLen(line) {
-			col = RuneLen(line)
-		}
-		before := *pos
-		b.Lines[pos.Line] = runeInsert(line, col, text)
-		b.Undo.PushGrouped(Operation{Type: OpInsert, Pos: before, Text: text, Before: before}, groupID)
-	}
-
-	// Advance all cursors by 1 rune
-	for i := len(allCursors) - 1; i >= 0; i-- {
-		allCursors[i].Col++
-	}
-	b.Dirty = true
-}
-
-// DeleteCharMulti deletes the character before each cursor (backspace)
-func (b *Buffer) DeleteCharMulti() {
-	allCursors := b.allCursorsSorted()
-	groupID := b.Undo.NewGroup()
-
-	// Process from bottom-right to top-left
-	for i := len(allCursors) - 1; i >= 0; i-- {
-		pos := allCursors[i]
-		if pos.Line < 0 || pos.Line >= len(b.Lines) {
-			continue
-		}
-		if pos.Col > 0 {
-			line := b.Lines[pos.Line]
-			col := pos.Col
-			rl := RuneLen(line)
-			if col > rl {
-				col = rl
-			}
-			before := *pos
-			deleted := string(runeAtIndex(line, col-1))
-			b.Lines[pos.Line] = runeSliceTo(line, col-1) + runeSliceFrom(line, col)
-			b.Undo.PushGrouped(Operation{Type: OpDelete, Pos: Cursor{Line: pos.Line, Col: col - 1}, Text: deleted, Before: before}, groupID)
-			pos.Col = col - 1
-		}
-	}
-	b.Dirty = true
-}
-
-// DeleteForwardMulti deletes the character after each cursor (delete key)
-func (b *Buffer) DeleteForwardMulti() {
-	allCursors := b.allCursorsSorted()
-	groupID := b.Undo.NewGroup()
-
-	for i := len(allCursors) - 1; i >= 0; i-- {
-		pos := allCursors[i]
-		if pos.Line < 0 || pos.Line >= len(b.Lines) {
-			continue
-		}
-		line := b.Lines[pos.Line]
-		if pos.Col < RuneLen(line) {
-			before := *pos
-			deleted := string(runeAtIndex(line, pos.Col))
-			b.Lines[pos.Line] = runeSliceTo(line, pos.Col) + runeSliceFrom(line, pos.Col+1)
-			b.Undo.PushGrouped(Operation{Type: OpDelete, Pos: *pos, Text: deleted, Before: before}, groupID)
-		}
-	}
-	b.Dirty = true
-}
-
-// MoveCursorsLeft moves all cursors one position to the left
-func (b *Buffer) MoveCursorsLeft() {
-	for i := range b.ExtraCursors {
-		if b.ExtraCursors[i].Line < 0 || b.ExtraCursors[i].Line >= len(b.Lines) {
-			continue
-		}
-		if b.ExtraCursors[i].Col > 0 {
-			b.ExtraCursors[i].Col--
-		} else if b.ExtraCursors[i].Line > 0 {
-			b.ExtraCursors[i].Line--
-			if b.ExtraCursors[i].Line >= 0 && b.ExtraCursors[i].Line < len(b.Lines) {
-				b.ExtraCursors[i].Col = RuneLen(b.Lines[b.ExtraCursors[i].Line])
-			}
-		}
-	}
-}
-
-// MoveCursorsRight moves all cursors one position to the right
-func (b *Buffer) MoveCursorsRight() {
-	for i := range b.ExtraCursors {
-		if b.ExtraCursors[i].Line < 0 || b.ExtraCursors[i].Line >= len(b.Lines) {
-			continue
-		}
-		if b.ExtraCursors[i].Col < RuneLen(b.Lines[b.ExtraCursors[i].Line]) {
-			b.ExtraCursors[i].Col++
-		} else if b.ExtraCursors[i].Line < len(b.Lines)-1 {
-			b.ExtraCursors[i].Line++
-			b.ExtraCursors[i].Col = 0
-		}
-	}
-}
-
-// MoveCursorsUp moves all cursors one line up
-func (b *Buffer) MoveCursorsUp() {
-	for i := range b.ExtraCursors {
-		if b.ExtraCursors[i].Line > 0 {
-			b.ExtraCursors[i].Line--
-			if b.ExtraCursors[i].Line >= 0 && b.ExtraCursors[i].Line < len(b.Lines) {
-				lineLen := RuneLen(b.Lines[b.ExtraCursors[i].Line])
-				if b.ExtraCursors[i].Col > lineLen {
-					b.ExtraCursors[i].Col = lineLen
-				}
-			}
-		}
-	}
-}
-
-// MoveCursorsDown moves all cursors one line down
-func (b *Buffer) MoveCursorsDown() {
-	for i := range b.ExtraCursors {
-		if b.ExtraCursors[i].Line < len(b.Lines)-1 {
-			b.ExtraCursors[i].Line++
-			if b.ExtraCursors[i].Line >= 0 && b.ExtraCursors[i].Line < len(b.Lines) {
-				lineLen := RuneLen(b.Lines[b.ExtraCursors[i].Line])
-				if b.ExtraCursors[i].Col > lineLen {
-					b.ExtraCursors[i].Col = lineLen
-				}
-			}
-		}
-	}
-}
-
-// SelectNextOccurrence finds the next occurrence of the current word/selection and adds a cursor there
-func (b *Buffer) SelectNextOccurrence() {
-	var searchText string
-	if b.Selection != nil && !b.Selection.Empty() {
-		searchText = b.GetSelectedText()
-	} else {
-		searchText = b.WordAtCursor()
-	}
-	if searchText == "" {
-		return
-	}
-
-	searchRuneLen := RuneLen(searchText)
-
-	// Find the last cursor position to search from after it
-	lastLine := b.Cursor.Line
-	lastCol := b.Cursor.Col + searchRuneLen
-	for _, c := range b.ExtraCursors {
-		if c.Line > lastLine || (c.Line == lastLine && c.Col+searchRuneLen > lastCol) {
-			lastLine = c.Line
-			lastCol = c.Col + searchRuneLen
-		}
-	}
-
-	searchLower := strings.ToLower(searchText)
-
-	// Search from after the last cursor
-	for lineIdx := lastLine; lineIdx < len(b.Lines); lineIdx++ {
-		startCol := 0
-		if lineIdx == lastLine {
-			startCol = lastCol
-		}
-		runes := []rune(b.Lines[lineIdx])
-		if startCol > len(runes) {
-			continue
-		}
-		remainder := string(runes[startCol:])
-		idx := strings.Index(strings.ToLower(remainder), searchLower)
-		if idx >= 0 {
-			// Convert byte index back to rune index
-			runeIdx := RuneLen(remainder[:idx])
-			b.AddCursorAt(lineIdx, startCol+runeIdx)
-			return
-		}
-	}
-	// Wrap around from beginning
-	for lineIdx := 0; lineIdx <= lastLine; lineIdx++ {
-		runes := []rune(b.Lines[lineIdx])
-		endCol := len(runes)
-		if lineIdx == lastLine {
-			endCol = lastCol - searchRuneLen
-			if endCol < 0 {
-				endCol = 0
-			}
-		}
-		if endCol > len(runes) {
-			endCol = len(runes)
-		}
-		portion := string(runes[:endCol])
-		idx := strings.Index(strings.ToLower(portion), searchLower)
-		if idx >= 0 {
-			runeIdx := RuneLen(portion[:idx])
-			b.AddCursorAt(lineIdx, runeIdx)
-			return
-		}
-	}
-}
-
 // GetTextInRange returns the text between two cursor positions.
 func (b *Buffer) GetTextInRange(start, end Cursor) string {
-	if start.Line < 0 || start.Line >= len(b.Lines) || end.Line < 0 || end.Line >= len(b.Lines) {
+	if start.Line < 0 || start.Line >= b.LineCount() || end.Line < 0 || end.Line >= b.LineCount() {
 		return ""
 	}
 	if start.Line == end.Line {
-		line := b.Lines[start.Line]
+		line := b.Line(start.Line)
 		rl := RuneLen(line)
 		sc := start.Col
 		ec := end.Col
@@ -2058,7 +1984,7 @@ func (b *Buffer) GetTextInRange(start, end Cursor) string {
 		return runeSlice(line, sc, ec)
 	}
 	var sb strings.Builder
-	firstLine := b.Lines[start.Line]
+	firstLine := b.Line(start.Line)
 	sc := start.Col
 	if sc > RuneLen(firstLine) {
 		sc = RuneLen(firstLine)
@@ -2066,10 +1992,10 @@ func (b *Buffer) GetTextInRange(start, end Cursor) string {
 	sb.WriteString(runeSliceFrom(firstLine, sc))
 	for i := start.Line + 1; i < end.Line; i++ {
 		sb.WriteByte('\n')
-		sb.WriteString(b.Lines[i])
+		sb.WriteString(b.Line(i))
 	}
 	sb.WriteByte('\n')
-	lastLine := b.Lines[end.Line]
+	lastLine := b.Line(end.Line)
 	ec := end.Col
 	if ec > RuneLen(lastLine) {
 		ec = RuneLen(lastLine)
@@ -2088,12 +2014,92 @@ func (b *Buffer) InsertTextAtPos(pos Cursor, text string) {
 	b.insertTextAt(pos, text)
 }
 
+// TextEdit replaces the text between Start and End with NewText.
+type TextEdit struct {
+	Start   Cursor
+	End     Cursor
+	NewText string
+}
+
+// ApplyEdits applies non-overlapping edits as a single undo step and returns
+// its undo group ID, or 0 if nothing changed. Edits may be given in any
+// order; they are applied bottom-up so earlier positions stay valid. Edits
+// starting at the same position are applied last first, so text inserted
+// there ends up in the order the edits were given.
+func (b *Buffer) ApplyEdits(edits []TextEdit) int {
+	if len(edits) == 0 {
+		return 0
+	}
+	order := make([]int, len(edits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, c := edits[order[i]].Start, edits[order[j]].Start
+		if a != c {
+			return c.Before(a)
+		}
+		return order[i] > order[j]
+	})
+	sorted := make([]TextEdit, len(edits))
+	for i, idx := range order {
+		sorted[i] = edits[idx]
+	}
+
+	before := b.Cursor
+	groupID := b.Undo.NewGroup()
+	changed := false
+	for _, te := range sorted {
+		start := b.clampPos(te.Start)
+		end := b.clampPos(te.End)
+		if end.Before(start) {
+			start, end = end, start
+		}
+		if oldText := b.GetTextInRange(start, end); oldText != "" {
+			b.removeText(start, oldText)
+			b.Undo.PushGrouped(Operation{Type: OpDelete, Pos: start, Text: oldText, Before: before}, groupID)
+			changed = true
+		}
+		if te.NewText != "" {
+			b.insertTextAt(start, te.NewText)
+			b.Undo.PushGrouped(Operation{Type: OpInsert, Pos: start, Text: te.NewText, Before: before}, groupID)
+			changed = true
+		}
+	}
+	if !changed {
+		return 0
+	}
+	b.clampCursor()
+	b.Selection = nil
+	b.RecomputeDirty()
+	return groupID
+}
+
+// clampPos limits a position to the buffer; positions past the last line
+// map to the end of the buffer, as LSP ranges ending at EOF do.
+func (b *Buffer) clampPos(pos Cursor) Cursor {
+	if pos.Line < 0 {
+		return Cursor{}
+	}
+	if pos.Line >= b.LineCount() {
+		last := b.LineCount() - 1
+		return Cursor{Line: last, Col: RuneLen(b.Line(last))}
+	}
+	if pos.Col < 0 {
+		pos.Col = 0
+	}
+	if rl := RuneLen(b.Line(pos.Line)); pos.Col > rl {
+		pos.Col = rl
+	}
+	return pos
+}
+
 // WordAtCursor returns the word under the cursor
 func (b *Buffer) WordAtCursor() string {
-	if b.Cursor.Line < 0 || b.Cursor.Line >= len(b.Lines) {
+	if b.Cursor.Line < 0 || b.Cursor.Line >= b.LineCount() {
 		return ""
 	}
-	line := b.Lines[b.Cursor.Line]
+	line := b.Line(b.Cursor.Line)
 	if b.Cursor.Col > RuneLen(line) {
 		return ""
 	}
@@ -1,7 +1,8 @@
 package buffer
 
 type Cursor struct {
-	Line, Col int
+	Line int `json:"line"`
+	Col  int `json:"col"`
 }
 
 func (c Cursor) Before(other Cursor) bool {
@@ -15,8 +16,19 @@ func (c Cursor) Equal(other Cursor) bool {
 	return c.Line == other.Line && c.Col == other.Col
 }
 
+// ExtraCursor is a cursor besides the primary one, with its own selection.
+type ExtraCursor struct {
+	Cursor
+	Selection *Selection
+
+	// Auto-close state, kept per cursor like the buffer keeps the primary's
+	autoClosePending []rune
+	autoClosePos     Cursor
+}
+
 type Selection struct {
-	Start, End Cursor
+	Start Cursor `json:"start"`
+	End   Cursor `json:"end"`
 }
 
 func NewSelection(a, b Cursor) Selection {
@@ -36,3 +48,26 @@ func (s Selection) Contains(c Cursor) bool {
 func (s Selection) Empty() bool {
 	return s.Start.Equal(s.End)
 }
+
+// Block is a rectangular selection: the lines from Anchor to Head and the
+// display columns between theirs. Its Col fields are display columns, with
+// tabs expanded and wide characters counted twice, not rune indexes.
+type Block struct {
+	Anchor, Head Cursor
+}
+
+// Lines returns the first and last line of the block.
+func (b Block) Lines() (top, bottom int) {
+	if b.Anchor.Line <= b.Head.Line {
+		return b.Anchor.Line, b.Head.Line
+	}
+	return b.Head.Line, b.Anchor.Line
+}
+
+// Cols returns the display columns of the block; right is exclusive.
+func (b Block) Cols() (left, right int) {
+	if b.Anchor.Col <= b.Head.Col {
+		return b.Anchor.Col, b.Head.Col
+	}
+	return b.Head.Col, b.Anchor.Col
+}
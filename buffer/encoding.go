@@ -0,0 +1,222 @@
+package buffer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// Encodings lists the encodings files can be opened and saved in, by the
+// names used in Buffer.Encoding.
+var Encodings = []string{
+	"UTF-8",
+	"UTF-8 BOM",
+	"UTF-16 LE",
+	"UTF-16 BE",
+	"Windows-1252",
+	"Latin-1",
+	"Shift_JIS",
+	"GBK",
+	"EUC-KR",
+}
+
+// textEncoding returns the codec for name, or nil for UTF-8.
+func textEncoding(name string) encoding.Encoding {
+	switch name {
+	case "UTF-16 LE":
+		return xunicode.UTF16(xunicode.LittleEndian, xunicode.UseBOM)
+	case "UTF-16 BE":
+		return xunicode.UTF16(xunicode.BigEndian, xunicode.UseBOM)
+	case "Windows-1252":
+		return charmap.Windows1252
+	case "Latin-1":
+		return charmap.ISO8859_1
+	case "Shift_JIS":
+		return japanese.ShiftJIS
+	case "GBK":
+		return simplifiedchinese.GBK
+	case "EUC-KR":
+		return korean.EUCKR
+	}
+	return nil
+}
+
+// isSingleByteEncoding reports whether every byte of name is a character on
+// its own, so text can be decoded from any byte boundary.
+func isSingleByteEncoding(name string) bool {
+	return name == "Latin-1" || name == "Windows-1252"
+}
+
+// decodeText converts data in the named encoding to UTF-8, dropping a byte
+// order mark.
+func decodeText(data []byte, name string) string {
+	enc := textEncoding(name)
+	if enc == nil {
+		return strings.TrimPrefix(string(data), "\uFEFF")
+	}
+	// UTF-16 decoders consume the BOM themselves
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(out)
+}
+
+// encodeText converts s to the named encoding, with a byte order mark for
+// "UTF-8 BOM" and UTF-16. Characters the encoding can't represent are
+// written as '?'; the second result counts them.
+func encodeText(s, name string) ([]byte, int) {
+	enc := textEncoding(name)
+	if enc == nil {
+		if name == "UTF-8 BOM" {
+			return append([]byte{0xEF, 0xBB, 0xBF}, s...), 0
+		}
+		return []byte(s), 0
+	}
+	if out, err := enc.NewEncoder().Bytes([]byte(s)); err == nil {
+		return out, 0
+	}
+
+	// Encode rune by rune to find what can't be represented
+	var out []byte
+	if strings.HasPrefix(name, "UTF-16") {
+		out, _ = enc.NewEncoder().Bytes(nil)
+		enc = xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM)
+		if name == "UTF-16 BE" {
+			enc = xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM)
+		}
+	}
+	encoder := enc.NewEncoder()
+	replaced := 0
+	var buf [utf8.UTFMax]byte
+	for _, r := range s {
+		n := utf8.EncodeRune(buf[:], r)
+		b, err := encoder.Bytes(buf[:n])
+		if err != nil {
+			b = []byte{'?'}
+			replaced++
+		}
+		out = append(out, b...)
+	}
+	return out, replaced
+}
+
+// detectLegacyEncoding guesses the encoding of text that isn't valid UTF-8.
+// A CJK encoding is picked when the text decodes cleanly into mostly its own
+// script; otherwise bytes 0x80-0x9F, which are printable in Windows-1252
+// but control codes in Latin-1, decide between those two.
+func detectLegacyEncoding(data []byte) string {
+	// Full-width kana need lead bytes 0x82 and 0x83, which Latin text
+	// hardly ever has, so Shift_JIS is safe to try first
+	if s := scriptCounts(data, japanese.ShiftJIS); s.valid && s.kana*10 >= s.total && (s.kana+s.han+s.punct)*10 >= s.total*9 {
+		return "Shift_JIS"
+	}
+	if letterTrails(data) {
+		// Accented letters inside words: a single-byte encoding
+		return singleByteEncoding(data)
+	}
+	if s := scriptCounts(data, korean.EUCKR); s.valid && s.hangul*2 >= s.total {
+		return "EUC-KR"
+	}
+	if s := scriptCounts(data, simplifiedchinese.GBK); s.valid && s.han > 0 && (s.han+s.punct)*10 >= s.total*9 {
+		return "GBK"
+	}
+	return singleByteEncoding(data)
+}
+
+func singleByteEncoding(data []byte) string {
+	for _, c := range data {
+		if c >= 0x80 && c <= 0x9F {
+			return "Windows-1252"
+		}
+	}
+	return "Latin-1"
+}
+
+// letterTrails reports whether high bytes are mostly followed by ASCII
+// letters, as accented letters in Latin text are. In GBK and EUC-KR text
+// both bytes of a character are nearly always high.
+func letterTrails(data []byte) bool {
+	leads, letters := 0, 0
+	for i := 0; i < len(data); i++ {
+		if data[i] < 0x80 {
+			continue
+		}
+		leads++
+		if i+1 < len(data) {
+			c := data[i+1]
+			if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+				letters++
+			}
+		}
+		i++
+	}
+	return letters*4 > leads
+}
+
+type scripts struct {
+	valid                           bool
+	total, hangul, kana, han, punct int // counts of non-ASCII characters
+}
+
+// scriptCounts decodes data with enc and counts the scripts of the
+// non-ASCII characters. Half-width katakana count as punctuation: Latin-1
+// letters decode to them in Shift_JIS.
+func scriptCounts(data []byte, enc encoding.Encoding) scripts {
+	out, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return scripts{}
+	}
+	s := scripts{valid: true}
+	for _, r := range string(out) {
+		if r < 0x80 {
+			continue
+		}
+		s.total++
+		switch {
+		case r == utf8.RuneError:
+			s.valid = false
+			return s
+		case unicode.Is(unicode.Hangul, r):
+			s.hangul++
+		case r >= 0x3040 && r <= 0x30FF:
+			s.kana++
+		case unicode.Is(unicode.Han, r):
+			s.han++
+		case r >= 0x3000 && r <= 0x303F, r >= 0xFF00 && r <= 0xFFEF:
+			s.punct++
+		}
+	}
+	return s
+}
+
+// UnencodableRunes counts the characters of the buffer that can't be
+// written in the named encoding.
+func (b *Buffer) UnencodableRunes(name string) int {
+	_, n := encodeText(b.Text(), name)
+	return n
+}
+
+// SetEncoding sets the encoding the buffer is saved in.
+func (b *Buffer) SetEncoding(name string) {
+	b.Encoding = name
+	b.HasBOM = name == "UTF-8 BOM"
+}
+
+// EncodeContent converts content, as built by BuildSaveContent, to the
+// bytes written to disk in the buffer's encoding.
+func (b *Buffer) EncodeContent(content string) []byte {
+	name := b.Encoding
+	if b.HasBOM && (name == "" || name == "UTF-8") {
+		name = "UTF-8 BOM"
+	}
+	out, _ := encodeText(content, name)
+	return out
+}
@@ -0,0 +1,99 @@
+package buffer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+	}{
+		{"UTF-16 LE", "héllo wörld\nsecond line"},
+		{"UTF-16 BE", "héllo wörld\nsecond line"},
+		{"Windows-1252", "café – “quoted” €5\nnaïve"},
+		{"Shift_JIS", "こんにちは、世界\nカタカナのテキストです"},
+		{"GBK", "你好，世界。\n这是一个测试文件"},
+		{"EUC-KR", "안녕하세요 세계\n이것은 테스트입니다"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			data, lost := encodeText(tt.text+"\n", tt.encoding)
+			if lost != 0 {
+				t.Fatalf("%d characters unencodable", lost)
+			}
+			path := filepath.Join(t.TempDir(), "file.txt")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+
+			b, err := NewBufferFromFile(path, 4)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if b.IsBinary {
+				t.Fatalf("loaded as binary")
+			}
+			if b.Encoding != tt.encoding {
+				t.Fatalf("detected %q, want %q", b.Encoding, tt.encoding)
+			}
+			if got := b.Text(); got != tt.text {
+				t.Fatalf("text = %q, want %q", got, tt.text)
+			}
+
+			// Saving writes the same bytes back
+			b.SetLine(0, b.Line(0))
+			if err := b.SaveWithOptions(false, true); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+			saved, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !bytes.Equal(saved, data) {
+				t.Fatalf("saved % x, want % x", saved, data)
+			}
+		})
+	}
+}
+
+func TestForcedEncoding(t *testing.T) {
+	// Valid UTF-8 that is really Latin-1 can only be read right by choosing
+	// the encoding
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("a\xc3\xa9b\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	b, err := NewBufferFromFileEncoding(path, 4, "Latin-1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := b.Text(); got != "aÃ©b" {
+		t.Fatalf("text = %q", got)
+	}
+	if b.Encoding != "Latin-1" || b.ForcedEncoding != "Latin-1" {
+		t.Fatalf("encoding %q, forced %q", b.Encoding, b.ForcedEncoding)
+	}
+}
+
+func TestUnencodableRunes(t *testing.T) {
+	b := NewBuffer(4)
+	b.SetLines([]string{"café €", "日本"})
+	if n := b.UnencodableRunes("Latin-1"); n != 3 {
+		t.Fatalf("Latin-1: %d unencodable, want 3", n)
+	}
+	if n := b.UnencodableRunes("Windows-1252"); n != 2 {
+		t.Fatalf("Windows-1252: %d unencodable, want 2", n)
+	}
+	if n := b.UnencodableRunes("UTF-16 LE"); n != 0 {
+		t.Fatalf("UTF-16 LE: %d unencodable, want 0", n)
+	}
+
+	out, lost := encodeText("é€", "Latin-1")
+	if lost != 1 || !bytes.Equal(out, []byte{0xE9, '?'}) {
+		t.Fatalf("encoded % x with %d lost", out, lost)
+	}
+}
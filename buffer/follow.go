@@ -0,0 +1,212 @@
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// ErrFollowReset is returned by FollowAppend when the followed file was
+// truncated or replaced (for example by log rotation). The buffer no longer
+// matches the start of the file and has to be reloaded.
+var ErrFollowReset = errors.New("file was truncated or replaced")
+
+// followState records how much of a followed file is in the buffer.
+type followState struct {
+	info os.FileInfo // identity of the file being followed
+	// offset is where the buffer's text ends in the file. Trailing line
+	// breaks are left out, as they are when loading, and read again with
+	// whatever follows them.
+	offset int64
+}
+
+// Following reports whether the buffer is following its file.
+func (b *Buffer) Following() bool {
+	return b.follow != nil
+}
+
+// StartFollow starts following the buffer's file, so FollowAppend picks up
+// what is written to it. The buffer must match the file on disk.
+func (b *Buffer) StartFollow() error {
+	if b.Path == "" {
+		return errors.New("buffer has no file")
+	}
+	if b.Dirty {
+		return errors.New("buffer has unsaved changes")
+	}
+	var (
+		info os.FileInfo
+		err  error
+	)
+	if b.large != nil {
+		info, err = b.large.f.Stat()
+	} else {
+		info, err = os.Stat(b.Path)
+	}
+	if err != nil {
+		return err
+	}
+	offset := info.Size()
+	if b.large == nil {
+		if offset, err = trimmedFileEnd(b.Path, offset); err != nil {
+			return err
+		}
+	}
+	b.follow = &followState{info: info, offset: offset}
+	return nil
+}
+
+// StopFollow stops following the buffer's file.
+func (b *Buffer) StopFollow() {
+	b.follow = nil
+}
+
+// FollowAppend appends whatever has been written to the end of the followed
+// file since the last call. Appended text is not an edit: it is added to the
+// saved text as well, so it neither dirties the buffer nor can be undone.
+// It reports whether any lines were added or extended.
+func (b *Buffer) FollowAppend() (bool, error) {
+	fs := b.follow
+	if fs == nil {
+		return false, nil
+	}
+	info, err := os.Stat(b.Path)
+	if err != nil {
+		return false, err
+	}
+	if !os.SameFile(fs.info, info) {
+		return false, ErrFollowReset
+	}
+	if b.large != nil {
+		before := b.large.Size()
+		b.large.Refresh()
+		b.FileSize = b.large.Size()
+		if b.FileSize < before {
+			return false, ErrFollowReset
+		}
+		return b.FileSize > before, nil
+	}
+	if info.Size() < fs.offset {
+		return false, ErrFollowReset
+	}
+	if info.Size() == fs.offset {
+		return false, nil
+	}
+
+	f, err := os.Open(b.Path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	data := make([]byte, info.Size()-fs.offset)
+	n, err := f.ReadAt(data, fs.offset)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	data = data[:n]
+	b.FileSize = fs.offset + int64(n)
+
+	// Hold back trailing line breaks and an incomplete character; they are
+	// read again once more has been written
+	if !isSingleByteEncoding(b.Encoding) {
+		data = data[:len(data)-incompleteRuneLen(data)]
+	}
+	data = bytes.TrimRight(data, "\r\n")
+	if len(data) == 0 {
+		return false, nil
+	}
+	fs.offset += int64(len(data))
+
+	text, err := b.decodeAppended(data)
+	if err != nil {
+		return false, err
+	}
+	pieces, eols, main := splitLines(text)
+	for i, eol := range eols {
+		if eol == "" && i < len(eols)-1 {
+			eol = lineBreak(main)
+		}
+		if eol == lineBreak(b.LineEnding) {
+			eol = ""
+		}
+		eols[i] = eol
+		b.MixedLineEndings = b.MixedLineEndings || eol != ""
+	}
+	b.text = appendPieces(b.text, pieces, eols)
+	b.saved = appendPieces(b.saved, pieces, eols)
+	b.version++
+	return true, nil
+}
+
+// decodeAppended converts bytes appended to the file to UTF-8. Only
+// encodings that can be decoded from any byte boundary can be followed.
+func (b *Buffer) decodeAppended(data []byte) (string, error) {
+	switch {
+	case b.Encoding == "" || b.Encoding == "UTF-8" || b.Encoding == "UTF-8 BOM":
+		return string(data), nil
+	case isSingleByteEncoding(b.Encoding):
+		return decodeText(data, b.Encoding), nil
+	}
+	return "", fmt.Errorf("cannot follow %s files", b.Encoding)
+}
+
+// appendPieces adds text split at line breaks to the end of r: the first
+// piece extends the last line and each further piece is a new line. Each
+// piece's line ends with its break in eols, as in a rope from newRopeEOL.
+func appendPieces(r *rope, pieces, eols []string) *rope {
+	last := r.Len() - 1
+	lines := make([]ropeLine, len(pieces))
+	for i, p := range pieces {
+		if i == 0 {
+			p = r.line(last).text + p
+		}
+		lines[i] = newRopeLine(p)
+		lines[i].eol = eols[i]
+	}
+	return r.replace(last, last+1, lines)
+}
+
+// incompleteRuneLen returns how many bytes at the end of data are the start
+// of a UTF-8 sequence that hasn't been written completely yet.
+func incompleteRuneLen(data []byte) int {
+	for n := 1; n <= utf8.UTFMax-1 && n <= len(data); n++ {
+		c := data[len(data)-n]
+		if utf8.RuneStart(c) {
+			if !utf8.FullRune(data[len(data)-n:]) {
+				return n
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// trimmedFileEnd returns size less the line breaks at the end of the file,
+// which loading leaves out of the buffer.
+func trimmedFileEnd(path string, size int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	buf := make([]byte, 4096)
+	for size > 0 {
+		from := size - int64(len(buf))
+		if from < 0 {
+			from = 0
+		}
+		n, err := f.ReadAt(buf[:size-from], from)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		trimmed := bytes.TrimRight(buf[:n], "\r\n")
+		size = from + int64(len(trimmed))
+		if len(trimmed) > 0 {
+			break
+		}
+	}
+	return size, nil
+}
@@ -0,0 +1,113 @@
+package buffer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func appendToFile(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+}
+
+func TestFollowAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	b, err := NewBufferFromFile(path, 4)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := b.StartFollow(); err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+
+	// A partial line, completed by the next write; the trailing newline and
+	// the incomplete "é" wait for more
+	appendToFile(t, path, "thr")
+	appendToFile(t, path, "ee\nfour\n\xc3")
+	if changed, err := b.FollowAppend(); err != nil || !changed {
+		t.Fatalf("expected an append, got %v (err %v)", changed, err)
+	}
+	if got := b.Text(); got != "one\ntwo\nthree\nfour" {
+		t.Fatalf("unexpected text %q", got)
+	}
+	appendToFile(t, path, "\xa9\r\n")
+	if _, err := b.FollowAppend(); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if got := b.Text(); got != "one\ntwo\nthree\nfour\né" {
+		t.Fatalf("unexpected text %q", got)
+	}
+	b.RecomputeDirty()
+	if b.Dirty {
+		t.Fatalf("appends from the file should not dirty the buffer")
+	}
+
+	if err := os.WriteFile(path, []byte("rotated\n"), 0644); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	if _, err := b.FollowAppend(); !errors.Is(err, ErrFollowReset) {
+		t.Fatalf("expected ErrFollowReset after truncation, got %v", err)
+	}
+}
+
+func TestFollowAppendKeepsLineEndings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("a\r\nb\r\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	b, err := NewBufferFromFile(path, 4)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := b.StartFollow(); err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+	appendToFile(t, path, "c\nd\r\n")
+	if _, err := b.FollowAppend(); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	counts := b.LineEndingCounts()
+	if counts["CRLF"] != 2 || counts["LF"] != 1 || !b.MixedLineEndings {
+		t.Fatalf("line endings = %v, mixed %v", counts, b.MixedLineEndings)
+	}
+	b.PreserveLineEndings = true
+	if got := b.BuildSaveContent(false, false); got != "a\r\nb\r\nc\nd" {
+		t.Fatalf("save content = %q", got)
+	}
+}
+
+func TestFollowDetectsReplacedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	b, err := NewBufferFromFile(path, 4)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := b.StartFollow(); err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("new file with more bytes\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := b.FollowAppend(); !errors.Is(err, ErrFollowReset) {
+		t.Fatalf("expected ErrFollowReset after rotation, got %v", err)
+	}
+}
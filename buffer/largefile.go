@@ -0,0 +1,485 @@
+package buffer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// largeStride is how many lines apart the line index records an offset.
+	// Finding a line scans at most this many lines from the nearest mark.
+	largeStride = 256
+	// largeBlockSize and largeCacheBlocks size the read cache that serves
+	// the lines on screen.
+	largeBlockSize   = 64 << 10
+	largeCacheBlocks = 256
+	// maxLargeLineBytes cuts pathological lines; the rest isn't shown.
+	maxLargeLineBytes = 1 << 20
+)
+
+// LargeFile serves the lines of a file too big to load into memory. Lines
+// are read from disk on demand while a background goroutine indexes where
+// lines start; until it finishes, LineCount covers the part indexed so far.
+type LargeFile struct {
+	f      *os.File
+	notify func()
+
+	mu        sync.Mutex
+	size      int64
+	marks     []int64 // offset of lines 0, largeStride, 2*largeStride, ...
+	newlines  int     // newlines indexed so far
+	tailStart int64   // offset just past the last newline indexed
+	scanned   int64   // bytes indexed so far
+	indexing  bool
+	gen       int // bumped when the index is reset
+	err       error
+	closed    bool
+
+	cacheMu sync.Mutex
+	blocks  map[int64][]byte
+	order   []int64 // cached blocks, oldest first
+	// The line read last, so rereading it or reading on doesn't rescan
+	lastLine  int
+	lastStart int64
+	lastNext  int64
+}
+
+// OpenLargeFile opens path and starts indexing it in the background. notify,
+// if set, is called from the indexing goroutine as it makes progress and
+// once it's done.
+func OpenLargeFile(path string, notify func()) (*LargeFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	lf := &LargeFile{
+		f:        f,
+		notify:   notify,
+		size:     info.Size(),
+		marks:    []int64{0},
+		blocks:   make(map[int64][]byte),
+		lastLine: -1,
+	}
+	lf.startIndexing()
+	return lf, nil
+}
+
+// lineEnding reports "CRLF" when the first line ends with one, else "LF".
+func (lf *LargeFile) lineEnding() string {
+	head := make([]byte, 4096)
+	n, _ := lf.f.ReadAt(head, 0)
+	if i := bytes.IndexByte(head[:n], '\n'); i > 0 && head[i-1] == '\r' {
+		return "CRLF"
+	}
+	return "LF"
+}
+
+// Close stops indexing and closes the file.
+func (lf *LargeFile) Close() {
+	lf.mu.Lock()
+	lf.closed = true
+	lf.mu.Unlock()
+	lf.f.Close()
+}
+
+// Size returns the file size as last seen.
+func (lf *LargeFile) Size() int64 {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.size
+}
+
+// Progress reports how much of the file has been indexed, from 0 to 1, and
+// whether indexing is finished.
+func (lf *LargeFile) Progress() (float64, bool) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	done := !lf.indexing
+	if lf.size == 0 || done {
+		return 1, done
+	}
+	return float64(lf.scanned) / float64(lf.size), done
+}
+
+// Err returns the error that stopped indexing, if any.
+func (lf *LargeFile) Err() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.err
+}
+
+// LineCount returns the number of lines indexed so far, at least one. A
+// last line without a newline is counted once indexing reaches it.
+func (lf *LargeFile) LineCount() int {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.lineCountLocked()
+}
+
+func (lf *LargeFile) lineCountLocked() int {
+	n := lf.newlines
+	if !lf.indexing && lf.size > lf.tailStart {
+		n++
+	}
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// Refresh picks up changes to the file's size. Growth is indexed from where
+// indexing left off; a file that shrank (truncated or replaced) is indexed
+// again from the start. It reports whether the file grew.
+func (lf *LargeFile) Refresh() (grew bool) {
+	info, err := lf.f.Stat()
+	if err != nil {
+		return false
+	}
+	size := info.Size()
+
+	lf.mu.Lock()
+	switch {
+	case size > lf.size:
+		lf.size = size
+		grew = true
+	case size < lf.size:
+		lf.size = size
+		lf.marks = []int64{0}
+		lf.newlines, lf.tailStart, lf.scanned = 0, 0, 0
+		lf.gen++
+	default:
+		lf.mu.Unlock()
+		return false
+	}
+	lf.mu.Unlock()
+
+	lf.cacheMu.Lock()
+	if grew {
+		// Only the partial block at the old end changed
+		kept := lf.order[:0]
+		for _, off := range lf.order {
+			if len(lf.blocks[off]) < largeBlockSize {
+				delete(lf.blocks, off)
+			} else {
+				kept = append(kept, off)
+			}
+		}
+		lf.order = kept
+	} else {
+		lf.blocks = make(map[int64][]byte)
+		lf.order = nil
+	}
+	lf.lastLine = -1
+	lf.cacheMu.Unlock()
+
+	lf.startIndexing()
+	return grew
+}
+
+func (lf *LargeFile) startIndexing() {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.indexing || lf.closed || lf.scanned >= lf.size {
+		return
+	}
+	lf.indexing = true
+	go lf.index()
+}
+
+// index scans the file for newlines, recording a mark every largeStride
+// lines.
+func (lf *LargeFile) index() {
+	buf := make([]byte, 1<<20)
+	lastNotify := time.Now()
+	for {
+		lf.mu.Lock()
+		gen, off, size, newlines := lf.gen, lf.scanned, lf.size, lf.newlines
+		if lf.closed || off >= size {
+			lf.indexing = false
+			lf.mu.Unlock()
+			break
+		}
+		lf.mu.Unlock()
+
+		n := int64(len(buf))
+		if size-off < n {
+			n = size - off
+		}
+		read, err := lf.f.ReadAt(buf[:n], off)
+		if read == 0 {
+			lf.mu.Lock()
+			lf.indexing = false
+			if err != nil && err != io.EOF {
+				lf.err = err
+			}
+			lf.mu.Unlock()
+			break
+		}
+
+		chunk := buf[:read]
+		var marks []int64
+		tail := int64(-1)
+		for i := 0; ; {
+			j := bytes.IndexByte(chunk[i:], '\n')
+			if j < 0 {
+				break
+			}
+			i += j + 1
+			newlines++
+			tail = off + int64(i)
+			if newlines%largeStride == 0 {
+				marks = append(marks, tail)
+			}
+		}
+
+		lf.mu.Lock()
+		if lf.gen == gen {
+			lf.marks = append(lf.marks, marks...)
+			lf.newlines = newlines
+			if tail >= 0 {
+				lf.tailStart = tail
+			}
+			lf.scanned = off + int64(read)
+		}
+		lf.mu.Unlock()
+
+		if lf.notify != nil && time.Since(lastNotify) > 100*time.Millisecond {
+			lastNotify = time.Now()
+			lf.notify()
+		}
+	}
+	if lf.notify != nil {
+		lf.notify()
+	}
+}
+
+// Line returns line i, or "" when it hasn't been indexed. Lines are
+// returned without their line ending, as valid UTF-8.
+func (lf *LargeFile) Line(i int) string {
+	lf.mu.Lock()
+	if i < 0 || i >= lf.lineCountLocked() || i/largeStride >= len(lf.marks) {
+		lf.mu.Unlock()
+		return ""
+	}
+	mark := lf.marks[i/largeStride]
+	size := lf.size
+	lf.mu.Unlock()
+
+	lf.cacheMu.Lock()
+	defer lf.cacheMu.Unlock()
+	start := mark
+	switch {
+	case lf.lastLine >= 0 && i == lf.lastLine:
+		start = lf.lastStart
+	case lf.lastLine >= 0 && i == lf.lastLine+1:
+		start = lf.lastNext
+	default:
+		for n := i % largeStride; n > 0; n-- {
+			start = lf.indexByte(start, size) + 1
+		}
+	}
+	end := lf.indexByte(start, size)
+	lf.lastLine, lf.lastStart, lf.lastNext = i, start, end+1
+
+	if end-start > maxLargeLineBytes {
+		end = start + maxLargeLineBytes
+	}
+	line := make([]byte, 0, end-start)
+	for off := start; off < end; {
+		blk := lf.block(off)
+		from := off % largeBlockSize
+		to := int64(len(blk))
+		if off-from+to > end {
+			to = end - (off - from)
+		}
+		if from >= to {
+			break
+		}
+		line = append(line, blk[from:to]...)
+		off += to - from
+	}
+	return decodeLargeLine(line, i == 0)
+}
+
+// indexByte returns the offset of the next newline at or after off, or size.
+// The caller holds cacheMu.
+func (lf *LargeFile) indexByte(off, size int64) int64 {
+	for off < size {
+		blk := lf.block(off)
+		from := off % largeBlockSize
+		if from >= int64(len(blk)) {
+			return size
+		}
+		if j := bytes.IndexByte(blk[from:], '\n'); j >= 0 {
+			return off + int64(j)
+		}
+		off += int64(len(blk)) - from
+	}
+	return size
+}
+
+// block returns the cached block containing off. The caller holds cacheMu.
+func (lf *LargeFile) block(off int64) []byte {
+	start := off - off%largeBlockSize
+	if blk, ok := lf.blocks[start]; ok {
+		return blk
+	}
+	blk := make([]byte, largeBlockSize)
+	n, _ := lf.f.ReadAt(blk, start)
+	blk = blk[:n]
+	if len(lf.order) >= largeCacheBlocks {
+		delete(lf.blocks, lf.order[0])
+		lf.order = lf.order[1:]
+	}
+	lf.blocks[start] = blk
+	lf.order = append(lf.order, start)
+	return blk
+}
+
+func decodeLargeLine(b []byte, first bool) string {
+	b = bytes.TrimSuffix(b, []byte("\r"))
+	if first {
+		b = bytes.TrimPrefix(b, []byte("\xEF\xBB\xBF"))
+	}
+	return strings.ToValidUTF8(string(b), "�")
+}
+
+// ScanLines calls fn with each line from line from onwards, or backwards
+// down to line 0 when backward is set, until fn returns false. Going
+// forwards it waits for the indexer and ends at the end of the file. It
+// reads the file directly, so it may run on any goroutine.
+func (lf *LargeFile) ScanLines(ctx context.Context, from int, backward bool, fn func(line int, text string) bool) error {
+	if from < 0 {
+		from = 0
+	}
+	if backward {
+		return lf.scanBackward(ctx, from, fn)
+	}
+	return lf.scanForward(ctx, from, fn)
+}
+
+func (lf *LargeFile) scanForward(ctx context.Context, from int, fn func(int, string) bool) error {
+	lf.mu.Lock()
+	g := from / largeStride
+	for g >= len(lf.marks) {
+		g--
+	}
+	off, line := lf.marks[g], g*largeStride
+	lf.mu.Unlock()
+
+	for {
+		lf.mu.Lock()
+		end, done := lf.tailStart, !lf.indexing
+		if done {
+			end = lf.size
+		}
+		lf.mu.Unlock()
+
+		if off < end {
+			r := bufio.NewReaderSize(io.NewSectionReader(lf.f, off, end-off), 1<<20)
+			for {
+				raw, n, err := readLargeLine(r)
+				if n == 0 {
+					break
+				}
+				if line >= from && !fn(line, decodeLargeLine(raw, line == 0)) {
+					return nil
+				}
+				off += n
+				line++
+				if err != nil {
+					break
+				}
+				if line%largeStride == 0 && ctx.Err() != nil {
+					return ctx.Err()
+				}
+			}
+		}
+		if done {
+			return ctx.Err()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+func (lf *LargeFile) scanBackward(ctx context.Context, from int, fn func(int, string) bool) error {
+	lf.mu.Lock()
+	marks := lf.marks
+	end := lf.tailStart
+	if !lf.indexing {
+		end = lf.size
+	}
+	if count := lf.lineCountLocked(); from >= count {
+		from = count - 1
+	}
+	lf.mu.Unlock()
+
+	for g := from / largeStride; g >= 0; g-- {
+		if g >= len(marks) {
+			continue
+		}
+		start, stop := marks[g], end
+		if g+1 < len(marks) {
+			stop = marks[g+1]
+		}
+		r := bufio.NewReaderSize(io.NewSectionReader(lf.f, start, stop-start), 1<<20)
+		var lines []string
+		for {
+			raw, n, err := readLargeLine(r)
+			if n == 0 {
+				break
+			}
+			lines = append(lines, decodeLargeLine(raw, g == 0 && len(lines) == 0))
+			if err != nil {
+				break
+			}
+		}
+		for i := len(lines) - 1; i >= 0; i-- {
+			line := g*largeStride + i
+			if line <= from && !fn(line, lines[i]) {
+				return nil
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// readLargeLine reads one line including its newline, returning the line
+// cut to maxLargeLineBytes and the number of bytes consumed.
+func readLargeLine(r *bufio.Reader) ([]byte, int64, error) {
+	var line []byte
+	var n int64
+	for {
+		part, err := r.ReadSlice('\n')
+		n += int64(len(part))
+		if len(line) < maxLargeLineBytes {
+			room := maxLargeLineBytes - len(line)
+			if len(part) > room {
+				part = part[:room]
+			}
+			line = append(line, part...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return bytes.TrimSuffix(line, []byte("\n")), n, err
+	}
+}
@@ -0,0 +1,136 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitIndexed(t *testing.T, lf *LargeFile) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, done := lf.Progress(); done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("indexing did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// writeLargeTestFile writes lines newline-terminated; the large-file index
+// does not count the empty line after the final newline.
+func writeLargeTestFile(t *testing.T, lines int) (string, []string) {
+	t.Helper()
+	want := make([]string, lines)
+	for i := range want {
+		want[i] = fmt.Sprintf("line %d %s", i, strings.Repeat("x", i%300))
+	}
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, []byte(strings.Join(want, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return path, want
+}
+
+func TestLargeFileLines(t *testing.T) {
+	path, want := writeLargeTestFile(t, 5000)
+	b, err := NewLargeFileBuffer(path, 4, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer b.Close()
+	waitIndexed(t, b.Large())
+
+	if !b.ReadOnly {
+		t.Fatalf("expected large-file buffers to be read-only")
+	}
+	if b.LineCount() != len(want) {
+		t.Fatalf("expected %d lines, got %d", len(want), b.LineCount())
+	}
+	for _, i := range []int{0, 1, 255, 256, 257, 4000, 3999, len(want) - 2, len(want) - 1} {
+		if got := b.Line(i); got != want[i] {
+			t.Fatalf("line %d: expected %q, got %q", i, want[i], got)
+		}
+	}
+	if got := b.LinesRange(510, 515); strings.Join(got, "|") != strings.Join(want[510:515], "|") {
+		t.Fatalf("unexpected range %q", got)
+	}
+}
+
+func TestLargeFileScanLines(t *testing.T) {
+	path, want := writeLargeTestFile(t, 2000)
+	lf, err := OpenLargeFile(path, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer lf.Close()
+
+	var forward []int
+	err = lf.ScanLines(context.Background(), 1500, false, func(line int, text string) bool {
+		if text != want[line] {
+			t.Fatalf("forward line %d: expected %q, got %q", line, want[line], text)
+		}
+		forward = append(forward, line)
+		return true
+	})
+	if err != nil || len(forward) != len(want)-1500 || forward[0] != 1500 {
+		t.Fatalf("forward scan visited %d lines (err %v)", len(forward), err)
+	}
+
+	waitIndexed(t, lf)
+	next := 700
+	err = lf.ScanLines(context.Background(), 700, true, func(line int, text string) bool {
+		if line != next || text != want[line] {
+			t.Fatalf("backward scan: expected line %d, got %d %q", next, line, text)
+		}
+		next--
+		return line > 300
+	})
+	if err != nil || next != 299 {
+		t.Fatalf("backward scan stopped at %d (err %v)", next, err)
+	}
+}
+
+func TestLargeFileRefreshPicksUpAppends(t *testing.T) {
+	path, want := writeLargeTestFile(t, 1000)
+	lf, err := OpenLargeFile(path, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer lf.Close()
+	waitIndexed(t, lf)
+	// Cache the partial block at the end of the file
+	if got := lf.Line(len(want) - 1); got != want[len(want)-1] {
+		t.Fatalf("last line = %q", got)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	f.WriteString("appended\n")
+	f.Close()
+
+	if !lf.Refresh() {
+		t.Fatalf("expected Refresh to report growth")
+	}
+	lf.cacheMu.Lock()
+	if len(lf.order) != len(lf.blocks) {
+		t.Fatalf("%d blocks cached but %d in eviction order", len(lf.blocks), len(lf.order))
+	}
+	lf.cacheMu.Unlock()
+	waitIndexed(t, lf)
+	if lf.LineCount() != len(want)+1 {
+		t.Fatalf("expected %d lines, got %d", len(want)+1, lf.LineCount())
+	}
+	if got := lf.Line(len(want)); got != "appended" {
+		t.Fatalf("expected appended line, got %q", got)
+	}
+}
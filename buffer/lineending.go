@@ -0,0 +1,199 @@
+package buffer
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LineEndings lists the line endings a buffer can be saved with, by the
+// names used in Buffer.LineEnding.
+var LineEndings = []string{"LF", "CRLF", "CR"}
+
+// lineBreak returns the characters of the named line ending.
+func lineBreak(name string) string {
+	switch name {
+	case "CRLF":
+		return "\r\n"
+	case "CR":
+		return "\r"
+	}
+	return "\n"
+}
+
+// splitLines splits s at LF, CRLF and lone CR. It returns the lines, the
+// most common line ending, and for each line the break after it when that
+// differs from the most common one ("" otherwise, and for the last line).
+func splitLines(s string) (lines, eols []string, main string) {
+	var breaks []string
+	counts := map[string]int{}
+	start := 0
+	for i := 0; i < len(s); i++ {
+		var eol string
+		switch {
+		case s[i] == '\n':
+			eol = "\n"
+		case s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n':
+			eol = "\r\n"
+		case s[i] == '\r':
+			eol = "\r"
+		default:
+			continue
+		}
+		lines = append(lines, s[start:i])
+		breaks = append(breaks, eol)
+		counts[eol]++
+		i += len(eol) - 1
+		start = i + 1
+	}
+	lines = append(lines, s[start:])
+
+	main = "LF"
+	for _, name := range LineEndings {
+		if counts[lineBreak(name)] > counts[lineBreak(main)] {
+			main = name
+		}
+	}
+	eols = make([]string, len(lines))
+	for i, eol := range breaks {
+		if eol != lineBreak(main) {
+			eols[i] = eol
+		}
+	}
+	return lines, eols, main
+}
+
+// NewBufferKeepingLineEndings returns a buffer of text split at any line
+// break, each line keeping its own. Unlike a loaded file, trailing blank
+// lines are kept, so BuildSaveContent(false, false) gives text back as it was
+// apart from the lines edited.
+func NewBufferKeepingLineEndings(text string, tabSize int) *Buffer {
+	lines, eols, main := splitLines(text)
+	b := NewBuffer(tabSize)
+	b.text = newRopeEOL(lines, eols)
+	b.saved = b.text
+	b.LineEnding = main
+	b.PreserveLineEndings = true
+	for _, eol := range eols {
+		b.MixedLineEndings = b.MixedLineEndings || eol != ""
+	}
+	return b
+}
+
+// lineEndingName returns the name of a line break, as in LineEndings.
+func lineEndingName(eol string) string {
+	switch eol {
+	case "\r\n":
+		return "CRLF"
+	case "\r":
+		return "CR"
+	}
+	return "LF"
+}
+
+// ConvertLineEndings makes every line end with the named line ending when
+// the buffer is saved. It dirties the buffer, as the file changes, and can
+// be undone like an edit.
+func (b *Buffer) ConvertLineEndings(name string) {
+	if name == b.LineEnding && !b.MixedLineEndings {
+		return
+	}
+	c := &LineEndingChange{
+		From:     b.LineEnding,
+		FromEOLs: b.lineEnds(),
+		To:       name,
+		changed:  b.lineEndingChanged,
+		saved:    b.saved,
+	}
+	b.setLineEndings(name, nil)
+	b.Undo.Push(Operation{Type: OpLineEndings, Pos: b.Cursor, Before: b.Cursor, Endings: c})
+	b.Dirty = true
+}
+
+// LineEndingChange is a line ending conversion: the buffer's line ending
+// before and after it, and each line's own line break before it when the
+// lines had mixed ones.
+type LineEndingChange struct {
+	From     string   `json:"from"`
+	FromEOLs []string `json:"from_eols,omitempty"`
+	To       string   `json:"to"`
+
+	// Whether the buffer was already dirtied by a conversion, and its saved
+	// text, at the time: undoing brings back a clean buffer only if it
+	// hasn't been saved since.
+	changed bool
+	saved   *rope
+}
+
+// undoLineEndings undoes the conversion c.
+func (b *Buffer) undoLineEndings(c *LineEndingChange) {
+	b.setLineEndings(c.From, c.FromEOLs)
+	b.lineEndingChanged = c.saved == nil || c.saved != b.saved || c.changed
+}
+
+// setLineEndings gives the buffer the line ending name and its lines the
+// line breaks eols, or name throughout if eols is nil. Lines past the end of
+// eols, such as a final newline added on save, end in name.
+func (b *Buffer) setLineEndings(name string, eols []string) {
+	if eols == nil {
+		b.clearLineEnds()
+	} else {
+		n := b.text.Len()
+		eols = append(eols[:min(len(eols), n):min(len(eols), n)], make([]string, max(n-len(eols), 0))...)
+		b.text = newRopeEOL(b.Lines(), eols)
+	}
+	b.LineEnding = name
+	b.MixedLineEndings = eols != nil
+	b.lineEndingChanged = true
+}
+
+// lineEnds returns the line break of every line when they are mixed, or
+// nil when they all end in LineEnding.
+func (b *Buffer) lineEnds() []string {
+	if !b.MixedLineEndings {
+		return nil
+	}
+	eols := make([]string, 0, b.text.Len())
+	b.text.each(0, b.text.Len(), func(_ int, l ropeLine) bool {
+		eols = append(eols, l.eol)
+		return true
+	})
+	return eols
+}
+
+// LineEndingCounts counts the lines ending in each line ending, by name.
+// The last line, which has no line break in the buffer, isn't counted.
+func (b *Buffer) LineEndingCounts() map[string]int {
+	counts := map[string]int{}
+	n := b.text.Len()
+	b.text.each(0, n, func(i int, l ropeLine) bool {
+		if i == n-1 {
+			return false
+		}
+		if l.eol == "" {
+			counts[b.LineEnding]++
+		} else {
+			counts[lineEndingName(l.eol)]++
+		}
+		return true
+	})
+	return counts
+}
+
+// LineEndingSummary describes the line endings of the buffer for the status
+// bar, such as "12 LF, 3 CRLF".
+func (b *Buffer) LineEndingSummary() string {
+	counts := b.LineEndingCounts()
+	var parts []string
+	for _, name := range LineEndings {
+		if counts[name] > 0 {
+			parts = append(parts, strconv.Itoa(counts[name])+" "+name)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// clearLineEnds gives every line the buffer's LineEnding. The saved text
+// is left alone, so its lines still compare equal.
+func (b *Buffer) clearLineEnds() {
+	b.text = newRope(b.Lines())
+}
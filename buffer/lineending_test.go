@@ -0,0 +1,180 @@
+package buffer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadTemp(t *testing.T, content string) (*Buffer, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	b, err := NewBufferFromFile(path, 4)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return b, path
+}
+
+func savedContent(t *testing.T, b *Buffer, path string) string {
+	t.Helper()
+	if err := b.SaveWithOptions(false, true); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(data)
+}
+
+func TestLineEndingDetection(t *testing.T) {
+	tests := []struct {
+		content string
+		ending  string
+		mixed   bool
+	}{
+		{"a\nb\n", "LF", false},
+		{"a\r\nb\r\n", "CRLF", false},
+		{"a\rb\r", "CR", false},
+		{"a\r\nb\r\nc\n", "CRLF", true},
+		{"a\nb\rc\n", "LF", true},
+		{"no break", "LF", false},
+	}
+	for _, tt := range tests {
+		b, _ := loadTemp(t, tt.content)
+		if b.LineEnding != tt.ending || b.MixedLineEndings != tt.mixed {
+			t.Errorf("%q: got %s mixed=%v, want %s mixed=%v", tt.content, b.LineEnding, b.MixedLineEndings, tt.ending, tt.mixed)
+		}
+		if b.LineCount() > 1 && b.Line(0) != "a" {
+			t.Errorf("%q: line 0 = %q", tt.content, b.Line(0))
+		}
+	}
+}
+
+func TestMixedLineEndingsSave(t *testing.T) {
+	const content = "one\r\ntwo\nthree\r\nfour\r\n"
+
+	// Preserved: only the edited line changes
+	b, path := loadTemp(t, content)
+	if got := b.LineEndingSummary(); got != "1 LF, 2 CRLF" {
+		t.Fatalf("summary = %q", got)
+	}
+	b.PreserveLineEndings = true
+	b.SetLine(1, "TWO")
+	if got := savedContent(t, b, path); got != "one\r\nTWO\nthree\r\nfour\r\n" {
+		t.Fatalf("preserved save = %q", got)
+	}
+
+	// Not preserved: saving converts to the most common ending
+	b, path = loadTemp(t, content)
+	if got := savedContent(t, b, path); got != "one\r\ntwo\r\nthree\r\nfour\r\n" {
+		t.Fatalf("normalized save = %q", got)
+	}
+	if b.MixedLineEndings {
+		t.Fatalf("still mixed after normalizing save")
+	}
+}
+
+func TestConvertLineEndings(t *testing.T) {
+	b, path := loadTemp(t, "a\r\nb\nc\r\n")
+	b.PreserveLineEndings = true
+	b.ConvertLineEndings("LF")
+	b.RecomputeDirty()
+	if !b.Dirty {
+		t.Fatalf("conversion should dirty the buffer")
+	}
+	if got := savedContent(t, b, path); got != "a\nb\nc\n" {
+		t.Fatalf("LF save = %q", got)
+	}
+	b.RecomputeDirty()
+	if b.Dirty {
+		t.Fatalf("dirty after save")
+	}
+
+	b.ConvertLineEndings("CR")
+	if got := savedContent(t, b, path); got != "a\rb\rc\r" {
+		t.Fatalf("CR save = %q", got)
+	}
+}
+
+func TestUndoLineEndingConversion(t *testing.T) {
+	b, _ := loadTemp(t, "a\r\nb\nc\r\n")
+	b.PreserveLineEndings = true
+	b.ConvertLineEndings("LF")
+	if got := b.BuildSaveContent(false, false); got != "a\nb\nc" {
+		t.Fatalf("converted = %q", got)
+	}
+
+	b.ApplyUndo()
+	b.RecomputeDirty()
+	if got := b.BuildSaveContent(false, false); got != "a\r\nb\nc" {
+		t.Fatalf("after undo = %q", got)
+	}
+	if b.Dirty || !b.MixedLineEndings {
+		t.Fatalf("after undo: dirty %v, mixed %v", b.Dirty, b.MixedLineEndings)
+	}
+
+	b.ApplyRedo()
+	b.RecomputeDirty()
+	if got := b.BuildSaveContent(false, false); got != "a\nb\nc" || !b.Dirty {
+		t.Fatalf("after redo = %q, dirty %v", got, b.Dirty)
+	}
+
+	// Undone after saving, the old line endings differ from the file
+	b.MarkSaved()
+	b.ApplyUndo()
+	b.RecomputeDirty()
+	if !b.Dirty {
+		t.Fatalf("undoing a saved conversion should dirty the buffer")
+	}
+}
+
+func TestMixedLineEndingsSurviveLineEdits(t *testing.T) {
+	const content = "one\ntwo\r\nthree\nfour\n"
+	b, _ := loadTemp(t, content)
+	b.PreserveLineEndings = true
+
+	// Split the CRLF line, then join it back
+	b.Cursor = Cursor{Line: 1, Col: 1}
+	b.InsertNewline()
+	if got := b.BuildSaveContent(false, true); got != "one\nt\r\nwo\r\nthree\nfour\n" {
+		t.Fatalf("after Enter = %q", got)
+	}
+	b.Backspace()
+	if got := b.BuildSaveContent(false, true); got != content {
+		t.Fatalf("after join = %q", got)
+	}
+
+	// Undo and redo put lines back with their own breaks
+	b.ApplyUndo()
+	b.ApplyUndo()
+	if got := b.BuildSaveContent(false, true); got != content {
+		t.Fatalf("after undo = %q", got)
+	}
+	b.ApplyRedo()
+	if got := b.BuildSaveContent(false, true); got != "one\nt\r\nwo\r\nthree\nfour\n" {
+		t.Fatalf("after redo = %q", got)
+	}
+
+	// Joining the CRLF line with the next drops its break, keeping the LF one
+	b, _ = loadTemp(t, content)
+	b.PreserveLineEndings = true
+	b.Cursor = Cursor{Line: 1, Col: 3}
+	b.Delete()
+	if got := b.BuildSaveContent(false, true); got != "one\ntwothree\nfour\n" {
+		t.Fatalf("after Delete join = %q", got)
+	}
+
+	// A multi-line paste into the CRLF line keeps its break on the last line
+	b, _ = loadTemp(t, content)
+	b.PreserveLineEndings = true
+	b.Cursor = Cursor{Line: 1, Col: 3}
+	b.InsertText("x\ny")
+	if got := b.BuildSaveContent(false, true); got != "one\ntwox\r\ny\r\nthree\nfour\n" {
+		t.Fatalf("after paste = %q", got)
+	}
+}
@@ -0,0 +1,365 @@
+package buffer
+
+import (
+	"sort"
+	"unicode"
+)
+
+// cursorState is a cursor, its selection and its auto-close state as rune
+// offsets, which other cursors' edits only shift.
+type cursorState struct {
+	pos              int
+	selStart, selEnd int // -1 without a selection
+	pending          []rune
+	pendingAt        int
+}
+
+// start is where the cursor's text begins: the selection start if it has one.
+func (st cursorState) start() int {
+	if st.selStart >= 0 && st.selStart < st.pos {
+		return st.selStart
+	}
+	return st.pos
+}
+
+// shift moves the state's offsets by delta, keeping them at or after floor.
+func (st *cursorState) shift(delta, floor int) {
+	move := func(off *int) {
+		*off += delta
+		if *off < floor {
+			*off = floor
+		}
+	}
+	move(&st.pos)
+	move(&st.pendingAt)
+	if st.selStart >= 0 {
+		move(&st.selStart)
+		move(&st.selEnd)
+	}
+}
+
+// clamp pulls offsets past limit back to it, for cursors whose text an edit
+// before them deleted.
+func (st *cursorState) clamp(limit int) {
+	st.pos = min(st.pos, limit)
+	st.pendingAt = min(st.pendingAt, limit)
+	if st.selStart >= 0 {
+		st.selStart = min(st.selStart, limit)
+		st.selEnd = min(st.selEnd, limit)
+	}
+}
+
+// saveCursor returns the primary cursor's state.
+func (b *Buffer) saveCursor() cursorState {
+	st := cursorState{pos: b.Offset(b.Cursor), selStart: -1, selEnd: -1, pending: b.autoClosePending}
+	if b.Selection != nil {
+		st.selStart, st.selEnd = b.Offset(b.Selection.Start), b.Offset(b.Selection.End)
+	}
+	if len(st.pending) > 0 {
+		st.pendingAt = b.Offset(b.autoClosePos)
+	}
+	return st
+}
+
+// loadCursor makes st the primary cursor.
+func (b *Buffer) loadCursor(st cursorState) {
+	b.Cursor = b.PosAt(st.pos)
+	b.Selection = nil
+	if st.selStart >= 0 {
+		sel := Selection{Start: b.PosAt(st.selStart), End: b.PosAt(st.selEnd)}
+		b.Selection = &sel
+	}
+	b.autoClosePending = st.pending
+	if len(st.pending) > 0 {
+		b.autoClosePos = b.PosAt(st.pendingAt)
+	}
+}
+
+// CursorCount returns the number of cursors, the primary included.
+func (b *Buffer) CursorCount() int {
+	return 1 + len(b.ExtraCursors)
+}
+
+// Cursors returns every cursor, primary first.
+func (b *Buffer) Cursors() []Cursor {
+	cursors := make([]Cursor, 0, b.CursorCount())
+	cursors = append(cursors, b.Cursor)
+	for _, ec := range b.ExtraCursors {
+		cursors = append(cursors, ec.Cursor)
+	}
+	return cursors
+}
+
+// restoreCursors puts the cursors back where Cursors found them, without
+// selections.
+func (b *Buffer) restoreCursors(cursors []Cursor) {
+	if len(cursors) == 0 {
+		return
+	}
+	b.Cursor = cursors[0]
+	b.ExtraCursors = b.ExtraCursors[:0]
+	for _, c := range cursors[1:] {
+		b.ExtraCursors = append(b.ExtraCursors, ExtraCursor{Cursor: c})
+	}
+}
+
+// EachCursor calls fn once for every cursor, with that cursor made the
+// primary one along with its selection, so any single-cursor movement or
+// edit works on all of them. Cursors are visited from the end of the buffer
+// back, so fn's edits don't move the cursors still to come; cursors that end
+// up in the same place are merged. The edits undo as one step, which puts
+// every cursor back.
+func (b *Buffer) EachCursor(fn func()) {
+	if len(b.ExtraCursors) == 0 {
+		fn()
+		return
+	}
+
+	before := b.Cursors()
+	states := []cursorState{b.saveCursor()}
+	for _, ec := range b.ExtraCursors {
+		b.Cursor, b.Selection = ec.Cursor, ec.Selection
+		b.autoClosePending, b.autoClosePos = ec.autoClosePending, ec.autoClosePos
+		states = append(states, b.saveCursor())
+	}
+	order := make([]int, len(states))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return states[order[i]].start() > states[order[j]].start()
+	})
+
+	// A larger group's first edit may not be ours; leave its cursors alone
+	nested := b.Undo.Grouping()
+	id := b.Undo.BeginGroup()
+	done := make([]bool, len(states))
+	for _, i := range order {
+		b.loadCursor(states[i])
+		count := b.RuneCount()
+		fn()
+		states[i] = b.saveCursor()
+		done[i] = true
+		delta := b.RuneCount() - count
+		if delta == 0 {
+			continue
+		}
+		for j := range states {
+			if j == i {
+				continue
+			}
+			if done[j] {
+				states[j].shift(delta, states[i].pos)
+			} else {
+				states[j].clamp(states[i].pos)
+			}
+		}
+	}
+	b.Undo.EndGroup()
+
+	// The primary comes first, so it wins when cursors merge
+	seen := make(map[int]bool, len(states))
+	b.ExtraCursors = b.ExtraCursors[:0]
+	for i, st := range states {
+		if seen[st.pos] {
+			continue
+		}
+		seen[st.pos] = true
+		if i == 0 {
+			continue
+		}
+		b.loadCursor(st)
+		b.ExtraCursors = append(b.ExtraCursors, ExtraCursor{
+			Cursor:           b.Cursor,
+			Selection:        b.Selection,
+			autoClosePending: b.autoClosePending,
+			autoClosePos:     b.autoClosePos,
+		})
+	}
+	b.loadCursor(states[0])
+
+	if op := b.Undo.groupStart(id); op != nil && !nested {
+		op.Cursors = before
+		op.CursorsAfter = b.Cursors()
+	}
+}
+
+// cursorSelections returns each cursor's selection, or an empty one at the
+// cursor, primary first.
+func (b *Buffer) cursorSelections() []Selection {
+	sels := make([]Selection, 0, b.CursorCount())
+	add := func(c Cursor, sel *Selection) {
+		if sel != nil {
+			sels = append(sels, *sel)
+		} else {
+			sels = append(sels, Selection{Start: c, End: c})
+		}
+	}
+	add(b.Cursor, b.Selection)
+	for _, ec := range b.ExtraCursors {
+		add(ec.Cursor, ec.Selection)
+	}
+	return sels
+}
+
+// overlaps reports whether two selections share text; an empty selection
+// overlaps one it touches.
+func overlaps(a, b Selection) bool {
+	if a.Empty() || b.Empty() {
+		return !a.End.Before(b.Start) && !b.End.Before(a.Start)
+	}
+	return a.Start.Before(b.End) && b.Start.Before(a.End)
+}
+
+// occurrences returns every place text appears in the buffer, ignoring case.
+func (b *Buffer) occurrences(text string) []Selection {
+	needle := []rune(text)
+	if len(needle) == 0 {
+		return nil
+	}
+	hay := []rune(b.Text())
+	var found []Selection
+	for i := 0; i+len(needle) <= len(hay); i++ {
+		match := true
+		for k, r := range needle {
+			if unicode.ToLower(hay[i+k]) != unicode.ToLower(r) {
+				match = false
+				break
+			}
+		}
+		if match {
+			found = append(found, Selection{Start: b.PosAt(i), End: b.PosAt(i + len(needle))})
+			i += len(needle) - 1
+		}
+	}
+	return found
+}
+
+// nextOccurrence returns the first occurrence of text at or after from,
+// wrapping around the end of the buffer, that overlaps none of taken.
+func (b *Buffer) nextOccurrence(text string, from Cursor, taken []Selection) (Selection, bool) {
+	matches := b.occurrences(text)
+	first := sort.Search(len(matches), func(i int) bool {
+		return !matches[i].Start.Before(from)
+	})
+	for k := range matches {
+		m := matches[(first+k)%len(matches)]
+		free := true
+		for _, t := range taken {
+			if overlaps(m, t) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return m, true
+		}
+	}
+	return Selection{}, false
+}
+
+// selectWordAtCursor selects the word under the primary cursor.
+func (b *Buffer) selectWordAtCursor() bool {
+	b.clampCursor()
+	start, end := b.WordAt(b.Cursor.Line, b.Cursor.Col)
+	if start == end {
+		return false
+	}
+	sel := Selection{Start: Cursor{Line: b.Cursor.Line, Col: start}, End: Cursor{Line: b.Cursor.Line, Col: end}}
+	b.Selection = &sel
+	b.Cursor = sel.End
+	return true
+}
+
+// SelectNextOccurrence selects the word under the cursor or, once there is a
+// selection, adds a cursor selecting the next occurrence of its text after
+// the most recently added one. It reports whether anything was selected.
+func (b *Buffer) SelectNextOccurrence() bool {
+	if b.Selection == nil || b.Selection.Empty() {
+		return b.selectWordAtCursor()
+	}
+	taken := b.cursorSelections()
+	match, ok := b.nextOccurrence(b.GetSelectedText(), taken[len(taken)-1].End, taken)
+	if !ok {
+		return false
+	}
+	b.ExtraCursors = append(b.ExtraCursors, ExtraCursor{Cursor: match.End, Selection: &match})
+	return true
+}
+
+// SkipOccurrence moves the most recently added selection on to the next
+// occurrence of the selected text, leaving out a match SelectNextOccurrence
+// took. It reports whether the selection moved.
+func (b *Buffer) SkipOccurrence() bool {
+	if b.Selection == nil || b.Selection.Empty() {
+		return b.selectWordAtCursor()
+	}
+	taken := b.cursorSelections()
+	last := len(taken) - 1
+	match, ok := b.nextOccurrence(b.GetSelectedText(), taken[last].End, taken[:last])
+	if !ok || match == taken[last] {
+		return false
+	}
+	if last == 0 {
+		b.Selection = &match
+		b.Cursor = match.End
+	} else {
+		b.ExtraCursors[last-1] = ExtraCursor{Cursor: match.End, Selection: &match}
+	}
+	return true
+}
+
+// SelectAllOccurrences puts a cursor on every occurrence of the selected
+// text, or of the word under the cursor, each selecting it. The occurrence
+// at the primary cursor stays primary. It returns the number selected.
+func (b *Buffer) SelectAllOccurrences() int {
+	var text string
+	if b.Selection != nil && !b.Selection.Empty() {
+		text = b.GetSelectedText()
+	} else {
+		text = b.WordAtCursor()
+	}
+	matches := b.occurrences(text)
+	if len(matches) == 0 {
+		return 0
+	}
+	primary := 0
+	for i, m := range matches {
+		if m.Contains(b.Cursor) {
+			primary = i
+			break
+		}
+	}
+	b.ExtraCursors = b.ExtraCursors[:0]
+	for i := range matches {
+		m := matches[i]
+		if i == primary {
+			b.Selection = &m
+			b.Cursor = m.End
+			continue
+		}
+		b.ExtraCursors = append(b.ExtraCursors, ExtraCursor{Cursor: m.End, Selection: &m})
+	}
+	return len(matches)
+}
+
+// AddCursorsToLineEnds replaces the selection with a cursor at the end of
+// each line it covers. A selection ending at the start of a line leaves that
+// line out.
+func (b *Buffer) AddCursorsToLineEnds() bool {
+	if b.Selection == nil || b.Selection.Empty() {
+		return false
+	}
+	sel := *b.Selection
+	last := sel.End.Line
+	if sel.End.Col == 0 && last > sel.Start.Line {
+		last--
+	}
+	b.Selection = nil
+	b.ExtraCursors = b.ExtraCursors[:0]
+	for l := sel.Start.Line; l < last; l++ {
+		b.ExtraCursors = append(b.ExtraCursors, ExtraCursor{Cursor: Cursor{Line: l, Col: RuneLen(b.Line(l))}})
+	}
+	b.Cursor = Cursor{Line: last, Col: RuneLen(b.Line(last))}
+	return true
+}
@@ -0,0 +1,148 @@
+package buffer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func checkCursors(t *testing.T, b *Buffer, want ...Cursor) {
+	t.Helper()
+	if got := b.Cursors(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("cursors = %v, want %v", got, want)
+	}
+}
+
+func TestEachCursorEditAndUndo(t *testing.T) {
+	b := NewBuffer(4)
+	b.SetLines([]string{"a b c", "d"})
+	b.Cursor = Cursor{Line: 0, Col: 5}
+	b.AddCursorAt(1, 1)
+	b.ExtraCursors = append(b.ExtraCursors, ExtraCursor{Cursor: Cursor{Line: 0, Col: 1}})
+	b.ExtraCursors = append(b.ExtraCursors, ExtraCursor{Cursor: Cursor{Line: 0, Col: 3}})
+
+	b.EachCursor(func() { b.InsertChar('!') })
+	if got := b.Text(); got != "a! b! c!\nd!" {
+		t.Fatalf("text = %q", got)
+	}
+	checkCursors(t, b, Cursor{0, 8}, Cursor{1, 2}, Cursor{0, 2}, Cursor{0, 5})
+
+	b.EachCursor(b.Backspace)
+	b.EachCursor(b.Backspace)
+	if got := b.Text(); got != "  \n" {
+		t.Fatalf("text after backspace = %q", got)
+	}
+
+	// Each edit undoes in one step with every cursor put back
+	b.ApplyUndo()
+	if got := b.Text(); got != "a b c\nd" {
+		t.Fatalf("text after undo = %q", got)
+	}
+	checkCursors(t, b, Cursor{0, 5}, Cursor{1, 1}, Cursor{0, 1}, Cursor{0, 3})
+	b.ApplyUndo()
+	if got := b.Text(); got != "a! b! c!\nd!" {
+		t.Fatalf("text after second undo = %q", got)
+	}
+	checkCursors(t, b, Cursor{0, 8}, Cursor{1, 2}, Cursor{0, 2}, Cursor{0, 5})
+	b.ApplyUndo()
+	checkCursors(t, b, Cursor{0, 5}, Cursor{1, 1}, Cursor{0, 1}, Cursor{0, 3})
+
+	b.ApplyRedo()
+	if got := b.Text(); got != "a! b! c!\nd!" {
+		t.Fatalf("text after redo = %q", got)
+	}
+	checkCursors(t, b, Cursor{0, 8}, Cursor{1, 2}, Cursor{0, 2}, Cursor{0, 5})
+}
+
+func TestEachCursorMergesCursors(t *testing.T) {
+	b := NewBuffer(4)
+	b.SetLines([]string{"ab"})
+	b.Cursor = Cursor{Line: 0, Col: 2}
+	b.ExtraCursors = append(b.ExtraCursors, ExtraCursor{Cursor: Cursor{Line: 0, Col: 1}})
+
+	// Backspacing past the other cursor deletes what it would have
+	b.EachCursor(b.DeleteWordBackward)
+	if got := b.Text(); got != "" {
+		t.Fatalf("text = %q", got)
+	}
+	checkCursors(t, b, Cursor{0, 0})
+}
+
+func TestEachCursorKeepsSelections(t *testing.T) {
+	b := NewBuffer(4)
+	b.SetLines([]string{"one two", "one two"})
+	b.Cursor = Cursor{Line: 0, Col: 3}
+	b.Selection = &Selection{Start: Cursor{Line: 0, Col: 0}, End: Cursor{Line: 0, Col: 3}}
+	b.ExtraCursors = append(b.ExtraCursors, ExtraCursor{
+		Cursor:    Cursor{Line: 1, Col: 3},
+		Selection: &Selection{Start: Cursor{Line: 1, Col: 0}, End: Cursor{Line: 1, Col: 3}},
+	})
+	b.EachCursor(func() { b.InsertChar('1') })
+	if got := b.Text(); got != "1 two\n1 two" {
+		t.Fatalf("text = %q", got)
+	}
+	if b.Selection != nil || b.ExtraCursors[0].Selection != nil {
+		t.Fatalf("selections kept after typing over them")
+	}
+	checkCursors(t, b, Cursor{0, 1}, Cursor{1, 1})
+}
+
+func TestSelectNextAndSkipOccurrence(t *testing.T) {
+	b := NewBuffer(4)
+	b.SetLines([]string{"foo x Foo", "foo foo"})
+	b.Cursor = Cursor{Line: 0, Col: 1}
+
+	// The first press selects the word
+	if !b.SelectNextOccurrence() || b.GetSelectedText() != "foo" || b.HasExtraCursors() {
+		t.Fatalf("first press: selection %v, %d extra cursors", b.Selection, len(b.ExtraCursors))
+	}
+	if !b.SelectNextOccurrence() {
+		t.Fatalf("second press found nothing")
+	}
+	want := Selection{Start: Cursor{Line: 0, Col: 6}, End: Cursor{Line: 0, Col: 9}}
+	if got := *b.ExtraCursors[0].Selection; got != want {
+		t.Fatalf("second occurrence = %v, want %v", got, want)
+	}
+
+	// Skipping moves the added selection on
+	if !b.SkipOccurrence() {
+		t.Fatalf("skip found nothing")
+	}
+	want = Selection{Start: Cursor{Line: 1, Col: 0}, End: Cursor{Line: 1, Col: 3}}
+	if got := *b.ExtraCursors[0].Selection; got != want || len(b.ExtraCursors) != 1 {
+		t.Fatalf("after skip = %v, want %v", got, want)
+	}
+
+	b.SelectNextOccurrence()
+	b.SelectNextOccurrence()
+	if b.SelectNextOccurrence() {
+		t.Fatalf("found an occurrence after all were selected")
+	}
+	b.EachCursor(func() { b.InsertChar('z') })
+	if got := b.Text(); got != "z x z\nz z" {
+		t.Fatalf("text = %q", got)
+	}
+}
+
+func TestSelectAllOccurrences(t *testing.T) {
+	b := NewBuffer(4)
+	b.SetLines([]string{"ab ab", "xab"})
+	b.Cursor = Cursor{Line: 0, Col: 4}
+	if n := b.SelectAllOccurrences(); n != 3 {
+		t.Fatalf("selected %d, want 3", n)
+	}
+	// The occurrence under the cursor stays primary
+	checkCursors(t, b, Cursor{0, 5}, Cursor{0, 2}, Cursor{1, 3})
+}
+
+func TestAddCursorsToLineEnds(t *testing.T) {
+	b := NewBuffer(4)
+	b.SetLines([]string{"one", "two", "three", "four"})
+	b.Selection = &Selection{Start: Cursor{Line: 0, Col: 1}, End: Cursor{Line: 3, Col: 0}}
+	if !b.AddCursorsToLineEnds() {
+		t.Fatalf("no cursors added")
+	}
+	if b.Selection != nil {
+		t.Fatalf("selection kept")
+	}
+	checkCursors(t, b, Cursor{2, 5}, Cursor{0, 3}, Cursor{1, 3})
+}
@@ -0,0 +1,328 @@
+package buffer
+
+import "unicode/utf8"
+
+// ropeLeafMax is the most lines a rope leaf holds. Leaves are copied on
+// every edit, so they stay small; the tree above them keeps lookups and
+// edits logarithmic in the number of lines.
+const ropeLeafMax = 64
+
+// ropeHashBase is the multiplier of the polynomial content hash (the 64-bit
+// FNV prime). Arithmetic wraps modulo 2^64.
+const ropeHashBase = 1099511628211
+
+// ropeLine is one line of text with its cached rune count and hash.
+type ropeLine struct {
+	text  string
+	runes int
+	hash  uint64
+	eol   string // line break after it in a mixed-ending file; "" for the buffer's LineEnding
+}
+
+func newRopeLine(s string) ropeLine {
+	// FNV-1a
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= ropeHashBase
+	}
+	return ropeLine{text: s, runes: utf8.RuneCountInString(s), hash: h}
+}
+
+// rope is an immutable AVL-balanced tree of lines. Edits return a new rope
+// that shares every untouched subtree with the old one, so an old version
+// (the saved state) costs nothing to keep. Each node caches the line count,
+// the rune count and a hash of its lines; the hash doesn't depend on the
+// tree's shape, so equal content has equal hashes.
+type rope struct {
+	left, right *rope
+	lines       []ropeLine // leaves only
+
+	count  int    // lines
+	runes  int    // runes of all lines, not counting separators
+	hash   uint64 // sum of line hashes times ropeHashBase^(lines after it)
+	pow    uint64 // ropeHashBase^count
+	height int    // 1 for leaves
+}
+
+// newRopeLeaf copies lines into a leaf; the caller may reuse the slice.
+func newRopeLeaf(lines []ropeLine) *rope {
+	if len(lines) == 0 {
+		return nil
+	}
+	r := &rope{lines: append([]ropeLine(nil), lines...), count: len(lines), pow: 1, height: 1}
+	for _, l := range lines {
+		r.runes += l.runes
+		r.hash = r.hash*ropeHashBase + l.hash
+		r.pow *= ropeHashBase
+	}
+	return r
+}
+
+func newRopeBranch(l, r *rope) *rope {
+	h := l.height
+	if r.height > h {
+		h = r.height
+	}
+	return &rope{
+		left:   l,
+		right:  r,
+		count:  l.count + r.count,
+		runes:  l.runes + r.runes,
+		hash:   l.hash*r.pow + r.hash,
+		pow:    l.pow * r.pow,
+		height: h + 1,
+	}
+}
+
+// newRope builds a balanced rope from lines.
+func newRope(lines []string) *rope {
+	return newRopeEOL(lines, nil)
+}
+
+// newRopeEOL builds a balanced rope from lines whose line breaks are in
+// eols, as returned by splitLines. A nil eols leaves them all "".
+func newRopeEOL(lines, eols []string) *rope {
+	leaves := make([]*rope, 0, len(lines)/ropeLeafMax+1)
+	chunk := make([]ropeLine, 0, ropeLeafMax)
+	for i, s := range lines {
+		l := newRopeLine(s)
+		if eols != nil {
+			l.eol = eols[i]
+		}
+		chunk = append(chunk, l)
+		if len(chunk) == ropeLeafMax {
+			leaves = append(leaves, newRopeLeaf(chunk))
+			chunk = chunk[:0]
+		}
+	}
+	if len(chunk) > 0 {
+		leaves = append(leaves, newRopeLeaf(chunk))
+	}
+	return buildRope(leaves)
+}
+
+func buildRope(nodes []*rope) *rope {
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	}
+	mid := len(nodes) / 2
+	return newRopeBranch(buildRope(nodes[:mid]), buildRope(nodes[mid:]))
+}
+
+func (r *rope) Len() int {
+	if r == nil {
+		return 0
+	}
+	return r.count
+}
+
+func (r *rope) isLeaf() bool { return r.height == 1 }
+
+// line returns line i, which must be in range.
+func (r *rope) line(i int) ropeLine {
+	for !r.isLeaf() {
+		if i < r.left.count {
+			r = r.left
+		} else {
+			i -= r.left.count
+			r = r.right
+		}
+	}
+	return r.lines[i]
+}
+
+// set returns a rope with line i replaced, copying only the path to it.
+func (r *rope) set(i int, l ropeLine) *rope {
+	if r.isLeaf() {
+		lines := append([]ropeLine(nil), r.lines...)
+		lines[i] = l
+		return newRopeLeaf(lines)
+	}
+	if i < r.left.count {
+		return newRopeBranch(r.left.set(i, l), r.right)
+	}
+	return newRopeBranch(r.left, r.right.set(i-r.left.count, l))
+}
+
+// each calls fn for lines [from, to) in order, stopping early if fn returns
+// false.
+func (r *rope) each(from, to int, fn func(i int, l ropeLine) bool) bool {
+	if r == nil || from >= to || to <= 0 || from >= r.count {
+		return true
+	}
+	if r.isLeaf() {
+		if from < 0 {
+			from = 0
+		}
+		if to > r.count {
+			to = r.count
+		}
+		for i := from; i < to; i++ {
+			if !fn(i, r.lines[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	n := r.left.count
+	if !r.left.each(from, to, fn) {
+		return false
+	}
+	return r.right.each(from-n, to-n, func(i int, l ropeLine) bool { return fn(i+n, l) })
+}
+
+// split returns the first i lines and the rest.
+func (r *rope) split(i int) (*rope, *rope) {
+	if r == nil {
+		return nil, nil
+	}
+	if i <= 0 {
+		return nil, r
+	}
+	if i >= r.count {
+		return r, nil
+	}
+	if r.isLeaf() {
+		return newRopeLeaf(r.lines[:i]), newRopeLeaf(r.lines[i:])
+	}
+	if i <= r.left.count {
+		a, b := r.left.split(i)
+		return a, joinRopes(b, r.right)
+	}
+	a, b := r.right.split(i - r.left.count)
+	return joinRopes(r.left, a), b
+}
+
+// joinRopes concatenates two ropes, keeping the result balanced.
+func joinRopes(l, r *rope) *rope {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	if l.isLeaf() && r.isLeaf() && l.count+r.count <= ropeLeafMax {
+		lines := make([]ropeLine, 0, l.count+r.count)
+		return newRopeLeaf(append(append(lines, l.lines...), r.lines...))
+	}
+	switch {
+	case l.height > r.height+1:
+		return rebalanceRopes(l.left, joinRopes(l.right, r))
+	case r.height > l.height+1:
+		return rebalanceRopes(joinRopes(l, r.left), r.right)
+	}
+	return newRopeBranch(l, r)
+}
+
+// rebalanceRopes joins two balanced ropes whose heights differ by at most
+// two, rotating as needed.
+func rebalanceRopes(l, r *rope) *rope {
+	switch {
+	case l.height > r.height+1:
+		if l.left.height >= l.right.height {
+			return newRopeBranch(l.left, newRopeBranch(l.right, r))
+		}
+		lr := l.right
+		return newRopeBranch(newRopeBranch(l.left, lr.left), newRopeBranch(lr.right, r))
+	case r.height > l.height+1:
+		if r.right.height >= r.left.height {
+			return newRopeBranch(newRopeBranch(l, r.left), r.right)
+		}
+		rl := r.left
+		return newRopeBranch(newRopeBranch(l, rl.left), newRopeBranch(rl.right, r.right))
+	}
+	return newRopeBranch(l, r)
+}
+
+// replace returns a rope with lines [from, to) replaced by lines.
+func (r *rope) replace(from, to int, lines []ropeLine) *rope {
+	head, rest := r.split(from)
+	_, tail := rest.split(to - from)
+	var mid *rope
+	if len(lines) <= ropeLeafMax {
+		mid = newRopeLeaf(lines)
+	} else {
+		leaves := make([]*rope, 0, len(lines)/ropeLeafMax+1)
+		for i := 0; i < len(lines); i += ropeLeafMax {
+			end := i + ropeLeafMax
+			if end > len(lines) {
+				end = len(lines)
+			}
+			leaves = append(leaves, newRopeLeaf(lines[i:end]))
+		}
+		mid = buildRope(leaves)
+	}
+	return joinRopes(joinRopes(head, mid), tail)
+}
+
+// offset returns the rune offset of the start of line i, counting one rune
+// per line separator.
+func (r *rope) offset(i int) int {
+	off := 0
+	for r != nil && i > 0 {
+		if r.isLeaf() {
+			for _, l := range r.lines[:i] {
+				off += l.runes + 1
+			}
+			return off
+		}
+		if i < r.left.count {
+			r = r.left
+			continue
+		}
+		off += r.left.runes + r.left.count
+		i -= r.left.count
+		r = r.right
+	}
+	return off
+}
+
+// lineAt returns the line containing rune offset off and the offset of that
+// line's start. Offsets past the end map to the last line.
+func (r *rope) lineAt(off int) (line, start int) {
+	for r != nil {
+		if r.isLeaf() {
+			for i, l := range r.lines {
+				if off <= l.runes || i == len(r.lines)-1 {
+					return line + i, start
+				}
+				off -= l.runes + 1
+				start += l.runes + 1
+			}
+		}
+		leftLen := r.left.runes + r.left.count // including the separator after it
+		if off < leftLen {
+			r = r.left
+			continue
+		}
+		off -= leftLen
+		start += leftLen
+		line += r.left.count
+		r = r.right
+	}
+	return line, start
+}
+
+// ropesEqual reports whether two ropes hold the same lines. Differing sizes
+// or hashes settle it at once; only equal hashes need a full comparison.
+func ropesEqual(a, b *rope) bool {
+	if a == b {
+		return true
+	}
+	if a.Len() != b.Len() || a == nil || b == nil {
+		return false
+	}
+	if a.runes != b.runes || a.hash != b.hash {
+		return false
+	}
+	equal := true
+	a.each(0, a.count, func(i int, l ropeLine) bool {
+		equal = l.text == b.line(i).text
+		return equal
+	})
+	return equal
+}
@@ -0,0 +1,129 @@
+package buffer
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// checkRope verifies the cached fields and the AVL invariant of every node.
+func checkRope(t *testing.T, r *rope) {
+	t.Helper()
+	if r == nil {
+		return
+	}
+	if r.isLeaf() {
+		if len(r.lines) == 0 || len(r.lines) > ropeLeafMax || r.count != len(r.lines) {
+			t.Fatalf("bad leaf with %d lines (count %d)", len(r.lines), r.count)
+		}
+		return
+	}
+	checkRope(t, r.left)
+	checkRope(t, r.right)
+	if d := r.left.height - r.right.height; d < -1 || d > 1 {
+		t.Fatalf("unbalanced node: heights %d and %d", r.left.height, r.right.height)
+	}
+	if r.count != r.left.count+r.right.count || r.runes != r.left.runes+r.right.runes {
+		t.Fatalf("stale counts in branch")
+	}
+}
+
+func TestRopeMatchesSliceModel(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var model []string
+	for i := 0; i < 1000; i++ {
+		model = append(model, fmt.Sprintf("line %d é", i))
+	}
+	b := NewBuffer(4)
+	b.SetLines(append([]string(nil), model...))
+
+	for step := 0; step < 2000; step++ {
+		from := rng.Intn(len(model))
+		to := from + rng.Intn(150)
+		if to > len(model) {
+			to = len(model)
+		}
+		var repl []string
+		for n := rng.Intn(150); n > 0; n-- {
+			repl = append(repl, fmt.Sprintf("s%d-%d", step, n))
+		}
+		if rng.Intn(3) == 0 {
+			b.SetLine(from, "set")
+			model[from] = "set"
+		} else {
+			b.ReplaceLines(from, to, repl...)
+			model = append(model[:from], append(repl, model[to:]...)...)
+			if len(model) == 0 {
+				model = []string{""}
+			}
+		}
+		if b.LineCount() != len(model) {
+			t.Fatalf("step %d: expected %d lines, got %d", step, len(model), b.LineCount())
+		}
+	}
+	checkRope(t, b.text)
+
+	if got, want := b.Text(), strings.Join(model, "\n"); got != want {
+		t.Fatalf("rope text differs from the model")
+	}
+	for _, i := range []int{0, len(model) / 2, len(model) - 1} {
+		if b.Line(i) != model[i] {
+			t.Fatalf("line %d: expected %q, got %q", i, model[i], b.Line(i))
+		}
+	}
+	if got := b.LinesRange(10, 13); strings.Join(got, "|") != strings.Join(model[10:13], "|") {
+		t.Fatalf("unexpected range %q", got)
+	}
+	if want := len([]rune(strings.Join(model, "\n"))); b.RuneCount() != want {
+		t.Fatalf("expected %d runes, got %d", want, b.RuneCount())
+	}
+}
+
+func TestOffsetRoundTrip(t *testing.T) {
+	b := NewBuffer(4)
+	lines := make([]string, 300)
+	for i := range lines {
+		lines[i] = strings.Repeat("ü", i%7)
+	}
+	b.SetLines(lines)
+	off := 0
+	for i, line := range lines {
+		for col := 0; col <= RuneLen(line); col++ {
+			pos := Cursor{Line: i, Col: col}
+			if got := b.Offset(pos); got != off+col {
+				t.Fatalf("Offset(%v) = %d, want %d", pos, got, off+col)
+			}
+			if got := b.PosAt(off + col); got != pos {
+				t.Fatalf("PosAt(%d) = %v, want %v", off+col, got, pos)
+			}
+		}
+		off += RuneLen(line) + 1
+	}
+}
+
+func TestDirtyTrackingComparesContent(t *testing.T) {
+	b := NewBuffer(4)
+	b.SetLines([]string{"alpha", "beta", "gamma"})
+	b.MarkSaved()
+
+	b.Cursor = Cursor{Line: 1, Col: 4}
+	b.InsertChar('!')
+	b.RecomputeDirty()
+	if !b.Dirty {
+		t.Fatalf("expected buffer to be dirty after an edit")
+	}
+	b.Backspace()
+	b.RecomputeDirty()
+	if b.Dirty {
+		t.Fatalf("expected buffer to be clean once the edit is reverted")
+	}
+
+	b.InsertNewline()
+	b.RecomputeDirty()
+	b.ApplyUndo()
+	b.RecomputeDirty()
+	if b.Dirty || b.Text() != "alpha\nbeta\ngamma" {
+		t.Fatalf("expected undo to restore the saved text, got %q (dirty %v)", b.Text(), b.Dirty)
+	}
+}
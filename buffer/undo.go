@@ -1,41 +1,103 @@
 package buffer
 
-import "time"
+import (
+	"errors"
+	"sort"
+	"time"
+)
 
 type OpType int
 
 const (
 	OpInsert OpType = iota
 	OpDelete
+	OpLineEndings // a line ending conversion, see Operation.Endings
 )
 
 type Operation struct {
-	Type   OpType
-	Pos    Cursor
-	Text   string
-	Before Cursor    // cursor position before op
-	Time   time.Time // when the operation was recorded
-	Group  int       // group ID for batched undo (0 = ungrouped)
+	Type   OpType    `json:"type"`
+	Pos    Cursor    `json:"pos"`
+	Text   string    `json:"text"`
+	Before Cursor    `json:"before"` // cursor position before op
+	Time   time.Time `json:"time"`   // when the operation was recorded
+	Group  int       `json:"group"`  // group ID for batched undo (0 = ungrouped)
+
+	// Set on the first operation of a multi-cursor edit: every cursor
+	// before and after it, primary first, for undo and redo to restore.
+	Cursors      []Cursor `json:"cursors,omitempty"`
+	CursorsAfter []Cursor `json:"cursors_after,omitempty"`
+
+	// Endings is the conversion an OpLineEndings operation made.
+	Endings *LineEndingChange `json:"endings,omitempty"`
 }
 
+// undoState is one state of the text in the undo tree. Undoing goes to the
+// parent; redoing follows redo, the child last left by undoing, so an edit
+// made after undoing starts a new branch instead of discarding the old one.
+type undoState struct {
+	id       int // creation order; the first state is 0
+	parent   *undoState
+	children []*undoState
+	redo     *undoState
+	ops      []*Operation // the edit from the parent's text, oldest first
+}
+
+// UndoStack is a buffer's undo history. Despite the name it is a tree of
+// every state the text has been in; undo and redo move along the branch
+// last visited.
 type UndoStack struct {
-	undos     []Operation
-	redos     []Operation
-	nextGroup int // next group ID to assign
+	root, cur *undoState
+	nextID    int
+	created   time.Time    // when the root state was current
+	undos     []*Operation // the edits from the root to cur, oldest first
+	nextGroup int          // next group ID to assign
+	group     int          // group every push joins while non-zero, see BeginGroup
+	depth     int          // BeginGroup calls not yet ended
+}
+
+// UndoState describes a state of the undo tree.
+type UndoState struct {
+	ID      int
+	Parent  int       // ID of the state it was edited from; -1 for the first
+	Time    time.Time // when the edit leading to it was made
+	Current bool
+	Ops     []Operation // the edit from the parent, oldest first
+}
+
+// UndoHistory is the undo tree of an UndoStack, for keeping it between
+// sessions. States are in the order they were made, the first being the
+// text the history starts from.
+type UndoHistory struct {
+	States    []SavedUndoState `json:"states"`
+	Current   int              `json:"current"` // index into States
+	Created   time.Time        `json:"created"`
+	NextGroup int              `json:"next_group"`
+}
+
+// SavedUndoState is a state of an UndoHistory.
+type SavedUndoState struct {
+	Parent int         `json:"parent"` // index into States; -1 for the first
+	Redo   int         `json:"redo"`   // child redo goes to; -1 for none
+	Ops    []Operation `json:"ops,omitempty"`
 }
 
 const undoGroupInterval = 300 * time.Millisecond
 
 func NewUndoStack() *UndoStack {
-	return &UndoStack{nextGroup: 1}
+	root := &undoState{}
+	return &UndoStack{root: root, cur: root, nextID: 1, created: time.Now(), nextGroup: 1}
 }
 
 func (u *UndoStack) Push(op Operation) {
 	op.Time = time.Now()
+	if u.group != 0 {
+		op.Group = u.group
+		u.add(op)
+		return
+	}
 
 	// Auto-group sequential single-character inserts/deletes within the time window
-	if len(u.undos) > 0 {
-		prev := &u.undos[len(u.undos)-1]
+	if prev := u.tip(); prev != nil {
 		if prev.Type == op.Type && len(op.Text) == 1 && len(prev.Text) == 1 &&
 			op.Time.Sub(prev.Time) < undoGroupInterval &&
 			!isGroupBreak(prev, &op) {
@@ -47,16 +109,41 @@ func (u *UndoStack) Push(op Operation) {
 		}
 	}
 
-	u.undos = append(u.undos, op)
-	u.redos = u.redos[:0]
+	u.add(op)
 }
 
 // PushGrouped pushes an operation with a specific group ID (for atomic ops like paste, indent).
 func (u *UndoStack) PushGrouped(op Operation, groupID int) {
 	op.Time = time.Now()
 	op.Group = groupID
-	u.undos = append(u.undos, op)
-	u.redos = u.redos[:0]
+	if u.group != 0 {
+		op.Group = u.group
+	}
+	u.add(op)
+}
+
+// tip returns the last operation of the current state if more can join
+// it: it has to be the newest state on its branch.
+func (u *UndoStack) tip() *Operation {
+	if u.cur == u.root || len(u.cur.children) > 0 {
+		return nil
+	}
+	return u.undos[len(u.undos)-1]
+}
+
+// add records op, joining the current state if op is in its group or
+// making a new state after it.
+func (u *UndoStack) add(op Operation) {
+	if prev := u.tip(); prev == nil || op.Group == 0 || prev.Group != op.Group {
+		s := &undoState{id: u.nextID, parent: u.cur}
+		u.nextID++
+		u.cur.children = append(u.cur.children, s)
+		u.cur.redo = nil
+		u.cur = s
+	}
+	p := &op
+	u.cur.ops = append(u.cur.ops, p)
+	u.undos = append(u.undos, p)
 }
 
 // NewGroup returns a fresh group ID for batching multiple operations as one undo.
@@ -66,6 +153,41 @@ func (u *UndoStack) NewGroup() int {
 	return id
 }
 
+// BeginGroup starts a group that every operation pushed joins until
+// EndGroup, so an edit made of other edits undoes in one step. Groups begun
+// inside a group are part of it.
+func (u *UndoStack) BeginGroup() int {
+	if u.depth == 0 {
+		u.group = u.NewGroup()
+	}
+	u.depth++
+	return u.group
+}
+
+// EndGroup ends the group started by BeginGroup.
+func (u *UndoStack) EndGroup() {
+	if u.depth > 0 {
+		u.depth--
+	}
+	if u.depth == 0 {
+		u.group = 0
+	}
+}
+
+// Grouping reports whether a group begun with BeginGroup is open.
+func (u *UndoStack) Grouping() bool {
+	return u.depth > 0
+}
+
+// groupStart returns the first operation of group id if the edit that led
+// to the current state is that group, or nil.
+func (u *UndoStack) groupStart(id int) *Operation {
+	if u.cur == u.root || u.cur.ops[0].Group != id {
+		return nil
+	}
+	return u.cur.ops[0]
+}
+
 // isGroupBreak returns true if consecutive ops should NOT be grouped
 // (e.g., space/newline breaks a word group, or non-adjacent positions).
 func isGroupBreak(prev, cur *Operation) bool {
@@ -86,45 +208,250 @@ func isGroupBreak(prev, cur *Operation) bool {
 	return false
 }
 
-func (u *UndoStack) CanUndo() bool { return len(u.undos) > 0 }
-func (u *UndoStack) CanRedo() bool { return len(u.redos) > 0 }
-
-// PopUndo pops the top operation and all others in the same group.
-func (u *UndoStack) PopUndo() (Operation, bool) {
+// LastGroup returns the group ID of the most recent undoable operation, or 0
+// if there is none or it is ungrouped.
+func (u *UndoStack) LastGroup() int {
 	if len(u.undos) == 0 {
-		return Operation{}, false
+		return 0
+	}
+	return u.undos[len(u.undos)-1].Group
+}
+
+func (u *UndoStack) CanUndo() bool { return u.cur != u.root }
+func (u *UndoStack) CanRedo() bool { return u.cur.redo != nil }
+
+func copyOps(ops []*Operation) []Operation {
+	out := make([]Operation, len(ops))
+	for i, op := range ops {
+		out[i] = *op
+	}
+	return out
+}
+
+// undo moves to the parent state and returns the edit that led from it,
+// oldest operation first.
+func (u *UndoStack) undo() ([]Operation, bool) {
+	s := u.cur
+	if s == u.root {
+		return nil, false
+	}
+	s.parent.redo = s
+	u.cur = s.parent
+	u.undos = u.undos[:len(u.undos)-len(s.ops)]
+	return copyOps(s.ops), true
+}
+
+// redo moves to the child state last undone from and returns the edit that
+// leads to it, oldest operation first.
+func (u *UndoStack) redo() ([]Operation, bool) {
+	s := u.cur.redo
+	if s == nil {
+		return nil, false
+	}
+	u.cur = s
+	u.undos = append(u.undos, s.ops...)
+	return copyOps(s.ops), true
+}
+
+// stateTime returns when s became a state of the text.
+func (u *UndoStack) stateTime(s *undoState) time.Time {
+	if len(s.ops) == 0 {
+		return u.created
+	}
+	return s.ops[len(s.ops)-1].Time
+}
+
+// all returns every state in creation order.
+func (u *UndoStack) all() []*undoState {
+	states := []*undoState{u.root}
+	for i := 0; i < len(states); i++ {
+		states = append(states, states[i].children...)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].id < states[j].id })
+	return states
+}
+
+func (u *UndoStack) find(id int) *undoState {
+	for _, s := range u.all() {
+		if s.id == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// States returns every state of the tree in the order they were made.
+func (u *UndoStack) States() []UndoState {
+	all := u.all()
+	states := make([]UndoState, len(all))
+	for i, s := range all {
+		states[i] = UndoState{ID: s.id, Parent: -1, Time: u.stateTime(s), Current: s == u.cur, Ops: copyOps(s.ops)}
+		if s.parent != nil {
+			states[i].Parent = s.parent.id
+		}
 	}
-	op := u.undos[len(u.undos)-1]
-	u.undos = u.undos[:len(u.undos)-1]
-	u.redos = append(u.redos, op)
+	return states
+}
+
+// CurrentState returns the ID of the current state.
+func (u *UndoStack) CurrentState() int {
+	return u.cur.id
+}
 
-	// If grouped, also pop all preceding ops in the same group
-	if op.Group != 0 {
-		for len(u.undos) > 0 && u.undos[len(u.undos)-1].Group == op.Group {
-			grouped := u.undos[len(u.undos)-1]
-			u.undos = u.undos[:len(u.undos)-1]
-			u.redos = append(u.redos, grouped)
+// StateAt returns the ID of the state the text was last brought to by an
+// edit made at or before t, or of the first state if there is none.
+func (u *UndoStack) StateAt(t time.Time) int {
+	var best *undoState
+	for _, s := range u.all() {
+		if at := u.stateTime(s); !at.After(t) && (best == nil || !at.Before(u.stateTime(best))) {
+			best = s
 		}
 	}
-	return op, true
+	if best == nil {
+		return u.root.id
+	}
+	return best.id
 }
 
-// PopRedo pops the top redo operation and all others in the same group.
-func (u *UndoStack) PopRedo() (Operation, bool) {
-	if len(u.redos) == 0 {
-		return Operation{}, false
+// History returns a copy of the undo tree.
+func (u *UndoStack) History() UndoHistory {
+	all := u.all()
+	index := make(map[*undoState]int, len(all))
+	for i, s := range all {
+		index[s] = i
+	}
+	h := UndoHistory{States: make([]SavedUndoState, len(all)), Current: index[u.cur], Created: u.created, NextGroup: u.nextGroup}
+	for i, s := range all {
+		saved := SavedUndoState{Parent: -1, Redo: -1, Ops: copyOps(s.ops)}
+		if s.parent != nil {
+			saved.Parent = index[s.parent]
+		}
+		if s.redo != nil {
+			saved.Redo = index[s.redo]
+		}
+		h.States[i] = saved
 	}
-	op := u.redos[len(u.redos)-1]
-	u.redos = u.redos[:len(u.redos)-1]
-	u.undos = append(u.undos, op)
+	return h
+}
 
-	// If grouped, also pop all following ops in the same group
-	if op.Group != 0 {
-		for len(u.redos) > 0 && u.redos[len(u.redos)-1].Group == op.Group {
-			grouped := u.redos[len(u.redos)-1]
-			u.redos = u.redos[:len(u.redos)-1]
-			u.undos = append(u.undos, grouped)
+// SetHistory replaces the undo tree with h, which must have been taken from
+// a buffer whose text is that of h's current state.
+func (u *UndoStack) SetHistory(h UndoHistory) error {
+	if len(h.States) == 0 || h.States[0].Parent != -1 || h.Current < 0 || h.Current >= len(h.States) {
+		return errors.New("invalid undo history")
+	}
+	states := make([]*undoState, len(h.States))
+	nextGroup := max(h.NextGroup, 1)
+	for i, saved := range h.States {
+		s := &undoState{id: i}
+		if i > 0 {
+			if saved.Parent < 0 || saved.Parent >= i || len(saved.Ops) == 0 {
+				return errors.New("invalid undo history")
+			}
+			s.parent = states[saved.Parent]
+			s.parent.children = append(s.parent.children, s)
+		}
+		for _, op := range saved.Ops {
+			s.ops = append(s.ops, &op)
+			nextGroup = max(nextGroup, op.Group+1)
+		}
+		states[i] = s
+	}
+	for i, saved := range h.States {
+		if saved.Redo < 0 {
+			continue
+		}
+		if saved.Redo >= len(states) || states[saved.Redo].parent != states[i] {
+			return errors.New("invalid undo history")
 		}
+		states[i].redo = states[saved.Redo]
+	}
+
+	u.root, u.cur = states[0], states[h.Current]
+	u.nextID = len(states)
+	u.created = h.Created
+	u.nextGroup = nextGroup
+	u.group, u.depth = 0, 0
+	u.undos = u.undos[:0]
+	var path []*undoState
+	for s := u.cur; s != u.root; s = s.parent {
+		path = append(path, s)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		u.undos = append(u.undos, path[i].ops...)
+	}
+	return nil
+}
+
+// TrimHistory drops edits until at most n operations are left, never
+// splitting one. Branches off the line undo and redo follow go first,
+// oldest first, then the oldest edits on that line.
+func (u *UndoStack) TrimHistory(n int) {
+	all := u.all()
+	total := 0
+	for _, s := range all {
+		total += len(s.ops)
+	}
+	if total <= n {
+		return
+	}
+
+	line := make(map[*undoState]bool)
+	for s := u.cur; s != nil; s = s.parent {
+		line[s] = true
+	}
+	for s := u.cur.redo; s != nil; s = s.redo {
+		line[s] = true
+	}
+	for _, s := range all {
+		if total <= n {
+			return
+		}
+		if line[s] || !line[s.parent] {
+			continue
+		}
+		total -= subtreeOps(s)
+		p := s.parent
+		for i, c := range p.children {
+			if c == s {
+				p.children = append(p.children[:i], p.children[i+1:]...)
+				break
+			}
+		}
+		if p.redo == s {
+			p.redo = nil
+		}
+	}
+
+	// Now the tree is a single line: the oldest edits go, then the newest
+	// ones redo would bring back
+	for total > n && u.root != u.cur {
+		next := u.cur
+		for next.parent != u.root {
+			next = next.parent
+		}
+		total -= len(next.ops)
+		u.created = u.stateTime(next)
+		u.undos = u.undos[len(next.ops):]
+		next.ops = nil
+		next.parent = nil
+		u.root = next
+	}
+	for total > n && u.cur.redo != nil {
+		last := u.cur
+		for last.redo != nil {
+			last = last.redo
+		}
+		total -= len(last.ops)
+		last.parent.children = nil
+		last.parent.redo = nil
+	}
+}
+
+func subtreeOps(s *undoState) int {
+	n := len(s.ops)
+	for _, c := range s.children {
+		n += subtreeOps(c)
 	}
-	return op, true
+	return n
 }
@@ -20,17 +20,17 @@ func TestUndoGroupedInsertPasteLikeSequence(t *testing.T) {
 	for _, ch := range "ock" {
 		b.InsertChar(ch)
 	}
-	if got := b.Lines[0]; got != "blockock" {
+	if got := b.Line(0); got != "blockock" {
 		t.Fatalf("expected blockock before undo, got %q", got)
 	}
 
 	b.ApplyUndo()
-	if got := b.Lines[0]; got != "block" {
+	if got := b.Line(0); got != "block" {
 		t.Fatalf("expected block after undo, got %q", got)
 	}
 
 	b.ApplyRedo()
-	if got := b.Lines[0]; got != "blockock" {
+	if got := b.Line(0); got != "blockock" {
 		t.Fatalf("expected blockock after redo, got %q", got)
 	}
 }
@@ -40,17 +40,163 @@ func TestUndoRedoSingleGroupedWordInsert(t *testing.T) {
 	for _, ch := range "block" {
 		b.InsertChar(ch)
 	}
-	if got := b.Lines[0]; got != "block" {
+	if got := b.Line(0); got != "block" {
 		t.Fatalf("expected block before undo, got %q", got)
 	}
 
 	b.ApplyUndo()
-	if got := b.Lines[0]; got != "" {
+	if got := b.Line(0); got != "" {
 		t.Fatalf("expected empty line after undo, got %q", got)
 	}
 
 	b.ApplyRedo()
-	if got := b.Lines[0]; got != "block" {
+	if got := b.Line(0); got != "block" {
 		t.Fatalf("expected block after redo, got %q", got)
 	}
 }
+
+func TestApplyEditsIsOneUndoStep(t *testing.T) {
+	b := NewBuffer(4)
+	b.SetLines([]string{"foo := 1", "bar(foo)", "return foo"})
+	b.MarkSaved()
+
+	b.ApplyEdits([]TextEdit{
+		{Start: Cursor{Line: 0, Col: 0}, End: Cursor{Line: 0, Col: 3}, NewText: "count"},
+		{Start: Cursor{Line: 2, Col: 7}, End: Cursor{Line: 2, Col: 10}, NewText: "count"},
+		{Start: Cursor{Line: 1, Col: 4}, End: Cursor{Line: 1, Col: 7}, NewText: "count"},
+	})
+	want := []string{"count := 1", "bar(count)", "return count"}
+	for i, line := range want {
+		if b.Line(i) != line {
+			t.Fatalf("line %d: expected %q, got %q", i, line, b.Line(i))
+		}
+	}
+	if !b.Dirty {
+		t.Fatalf("expected buffer to be dirty after edits")
+	}
+
+	b.ApplyUndo()
+	if got := b.Text(); got != "foo := 1\nbar(foo)\nreturn foo" {
+		t.Fatalf("expected all edits undone at once, got %q", got)
+	}
+	if b.Undo.CanUndo() {
+		t.Fatalf("expected no further undo steps")
+	}
+}
+
+func TestApplyEditsKeepsInsertOrder(t *testing.T) {
+	b := NewBuffer(4)
+	b.SetLines([]string{"fmt.Println()"})
+	at := Cursor{Line: 0, Col: 12}
+	b.ApplyEdits([]TextEdit{
+		{Start: at, End: at, NewText: "a"},
+		{Start: Cursor{Line: 0, Col: 0}, End: Cursor{Line: 0, Col: 3}, NewText: "log"},
+		{Start: at, End: at, NewText: ", b"},
+	})
+	if got := b.Line(0); got != "log.Println(a, b)" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestUndoTreeKeepsAbandonedBranch(t *testing.T) {
+	b := NewBuffer(4)
+	b.InsertText("one")
+	b.InsertText(" two")
+	first := b.Undo.CurrentState()
+	b.ApplyUndo()
+	b.InsertText(" 2")
+	if got := b.Text(); got != "one 2" {
+		t.Fatalf("text = %q", got)
+	}
+
+	// Undo goes back to the branch point, redo follows the newest branch
+	b.ApplyUndo()
+	b.ApplyRedo()
+	if got := b.Text(); got != "one 2" {
+		t.Fatalf("text after redo = %q", got)
+	}
+
+	if !b.GoToUndoState(first) {
+		t.Fatalf("state %d not found", first)
+	}
+	if got := b.Text(); got != "one two" || b.Undo.CurrentState() != first {
+		t.Fatalf("text on the old branch = %q", got)
+	}
+	if states := b.Undo.States(); len(states) != 4 || states[3].Parent != states[1].ID {
+		t.Fatalf("states = %+v", states)
+	}
+
+	b.GoToUndoState(0)
+	if got := b.Text(); got != "" || b.Dirty {
+		t.Fatalf("text at the first state = %q, dirty %v", got, b.Dirty)
+	}
+}
+
+func TestUndoStateAt(t *testing.T) {
+	b := NewBuffer(4)
+	b.InsertText("aa")
+	b.InsertText("bb")
+	b.InsertText("cc")
+	states := b.Undo.cur
+	base := time.Now().Add(-time.Hour)
+	for s, age := states, 0; s.parent != nil; s, age = s.parent, age+10 {
+		s.ops[0].Time = base.Add(-time.Duration(age) * time.Minute)
+	}
+	// "aabb" was reached 10 minutes before "aabbcc"
+	id := b.Undo.StateAt(base.Add(-5 * time.Minute))
+	b.GoToUndoState(id)
+	if got := b.Text(); got != "aabb" {
+		t.Fatalf("text 5 minutes back = %q", got)
+	}
+	if id := b.Undo.StateAt(base.Add(-time.Hour)); id != 0 {
+		t.Fatalf("state before any edit = %d", id)
+	}
+}
+
+func TestUndoHistoryRoundTrip(t *testing.T) {
+	b := NewBuffer(4)
+	b.InsertText("xx")
+	b.InsertText("yy")
+	b.ApplyUndo()
+	b.InsertText("zz")
+	b.ApplyUndo()
+
+	r := NewUndoStack()
+	if err := r.SetHistory(b.Undo.History()); err != nil {
+		t.Fatalf("set history: %v", err)
+	}
+	b.Undo = r
+	b.ApplyRedo()
+	if got := b.Text(); got != "xxzz" {
+		t.Fatalf("redo after restore = %q", got)
+	}
+	if len(r.States()) != 4 {
+		t.Fatalf("%d states after restore, want 4", len(r.States()))
+	}
+	if err := r.SetHistory(UndoHistory{States: []SavedUndoState{{Parent: -1}, {Parent: 3}}}); err == nil {
+		t.Fatalf("accepted a history with a bad parent")
+	}
+}
+
+func TestTrimHistoryKeepsGroupsWhole(t *testing.T) {
+	u := NewUndoStack()
+	u.Push(Operation{Type: OpInsert, Text: "a"})
+	g := u.NewGroup()
+	u.PushGrouped(Operation{Type: OpInsert, Text: "b"}, g)
+	u.PushGrouped(Operation{Type: OpInsert, Text: "c"}, g)
+	u.Push(Operation{Type: OpDelete, Text: "d"})
+
+	// Cutting into the group drops all of it
+	u.TrimHistory(2)
+	h := u.History()
+	if len(h.States) != 2 || len(h.States[1].Ops) != 1 || h.States[1].Ops[0].Text != "d" {
+		t.Fatalf("states after trim = %+v", h.States)
+	}
+
+	// A restored stack hands out group IDs past the ones it holds
+	r := NewUndoStack()
+	r.SetHistory(UndoHistory{States: []SavedUndoState{{Parent: -1, Redo: -1}, {Parent: 0, Redo: -1, Ops: []Operation{{Text: "x", Group: 7}}}}, Current: 1})
+	if id := r.NewGroup(); id != 8 {
+		t.Fatalf("new group = %d, want 8", id)
+	}
+}
@@ -12,8 +12,11 @@ import (
 
 var internalClipboard string
 
+// Write puts text on the system clipboard and at the front of the
+// clipboard history.
 func Write(text string) bool {
 	internalClipboard = text
+	record(text)
 	ok := false
 
 	if err := clipboard.WriteAll(text); err == nil {
@@ -0,0 +1,62 @@
+package clipboardx
+
+import "sync"
+
+// DefaultHistoryLimit is how many copies History keeps unless
+// SetHistoryLimit says otherwise.
+const DefaultHistoryLimit = 30
+
+var (
+	historyMu    sync.Mutex
+	history      []string // newest first
+	historyLimit = DefaultHistoryLimit
+)
+
+// record puts text at the front of the history, moving it there if it was
+// copied before.
+func record(text string) {
+	if text == "" {
+		return
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for i, h := range history {
+		if h == text {
+			history = append(history[:i], history[i+1:]...)
+			break
+		}
+	}
+	history = append([]string{text}, history...)
+	if len(history) > historyLimit {
+		history = history[:historyLimit]
+	}
+}
+
+// History returns the texts written to the clipboard, newest first.
+func History() []string {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	return append([]string(nil), history...)
+}
+
+// SetHistory replaces the history, newest first, as when restoring it from
+// an earlier session. The clipboard itself is left alone.
+func SetHistory(texts []string) {
+	historyMu.Lock()
+	history = nil
+	historyMu.Unlock()
+	for i := len(texts) - 1; i >= 0; i-- {
+		record(texts[i])
+	}
+}
+
+// SetHistoryLimit sets how many texts the history keeps; less than one
+// keeps none.
+func SetHistoryLimit(n int) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	historyLimit = max(n, 0)
+	if len(history) > historyLimit {
+		history = history[:historyLimit]
+	}
+}
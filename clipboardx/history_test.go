@@ -0,0 +1,24 @@
+package clipboardx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistoryKeepsNewestFirst(t *testing.T) {
+	defer SetHistoryLimit(DefaultHistoryLimit)
+	SetHistory(nil)
+	SetHistoryLimit(3)
+	for _, text := range []string{"a", "b", "c", "a", "", "d"} {
+		record(text)
+	}
+	// A repeated copy moves to the front and the oldest drops off
+	if got, want := History(), []string{"d", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("history = %q, want %q", got, want)
+	}
+
+	SetHistory([]string{"x", "y", "x", "z", "w"})
+	if got, want := History(), []string{"x", "y", "z"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("restored history = %q, want %q", got, want)
+	}
+}
@@ -2,8 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 )
@@ -21,6 +24,19 @@ type Config struct {
 	InsertFinalNewline bool    `json:"insert_final_newline"`
 	ImageTempTabs      bool    `json:"image_temp_tabs"`
 	ImageProtocol      string  `json:"image_protocol"`
+	LargeFileMB        int     `json:"large_file_mb"` // files above this open read-only in large-file mode
+
+	PreserveMixedLineEndings bool   `json:"preserve_mixed_line_endings"` // save each line of a mixed-ending file with its own ending
+	ClipboardHistorySize     int    `json:"clipboard_history_size"`      // copies and cuts kept for Paste from History
+	PersistClipboardHistory  bool   `json:"persist_clipboard_history"`   // keep the clipboard history across sessions
+	FileHistoryMB            int    `json:"file_history_mb"`             // space for saved versions of files, 0 to keep none
+	HotExit                  bool   `json:"hot_exit"`                    // quit without asking, keeping unsaved changes in the session
+	RenderWhitespace         string `json:"render_whitespace"`           // "none", "trailing" or "all": whitespace drawn with visible glyphs
+	Rulers                   []int  `json:"rulers"`                      // columns to draw vertical rulers at
+
+	// replaced holds the user's own values of settings a workspace
+	// overrides, which Save writes instead of the overrides.
+	replaced map[string]json.RawMessage
 }
 
 // LanguageTabSize returns the appropriate tab size for a given language.
@@ -50,318 +66,357 @@ func (c *Config) LanguageUseTabs(language string) bool {
 }
 
 type ColorScheme struct {
-	Name             string
-	Background       tcell.Color
-	Foreground       tcell.Color
-	Selection        tcell.Color
-	LineNumber       tcell.Color
-	LineNumberActive tcell.Color
-	StatusBarBg      tcell.Color
-	StatusBarFg      tcell.Color
-	StatusBarModeBg  tcell.Color
-	TabBarBg         tcell.Color
-	TabBarFg         tcell.Color
-	TabBarActiveBg   tcell.Color
-	TabBarActiveFg   tcell.Color
-	TreeHeaderFg     tcell.Color
-	TreeDirFg        tcell.Color
-	TreeFileFg       tcell.Color
-	TreeSelectionBg  tcell.Color
-	TreeBorder       tcell.Color
-	DialogBg         tcell.Color
-	DialogFg         tcell.Color
-	DialogInputBg    tcell.Color
-	IndentGuide      tcell.Color
+	Name              string
+	Background        tcell.Color
+	Foreground        tcell.Color
+	Selection         tcell.Color
+	LineNumber        tcell.Color
+	LineNumberActive  tcell.Color
+	StatusBarBg       tcell.Color
+	StatusBarFg       tcell.Color
+	StatusBarModeBg   tcell.Color
+	TabBarBg          tcell.Color
+	TabBarFg          tcell.Color
+	TabBarActiveBg    tcell.Color
+	TabBarActiveFg    tcell.Color
+	TreeHeaderFg      tcell.Color
+	TreeDirFg         tcell.Color
+	TreeFileFg        tcell.Color
+	TreeSelectionBg   tcell.Color
+	TreeBorder        tcell.Color
+	DialogBg          tcell.Color
+	DialogFg          tcell.Color
+	DialogInputBg     tcell.Color
+	IndentGuide       tcell.Color
+	IndentGuideActive tcell.Color
+	BracketColors     []tcell.Color
+	BracketUnmatched  tcell.Color
 }
 
 var Themes = map[string]*ColorScheme{
 	"dark": {
-		Name:             "Dark",
-		Background:       tcell.ColorBlack,
-		Foreground:       tcell.ColorWhite,
-		Selection:        tcell.ColorDarkBlue,
-		LineNumber:       tcell.ColorGray,
-		LineNumberActive: tcell.ColorWhite,
-		StatusBarBg:      tcell.ColorDarkBlue,
-		StatusBarFg:      tcell.ColorWhite,
-		StatusBarModeBg:  tcell.ColorBlue,
-		TabBarBg:         tcell.ColorBlack,
-		TabBarFg:         tcell.ColorGray,
-		TabBarActiveBg:   tcell.ColorDarkBlue,
-		TabBarActiveFg:   tcell.ColorWhite,
-		TreeHeaderFg:     tcell.ColorYellow,
-		TreeDirFg:        tcell.ColorBlue,
-		TreeFileFg:       tcell.ColorWhite,
-		TreeSelectionBg:  tcell.ColorDarkBlue,
-		TreeBorder:       tcell.ColorGray,
-		DialogBg:         tcell.ColorBlack,
-		DialogFg:         tcell.ColorWhite,
-		DialogInputBg:    tcell.ColorDarkBlue,
-		IndentGuide:      tcell.ColorDimGray,
+		Name:              "Dark",
+		Background:        tcell.ColorBlack,
+		Foreground:        tcell.ColorWhite,
+		Selection:         tcell.ColorDarkBlue,
+		LineNumber:        tcell.ColorGray,
+		LineNumberActive:  tcell.ColorWhite,
+		StatusBarBg:       tcell.ColorDarkBlue,
+		StatusBarFg:       tcell.ColorWhite,
+		StatusBarModeBg:   tcell.ColorBlue,
+		TabBarBg:          tcell.ColorBlack,
+		TabBarFg:          tcell.ColorGray,
+		TabBarActiveBg:    tcell.ColorDarkBlue,
+		TabBarActiveFg:    tcell.ColorWhite,
+		TreeHeaderFg:      tcell.ColorYellow,
+		TreeDirFg:         tcell.ColorBlue,
+		TreeFileFg:        tcell.ColorWhite,
+		TreeSelectionBg:   tcell.ColorDarkBlue,
+		TreeBorder:        tcell.ColorGray,
+		DialogBg:          tcell.ColorBlack,
+		DialogFg:          tcell.ColorWhite,
+		DialogInputBg:     tcell.ColorDarkBlue,
+		IndentGuide:       tcell.ColorDimGray,
+		IndentGuideActive: tcell.ColorGray,
+		BracketColors:     []tcell.Color{tcell.ColorGold, tcell.ColorOrchid, tcell.ColorDeepSkyBlue},
+		BracketUnmatched:  tcell.ColorRed,
 	},
 	"light": {
-		Name:             "Light",
-		Background:       tcell.ColorWhite,
-		Foreground:       tcell.ColorBlack,
-		Selection:        tcell.ColorLightBlue,
-		LineNumber:       tcell.ColorGray,
-		LineNumberActive: tcell.ColorBlack,
-		StatusBarBg:      tcell.ColorLightBlue,
-		StatusBarFg:      tcell.ColorBlack,
-		StatusBarModeBg:  tcell.ColorBlue,
-		TabBarBg:         tcell.ColorWhite,
-		TabBarFg:         tcell.ColorGray,
-		TabBarActiveBg:   tcell.ColorLightBlue,
-		TabBarActiveFg:   tcell.ColorBlack,
-		TreeHeaderFg:     tcell.ColorBlue,
-		TreeDirFg:        tcell.ColorBlue,
-		TreeFileFg:       tcell.ColorBlack,
-		TreeSelectionBg:  tcell.ColorLightBlue,
-		TreeBorder:       tcell.ColorGray,
-		DialogBg:         tcell.ColorWhite,
-		DialogFg:         tcell.ColorBlack,
-		DialogInputBg:    tcell.ColorLightGray,
-		IndentGuide:      tcell.ColorLightGray,
+		Name:              "Light",
+		Background:        tcell.ColorWhite,
+		Foreground:        tcell.ColorBlack,
+		Selection:         tcell.ColorLightBlue,
+		LineNumber:        tcell.ColorGray,
+		LineNumberActive:  tcell.ColorBlack,
+		StatusBarBg:       tcell.ColorLightBlue,
+		StatusBarFg:       tcell.ColorBlack,
+		StatusBarModeBg:   tcell.ColorBlue,
+		TabBarBg:          tcell.ColorWhite,
+		TabBarFg:          tcell.ColorGray,
+		TabBarActiveBg:    tcell.ColorLightBlue,
+		TabBarActiveFg:    tcell.ColorBlack,
+		TreeHeaderFg:      tcell.ColorBlue,
+		TreeDirFg:         tcell.ColorBlue,
+		TreeFileFg:        tcell.ColorBlack,
+		TreeSelectionBg:   tcell.ColorLightBlue,
+		TreeBorder:        tcell.ColorGray,
+		DialogBg:          tcell.ColorWhite,
+		DialogFg:          tcell.ColorBlack,
+		DialogInputBg:     tcell.ColorLightGray,
+		IndentGuide:       tcell.ColorLightGray,
+		IndentGuideActive: tcell.ColorDarkGray,
+		BracketColors:     []tcell.Color{tcell.NewRGBColor(4, 49, 250), tcell.NewRGBColor(49, 147, 49), tcell.NewRGBColor(123, 56, 20)},
+		BracketUnmatched:  tcell.NewRGBColor(205, 49, 49),
 	},
 	"monokai": {
-		Name:             "Monokai",
-		Background:       tcell.NewRGBColor(39, 40, 34),
-		Foreground:       tcell.NewRGBColor(248, 248, 242),
-		Selection:        tcell.NewRGBColor(73, 72, 62),
-		LineNumber:       tcell.NewRGBColor(144, 144, 128),
-		LineNumberActive: tcell.NewRGBColor(248, 248, 242),
-		StatusBarBg:      tcell.NewRGBColor(73, 72, 62),
-		StatusBarFg:      tcell.NewRGBColor(248, 248, 242),
-		StatusBarModeBg:  tcell.NewRGBColor(102, 217, 239),
-		TabBarBg:         tcell.NewRGBColor(39, 40, 34),
-		TabBarFg:         tcell.NewRGBColor(144, 144, 128),
-		TabBarActiveBg:   tcell.NewRGBColor(73, 72, 62),
-		TabBarActiveFg:   tcell.NewRGBColor(248, 248, 242),
-		TreeHeaderFg:     tcell.NewRGBColor(249, 38, 114),
-		TreeDirFg:        tcell.NewRGBColor(102, 217, 239),
-		TreeFileFg:       tcell.NewRGBColor(248, 248, 242),
-		TreeSelectionBg:  tcell.NewRGBColor(73, 72, 62),
-		TreeBorder:       tcell.NewRGBColor(144, 144, 128),
-		DialogBg:         tcell.NewRGBColor(39, 40, 34),
-		DialogFg:         tcell.NewRGBColor(248, 248, 242),
-		DialogInputBg:    tcell.NewRGBColor(73, 72, 62),
-		IndentGuide:      tcell.NewRGBColor(70, 71, 60),
+		Name:              "Monokai",
+		Background:        tcell.NewRGBColor(39, 40, 34),
+		Foreground:        tcell.NewRGBColor(248, 248, 242),
+		Selection:         tcell.NewRGBColor(73, 72, 62),
+		LineNumber:        tcell.NewRGBColor(144, 144, 128),
+		LineNumberActive:  tcell.NewRGBColor(248, 248, 242),
+		StatusBarBg:       tcell.NewRGBColor(73, 72, 62),
+		StatusBarFg:       tcell.NewRGBColor(248, 248, 242),
+		StatusBarModeBg:   tcell.NewRGBColor(102, 217, 239),
+		TabBarBg:          tcell.NewRGBColor(39, 40, 34),
+		TabBarFg:          tcell.NewRGBColor(144, 144, 128),
+		TabBarActiveBg:    tcell.NewRGBColor(73, 72, 62),
+		TabBarActiveFg:    tcell.NewRGBColor(248, 248, 242),
+		TreeHeaderFg:      tcell.NewRGBColor(249, 38, 114),
+		TreeDirFg:         tcell.NewRGBColor(102, 217, 239),
+		TreeFileFg:        tcell.NewRGBColor(248, 248, 242),
+		TreeSelectionBg:   tcell.NewRGBColor(73, 72, 62),
+		TreeBorder:        tcell.NewRGBColor(144, 144, 128),
+		DialogBg:          tcell.NewRGBColor(39, 40, 34),
+		DialogFg:          tcell.NewRGBColor(248, 248, 242),
+		DialogInputBg:     tcell.NewRGBColor(73, 72, 62),
+		IndentGuide:       tcell.NewRGBColor(70, 71, 60),
+		IndentGuideActive: tcell.NewRGBColor(117, 113, 94),
+		BracketColors:     []tcell.Color{tcell.NewRGBColor(230, 219, 116), tcell.NewRGBColor(174, 129, 255), tcell.NewRGBColor(102, 217, 239)},
+		BracketUnmatched:  tcell.NewRGBColor(249, 38, 114),
 	},
 	"nord": {
-		Name:             "Nord",
-		Background:       tcell.NewRGBColor(46, 52, 64),
-		Foreground:       tcell.NewRGBColor(236, 239, 244),
-		Selection:        tcell.NewRGBColor(67, 76, 94),
-		LineNumber:       tcell.NewRGBColor(76, 86, 106),
-		LineNumberActive: tcell.NewRGBColor(236, 239, 244),
-		StatusBarBg:      tcell.NewRGBColor(67, 76, 94),
-		StatusBarFg:      tcell.NewRGBColor(236, 239, 244),
-		StatusBarModeBg:  tcell.NewRGBColor(136, 192, 208),
-		TabBarBg:         tcell.NewRGBColor(46, 52, 64),
-		TabBarFg:         tcell.NewRGBColor(76, 86, 106),
-		TabBarActiveBg:   tcell.NewRGBColor(67, 76, 94),
-		TabBarActiveFg:   tcell.NewRGBColor(236, 239, 244),
-		TreeHeaderFg:     tcell.NewRGBColor(136, 192, 208),
-		TreeDirFg:        tcell.NewRGBColor(136, 192, 208),
-		TreeFileFg:       tcell.NewRGBColor(236, 239, 244),
-		TreeSelectionBg:  tcell.NewRGBColor(67, 76, 94),
-		TreeBorder:       tcell.NewRGBColor(76, 86, 106),
-		DialogBg:         tcell.NewRGBColor(46, 52, 64),
-		DialogFg:         tcell.NewRGBColor(236, 239, 244),
-		DialogInputBg:    tcell.NewRGBColor(67, 76, 94),
-		IndentGuide:      tcell.NewRGBColor(59, 66, 82),
+		Name:              "Nord",
+		Background:        tcell.NewRGBColor(46, 52, 64),
+		Foreground:        tcell.NewRGBColor(236, 239, 244),
+		Selection:         tcell.NewRGBColor(67, 76, 94),
+		LineNumber:        tcell.NewRGBColor(76, 86, 106),
+		LineNumberActive:  tcell.NewRGBColor(236, 239, 244),
+		StatusBarBg:       tcell.NewRGBColor(67, 76, 94),
+		StatusBarFg:       tcell.NewRGBColor(236, 239, 244),
+		StatusBarModeBg:   tcell.NewRGBColor(136, 192, 208),
+		TabBarBg:          tcell.NewRGBColor(46, 52, 64),
+		TabBarFg:          tcell.NewRGBColor(76, 86, 106),
+		TabBarActiveBg:    tcell.NewRGBColor(67, 76, 94),
+		TabBarActiveFg:    tcell.NewRGBColor(236, 239, 244),
+		TreeHeaderFg:      tcell.NewRGBColor(136, 192, 208),
+		TreeDirFg:         tcell.NewRGBColor(136, 192, 208),
+		TreeFileFg:        tcell.NewRGBColor(236, 239, 244),
+		TreeSelectionBg:   tcell.NewRGBColor(67, 76, 94),
+		TreeBorder:        tcell.NewRGBColor(76, 86, 106),
+		DialogBg:          tcell.NewRGBColor(46, 52, 64),
+		DialogFg:          tcell.NewRGBColor(236, 239, 244),
+		DialogInputBg:     tcell.NewRGBColor(67, 76, 94),
+		IndentGuide:       tcell.NewRGBColor(59, 66, 82),
+		IndentGuideActive: tcell.NewRGBColor(76, 86, 106),
+		BracketColors:     []tcell.Color{tcell.NewRGBColor(235, 203, 139), tcell.NewRGBColor(180, 142, 173), tcell.NewRGBColor(136, 192, 208)},
+		BracketUnmatched:  tcell.NewRGBColor(191, 97, 106),
 	},
 	"solarized-dark": {
-		Name:             "Solarized Dark",
-		Background:       tcell.NewRGBColor(0, 43, 54),
-		Foreground:       tcell.NewRGBColor(131, 148, 150),
-		Selection:        tcell.NewRGBColor(7, 54, 66),
-		LineNumber:       tcell.NewRGBColor(88, 110, 117),
-		LineNumberActive: tcell.NewRGBColor(147, 161, 161),
-		StatusBarBg:      tcell.NewRGBColor(7, 54, 66),
-		StatusBarFg:      tcell.NewRGBColor(147, 161, 161),
-		StatusBarModeBg:  tcell.NewRGBColor(38, 139, 210),
-		TabBarBg:         tcell.NewRGBColor(0, 43, 54),
-		TabBarFg:         tcell.NewRGBColor(88, 110, 117),
-		TabBarActiveBg:   tcell.NewRGBColor(7, 54, 66),
-		TabBarActiveFg:   tcell.NewRGBColor(147, 161, 161),
-		TreeHeaderFg:     tcell.NewRGBColor(203, 75, 22),
-		TreeDirFg:        tcell.NewRGBColor(38, 139, 210),
-		TreeFileFg:       tcell.NewRGBColor(131, 148, 150),
-		TreeSelectionBg:  tcell.NewRGBColor(7, 54, 66),
-		TreeBorder:       tcell.NewRGBColor(88, 110, 117),
-		DialogBg:         tcell.NewRGBColor(0, 43, 54),
-		DialogFg:         tcell.NewRGBColor(131, 148, 150),
-		DialogInputBg:    tcell.NewRGBColor(7, 54, 66),
-		IndentGuide:      tcell.NewRGBColor(30, 65, 73),
+		Name:              "Solarized Dark",
+		Background:        tcell.NewRGBColor(0, 43, 54),
+		Foreground:        tcell.NewRGBColor(131, 148, 150),
+		Selection:         tcell.NewRGBColor(7, 54, 66),
+		LineNumber:        tcell.NewRGBColor(88, 110, 117),
+		LineNumberActive:  tcell.NewRGBColor(147, 161, 161),
+		StatusBarBg:       tcell.NewRGBColor(7, 54, 66),
+		StatusBarFg:       tcell.NewRGBColor(147, 161, 161),
+		StatusBarModeBg:   tcell.NewRGBColor(38, 139, 210),
+		TabBarBg:          tcell.NewRGBColor(0, 43, 54),
+		TabBarFg:          tcell.NewRGBColor(88, 110, 117),
+		TabBarActiveBg:    tcell.NewRGBColor(7, 54, 66),
+		TabBarActiveFg:    tcell.NewRGBColor(147, 161, 161),
+		TreeHeaderFg:      tcell.NewRGBColor(203, 75, 22),
+		TreeDirFg:         tcell.NewRGBColor(38, 139, 210),
+		TreeFileFg:        tcell.NewRGBColor(131, 148, 150),
+		TreeSelectionBg:   tcell.NewRGBColor(7, 54, 66),
+		TreeBorder:        tcell.NewRGBColor(88, 110, 117),
+		DialogBg:          tcell.NewRGBColor(0, 43, 54),
+		DialogFg:          tcell.NewRGBColor(131, 148, 150),
+		DialogInputBg:     tcell.NewRGBColor(7, 54, 66),
+		IndentGuide:       tcell.NewRGBColor(30, 65, 73),
+		IndentGuideActive: tcell.NewRGBColor(88, 110, 117),
+		BracketColors:     []tcell.Color{tcell.NewRGBColor(181, 137, 0), tcell.NewRGBColor(211, 54, 130), tcell.NewRGBColor(38, 139, 210)},
+		BracketUnmatched:  tcell.NewRGBColor(220, 50, 47),
 	},
 	"gruvbox": {
-		Name:             "Gruvbox Dark",
-		Background:       tcell.NewRGBColor(40, 40, 40),
-		Foreground:       tcell.NewRGBColor(235, 219, 178),
-		Selection:        tcell.NewRGBColor(60, 56, 54),
-		LineNumber:       tcell.NewRGBColor(146, 131, 116),
-		LineNumberActive: tcell.NewRGBColor(251, 241, 199),
-		StatusBarBg:      tcell.NewRGBColor(60, 56, 54),
-		StatusBarFg:      tcell.NewRGBColor(235, 219, 178),
-		StatusBarModeBg:  tcell.NewRGBColor(184, 187, 38),
-		TabBarBg:         tcell.NewRGBColor(40, 40, 40),
-		TabBarFg:         tcell.NewRGBColor(146, 131, 116),
-		TabBarActiveBg:   tcell.NewRGBColor(60, 56, 54),
-		TabBarActiveFg:   tcell.NewRGBColor(235, 219, 178),
-		TreeHeaderFg:     tcell.NewRGBColor(254, 128, 25),
-		TreeDirFg:        tcell.NewRGBColor(131, 165, 152),
-		TreeFileFg:       tcell.NewRGBColor(235, 219, 178),
-		TreeSelectionBg:  tcell.NewRGBColor(60, 56, 54),
-		TreeBorder:       tcell.NewRGBColor(102, 92, 84),
-		DialogBg:         tcell.NewRGBColor(40, 40, 40),
-		DialogFg:         tcell.NewRGBColor(235, 219, 178),
-		DialogInputBg:    tcell.NewRGBColor(60, 56, 54),
-		IndentGuide:      tcell.NewRGBColor(80, 73, 69),
+		Name:              "Gruvbox Dark",
+		Background:        tcell.NewRGBColor(40, 40, 40),
+		Foreground:        tcell.NewRGBColor(235, 219, 178),
+		Selection:         tcell.NewRGBColor(60, 56, 54),
+		LineNumber:        tcell.NewRGBColor(146, 131, 116),
+		LineNumberActive:  tcell.NewRGBColor(251, 241, 199),
+		StatusBarBg:       tcell.NewRGBColor(60, 56, 54),
+		StatusBarFg:       tcell.NewRGBColor(235, 219, 178),
+		StatusBarModeBg:   tcell.NewRGBColor(184, 187, 38),
+		TabBarBg:          tcell.NewRGBColor(40, 40, 40),
+		TabBarFg:          tcell.NewRGBColor(146, 131, 116),
+		TabBarActiveBg:    tcell.NewRGBColor(60, 56, 54),
+		TabBarActiveFg:    tcell.NewRGBColor(235, 219, 178),
+		TreeHeaderFg:      tcell.NewRGBColor(254, 128, 25),
+		TreeDirFg:         tcell.NewRGBColor(131, 165, 152),
+		TreeFileFg:        tcell.NewRGBColor(235, 219, 178),
+		TreeSelectionBg:   tcell.NewRGBColor(60, 56, 54),
+		TreeBorder:        tcell.NewRGBColor(102, 92, 84),
+		DialogBg:          tcell.NewRGBColor(40, 40, 40),
+		DialogFg:          tcell.NewRGBColor(235, 219, 178),
+		DialogInputBg:     tcell.NewRGBColor(60, 56, 54),
+		IndentGuide:       tcell.NewRGBColor(80, 73, 69),
+		IndentGuideActive: tcell.NewRGBColor(124, 111, 100),
+		BracketColors:     []tcell.Color{tcell.NewRGBColor(250, 189, 47), tcell.NewRGBColor(211, 134, 155), tcell.NewRGBColor(131, 165, 152)},
+		BracketUnmatched:  tcell.NewRGBColor(251, 73, 52),
 	},
 	"gruvbox-light": {
-		Name:             "Gruvbox Light",
-		Background:       tcell.NewRGBColor(251, 241, 199),
-		Foreground:       tcell.NewRGBColor(60, 56, 54),
-		Selection:        tcell.NewRGBColor(213, 196, 161),
-		LineNumber:       tcell.NewRGBColor(189, 174, 147),
-		LineNumberActive: tcell.NewRGBColor(60, 56, 54),
-		StatusBarBg:      tcell.NewRGBColor(213, 196, 161),
-		StatusBarFg:      tcell.NewRGBColor(60, 56, 54),
-		StatusBarModeBg:  tcell.NewRGBColor(121, 116, 14),
-		TabBarBg:         tcell.NewRGBColor(251, 241, 199),
-		TabBarFg:         tcell.NewRGBColor(146, 131, 116),
-		TabBarActiveBg:   tcell.NewRGBColor(213, 196, 161),
-		TabBarActiveFg:   tcell.NewRGBColor(60, 56, 54),
-		TreeHeaderFg:     tcell.NewRGBColor(175, 58, 3),
-		TreeDirFg:        tcell.NewRGBColor(69, 133, 136),
-		TreeFileFg:       tcell.NewRGBColor(60, 56, 54),
-		TreeSelectionBg:  tcell.NewRGBColor(213, 196, 161),
-		TreeBorder:       tcell.NewRGBColor(189, 174, 147),
-		DialogBg:         tcell.NewRGBColor(251, 241, 199),
-		DialogFg:         tcell.NewRGBColor(60, 56, 54),
-		DialogInputBg:    tcell.NewRGBColor(213, 196, 161),
-		IndentGuide:      tcell.NewRGBColor(213, 196, 161),
+		Name:              "Gruvbox Light",
+		Background:        tcell.NewRGBColor(251, 241, 199),
+		Foreground:        tcell.NewRGBColor(60, 56, 54),
+		Selection:         tcell.NewRGBColor(213, 196, 161),
+		LineNumber:        tcell.NewRGBColor(189, 174, 147),
+		LineNumberActive:  tcell.NewRGBColor(60, 56, 54),
+		StatusBarBg:       tcell.NewRGBColor(213, 196, 161),
+		StatusBarFg:       tcell.NewRGBColor(60, 56, 54),
+		StatusBarModeBg:   tcell.NewRGBColor(121, 116, 14),
+		TabBarBg:          tcell.NewRGBColor(251, 241, 199),
+		TabBarFg:          tcell.NewRGBColor(146, 131, 116),
+		TabBarActiveBg:    tcell.NewRGBColor(213, 196, 161),
+		TabBarActiveFg:    tcell.NewRGBColor(60, 56, 54),
+		TreeHeaderFg:      tcell.NewRGBColor(175, 58, 3),
+		TreeDirFg:         tcell.NewRGBColor(69, 133, 136),
+		TreeFileFg:        tcell.NewRGBColor(60, 56, 54),
+		TreeSelectionBg:   tcell.NewRGBColor(213, 196, 161),
+		TreeBorder:        tcell.NewRGBColor(189, 174, 147),
+		DialogBg:          tcell.NewRGBColor(251, 241, 199),
+		DialogFg:          tcell.NewRGBColor(60, 56, 54),
+		DialogInputBg:     tcell.NewRGBColor(213, 196, 161),
+		IndentGuide:       tcell.NewRGBColor(213, 196, 161),
+		IndentGuideActive: tcell.NewRGBColor(168, 153, 132),
+		BracketColors:     []tcell.Color{tcell.NewRGBColor(181, 118, 20), tcell.NewRGBColor(143, 63, 113), tcell.NewRGBColor(7, 102, 120)},
+		BracketUnmatched:  tcell.NewRGBColor(157, 0, 6),
 	},
 	"dracula": {
-		Name:             "Dracula",
-		Background:       tcell.NewRGBColor(40, 42, 54),
-		Foreground:       tcell.NewRGBColor(248, 248, 242),
-		Selection:        tcell.NewRGBColor(68, 71, 90),
-		LineNumber:       tcell.NewRGBColor(98, 114, 164),
-		LineNumberActive: tcell.NewRGBColor(248, 248, 242),
-		StatusBarBg:      tcell.NewRGBColor(68, 71, 90),
-		StatusBarFg:      tcell.NewRGBColor(248, 248, 242),
-		StatusBarModeBg:  tcell.NewRGBColor(189, 147, 249),
-		TabBarBg:         tcell.NewRGBColor(40, 42, 54),
-		TabBarFg:         tcell.NewRGBColor(98, 114, 164),
-		TabBarActiveBg:   tcell.NewRGBColor(68, 71, 90),
-		TabBarActiveFg:   tcell.NewRGBColor(248, 248, 242),
-		TreeHeaderFg:     tcell.NewRGBColor(255, 121, 198),
-		TreeDirFg:        tcell.NewRGBColor(139, 233, 253),
-		TreeFileFg:       tcell.NewRGBColor(248, 248, 242),
-		TreeSelectionBg:  tcell.NewRGBColor(68, 71, 90),
-		TreeBorder:       tcell.NewRGBColor(98, 114, 164),
-		DialogBg:         tcell.NewRGBColor(40, 42, 54),
-		DialogFg:         tcell.NewRGBColor(248, 248, 242),
-		DialogInputBg:    tcell.NewRGBColor(68, 71, 90),
-		IndentGuide:      tcell.NewRGBColor(55, 58, 75),
+		Name:              "Dracula",
+		Background:        tcell.NewRGBColor(40, 42, 54),
+		Foreground:        tcell.NewRGBColor(248, 248, 242),
+		Selection:         tcell.NewRGBColor(68, 71, 90),
+		LineNumber:        tcell.NewRGBColor(98, 114, 164),
+		LineNumberActive:  tcell.NewRGBColor(248, 248, 242),
+		StatusBarBg:       tcell.NewRGBColor(68, 71, 90),
+		StatusBarFg:       tcell.NewRGBColor(248, 248, 242),
+		StatusBarModeBg:   tcell.NewRGBColor(189, 147, 249),
+		TabBarBg:          tcell.NewRGBColor(40, 42, 54),
+		TabBarFg:          tcell.NewRGBColor(98, 114, 164),
+		TabBarActiveBg:    tcell.NewRGBColor(68, 71, 90),
+		TabBarActiveFg:    tcell.NewRGBColor(248, 248, 242),
+		TreeHeaderFg:      tcell.NewRGBColor(255, 121, 198),
+		TreeDirFg:         tcell.NewRGBColor(139, 233, 253),
+		TreeFileFg:        tcell.NewRGBColor(248, 248, 242),
+		TreeSelectionBg:   tcell.NewRGBColor(68, 71, 90),
+		TreeBorder:        tcell.NewRGBColor(98, 114, 164),
+		DialogBg:          tcell.NewRGBColor(40, 42, 54),
+		DialogFg:          tcell.NewRGBColor(248, 248, 242),
+		DialogInputBg:     tcell.NewRGBColor(68, 71, 90),
+		IndentGuide:       tcell.NewRGBColor(55, 58, 75),
+		IndentGuideActive: tcell.NewRGBColor(98, 114, 164),
+		BracketColors:     []tcell.Color{tcell.NewRGBColor(241, 250, 140), tcell.NewRGBColor(255, 121, 198), tcell.NewRGBColor(139, 233, 253)},
+		BracketUnmatched:  tcell.NewRGBColor(255, 85, 85),
 	},
 	"one-dark": {
-		Name:             "One Dark",
-		Background:       tcell.NewRGBColor(40, 44, 52),
-		Foreground:       tcell.NewRGBColor(171, 178, 191),
-		Selection:        tcell.NewRGBColor(61, 66, 77),
-		LineNumber:       tcell.NewRGBColor(92, 99, 112),
-		LineNumberActive: tcell.NewRGBColor(171, 178, 191),
-		StatusBarBg:      tcell.NewRGBColor(61, 66, 77),
-		StatusBarFg:      tcell.NewRGBColor(171, 178, 191),
-		StatusBarModeBg:  tcell.NewRGBColor(97, 175, 239),
-		TabBarBg:         tcell.NewRGBColor(40, 44, 52),
-		TabBarFg:         tcell.NewRGBColor(92, 99, 112),
-		TabBarActiveBg:   tcell.NewRGBColor(61, 66, 77),
-		TabBarActiveFg:   tcell.NewRGBColor(171, 178, 191),
-		TreeHeaderFg:     tcell.NewRGBColor(198, 120, 221),
-		TreeDirFg:        tcell.NewRGBColor(97, 175, 239),
-		TreeFileFg:       tcell.NewRGBColor(171, 178, 191),
-		TreeSelectionBg:  tcell.NewRGBColor(61, 66, 77),
-		TreeBorder:       tcell.NewRGBColor(92, 99, 112),
-		DialogBg:         tcell.NewRGBColor(40, 44, 52),
-		DialogFg:         tcell.NewRGBColor(171, 178, 191),
-		DialogInputBg:    tcell.NewRGBColor(61, 66, 77),
-		IndentGuide:      tcell.NewRGBColor(52, 56, 67),
+		Name:              "One Dark",
+		Background:        tcell.NewRGBColor(40, 44, 52),
+		Foreground:        tcell.NewRGBColor(171, 178, 191),
+		Selection:         tcell.NewRGBColor(61, 66, 77),
+		LineNumber:        tcell.NewRGBColor(92, 99, 112),
+		LineNumberActive:  tcell.NewRGBColor(171, 178, 191),
+		StatusBarBg:       tcell.NewRGBColor(61, 66, 77),
+		StatusBarFg:       tcell.NewRGBColor(171, 178, 191),
+		StatusBarModeBg:   tcell.NewRGBColor(97, 175, 239),
+		TabBarBg:          tcell.NewRGBColor(40, 44, 52),
+		TabBarFg:          tcell.NewRGBColor(92, 99, 112),
+		TabBarActiveBg:    tcell.NewRGBColor(61, 66, 77),
+		TabBarActiveFg:    tcell.NewRGBColor(171, 178, 191),
+		TreeHeaderFg:      tcell.NewRGBColor(198, 120, 221),
+		TreeDirFg:         tcell.NewRGBColor(97, 175, 239),
+		TreeFileFg:        tcell.NewRGBColor(171, 178, 191),
+		TreeSelectionBg:   tcell.NewRGBColor(61, 66, 77),
+		TreeBorder:        tcell.NewRGBColor(92, 99, 112),
+		DialogBg:          tcell.NewRGBColor(40, 44, 52),
+		DialogFg:          tcell.NewRGBColor(171, 178, 191),
+		DialogInputBg:     tcell.NewRGBColor(61, 66, 77),
+		IndentGuide:       tcell.NewRGBColor(52, 56, 67),
+		IndentGuideActive: tcell.NewRGBColor(92, 99, 112),
+		BracketColors:     []tcell.Color{tcell.NewRGBColor(229, 192, 123), tcell.NewRGBColor(198, 120, 221), tcell.NewRGBColor(97, 175, 239)},
+		BracketUnmatched:  tcell.NewRGBColor(224, 108, 117),
 	},
 	"tokyo-night": {
-		Name:             "Tokyo Night",
-		Background:       tcell.NewRGBColor(26, 27, 38),
-		Foreground:       tcell.NewRGBColor(169, 177, 214),
-		Selection:        tcell.NewRGBColor(47, 52, 73),
-		LineNumber:       tcell.NewRGBColor(86, 95, 137),
-		LineNumberActive: tcell.NewRGBColor(169, 177, 214),
-		StatusBarBg:      tcell.NewRGBColor(47, 52, 73),
-		StatusBarFg:      tcell.NewRGBColor(169, 177, 214),
-		StatusBarModeBg:  tcell.NewRGBColor(125, 207, 255),
-		TabBarBg:         tcell.NewRGBColor(26, 27, 38),
-		TabBarFg:         tcell.NewRGBColor(86, 95, 137),
-		TabBarActiveBg:   tcell.NewRGBColor(47, 52, 73),
-		TabBarActiveFg:   tcell.NewRGBColor(169, 177, 214),
-		TreeHeaderFg:     tcell.NewRGBColor(187, 154, 247),
-		TreeDirFg:        tcell.NewRGBColor(125, 207, 255),
-		TreeFileFg:       tcell.NewRGBColor(169, 177, 214),
-		TreeSelectionBg:  tcell.NewRGBColor(47, 52, 73),
-		TreeBorder:       tcell.NewRGBColor(86, 95, 137),
-		DialogBg:         tcell.NewRGBColor(26, 27, 38),
-		DialogFg:         tcell.NewRGBColor(169, 177, 214),
-		DialogInputBg:    tcell.NewRGBColor(47, 52, 73),
-		IndentGuide:      tcell.NewRGBColor(40, 44, 60),
+		Name:              "Tokyo Night",
+		Background:        tcell.NewRGBColor(26, 27, 38),
+		Foreground:        tcell.NewRGBColor(169, 177, 214),
+		Selection:         tcell.NewRGBColor(47, 52, 73),
+		LineNumber:        tcell.NewRGBColor(86, 95, 137),
+		LineNumberActive:  tcell.NewRGBColor(169, 177, 214),
+		StatusBarBg:       tcell.NewRGBColor(47, 52, 73),
+		StatusBarFg:       tcell.NewRGBColor(169, 177, 214),
+		StatusBarModeBg:   tcell.NewRGBColor(125, 207, 255),
+		TabBarBg:          tcell.NewRGBColor(26, 27, 38),
+		TabBarFg:          tcell.NewRGBColor(86, 95, 137),
+		TabBarActiveBg:    tcell.NewRGBColor(47, 52, 73),
+		TabBarActiveFg:    tcell.NewRGBColor(169, 177, 214),
+		TreeHeaderFg:      tcell.NewRGBColor(187, 154, 247),
+		TreeDirFg:         tcell.NewRGBColor(125, 207, 255),
+		TreeFileFg:        tcell.NewRGBColor(169, 177, 214),
+		TreeSelectionBg:   tcell.NewRGBColor(47, 52, 73),
+		TreeBorder:        tcell.NewRGBColor(86, 95, 137),
+		DialogBg:          tcell.NewRGBColor(26, 27, 38),
+		DialogFg:          tcell.NewRGBColor(169, 177, 214),
+		DialogInputBg:     tcell.NewRGBColor(47, 52, 73),
+		IndentGuide:       tcell.NewRGBColor(40, 44, 60),
+		IndentGuideActive: tcell.NewRGBColor(65, 72, 104),
+		BracketColors:     []tcell.Color{tcell.NewRGBColor(224, 175, 104), tcell.NewRGBColor(187, 154, 247), tcell.NewRGBColor(125, 207, 255)},
+		BracketUnmatched:  tcell.NewRGBColor(247, 118, 142),
 	},
 	"catppuccin": {
-		Name:             "Catppuccin Mocha",
-		Background:       tcell.NewRGBColor(30, 30, 46),
-		Foreground:       tcell.NewRGBColor(205, 214, 244),
-		Selection:        tcell.NewRGBColor(69, 71, 90),
-		LineNumber:       tcell.NewRGBColor(108, 112, 134),
-		LineNumberActive: tcell.NewRGBColor(205, 214, 244),
-		StatusBarBg:      tcell.NewRGBColor(69, 71, 90),
-		StatusBarFg:      tcell.NewRGBColor(205, 214, 244),
-		StatusBarModeBg:  tcell.NewRGBColor(180, 190, 254),
-		TabBarBg:         tcell.NewRGBColor(30, 30, 46),
-		TabBarFg:         tcell.NewRGBColor(108, 112, 134),
-		TabBarActiveBg:   tcell.NewRGBColor(69, 71, 90),
-		TabBarActiveFg:   tcell.NewRGBColor(205, 214, 244),
-		TreeHeaderFg:     tcell.NewRGBColor(245, 194, 231),
-		TreeDirFg:        tcell.NewRGBColor(137, 220, 235),
-		TreeFileFg:       tcell.NewRGBColor(205, 214, 244),
-		TreeSelectionBg:  tcell.NewRGBColor(69, 71, 90),
-		TreeBorder:       tcell.NewRGBColor(108, 112, 134),
-		DialogBg:         tcell.NewRGBColor(30, 30, 46),
-		DialogFg:         tcell.NewRGBColor(205, 214, 244),
-		DialogInputBg:    tcell.NewRGBColor(69, 71, 90),
-		IndentGuide:      tcell.NewRGBColor(52, 53, 65),
+		Name:              "Catppuccin Mocha",
+		Background:        tcell.NewRGBColor(30, 30, 46),
+		Foreground:        tcell.NewRGBColor(205, 214, 244),
+		Selection:         tcell.NewRGBColor(69, 71, 90),
+		LineNumber:        tcell.NewRGBColor(108, 112, 134),
+		LineNumberActive:  tcell.NewRGBColor(205, 214, 244),
+		StatusBarBg:       tcell.NewRGBColor(69, 71, 90),
+		StatusBarFg:       tcell.NewRGBColor(205, 214, 244),
+		StatusBarModeBg:   tcell.NewRGBColor(180, 190, 254),
+		TabBarBg:          tcell.NewRGBColor(30, 30, 46),
+		TabBarFg:          tcell.NewRGBColor(108, 112, 134),
+		TabBarActiveBg:    tcell.NewRGBColor(69, 71, 90),
+		TabBarActiveFg:    tcell.NewRGBColor(205, 214, 244),
+		TreeHeaderFg:      tcell.NewRGBColor(245, 194, 231),
+		TreeDirFg:         tcell.NewRGBColor(137, 220, 235),
+		TreeFileFg:        tcell.NewRGBColor(205, 214, 244),
+		TreeSelectionBg:   tcell.NewRGBColor(69, 71, 90),
+		TreeBorder:        tcell.NewRGBColor(108, 112, 134),
+		DialogBg:          tcell.NewRGBColor(30, 30, 46),
+		DialogFg:          tcell.NewRGBColor(205, 214, 244),
+		DialogInputBg:     tcell.NewRGBColor(69, 71, 90),
+		IndentGuide:       tcell.NewRGBColor(52, 53, 65),
+		IndentGuideActive: tcell.NewRGBColor(88, 91, 112),
+		BracketColors:     []tcell.Color{tcell.NewRGBColor(249, 226, 175), tcell.NewRGBColor(245, 194, 231), tcell.NewRGBColor(137, 180, 250)},
+		BracketUnmatched:  tcell.NewRGBColor(243, 139, 168),
 	},
 	"high-contrast": {
-		Name:             "High Contrast",
-		Background:       tcell.NewRGBColor(0, 0, 0),
-		Foreground:       tcell.NewRGBColor(255, 255, 255),
-		Selection:        tcell.NewRGBColor(0, 80, 160),
-		LineNumber:       tcell.NewRGBColor(180, 180, 180),
-		LineNumberActive: tcell.NewRGBColor(255, 255, 0),
-		StatusBarBg:      tcell.NewRGBColor(0, 0, 200),
-		StatusBarFg:      tcell.NewRGBColor(255, 255, 255),
-		StatusBarModeBg:  tcell.NewRGBColor(200, 200, 0),
-		TabBarBg:         tcell.NewRGBColor(0, 0, 0),
-		TabBarFg:         tcell.NewRGBColor(180, 180, 180),
-		TabBarActiveBg:   tcell.NewRGBColor(0, 0, 200),
-		TabBarActiveFg:   tcell.NewRGBColor(255, 255, 255),
-		TreeHeaderFg:     tcell.NewRGBColor(255, 255, 0),
-		TreeDirFg:        tcell.NewRGBColor(100, 200, 255),
-		TreeFileFg:       tcell.NewRGBColor(255, 255, 255),
-		TreeSelectionBg:  tcell.NewRGBColor(0, 80, 160),
-		TreeBorder:       tcell.NewRGBColor(255, 255, 255),
-		DialogBg:         tcell.NewRGBColor(0, 0, 0),
-		DialogFg:         tcell.NewRGBColor(255, 255, 255),
-		DialogInputBg:    tcell.NewRGBColor(40, 40, 40),
-		IndentGuide:      tcell.NewRGBColor(60, 60, 60),
+		Name:              "High Contrast",
+		Background:        tcell.NewRGBColor(0, 0, 0),
+		Foreground:        tcell.NewRGBColor(255, 255, 255),
+		Selection:         tcell.NewRGBColor(0, 80, 160),
+		LineNumber:        tcell.NewRGBColor(180, 180, 180),
+		LineNumberActive:  tcell.NewRGBColor(255, 255, 0),
+		StatusBarBg:       tcell.NewRGBColor(0, 0, 200),
+		StatusBarFg:       tcell.NewRGBColor(255, 255, 255),
+		StatusBarModeBg:   tcell.NewRGBColor(200, 200, 0),
+		TabBarBg:          tcell.NewRGBColor(0, 0, 0),
+		TabBarFg:          tcell.NewRGBColor(180, 180, 180),
+		TabBarActiveBg:    tcell.NewRGBColor(0, 0, 200),
+		TabBarActiveFg:    tcell.NewRGBColor(255, 255, 255),
+		TreeHeaderFg:      tcell.NewRGBColor(255, 255, 0),
+		TreeDirFg:         tcell.NewRGBColor(100, 200, 255),
+		TreeFileFg:        tcell.NewRGBColor(255, 255, 255),
+		TreeSelectionBg:   tcell.NewRGBColor(0, 80, 160),
+		TreeBorder:        tcell.NewRGBColor(255, 255, 255),
+		DialogBg:          tcell.NewRGBColor(0, 0, 0),
+		DialogFg:          tcell.NewRGBColor(255, 255, 255),
+		DialogInputBg:     tcell.NewRGBColor(40, 40, 40),
+		IndentGuide:       tcell.NewRGBColor(60, 60, 60),
+		IndentGuideActive: tcell.NewRGBColor(160, 160, 160),
+		BracketColors:     []tcell.Color{tcell.ColorYellow, tcell.ColorFuchsia, tcell.ColorAqua},
+		BracketUnmatched:  tcell.ColorRed,
 	},
 }
 
@@ -382,6 +437,12 @@ func Default() *Config {
 		InsertFinalNewline: true,
 		ImageTempTabs:      true,
 		ImageProtocol:      "auto",
+		LargeFileMB:        100,
+
+		PreserveMixedLineEndings: true,
+		ClipboardHistorySize:     30,
+		FileHistoryMB:            50,
+		RenderWhitespace:         "none",
 	}
 }
 
@@ -430,6 +491,103 @@ func (c *Config) Save() error {
 	if err != nil {
 		return err
 	}
+	if len(c.replaced) > 0 {
+		var settings map[string]json.RawMessage
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return err
+		}
+		for key, value := range c.replaced {
+			settings[key] = value
+		}
+		if data, err = json.MarshalIndent(settings, "", "  "); err != nil {
+			return err
+		}
+	}
 
 	return os.WriteFile(path, data, 0644)
 }
+
+// WorkspaceSettings are the settings a workspace file may override. They
+// change only how files look and are edited: a workspace checked into a
+// repository must not be able to pick the program the terminal runs, or
+// how much of the disk and memory the editor uses.
+var WorkspaceSettings = map[string]bool{
+	"tab_size":                    true,
+	"theme":                       true,
+	"word_wrap":                   true,
+	"auto_close":                  true,
+	"quote_wrap_selection":        true,
+	"trim_trailing_whitespace":    true,
+	"insert_final_newline":        true,
+	"preserve_mixed_line_endings": true,
+	"render_whitespace":           true,
+	"rulers":                      true,
+	"tree_width":                  true,
+	"terminal_ratio":              true,
+}
+
+// ApplyOverrides sets the settings in overrides, a JSON object like
+// settings.json, until ClearOverrides. Save keeps writing the values they
+// replaced, so a workspace's settings don't leak into the user's. Only
+// WorkspaceSettings are applied; the others are left alone and named in the
+// error returned.
+func (c *Config) ApplyOverrides(overrides json.RawMessage) error {
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(overrides, &settings); err != nil {
+		return err
+	}
+	var refused []string
+	for key := range settings {
+		if !WorkspaceSettings[key] {
+			refused = append(refused, key)
+			delete(settings, key)
+		}
+	}
+	current, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(current, &values); err != nil {
+		return err
+	}
+	if c.replaced == nil {
+		c.replaced = make(map[string]json.RawMessage)
+	}
+	for key := range settings {
+		value, known := values[key]
+		if _, done := c.replaced[key]; known && !done {
+			c.replaced[key] = value
+		}
+	}
+	allowed, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(allowed, c); err != nil {
+		return err
+	}
+	if len(refused) > 0 {
+		sort.Strings(refused)
+		return errors.New("not allowed in a workspace: " + strings.Join(refused, ", "))
+	}
+	return nil
+}
+
+// Overridden reports whether ApplyOverrides replaced the setting key.
+func (c *Config) Overridden(key string) bool {
+	_, ok := c.replaced[key]
+	return ok
+}
+
+// ClearOverrides puts back the settings ApplyOverrides replaced.
+func (c *Config) ClearOverrides() {
+	if len(c.replaced) == 0 {
+		return
+	}
+	data, err := json.Marshal(c.replaced)
+	c.replaced = nil
+	if err == nil {
+		json.Unmarshal(data, c)
+	}
+}
@@ -16,6 +16,7 @@ type EditorConfigSettings struct {
 	TrimTrailingWhitespace bool
 	InsertFinalNewline     bool
 	Charset                string // "utf-8", "latin1", etc.
+	MaxLineLength          int    // 0 means unset or "off"
 }
 
 // FindEditorConfig searches for .editorconfig files from the file's directory
@@ -235,6 +236,12 @@ func settingsFromMap(m map[string]string) *EditorConfigSettings {
 		s.Charset = v
 		hasAny = true
 	}
+	if v, ok := m["max_line_length"]; ok {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			s.MaxLineLength = n
+		}
+		hasAny = true
+	}
 
 	if !hasAny {
 		return nil
@@ -1,13 +1,19 @@
 package editor
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+
+	"editor/buffer"
+	"editor/ui"
 )
 
 const backupInterval = 30 * time.Second
@@ -16,6 +22,11 @@ type backupInfo struct {
 	OriginalPath string `json:"original_path"`
 	WorkDir      string `json:"work_dir"`
 	Timestamp    string `json:"timestamp"`
+
+	// Untitled is the ID of an untitled buffer's backup, which has no
+	// OriginalPath, and Cursor where its cursor was.
+	Untitled string        `json:"untitled,omitempty"`
+	Cursor   buffer.Cursor `json:"cursor"`
 }
 
 func backupDir() string {
@@ -29,6 +40,16 @@ func backupPathForFile(originalPath string) string {
 	return filepath.Join(backupDir(), name)
 }
 
+func untitledBackupPath(id string) string {
+	return filepath.Join(backupDir(), "untitled-"+id+".bak")
+}
+
+func newUntitledID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func backupMetaPath(backupPath string) string {
 	return backupPath + ".json"
 }
@@ -51,12 +72,16 @@ func (e *Editor) saveBackups() {
 	dir := backupDir()
 	os.MkdirAll(dir, 0755)
 
-	for _, buf := range e.buffers {
-		if !buf.Dirty || buf.Path == "" {
+	for _, buf := range e.allBuffers() {
+		if buf.Path == "" {
+			e.saveUntitledBackup(buf)
+			continue
+		}
+		if !buf.Dirty || buf.ReadOnly {
 			continue
 		}
 		bpath := backupPathForFile(buf.Path)
-		content := strings.Join(buf.Lines, "\n") + "\n"
+		content := buf.Text() + "\n"
 		os.WriteFile(bpath, []byte(content), 0644)
 
 		meta := backupInfo{
@@ -69,6 +94,40 @@ func (e *Editor) saveBackups() {
 	}
 }
 
+// saveUntitledBackup backs up a buffer with no file under its UntitledID,
+// with its cursor so it can be restored as it was.
+func (e *Editor) saveUntitledBackup(buf *buffer.Buffer) {
+	if !buf.Dirty {
+		e.cleanUntitledBackup(buf)
+		return
+	}
+	if buf.UntitledID == "" {
+		buf.UntitledID = newUntitledID()
+	}
+	bpath := untitledBackupPath(buf.UntitledID)
+	os.WriteFile(bpath, []byte(buf.Text()), 0600)
+
+	meta := backupInfo{
+		WorkDir:   e.watchedRoot,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Untitled:  buf.UntitledID,
+		Cursor:    buf.Cursor,
+	}
+	metaData, _ := json.Marshal(meta)
+	os.WriteFile(backupMetaPath(bpath), metaData, 0600)
+}
+
+// cleanUntitledBackup removes the backup of an untitled buffer, once it has
+// been saved to a file or closed.
+func (e *Editor) cleanUntitledBackup(buf *buffer.Buffer) {
+	if buf.UntitledID == "" {
+		return
+	}
+	bpath := untitledBackupPath(buf.UntitledID)
+	os.Remove(bpath)
+	os.Remove(backupMetaPath(bpath))
+}
+
 func (e *Editor) cleanBackup(path string) {
 	if path == "" {
 		return
@@ -79,8 +138,9 @@ func (e *Editor) cleanBackup(path string) {
 }
 
 func (e *Editor) cleanAllBackups() {
-	for _, buf := range e.buffers {
+	for _, buf := range e.allBuffers() {
 		e.cleanBackup(buf.Path)
+		e.cleanUntitledBackup(buf)
 	}
 }
 
@@ -118,6 +178,78 @@ func (e *Editor) checkForBackups() []backupInfo {
 	return found
 }
 
+// recoverBackups restores file backups to their files and returns the
+// backups of untitled buffers, oldest first, to be offered separately.
+func (e *Editor) recoverBackups(backups []backupInfo) (recovered int, untitled []backupInfo) {
+	for _, info := range backups {
+		if info.Untitled != "" {
+			untitled = append(untitled, info)
+			continue
+		}
+		if e.recoverBackup(info) == nil {
+			recovered++
+		}
+	}
+	sort.Slice(untitled, func(i, j int) bool { return untitled[i].Timestamp < untitled[j].Timestamp })
+	return recovered, untitled
+}
+
+// offerUntitledRecovery asks whether to reopen untitled buffers backed up
+// before a crash. Declining deletes their backups; cancelling keeps them
+// for the next start.
+func (e *Editor) offerUntitledRecovery(backups []backupInfo) {
+	what := "1 untitled buffer"
+	if len(backups) != 1 {
+		what = fmt.Sprintf("%d untitled buffers", len(backups))
+	}
+	d := ui.NewRecoverConfirmDialog(what)
+	d.OnConfirm = func(answer rune) {
+		e.dialog = nil
+		switch answer {
+		case 'y':
+			n := e.restoreUntitledBackups(backups)
+			e.setTemporaryMessage(fmt.Sprintf("Restored %d untitled buffer(s)", n))
+		case 'n':
+			for _, info := range backups {
+				bpath := untitledBackupPath(info.Untitled)
+				os.Remove(bpath)
+				os.Remove(backupMetaPath(bpath))
+			}
+		}
+	}
+	e.dialog = d
+}
+
+// restoreUntitledBackups opens each backup as an unsaved untitled tab with
+// its cursor where it was, reusing an empty untitled tab if one is active.
+// The tabs keep their backups' IDs, so the next backup replaces them.
+func (e *Editor) restoreUntitledBackups(backups []backupInfo) int {
+	restored := 0
+	for _, info := range backups {
+		data, err := os.ReadFile(untitledBackupPath(info.Untitled))
+		if err != nil {
+			continue
+		}
+		buf := e.activeBuffer()
+		if buf == nil || buf.Path != "" || buf.Dirty || buf.LineCount() > 1 || buf.Line(0) != "" {
+			e.openEmptyBuffer()
+			buf = e.activeBuffer()
+		}
+		e.cleanUntitledBackup(buf)
+		buf.UntitledID = info.Untitled
+		buf.SetLines(strings.Split(string(data), "\n"))
+		buf.RecomputeDirty()
+		if info.Cursor.Line < buf.LineCount() {
+			buf.Cursor.Line = info.Cursor.Line
+			buf.Cursor.Col = min(info.Cursor.Col, buffer.RuneLen(buf.Line(info.Cursor.Line)))
+		}
+		e.tabBar.SetModified(e.activeTab, buf.Dirty)
+		restored++
+	}
+	e.updateStatus()
+	return restored
+}
+
 // recoverBackup restores a backup file to the original path.
 func (e *Editor) recoverBackup(info backupInfo) error {
 	bpath := backupPathForFile(info.OriginalPath)
@@ -0,0 +1,44 @@
+package editor
+
+import (
+	"os"
+	"testing"
+
+	"editor/buffer"
+)
+
+func TestUntitledBuffersAreBackedUpAndRestored(t *testing.T) {
+	e, b := newBlockTestEditor(t, "")
+	b.InsertText("select 1;\nselect 2;")
+	b.Cursor = buffer.Cursor{Line: 1, Col: 6}
+	e.saveBackups()
+
+	// A fresh editor in the same directory, as after a crash
+	home := os.Getenv("HOME")
+	e2, _ := newBlockTestEditor(t, "")
+	t.Setenv("HOME", home)
+	e2.watchedRoot = e.watchedRoot
+	recovered, untitled := e2.recoverBackups(e2.checkForBackups())
+	if recovered != 0 || len(untitled) != 1 || untitled[0].Untitled != b.UntitledID {
+		t.Fatalf("recovered %d, untitled %+v", recovered, untitled)
+	}
+	if n := e2.restoreUntitledBackups(untitled); n != 1 {
+		t.Fatalf("restored %d buffers", n)
+	}
+
+	// The empty tab it started with is reused
+	if len(e2.buffers) != 1 {
+		t.Fatalf("%d tabs after restore, want 1", len(e2.buffers))
+	}
+	r := e2.buffers[0]
+	checkLines(t, r, "select 1;", "select 2;")
+	if !r.Dirty || r.Path != "" || r.Cursor != (buffer.Cursor{Line: 1, Col: 6}) {
+		t.Fatalf("restored buffer dirty %v path %q cursor %+v", r.Dirty, r.Path, r.Cursor)
+	}
+
+	// Closing the tab drops its backup
+	e2.removeTab(0)
+	if _, err := os.Stat(untitledBackupPath(b.UntitledID)); !os.IsNotExist(err) {
+		t.Fatalf("backup still there after closing: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package editor
+
+import (
+	"strings"
+
+	"editor/buffer"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// blockSpans returns the part of each line the block covers, for lines
+// [top, bottom] and display columns [left, right).
+func blockSpans(buf *buffer.Buffer, top, bottom, left, right int) []buffer.ColumnSpan {
+	spans := make([]buffer.ColumnSpan, 0, bottom-top+1)
+	for l := top; l <= bottom; l++ {
+		line := buf.Line(l)
+		span := buffer.ColumnSpan{
+			Line: l,
+			From: displayColToBufferCol(line, left, buf.TabSize),
+			To:   displayColToBufferCol(line, right, buf.TabSize),
+		}
+		if width := bufferColToDisplayCol(line, buffer.RuneLen(line), buf.TabSize); width < left {
+			span.Pad = left - width
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// selectedSpans returns the spans of buf's block selection.
+func selectedSpans(buf *buffer.Buffer) []buffer.ColumnSpan {
+	top, bottom := buf.Block.Lines()
+	left, right := buf.Block.Cols()
+	return blockSpans(buf, top, bottom, left, right)
+}
+
+// cursorDisplayPos returns the cursor as a line and display column.
+func cursorDisplayPos(buf *buffer.Buffer) buffer.Cursor {
+	return buffer.Cursor{
+		Line: buf.Cursor.Line,
+		Col:  bufferColToDisplayCol(buf.Line(buf.Cursor.Line), buf.Cursor.Col, buf.TabSize),
+	}
+}
+
+// setBlockHead moves the moving corner of the block and the cursor with it.
+func setBlockHead(buf *buffer.Buffer, head buffer.Cursor) {
+	if head.Line < 0 {
+		head.Line = 0
+	}
+	if head.Line >= buf.LineCount() {
+		head.Line = buf.LineCount() - 1
+	}
+	if head.Col < 0 {
+		head.Col = 0
+	}
+	buf.Block.Head = head
+	line := buf.Line(head.Line)
+	buf.Cursor = buffer.Cursor{Line: head.Line, Col: displayColToBufferCol(line, head.Col, buf.TabSize)}
+}
+
+// collapseBlock leaves a zero-width block at display column col, a cursor
+// on each of its lines.
+func collapseBlock(buf *buffer.Buffer, col int) {
+	buf.Block.Anchor.Col = col
+	setBlockHead(buf, buffer.Cursor{Line: buf.Block.Head.Line, Col: col})
+}
+
+// handleBlockSelectKey extends a block selection with Alt+Shift+arrows,
+// starting one at the cursor.
+func (e *Editor) handleBlockSelectKey(ev *tcell.EventKey) bool {
+	if ev.Modifiers()&(tcell.ModAlt|tcell.ModShift) != tcell.ModAlt|tcell.ModShift || e.focusTarget != "editor" {
+		return false
+	}
+	var dLine, dCol int
+	switch ev.Key() {
+	case tcell.KeyUp:
+		dLine = -1
+	case tcell.KeyDown:
+		dLine = 1
+	case tcell.KeyLeft:
+		dCol = -1
+	case tcell.KeyRight:
+		dCol = 1
+	default:
+		return false
+	}
+	buf := e.activeBuffer()
+	if buf == nil || buf.Large() != nil || e.hexViews[buf] != nil || e.imageViews[buf] != nil {
+		return false
+	}
+	if buf.Block == nil {
+		pos := cursorDisplayPos(buf)
+		buf.Block = &buffer.Block{Anchor: pos, Head: pos}
+		buf.Selection = nil
+		buf.ClearExtraCursors()
+	}
+	head := buf.Block.Head
+	setBlockHead(buf, buffer.Cursor{Line: head.Line + dLine, Col: head.Col + dCol})
+	e.mouseScrolling = false
+	e.updateStatus()
+	return true
+}
+
+// handleBlockKey handles keys while a block selection is active: typing,
+// deleting, copying and pasting act on every line of the block. Other keys
+// drop the block and are handled as usual.
+func (e *Editor) handleBlockKey(buf *buffer.Buffer, ev *tcell.EventKey) bool {
+	left, right := buf.Block.Cols()
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		buf.Block = nil
+		return true
+	case tcell.KeyCtrlC:
+		e.copyBlock(buf)
+		return true
+	case tcell.KeyCtrlX:
+		e.copyBlock(buf)
+		e.deleteBlock(buf, left, right)
+		return true
+	case tcell.KeyCtrlV:
+		e.pasteColumn(buf, clipboardRead())
+		return true
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if left == right {
+			if left == 0 {
+				return true
+			}
+			left--
+		}
+		e.deleteBlock(buf, left, right)
+		return true
+	case tcell.KeyDelete:
+		if left == right {
+			right++
+		}
+		e.deleteBlock(buf, left, right)
+		return true
+	case tcell.KeyRune:
+		if ev.Modifiers()&(tcell.ModCtrl|tcell.ModAlt) != 0 {
+			break
+		}
+		buf.ReplaceSpans(selectedSpans(buf), []string{string(ev.Rune())})
+		collapseBlock(buf, left+runewidth.RuneWidth(ev.Rune()))
+		e.markDirty()
+		e.updateStatus()
+		return true
+	}
+	buf.Block = nil
+	return false
+}
+
+// deleteBlock deletes display columns [left, right) of the block's lines
+// and leaves a zero-width block where they were.
+func (e *Editor) deleteBlock(buf *buffer.Buffer, left, right int) {
+	top, bottom := buf.Block.Lines()
+	spans := blockSpans(buf, top, bottom, left, right)
+	newLeft := left
+	for i, s := range spans {
+		line := buf.Line(s.Line)
+		from := bufferColToDisplayCol(line, s.From, buf.TabSize)
+		if s.To == s.From && s.From < buffer.RuneLen(line) && from >= left && from < right {
+			// A wide character starting in the range but ending past it
+			spans[i].To++
+		}
+		// A wide character or tab reaching into the range is deleted whole,
+		// so the block moves to where the leftmost one starts
+		if spans[i].To > s.From && from < newLeft {
+			newLeft = from
+		}
+	}
+	buf.ReplaceSpans(spans, []string{""})
+	collapseBlock(buf, newLeft)
+	e.markDirty()
+	e.updateStatus()
+}
+
+// copyBlock puts the block's text on the clipboard, one line per line of
+// the block, and remembers it so pasting it inserts a column again.
+func (e *Editor) copyBlock(buf *buffer.Buffer) {
+	text := strings.Join(buf.SpansText(selectedSpans(buf)), "\n")
+	clipboardWrite(text)
+	e.blockClip = text
+	e.setTemporaryMessage("Copied block")
+}
+
+// pasteColumn pastes text as a column: line i of text goes on the i-th line
+// down from the block or cursor, at the same display column. One line of
+// text pasted into a block is repeated on each of its lines.
+func (e *Editor) pasteColumn(buf *buffer.Buffer, text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text == "" {
+		return
+	}
+	texts := strings.Split(text, "\n")
+	var spans []buffer.ColumnSpan
+	if buf.Block != nil {
+		top, bottom := buf.Block.Lines()
+		left, right := buf.Block.Cols()
+		spans = blockSpans(buf, top, bottom, left, right)
+		if len(texts) > 1 {
+			// The block's text is replaced by as many lines as are pasted
+			for len(texts) < len(spans) {
+				texts = append(texts, "")
+			}
+			spans = append(spans, blockSpans(buf, bottom+1, top+len(texts)-1, left, left)...)
+		}
+	} else {
+		pos := cursorDisplayPos(buf)
+		spans = blockSpans(buf, pos.Line, pos.Line+len(texts)-1, pos.Col, pos.Col)
+	}
+	// Lines past the end of the buffer are added
+	buf.ReplaceSpans(spans, texts)
+
+	last := spans[len(spans)-1]
+	lastText := texts[len(texts)-1]
+	buf.Block = nil
+	buf.Selection = nil
+	buf.Cursor = buffer.Cursor{Line: last.Line, Col: last.From + buffer.RuneLen(lastText)}
+	if lastText != "" {
+		buf.Cursor.Col += last.Pad
+	}
+	e.markDirty()
+	e.updateStatus()
+}
+
+// inBlock reports whether display column col of line is inside buf's
+// block selection.
+func inBlock(buf *buffer.Buffer, line, col int) bool {
+	if buf.Block == nil {
+		return false
+	}
+	top, bottom := buf.Block.Lines()
+	left, right := buf.Block.Cols()
+	return line >= top && line <= bottom && col >= left && col < right
+}
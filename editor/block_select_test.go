@@ -0,0 +1,93 @@
+package editor
+
+import (
+	"strings"
+	"testing"
+
+	"editor/buffer"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func newBlockTestEditor(t *testing.T, lines ...string) (*Editor, *buffer.Buffer) {
+	t.Helper()
+	e, _ := newWorkspaceTestEditor(t)
+	b := buffer.NewBuffer(4)
+	b.SetLines(lines)
+	b.MarkSaved()
+	e.buffers = []*buffer.Buffer{b}
+	e.views[b] = &EditorView{}
+	e.tabBar.AddTab("", false)
+	e.activeTab = 0
+	e.focusTarget = "editor"
+	return e, b
+}
+
+func checkLines(t *testing.T, b *buffer.Buffer, want ...string) {
+	t.Helper()
+	got := b.Lines()
+	if len(got) != len(want) {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("lines = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestBlockSpansUseDisplayColumns(t *testing.T) {
+	b := buffer.NewBuffer(4)
+	b.SetLines([]string{"\tab", "日本語x", "ab"})
+	spans := blockSpans(b, 0, 2, 4, 6)
+	want := []buffer.ColumnSpan{
+		{Line: 0, From: 1, To: 3},         // the tab fills columns 0-3
+		{Line: 1, From: 2, To: 3},         // wide characters are two columns
+		{Line: 2, From: 2, To: 2, Pad: 2}, // short line
+	}
+	for i, s := range spans {
+		if s != want[i] {
+			t.Fatalf("span %d = %+v, want %+v", i, s, want[i])
+		}
+	}
+}
+
+func TestBlockTypeDeleteAndUndo(t *testing.T) {
+	e, b := newBlockTestEditor(t, "a1 | x", "b2 | y", "c")
+
+	// Select columns 3-4 on the first two lines
+	b.Cursor = buffer.Cursor{Line: 0, Col: 3}
+	e.handleKey(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModAlt|tcell.ModShift))
+	e.handleKey(tcell.NewEventKey(tcell.KeyRight, 0, tcell.ModAlt|tcell.ModShift))
+	if b.Block == nil {
+		t.Fatalf("no block selection")
+	}
+
+	e.handleKey(tcell.NewEventKey(tcell.KeyRune, '!', 0))
+	checkLines(t, b, "a1 ! x", "b2 ! y", "c")
+
+	// The block is now a column cursor after the typed text
+	e.handleKey(tcell.NewEventKey(tcell.KeyBackspace2, 0, 0))
+	checkLines(t, b, "a1  x", "b2  y", "c")
+
+	b.ApplyUndo()
+	checkLines(t, b, "a1 ! x", "b2 ! y", "c")
+}
+
+func TestBlockCopyPastesAsColumn(t *testing.T) {
+	e, b := newBlockTestEditor(t, "ab", "cd", "x")
+	b.Block = &buffer.Block{Anchor: buffer.Cursor{Line: 0, Col: 0}, Head: buffer.Cursor{Line: 1, Col: 1}}
+	text := strings.Join(b.SpansText(selectedSpans(b)), "\n")
+	if text != "a\nc" {
+		t.Fatalf("block text = %q", text)
+	}
+
+	// Pasted at the end of the last line, the column runs past the end of
+	// the buffer
+	b.Block = nil
+	b.Cursor = buffer.Cursor{Line: 2, Col: 1}
+	e.pasteColumn(b, text)
+	checkLines(t, b, "ab", "cd", "xa", " c")
+	b.ApplyUndo()
+	checkLines(t, b, "ab", "cd", "x")
+}
@@ -0,0 +1,287 @@
+package editor
+
+import (
+	"strings"
+
+	"editor/buffer"
+	"editor/highlight"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// bracketScanLines is how far above the viewport bracket nesting is counted
+// from. Brackets opened further up are not seen, so the window starts at
+// depth zero in a file nested deeper than that.
+const bracketScanLines = 1000
+
+// scopeScanLines bounds how far the current scope's guide is followed above
+// and below the cursor.
+const scopeScanLines = 1000
+
+type bracketPos struct {
+	line, col int
+}
+
+// bracketPairs holds the nesting depth of each bracket on the visible lines,
+// -1 marking a closer that matches no opener.
+type bracketPairs struct {
+	colors    []tcell.Color
+	unmatched tcell.Color
+	depth     map[bracketPos]int
+}
+
+// findBracketPairs works out the depth of every bracket in lines [start, end)
+// of buf, counting from bracketScanLines above start. Brackets inside
+// strings, rune literals such as '(' and comments of the buffer's language
+// are skipped. Closers with no opener get the unmatched colour. It returns
+// nil when the theme has no bracket colours.
+func findBracketPairs(buf *buffer.Buffer, start, end int, colors []tcell.Color, unmatched tcell.Color) *bracketPairs {
+	if len(colors) == 0 || start >= end {
+		return nil
+	}
+	from := start - bracketScanLines
+	if buf.Large() != nil {
+		from = start - highlight.ContextLines
+	}
+	if from < 0 {
+		from = 0
+	}
+	syn := bracketSyntaxOf(buf.Language)
+	p := &bracketPairs{colors: colors, unmatched: unmatched, depth: make(map[bracketPos]int)}
+	var open []rune
+	var quote rune
+	inComment := false
+	for i, line := range buf.LinesRange(from, end) {
+		lineIdx := from + i
+		runes := []rune(line)
+		if quote != '`' {
+			// Only raw strings run on to the next line
+			quote = 0
+		}
+		for c := 0; c < len(runes); c++ {
+			ch := runes[c]
+			if inComment {
+				if ch == '*' && c+1 < len(runes) && runes[c+1] == '/' {
+					inComment = false
+					c++
+				}
+				continue
+			}
+			if quote != 0 {
+				if ch == '\\' && quote != '`' {
+					c++
+				} else if ch == quote {
+					quote = 0
+				}
+				continue
+			}
+			if syn.lineComment != "" && ch == rune(syn.lineComment[0]) && strings.HasPrefix(string(runes[c:]), syn.lineComment) {
+				break
+			}
+			switch ch {
+			case '"':
+				quote = ch
+			case '`':
+				if syn.rawQuote {
+					quote = ch
+				}
+			case '/':
+				if syn.blockComment && c+1 < len(runes) && runes[c+1] == '*' {
+					inComment = true
+					c++
+				}
+			case '\'':
+				if syn.singleQuote {
+					quote = ch
+				} else if c+2 < len(runes) && runes[c+2] == '\'' {
+					// A lone quote, as in Lisp's '(a b), is left alone
+					c += 2
+				} else if c+3 < len(runes) && runes[c+1] == '\\' && runes[c+3] == '\'' {
+					c += 3
+				}
+			case '(', '[', '{':
+				if lineIdx >= start {
+					p.depth[bracketPos{lineIdx, c}] = len(open)
+				}
+				open = append(open, ch)
+			case ')', ']', '}':
+				n := len(open)
+				if n > 0 && open[n-1] == openerOf(ch) {
+					open = open[:n-1]
+					if lineIdx >= start {
+						p.depth[bracketPos{lineIdx, c}] = n - 1
+					}
+				} else if from == 0 && lineIdx >= start {
+					// Only a scan from the top of the file can tell
+					p.depth[bracketPos{lineIdx, c}] = -1
+				}
+			}
+		}
+	}
+	return p
+}
+
+// bracketSyntax is what findBracketPairs knows of a language's comments and
+// strings.
+type bracketSyntax struct {
+	lineComment  string // starts a comment running to the end of the line
+	blockComment bool   // /* */ comments
+	rawQuote     bool   // `...` strings, which can span lines
+	singleQuote  bool   // '...' is a string rather than a rune literal
+}
+
+// bracketSyntaxOf returns the syntax of the language named lang, as from
+// highlight.DetectLanguage. Unknown languages and plain text have only
+// double-quoted strings and rune literals.
+func bracketSyntaxOf(lang string) bracketSyntax {
+	switch strings.ToLower(lang) {
+	case "go":
+		return bracketSyntax{lineComment: "//", blockComment: true, rawQuote: true}
+	case "javascript", "typescript", "tsx", "jsx":
+		return bracketSyntax{lineComment: "//", blockComment: true, rawQuote: true, singleQuote: true}
+	case "c", "c++", "c#", "java", "rust", "kotlin", "swift", "scala", "objective-c", "zig":
+		return bracketSyntax{lineComment: "//", blockComment: true}
+	case "php", "dart":
+		return bracketSyntax{lineComment: "//", blockComment: true, singleQuote: true}
+	case "css", "scss", "less":
+		return bracketSyntax{blockComment: true, singleQuote: true}
+	case "python", "ruby", "perl", "r", "elixir", "powershell",
+		"bash", "shell", "sh", "zsh", "fish", "yaml", "toml":
+		return bracketSyntax{lineComment: "#", singleQuote: true}
+	case "makefile", "cmake", "dockerfile", "nim", "tcl", "julia", "ini":
+		return bracketSyntax{lineComment: "#"}
+	case "lua", "sql":
+		return bracketSyntax{lineComment: "--", singleQuote: true}
+	case "haskell", "ada", "vhdl":
+		return bracketSyntax{lineComment: "--"}
+	case "common lisp", "scheme", "clojure", "racket", "emacslisp":
+		return bracketSyntax{lineComment: ";"}
+	}
+	return bracketSyntax{}
+}
+
+func openerOf(closer rune) rune {
+	switch closer {
+	case ')':
+		return '('
+	case ']':
+		return '['
+	}
+	return '{'
+}
+
+// style gives base the colour of the bracket at line, col, if there is one.
+func (p *bracketPairs) style(base tcell.Style, line, col int) tcell.Style {
+	if p == nil {
+		return base
+	}
+	d, ok := p.depth[bracketPos{line, col}]
+	if !ok {
+		return base
+	}
+	if d < 0 {
+		return base.Foreground(p.unmatched)
+	}
+	return base.Foreground(p.colors[d%len(p.colors)])
+}
+
+// scopeGuide is the indent guide of the block holding the cursor.
+type scopeGuide struct {
+	col         int // display column the guide is drawn at
+	first, last int // lines it is highlighted on
+}
+
+// has reports whether the guide at display column col of line is the
+// current scope's.
+func (g *scopeGuide) has(line, col int) bool {
+	return g != nil && col == g.col && line >= g.first && line <= g.last
+}
+
+// findScopeGuide finds the guide of the innermost indented block around line.
+// On a line that opens a block, such as "func f() {", that is the block
+// below it; on the line closing one, the block above. It returns nil at the
+// top level.
+func findScopeGuide(buf *buffer.Buffer, line int) *scopeGuide {
+	tabSize := buf.TabSize
+	if tabSize <= 0 || line < 0 || line >= buf.LineCount() {
+		return nil
+	}
+	lo := line - scopeScanLines
+	if lo < 0 {
+		lo = 0
+	}
+	lines := buf.LinesRange(lo, line+scopeScanLines+1)
+	// indent is -1 for a blank line
+	indent := func(l int) int {
+		s := lines[l-lo]
+		if strings.TrimSpace(s) == "" {
+			return -1
+		}
+		return indentWidth(s, tabSize)
+	}
+	hi := lo + len(lines)
+	prev, next := -1, -1
+	for l := line - 1; l >= lo && prev < 0; l-- {
+		prev = indent(l)
+	}
+	for l := line + 1; l < hi && next < 0; l++ {
+		next = indent(l)
+	}
+
+	g := &scopeGuide{first: line, last: line}
+	cur := indent(line)
+	switch {
+	case cur >= 0 && next > cur:
+		g.col = cur
+		g.first++
+	case cur >= 0 && prev > cur:
+		g.col = cur
+		g.last--
+	default:
+		if cur < 0 {
+			cur = max(prev, next)
+		}
+		if cur <= 0 {
+			return nil
+		}
+		g.col = (cur - 1) / tabSize * tabSize
+	}
+
+	inside := func(l int) bool {
+		ind := indent(l)
+		return ind < 0 || ind > g.col
+	}
+	if g.first <= line {
+		for g.first > lo && inside(g.first-1) {
+			g.first--
+		}
+	}
+	if g.last >= line {
+		for g.last < hi-1 && inside(g.last+1) {
+			g.last++
+		}
+	}
+	// Blank lines at either end belong to no block
+	for g.first < g.last && indent(g.first) < 0 {
+		g.first++
+	}
+	for g.last > g.first && indent(g.last) < 0 {
+		g.last--
+	}
+	return g
+}
+
+// indentWidth is the display width of line's leading whitespace.
+func indentWidth(line string, tabSize int) int {
+	w := 0
+	for _, r := range line {
+		if r == ' ' {
+			w++
+		} else if r == '\t' {
+			w += tabSize - (w % tabSize)
+		} else {
+			break
+		}
+	}
+	return w
+}
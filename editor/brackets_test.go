@@ -0,0 +1,112 @@
+package editor
+
+import (
+	"testing"
+
+	"editor/buffer"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestBracketPairDepths(t *testing.T) {
+	b := buffer.NewBuffer(4)
+	b.SetLines([]string{
+		`{"a": [1, (2)],`,
+		`  "b": "[not]", c: ')'}`,
+		`]`,
+	})
+	colors := []tcell.Color{tcell.ColorRed, tcell.ColorGreen}
+	pairs := findBracketPairs(b, 0, b.LineCount(), colors, tcell.ColorBlue)
+	want := map[bracketPos]int{
+		{0, 0}: 0, {0, 6}: 1, {0, 10}: 2, {0, 12}: 2, {0, 13}: 1,
+		{1, 22}: 0,
+		{2, 0}:  -1,
+	}
+	if len(pairs.depth) != len(want) {
+		t.Fatalf("depths = %v, want %v", pairs.depth, want)
+	}
+	for pos, d := range want {
+		if got, ok := pairs.depth[pos]; !ok || got != d {
+			t.Fatalf("depth at %v = %d (%v), want %d", pos, got, ok, d)
+		}
+	}
+
+	// Depth carries over from lines above the window
+	pairs = findBracketPairs(b, 1, 2, colors, tcell.ColorBlue)
+	if d := pairs.depth[bracketPos{1, 22}]; d != 0 {
+		t.Fatalf("closer depth = %d, want 0", d)
+	}
+	if fg, _, _ := pairs.style(tcell.StyleDefault, 1, 22).Decompose(); fg != tcell.ColorRed {
+		t.Fatalf("closer colour = %v, want the first bracket colour", fg)
+	}
+	pairs = findBracketPairs(b, 2, 3, colors, tcell.ColorBlue)
+	if fg, _, _ := pairs.style(tcell.StyleDefault, 2, 0).Decompose(); fg != tcell.ColorBlue {
+		t.Fatalf("unmatched closer colour = %v, want the theme's", fg)
+	}
+}
+
+func TestBracketPairsSkipCommentsAndStrings(t *testing.T) {
+	colors := []tcell.Color{tcell.ColorRed}
+	b := buffer.NewBuffer(4)
+	b.Language = "Go"
+	b.SetLines([]string{
+		"f(a) // g(",
+		"s := `{",
+		"]` + x[0] /* ( */ + y{}",
+		"/* [",
+		"*/ z()",
+	})
+	pairs := findBracketPairs(b, 0, b.LineCount(), colors, tcell.ColorBlue)
+	want := []bracketPos{{0, 1}, {0, 3}, {2, 6}, {2, 8}, {2, 21}, {2, 22}, {4, 4}, {4, 5}}
+	if len(pairs.depth) != len(want) {
+		t.Fatalf("Go depths = %v, want brackets at %v", pairs.depth, want)
+	}
+	for _, pos := range want {
+		if d, ok := pairs.depth[pos]; !ok || d != 0 {
+			t.Fatalf("Go depth at %v = %d (%v), want 0", pos, d, ok)
+		}
+	}
+
+	b.Language = "Python"
+	b.SetLines([]string{`x = ')' + f('(', '\\') # (`})
+	pairs = findBracketPairs(b, 0, b.LineCount(), colors, tcell.ColorBlue)
+	_, opener := pairs.depth[bracketPos{0, 11}]
+	_, closer := pairs.depth[bracketPos{0, 21}]
+	if len(pairs.depth) != 2 || !opener || !closer {
+		t.Fatalf("Python depths = %v, want only f's parentheses", pairs.depth)
+	}
+}
+
+func TestScopeGuide(t *testing.T) {
+	b := buffer.NewBuffer(4)
+	b.SetLines([]string{
+		"func f() {",
+		"    if x {",
+		"        y()",
+		"",
+		"        z()",
+		"    }",
+		"    w()",
+		"}",
+	})
+	tests := []struct {
+		line, col, first, last int
+	}{
+		{0, 0, 1, 6}, // opener: the block below
+		{2, 4, 2, 4},
+		{3, 4, 2, 4}, // blank line inside the block
+		{5, 4, 2, 4}, // closer: the block above
+		{6, 0, 1, 6},
+		{7, 0, 1, 6},
+	}
+	for _, tt := range tests {
+		g := findScopeGuide(b, tt.line)
+		if g == nil || g.col != tt.col || g.first != tt.first || g.last != tt.last {
+			t.Fatalf("scope at line %d = %+v, want col %d lines %d-%d", tt.line, g, tt.col, tt.first, tt.last)
+		}
+	}
+	b.SetLines([]string{"a", "b"})
+	if g := findScopeGuide(b, 0); g != nil {
+		t.Fatalf("top-level scope = %+v, want none", g)
+	}
+}
@@ -0,0 +1,179 @@
+package editor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"editor/buffer"
+	"editor/clipboardx"
+	"editor/ui"
+)
+
+// clipPreviewWidth is how much of an entry's first line the history picker
+// shows.
+const clipPreviewWidth = 60
+
+// lastPaste remembers where the last paste went, so Cycle Paste can swap it
+// for an older clipboard entry.
+type lastPaste struct {
+	buf   *buffer.Buffer
+	start buffer.Cursor
+	end   buffer.Cursor
+	text  string
+	index int // position of text in the clipboard history, or -1
+}
+
+func clipboardHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "aln", "clipboard.json")
+}
+
+// loadClipboardHistory sizes the clipboard history from the settings and,
+// if it is persisted, restores it from the last session.
+func (e *Editor) loadClipboardHistory() {
+	clipboardx.SetHistoryLimit(e.cfg.ClipboardHistorySize)
+	if !e.cfg.PersistClipboardHistory {
+		return
+	}
+	data, err := os.ReadFile(clipboardHistoryPath())
+	if err != nil {
+		return
+	}
+	var texts []string
+	if err := json.Unmarshal(data, &texts); err != nil {
+		return
+	}
+	clipboardx.SetHistory(texts)
+}
+
+// saveClipboardHistory writes the clipboard history for the next session,
+// or removes a stored one once persisting is turned off.
+func (e *Editor) saveClipboardHistory() error {
+	path := clipboardHistoryPath()
+	if path == "" {
+		return nil
+	}
+	if !e.cfg.PersistClipboardHistory {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(clipboardx.History(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// clipPreview returns the first non-blank line of text, shortened to fit the
+// picker, and how many more lines there are.
+func clipPreview(text string) (string, int) {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	first := ""
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			first = strings.TrimSpace(line)
+			break
+		}
+	}
+	first = strings.ReplaceAll(first, "\t", " ")
+	if utf8.RuneCountInString(first) > clipPreviewWidth {
+		first = string([]rune(first)[:clipPreviewWidth-1]) + "…"
+	}
+	return first, len(lines) - 1
+}
+
+// openClipboardHistory lists the clipboard history, newest first. The entry
+// picked goes back on the clipboard and is pasted into the editor, or into
+// the terminal when it has focus.
+func (e *Editor) openClipboardHistory() {
+	history := clipboardx.History()
+	if len(history) == 0 {
+		e.setTemporaryError("Clipboard history is empty")
+		return
+	}
+	toTerminal := e.focusTarget == "terminal" && e.terminal != nil
+	e.closeFragileModals()
+	commands := make([]ui.Command, 0, len(history))
+	for i, text := range history {
+		preview, more := clipPreview(text)
+		cmd := ui.Command{
+			Name: fmt.Sprintf("%d. %s", i+1, preview),
+			Action: func() {
+				clipboardWrite(text)
+				if toTerminal {
+					e.terminal.WritePaste(text)
+					return
+				}
+				e.pasteText(text)
+			},
+		}
+		if more > 0 {
+			cmd.Shortcut = fmt.Sprintf("+%d lines", more)
+		}
+		commands = append(commands, cmd)
+	}
+	cp := ui.NewCommandPalette(commands, e.cfg.GetTheme())
+	cp.OnClose = func() {
+		e.commandPalette = nil
+	}
+	e.commandPalette = cp
+}
+
+// cyclePaste replaces the text just pasted with the next older entry in the
+// clipboard history. Anywhere else it pastes the newest entry.
+func (e *Editor) cyclePaste() {
+	buf := e.activeBuffer()
+	if buf == nil || buf.ReadOnly {
+		return
+	}
+	history := clipboardx.History()
+	if len(history) == 0 {
+		e.setTemporaryError("Clipboard history is empty")
+		return
+	}
+
+	lp := e.lastPaste
+	if lp.buf != buf || buf.HasExtraCursors() || buf.Cursor != lp.end ||
+		buf.GetTextInRange(lp.start, lp.end) != lp.text {
+		e.pasteText(history[0])
+		return
+	}
+
+	next := (lp.index + 1) % len(history)
+	text := history[next]
+	buf.ApplyEdits([]buffer.TextEdit{{Start: lp.start, End: lp.end, NewText: text}})
+	buf.Cursor = buf.PosAt(buf.Offset(lp.start) + utf8.RuneCountInString(text))
+	e.rememberPaste(buf, text)
+	e.lastPaste.index = next
+	e.markDirty()
+	e.setTemporaryMessage(fmt.Sprintf("Pasted clipboard entry %d of %d", next+1, len(history)))
+}
+
+// rememberPaste records that text was just pasted before the cursor, for
+// cyclePaste.
+func (e *Editor) rememberPaste(buf *buffer.Buffer, text string) {
+	start := buf.PosAt(max(buf.Offset(buf.Cursor)-utf8.RuneCountInString(text), 0))
+	e.lastPaste = lastPaste{buf: buf, start: start, end: buf.Cursor, text: text, index: historyIndex(text)}
+}
+
+// historyIndex returns where text is in the clipboard history, or -1.
+func historyIndex(text string) int {
+	for i, h := range clipboardx.History() {
+		if h == text {
+			return i
+		}
+	}
+	return -1
+}
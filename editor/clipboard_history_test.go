@@ -0,0 +1,56 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+
+	"editor/buffer"
+	"editor/clipboardx"
+)
+
+func TestCyclePasteSwapsInOlderEntries(t *testing.T) {
+	e, b := newBlockTestEditor(t, "x")
+	clipboardx.SetHistory([]string{"new", "two\nlines", "old"})
+	defer clipboardx.SetHistory(nil)
+	b.Cursor = buffer.Cursor{Line: 0, Col: 1}
+
+	e.pasteText("new")
+	checkLines(t, b, "xnew")
+	e.cyclePaste()
+	checkLines(t, b, "xtwo", "lines")
+	e.cyclePaste()
+	checkLines(t, b, "xold")
+	e.cyclePaste()
+	checkLines(t, b, "xnew")
+
+	// Once the cursor moves away it pastes the newest entry afresh
+	b.Cursor = buffer.Cursor{Line: 0, Col: 0}
+	e.cyclePaste()
+	checkLines(t, b, "newxnew")
+}
+
+func TestClipboardHistoryPersistence(t *testing.T) {
+	e, _ := newWorkspaceTestEditor(t)
+	defer clipboardx.SetHistory(nil)
+	want := []string{"one", "two\n"}
+	clipboardx.SetHistory(want)
+
+	// Nothing is kept unless persisting is on
+	e.saveClipboardHistory()
+	clipboardx.SetHistory(nil)
+	e.loadClipboardHistory()
+	if got := clipboardx.History(); len(got) != 0 {
+		t.Fatalf("history restored without persisting: %q", got)
+	}
+
+	e.cfg.PersistClipboardHistory = true
+	clipboardx.SetHistory(want)
+	if err := e.saveClipboardHistory(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	clipboardx.SetHistory(nil)
+	e.loadClipboardHistory()
+	if got := clipboardx.History(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("history = %q, want %q", got, want)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 
@@ -43,6 +42,16 @@ type Editor struct {
 	dialog         *ui.Dialog
 	quickOpen      *ui.QuickOpen
 	commandPalette *ui.CommandPalette
+	editPreview    *ui.EditPreview
+	timeline       *ui.TimelinePanel
+	searchPanel    *ui.SearchPanel
+	findInFiles    *projectSearch
+	largeFind      largeFind
+	macro          macroRecorder
+	lastPaste      lastPaste
+
+	// Multi-file operations that can be reverted together
+	workspaceTxns []*workspaceTxn
 
 	highlight *highlight.Highlighter
 
@@ -58,10 +67,18 @@ type Editor struct {
 	// Editor view state per buffer
 	views map[*buffer.Buffer]*EditorView
 
+	// Split panes: the tabs above are the focused pane's
+	pane      *pane
+	layout    *split
+	dragSplit *split // divider being dragged
+
 	// Image viewer for image files
 	imageViews          map[*buffer.Buffer]*ui.ImageView
-	needsSync           bool // force full screen Sync on next render
-	protocolImageHidden bool // true when protocol image is temporarily cleared for overlays
+	hexViews            map[*buffer.Buffer]*ui.HexView
+	hexQuery            string // last hex editor search
+	blockClip           string // text of the last block copied, pasted back as a column
+	needsSync           bool   // force full screen Sync on next render
+	protocolImageHidden bool   // true when protocol image is temporarily cleared for overlays
 
 	// Mouse drag tracking
 	mouseDown                bool
@@ -86,9 +103,15 @@ type Editor struct {
 	fileWatcher *fsnotify.Watcher
 	watchedRoot string
 
+	// The named session or workspace file in use, if any; it is saved
+	// again when switching away and on exit
+	sessionName   string
+	workspacePath string
+
 	// LSP
 	lspManager   *lsp.Manager
 	autocomplete *ui.Autocomplete
+	hover        *ui.HoverPopup
 
 	// Bracketed paste state (suppresses auto-indent and auto-close)
 	pasting bool
@@ -105,6 +128,8 @@ type Editor struct {
 type EditorView struct {
 	scrollY int
 	scrollX int
+
+	cursors *viewCursors // kept while another pane has focus
 }
 
 // FileWatchEvent carries file system change notifications to the main event loop.
@@ -115,17 +140,21 @@ type FileWatchEvent struct {
 }
 
 func New(cfg *config.Config) *Editor {
+	p := newPane()
 	return &Editor{
+		pane:        p,
+		layout:      &split{pane: p},
 		cfg:         cfg,
 		highlight:   highlight.New(),
-		gitGutter:   NewGitGutter(),
+		gitGutter:   p.gitGutter,
 		activeTab:   -1,
 		treeOpen:    true,
 		treeWidth:   cfg.TreeWidth,
 		termRatio:   cfg.TermRatio,
 		focusTarget: "editor",
-		views:       make(map[*buffer.Buffer]*EditorView),
+		views:       p.views,
 		imageViews:  make(map[*buffer.Buffer]*ui.ImageView),
+		hexViews:    make(map[*buffer.Buffer]*ui.HexView),
 		previewTab:  -1,
 	}
 }
@@ -154,9 +183,7 @@ func (e *Editor) Run(files []string, isDirOpen bool) error {
 	e.lspManager = lsp.NewManager(cwd)
 
 	// Initialize components
-	e.tabBar = ui.NewTabBar()
-	e.tabBar.OnSwitch = func(idx int) { e.switchTab(idx) }
-	e.tabBar.OnClose = func(idx int) { e.closeTab(idx) }
+	e.tabBar = e.newTabBar()
 
 	e.fileTree = ui.NewFileTree(cwd)
 	e.fileTree.OnFileOpen = func(path string) {
@@ -217,12 +244,7 @@ func (e *Editor) Run(files []string, isDirOpen bool) error {
 					e.setTemporaryError("Error: " + err.Error())
 				} else {
 					// Close buffer if open
-					for i, buf := range e.buffers {
-						if buf.Path == path {
-							e.removeTab(i)
-							break
-						}
-					}
+					e.removeTabsWhere(func(buf *buffer.Buffer) bool { return buf.Path == path })
 					e.fileTree.Refresh()
 					e.setTemporaryMessage("Deleted " + name)
 				}
@@ -245,18 +267,8 @@ func (e *Editor) Run(files []string, isDirOpen bool) error {
 			if err != nil {
 				e.setTemporaryError("Error: " + err.Error())
 			} else {
-				// Update buffer path if open
-				for i, buf := range e.buffers {
-					if buf.Path == oldPath {
-						buf.Path = newPath
-						buf.Language = highlight.DetectLanguage(newPath)
-						if i < len(e.tabBar.Tabs) {
-							e.tabBar.Tabs[i].Title = newName
-							e.tabBar.Tabs[i].Path = newPath
-						}
-						break
-					}
-				}
+				// Update buffer paths if open
+				e.retargetBuffers(oldPath, newPath)
 				e.fileTree.Refresh()
 				e.setTemporaryMessage("Renamed to " + newName)
 			}
@@ -267,6 +279,8 @@ func (e *Editor) Run(files []string, isDirOpen bool) error {
 	}
 
 	e.statusBar = ui.NewStatusBar()
+	e.statusBar.OnEncodingClick = e.reopenWithEncoding
+	e.statusBar.OnLineEndClick = e.openLineEndingPicker
 
 	// Set up file watcher
 	e.watchedRoot = cwd
@@ -275,19 +289,25 @@ func (e *Editor) Run(files []string, isDirOpen bool) error {
 	// Start auto-backup timer
 	e.startBackupTimer()
 
+	e.loadClipboardHistory()
+
 	// Check for crash recovery backups
-	backups := e.checkForBackups()
-	if len(backups) > 0 {
-		for _, info := range backups {
-			e.recoverBackup(info)
-		}
-		e.statusBar.Message = fmt.Sprintf("Recovered %d backup(s) from previous session", len(backups))
+	recovered, untitled := e.recoverBackups(e.checkForBackups())
+	if recovered > 0 {
+		e.statusBar.Message = fmt.Sprintf("Recovered %d backup(s) from previous session", recovered)
 	}
 
-	// Open files from CLI args
+	// Open files from CLI args; a workspace file opens the workspace
 	if len(files) > 0 {
+		e.RestoreUnsaved()
 		for _, f := range files {
 			absPath, _ := filepath.Abs(f)
+			if isWorkspaceFile(absPath) {
+				if err := e.openWorkspace(absPath); err != nil {
+					e.setTemporaryError("Can't open workspace: " + err.Error())
+				}
+				continue
+			}
 			e.openFile(absPath)
 		}
 	} else {
@@ -303,6 +323,10 @@ func (e *Editor) Run(files []string, isDirOpen bool) error {
 		}
 	}
 
+	if len(untitled) > 0 {
+		e.offerUntitledRecovery(untitled)
+	}
+
 	e.updateFocus()
 
 	// Initialize cursor blink
@@ -358,24 +382,43 @@ func (e *Editor) Run(files []string, isDirOpen bool) error {
 			}
 		case *FileWatchEvent:
 			e.handleFileWatchEvent(ev)
+		case *LargeFileEvent:
+			e.updateStatus()
+		case *LargeFindEvent:
+			e.handleLargeFindEvent(ev)
+		case *ProjectSearchEvent:
+			e.handleProjectSearchEvent(ev)
+		case *ui.SearchResultsEvent:
+			if e.commandPalette == nil || !e.commandPalette.HandleSearchEvent(ev) {
+				ev.Cancel()
+			}
 		case *tcell.EventPaste:
 			e.pasting = ev.Start()
 			if buf := e.activeBuffer(); buf != nil {
 				buf.Pasting = e.pasting
 			}
 		}
+
+		// Keep language servers up to date with the edits just made
+		e.syncDocuments()
 	}
 
 	// Save session before cleanup
-	e.SaveSession()
+	sessionErr := e.SaveSession()
+	e.saveCurrentSession()
+	e.saveAllUndo()
+	e.saveClipboardHistory()
 
 	// Clean up file watcher
 	if e.fileWatcher != nil {
 		e.fileWatcher.Close()
 	}
 
-	// Clean up backups on clean exit
-	e.cleanAllBackups()
+	// Clean up backups on clean exit. Without the session, the backups are
+	// all that is left of changes hot exit meant to keep.
+	if sessionErr == nil {
+		e.cleanAllBackups()
+	}
 
 	// Clean up terminal
 	if e.terminal != nil {
@@ -402,6 +445,10 @@ func (e *Editor) openFile(path string) {
 			return
 		}
 	}
+	if buf := e.bufferInOtherPane(path); buf != nil {
+		e.showBuffer(buf)
+		return
+	}
 
 	// Check if file exists before loading
 	fileExists := true
@@ -420,8 +467,7 @@ func (e *Editor) openFile(path string) {
 				if oldIV, ok := e.imageViews[e.buffers[i]]; ok {
 					oldIV.ClearProtocolImage()
 					e.needsSync = true
-					e.removeTab(i)
-					e.quit = false // removeTab may set quit if it was the last tab
+					e.dropTab(i)
 					if e.activeTab >= len(e.buffers) {
 						e.activeTab = len(e.buffers) - 1
 					}
@@ -445,26 +491,38 @@ func (e *Editor) openFile(path string) {
 		return
 	}
 
-	buf, err := buffer.NewBufferFromFile(path, e.cfg.TabSize)
+	buf, err := e.loadBuffer(path)
 	if err != nil {
 		e.setTemporaryError("Error: " + err.Error())
 		return
 	}
 	buf.Language = highlight.DetectLanguage(path)
 	e.applyFileSettings(buf)
+	hexErr := e.openBinaryInHex(buf)
 	e.buffers = append(e.buffers, buf)
 	e.views[buf] = &EditorView{}
 	e.tabBar.AddTab(path, false)
 	e.switchTab(len(e.buffers) - 1)
-	e.lspManager.DidOpen(buf.Language, path, strings.Join(buf.Lines, "\n"))
+	if buf.Large() == nil && !buf.IsBinary {
+		e.lspManager.DidOpen(buf.Language, path, buf.Text())
+	}
 
 	// Set status message based on file state
 	if !fileExists {
 		e.statusBar.Message = fmt.Sprintf("New file: %s", filepath.Base(path))
+	} else if buf.Large() != nil {
+		e.statusBar.Message = fmt.Sprintf("Large file (%d MB) opened read-only", buf.FileSize/(1024*1024))
+	} else if e.hexViews[buf] != nil {
+		e.statusBar.Message = "Binary file opened in the hex editor"
 	} else if buf.ReadOnly {
 		e.statusBar.Message = "⚠ Binary file opened as read-only"
+		if hexErr != nil {
+			e.statusBar.Message += " (hex editor: " + hexErr.Error() + ")"
+		}
 	} else if buf.FileSize > 10*1024*1024 {
 		e.statusBar.Message = fmt.Sprintf("⚠ Large file (%d MB)", buf.FileSize/(1024*1024))
+	} else if buf.MixedLineEndings {
+		e.statusBar.Message = mixedLineEndingsWarning(buf)
 	} else {
 		e.statusBar.Message = ""
 	}
@@ -482,6 +540,10 @@ func (e *Editor) openFilePreview(path string) {
 			return
 		}
 	}
+	if buf := e.bufferInOtherPane(path); buf != nil {
+		e.showBuffer(buf)
+		return
+	}
 
 	// Check if file exists before loading
 	fileExists := true
@@ -498,22 +560,32 @@ func (e *Editor) openFilePreview(path string) {
 	// If there's an existing preview tab, replace it
 	if e.previewTab >= 0 && e.previewTab < len(e.buffers) && e.previewTab < len(e.tabBar.Tabs) {
 		oldBuf := e.buffers[e.previewTab]
+		// Another pane showing the old buffer keeps it open
+		shared := e.inOtherPane(oldBuf)
 		if !oldBuf.Dirty {
 			// Clean up any old image view
-			if iv, ok := e.imageViews[oldBuf]; ok {
+			if iv, ok := e.imageViews[oldBuf]; ok && !shared {
 				iv.Close()
 				delete(e.imageViews, oldBuf)
 			}
+			if !shared {
+				e.saveUndo(oldBuf)
+				delete(e.hexViews, oldBuf)
+			}
 			// Replace the preview tab content
-			newBuf, err := buffer.NewBufferFromFile(path, e.cfg.TabSize)
+			newBuf, err := e.loadBuffer(path)
 			if err != nil {
 				e.setTemporaryError("Error: " + err.Error())
 				return
 			}
 			newBuf.Language = highlight.DetectLanguage(path)
 			e.applyFileSettings(newBuf)
+			e.openBinaryInHex(newBuf)
+			if !shared {
+				oldBuf.Close()
+				e.highlight.InvalidateCache(oldBuf.Path)
+			}
 			delete(e.views, oldBuf)
-			e.highlight.InvalidateCache(oldBuf.Path)
 			e.buffers[e.previewTab] = newBuf
 			e.views[newBuf] = &EditorView{}
 			e.tabBar.Tabs[e.previewTab].Title = filepath.Base(path)
@@ -532,24 +604,29 @@ func (e *Editor) openFilePreview(path string) {
 	}
 
 	// Open as new preview tab
-	buf, err := buffer.NewBufferFromFile(path, e.cfg.TabSize)
+	buf, err := e.loadBuffer(path)
 	if err != nil {
 		e.setTemporaryError("Error: " + err.Error())
 		return
 	}
 	buf.Language = highlight.DetectLanguage(path)
 	e.applyFileSettings(buf)
+	e.openBinaryInHex(buf)
 	e.buffers = append(e.buffers, buf)
 	e.views[buf] = &EditorView{}
 	e.tabBar.AddTab(path, false)
 	e.tabBar.Tabs[len(e.tabBar.Tabs)-1].Preview = true
 	e.previewTab = len(e.buffers) - 1
 	e.switchTab(e.previewTab)
-	e.lspManager.DidOpen(buf.Language, path, strings.Join(buf.Lines, "\n"))
+	if buf.Large() == nil && !buf.IsBinary {
+		e.lspManager.DidOpen(buf.Language, path, buf.Text())
+	}
 
 	// Set status message
 	if !fileExists {
 		e.statusBar.Message = fmt.Sprintf("New file: %s", filepath.Base(path))
+	} else if buf.MixedLineEndings {
+		e.statusBar.Message = mixedLineEndingsWarning(buf)
 	} else {
 		e.statusBar.Message = ""
 	}
@@ -559,6 +636,7 @@ func (e *Editor) openFilePreview(path string) {
 func (e *Editor) openEmptyBuffer() {
 	buf := buffer.NewBuffer(e.cfg.TabSize)
 	buf.AutoCloseEnabled = e.cfg.AutoClose
+	buf.UntitledID = newUntitledID()
 	e.buffers = append(e.buffers, buf)
 	e.views[buf] = &EditorView{}
 	// Don't use AddTab here — its dedup check merges all untitled tabs.
@@ -582,9 +660,6 @@ func (e *Editor) switchTab(idx int) {
 			e.buffers[e.activeTab].ClearExtraCursors()
 		}
 
-		// Clear stale selection anchor from previous buffer
-		selectionAnchor = nil
-
 		e.activeTab = idx
 		e.tabBar.Active = idx
 		e.gitGutter.Update(e.buffers[idx].Path)
@@ -607,7 +682,8 @@ func (e *Editor) closeTab(idx int) {
 		return
 	}
 	buf := e.buffers[idx]
-	if buf.Dirty {
+	// Another pane showing the buffer keeps its changes
+	if buf.Dirty && !e.inOtherPane(buf) {
 		name := filepath.Base(buf.Path)
 		if name == "." || name == "" {
 			name = "untitled"
@@ -616,7 +692,11 @@ func (e *Editor) closeTab(idx int) {
 		e.dialog.OnConfirm = func(answer rune) {
 			switch answer {
 			case 'y':
-				buf.SaveWithOptions(e.cfg.TrimTrailingSpace, e.cfg.InsertFinalNewline)
+				if hv, ok := e.hexViews[buf]; ok {
+					e.saveHexView(buf, hv)
+				} else {
+					buf.SaveWithOptions(e.cfg.TrimTrailingSpace, e.cfg.InsertFinalNewline)
+				}
 				buf.ExternallyModified = false
 				e.removeTab(idx)
 			case 'n':
@@ -632,19 +712,35 @@ func (e *Editor) closeTab(idx int) {
 }
 
 func (e *Editor) removeTab(idx int) {
+	if e.dropTab(idx) {
+		e.quit = true
+	}
+}
+
+// dropTab closes tab idx like removeTab, but closing the last tab of the
+// last pane leaves the editor without tabs instead of quitting. It reports
+// whether that happened; the caller opens another tab.
+func (e *Editor) dropTab(idx int) (empty bool) {
 	if idx < 0 || idx >= len(e.buffers) {
-		return
+		return false
 	}
 	buf := e.buffers[idx]
 	delete(e.views, buf)
-	// Clean up image view if present
-	if iv, ok := e.imageViews[buf]; ok {
-		iv.ClearProtocolImage()
-		e.needsSync = true
-		iv.Close()
-		delete(e.imageViews, buf)
+	// A buffer still shown in another pane stays open
+	if !e.inOtherPane(buf) {
+		e.saveUndo(buf)
+		e.cleanUntitledBackup(buf)
+		buf.Close()
+		delete(e.hexViews, buf)
+		// Clean up image view if present
+		if iv, ok := e.imageViews[buf]; ok {
+			iv.ClearProtocolImage()
+			e.needsSync = true
+			iv.Close()
+			delete(e.imageViews, buf)
+		}
+		e.highlight.InvalidateCache(buf.Path)
 	}
-	e.highlight.InvalidateCache(buf.Path)
 	e.buffers = append(e.buffers[:idx], e.buffers[idx+1:]...)
 	e.tabBar.RemoveTab(idx)
 
@@ -656,14 +752,15 @@ func (e *Editor) removeTab(idx int) {
 	}
 
 	if len(e.buffers) == 0 {
-		e.quit = true
-		return
+		// Closing the last tab of a split pane closes the pane
+		return !e.closePane()
 	}
 	if e.activeTab >= len(e.buffers) {
 		e.activeTab = len(e.buffers) - 1
 	}
 	e.tabBar.Active = e.activeTab
 	e.updateStatus()
+	return false
 }
 
 func (e *Editor) activeBuffer() *buffer.Buffer {
@@ -690,6 +787,14 @@ func (e *Editor) saveCurrentFile() {
 		e.openSaveAsDialog()
 		return
 	}
+	if hv, ok := e.hexViews[buf]; ok {
+		if err := e.saveHexView(buf, hv); err != nil {
+			e.setTemporaryError("Error saving: " + err.Error())
+			return
+		}
+		e.onSaveSuccess(buf, "Saved "+filepath.Base(buf.Path))
+		return
+	}
 	err := buf.SaveWithOptions(e.cfg.TrimTrailingSpace, e.cfg.InsertFinalNewline)
 	if err != nil {
 		if os.IsPermission(err) {
@@ -708,6 +813,10 @@ func (e *Editor) onSaveSuccess(buf *buffer.Buffer, message string) {
 	e.tabBar.SetModified(e.activeTab, false)
 	e.tabBar.SetExternallyModified(e.activeTab, false)
 	e.cleanBackup(buf.Path)
+	e.cleanUntitledBackup(buf)
+	buf.UntitledID = ""
+	e.recordFileVersion(buf)
+	e.saveUndo(buf)
 	e.gitGutter.Update(buf.Path)
 	e.lspManager.DidSave(buf.Path)
 }
@@ -735,7 +844,7 @@ func (e *Editor) promptSudoSave(buf *buffer.Buffer, path string, onSuccess func(
 }
 
 func (e *Editor) saveWithSudo(buf *buffer.Buffer, path, password string) error {
-	content := buf.BuildSaveContent(e.cfg.TrimTrailingSpace, e.cfg.InsertFinalNewline)
+	content := string(buf.EncodeContent(buf.BuildSaveContent(e.cfg.TrimTrailingSpace, e.cfg.InsertFinalNewline)))
 
 	// Validate credentials first so password input is never mixed with file content.
 	authCmd := exec.Command("sudo", "-S", "-k", "-p", "", "-v")
@@ -768,6 +877,9 @@ func (e *Editor) saveWithSudo(buf *buffer.Buffer, path, password string) error {
 
 	buf.MarkSaved()
 	buf.LastSaveTime = time.Now()
+	if buf.Following() {
+		buf.StartFollow()
+	}
 	return nil
 }
 
@@ -813,12 +925,14 @@ func (e *Editor) performReload() {
 	oldLine := buf.Cursor.Line
 	oldCol := buf.Cursor.Col
 
-	// Reload from disk
-	newBuf, err := buffer.NewBufferFromFile(buf.Path, e.cfg.TabSize)
+	// Reload from disk, keeping the undo history if the file is unchanged
+	e.saveUndo(buf)
+	newBuf, err := e.reloadBuffer(buf)
 	if err != nil {
 		e.setTemporaryError("Error reloading: " + err.Error())
 		return
 	}
+	buf.Close()
 
 	// Copy properties
 	newBuf.Language = buf.Language
@@ -826,16 +940,20 @@ func (e *Editor) performReload() {
 
 	// Replace buffer in place
 	*buf = *newBuf
+	if hv, ok := e.hexViews[buf]; ok {
+		hv.Reload()
+		buf.ReadOnly = true
+	}
 
 	// Restore cursor position (clamped to new content)
 	buf.Cursor.Line = oldLine
 	buf.Cursor.Col = oldCol
-	if buf.Cursor.Line >= len(buf.Lines) {
-		buf.Cursor.Line = len(buf.Lines) - 1
+	if buf.Cursor.Line >= buf.LineCount() {
+		buf.Cursor.Line = buf.LineCount() - 1
 	}
-	if buf.Cursor.Line >= 0 && buf.Cursor.Line < len(buf.Lines) {
-		if buf.Cursor.Col > buffer.RuneLen(buf.Lines[buf.Cursor.Line]) {
-			buf.Cursor.Col = buffer.RuneLen(buf.Lines[buf.Cursor.Line])
+	if buf.Cursor.Line >= 0 && buf.Cursor.Line < buf.LineCount() {
+		if buf.Cursor.Col > buffer.RuneLen(buf.Line(buf.Cursor.Line)) {
+			buf.Cursor.Col = buffer.RuneLen(buf.Line(buf.Cursor.Line))
 		}
 	}
 
@@ -851,11 +969,35 @@ func (e *Editor) performReload() {
 	e.setTemporaryMessage("Reloaded " + filepath.Base(buf.Path))
 }
 
+// documentVersion is the version language servers know buf's text by. It
+// goes up with every edit, so an edit computed against an older text can be
+// told apart.
+func documentVersion(buf *buffer.Buffer) int {
+	return buf.Version() + 1
+}
+
+// syncDocuments sends the language servers the text of every open buffer
+// edited since they last saw it.
+func (e *Editor) syncDocuments() {
+	if e.lspManager == nil {
+		return
+	}
+	for _, buf := range e.allBuffers() {
+		if buf.Path == "" || buf.Large() != nil {
+			continue
+		}
+		if sent := e.lspManager.DocumentVersion(buf.Path); sent != 0 && sent != documentVersion(buf) {
+			e.lspManager.DidChange(buf.Path, buf.Text(), documentVersion(buf))
+		}
+	}
+}
+
 func (e *Editor) gotoDefinition() {
 	buf := e.activeBuffer()
-	if buf == nil || buf.Path == "" || e.lspManager == nil {
+	if buf == nil || buf.Path == "" || buf.Large() != nil || e.lspManager == nil {
 		return
 	}
+	e.syncDocuments()
 	loc := e.lspManager.Definition(buf.Language, buf.Path, buf.Cursor.Line, buf.Cursor.Col)
 	if loc == nil {
 		e.setTemporaryError("No definition found")
@@ -879,14 +1021,33 @@ func (e *Editor) gotoDefinition() {
 
 func (e *Editor) renameSymbol() {
 	buf := e.activeBuffer()
-	if buf == nil || buf.Path == "" || e.lspManager == nil {
+	if buf == nil || buf.Path == "" || buf.Large() != nil || e.lspManager == nil {
+		return
+	}
+	line, col := buf.Cursor.Line, buf.Cursor.Col
+	e.syncDocuments()
+
+	// Let the server validate the position before asking for a name
+	rng, placeholder, err := e.lspManager.PrepareRename(buf.Language, buf.Path, line, col)
+	if err != nil {
+		e.setTemporaryError("Cannot rename: " + err.Error())
 		return
 	}
-	word := buf.WordAtCursor()
+	word := placeholder
+	if word == "" && rng != nil && rng.Start.Line == rng.End.Line {
+		word = buf.GetTextInRange(
+			buffer.Cursor{Line: rng.Start.Line, Col: rng.Start.Character},
+			buffer.Cursor{Line: rng.End.Line, Col: rng.End.Character},
+		)
+	}
+	if word == "" {
+		word = buf.WordAtCursor()
+	}
 	if word == "" {
 		e.setTemporaryError("No symbol under cursor")
 		return
 	}
+
 	d := ui.NewInputDialog("Rename: ")
 	d.Input = word
 	d.Cursor = len([]rune(word))
@@ -895,13 +1056,16 @@ func (e *Editor) renameSymbol() {
 		if newName == "" || newName == word {
 			return
 		}
-		edit := e.lspManager.Rename(buf.Language, buf.Path, buf.Cursor.Line, buf.Cursor.Col, newName)
-		if edit == nil || len(edit.Changes) == 0 {
+		e.syncDocuments()
+		edit := e.lspManager.Rename(buf.Language, buf.Path, line, col, newName)
+		if edit == nil || edit.Empty() {
 			e.setTemporaryError("Rename failed")
 			return
 		}
-		e.applyWorkspaceEdit(edit)
-		e.statusBar.Message = fmt.Sprintf("Renamed '%s' to '%s'", word, newName)
+		title := fmt.Sprintf("Rename '%s' → '%s'", word, newName)
+		e.previewWorkspaceEdit(title, edit, func(applied int) {
+			e.statusBar.Message = fmt.Sprintf("Renamed '%s' to '%s' (%d changes)", word, newName, applied)
+		})
 	}
 	d.OnCancel = func() {
 		e.dialog = nil
@@ -909,81 +1073,26 @@ func (e *Editor) renameSymbol() {
 	e.dialog = d
 }
 
-func (e *Editor) applyWorkspaceEdit(edit *lsp.WorkspaceEdit) {
-	for uri, edits := range edit.Changes {
-		path := lsp.URIToPath(uri)
-		var buf *buffer.Buffer
-		for _, b := range e.buffers {
-			if b.Path == path {
-				buf = b
-				break
-			}
-		}
-		if buf == nil {
-			e.openFile(path)
-			buf = e.activeBuffer()
-		}
-		if buf == nil {
-			continue
-		}
-
-		// Sort edits bottom-to-top to preserve positions
-		sort.Slice(edits, func(i, j int) bool {
-			if edits[i].Range.Start.Line != edits[j].Range.Start.Line {
-				return edits[i].Range.Start.Line > edits[j].Range.Start.Line
-			}
-			return edits[i].Range.Start.Character > edits[j].Range.Start.Character
-		})
-
-		for _, te := range edits {
-			startPos := buffer.Cursor{Line: te.Range.Start.Line, Col: te.Range.Start.Character}
-			endPos := buffer.Cursor{Line: te.Range.End.Line, Col: te.Range.End.Character}
-			oldText := buf.GetTextInRange(startPos, endPos)
-			if oldText != "" {
-				buf.RemoveTextAt(startPos, oldText)
-			}
-			if te.NewText != "" {
-				buf.InsertTextAtPos(startPos, te.NewText)
-			}
-		}
-		buf.RecomputeDirty()
-		e.highlight.InvalidateCache(path)
-		// Update tab modified indicator
-		for i, b := range e.buffers {
-			if b == buf {
-				e.tabBar.SetModified(i, buf.Dirty)
-				break
-			}
-		}
-	}
-}
-
 func (e *Editor) showHoverInfo() {
 	buf := e.activeBuffer()
-	if buf == nil || buf.Path == "" || e.lspManager == nil {
+	if buf == nil || buf.Path == "" || buf.Large() != nil || e.lspManager == nil {
 		return
 	}
+	e.syncDocuments()
 	info := e.lspManager.Hover(buf.Language, buf.Path, buf.Cursor.Line, buf.Cursor.Col)
 	if info == "" {
-		e.statusBar.Message = "No hover info"
-	} else {
-		// Truncate for status bar display
-		if len(info) > 120 {
-			info = info[:120] + "…"
-		}
-		// Replace newlines with spaces for status bar
-		for i, ch := range info {
-			if ch == '\n' || ch == '\r' {
-				// Safe slicing - check bounds before accessing i+1
-				if i+1 < len(info) {
-					info = info[:i] + " " + info[i+1:]
-				} else {
-					info = info[:i] + " "
-				}
-			}
-		}
-		e.statusBar.Message = info
+		e.setTemporaryMessage("No hover info")
+		return
+	}
+	x, y, ok := e.cursorScreenPos()
+	if !ok {
+		return
+	}
+	popup := ui.NewHoverPopup(info, buf.Language, x, y, e.highlight, e.cfg.GetTheme())
+	popup.OnClose = func() {
+		e.hover = nil
 	}
+	e.hover = popup
 }
 
 func (e *Editor) toggleTerminal() {
@@ -1086,10 +1195,13 @@ func (e *Editor) applyFileSettings(buf *buffer.Buffer) {
 	buf.TabSize = e.cfg.LanguageTabSize(buf.Language)
 	buf.UseTabs = e.cfg.LanguageUseTabs(buf.Language)
 	buf.AutoCloseEnabled = e.cfg.AutoClose
+	buf.PreserveLineEndings = e.cfg.PreserveMixedLineEndings
+	buf.MaxLineLength = 0
 
 	// Override with .editorconfig if present
 	if buf.Path != "" {
 		if ec := config.FindEditorConfig(buf.Path); ec != nil {
+			buf.MaxLineLength = ec.MaxLineLength
 			if ec.IndentSize > 0 {
 				buf.TabSize = ec.IndentSize
 			}
@@ -1105,6 +1217,8 @@ func (e *Editor) applyFileSettings(buf *buffer.Buffer) {
 				buf.LineEnding = "CRLF"
 			} else if ec.EndOfLine == "lf" {
 				buf.LineEnding = "LF"
+			} else if ec.EndOfLine == "cr" {
+				buf.LineEnding = "CR"
 			}
 		}
 	}
@@ -1120,6 +1234,11 @@ func (e *Editor) updateStatus() {
 		e.statusBar.Filename = "untitled"
 	}
 
+	if hv, ok := e.hexViews[buf]; ok {
+		e.updateHexStatus(buf, hv)
+		return
+	}
+
 	// Image view: show image-specific status
 	if iv, ok := e.imageViews[buf]; ok {
 		e.statusBar.Line = 0
@@ -1140,16 +1259,26 @@ func (e *Editor) updateStatus() {
 	e.statusBar.Line = buf.Cursor.Line
 	e.statusBar.Col = buf.Cursor.Col
 	e.statusBar.Language = buf.Language
-	e.statusBar.LineEnd = buf.LineEnding
+	e.statusBar.LineEnd = lineEndingLabel(buf)
 	e.statusBar.Encoding = buf.Encoding
 	if e.statusBar.Encoding == "" {
 		e.statusBar.Encoding = "UTF-8"
 	}
 	if e.focusTarget == "terminal" {
 		e.statusBar.Mode = "TERM"
+	} else if lf := buf.Large(); lf != nil {
+		e.statusBar.Mode = largeFileMode(lf)
+		if buf.Following() && e.statusBar.Mode == "VIEW" {
+			e.statusBar.Mode = "FOLLOW"
+		}
+	} else if buf.Following() {
+		e.statusBar.Mode = "FOLLOW"
 	} else {
 		e.statusBar.Mode = "EDIT"
 	}
+	if e.macro.recording {
+		e.statusBar.Mode = "REC"
+	}
 	// Selection info
 	if buf.Selection != nil && !buf.Selection.Empty() {
 		text := buf.GetSelectedText()
@@ -1223,18 +1352,11 @@ func (e *Editor) termLayout() (x, y, w, h int) {
 	return
 }
 
+// editorLayout returns the focused pane's editing area, below its tab bar.
 func (e *Editor) editorLayout() (x, y, w, h int) {
-	screenW, screenH := e.screen.Size()
-	left := e.treeLeft()
-	x = left
-	y = 1 // below tab bar
-	w = screenW - left
-	h = screenH - 2 // -1 tab bar, -1 status bar
-	if e.termOpen {
-		_, termY, _, _ := e.termLayout()
-		h = termY - y
-	}
-	return
+	e.layoutPanes()
+	p := e.pane
+	return p.x, p.y + 1, p.w, p.h - 1
 }
 
 // setStatusMessage sets a permanent status message (won't auto-clear)
@@ -1285,17 +1407,27 @@ func (e *Editor) openQuickOpen() {
 
 func (e *Editor) openCommandPalette() {
 	e.closeFragileModals()
+	e.macro.paletteAt = len(e.macro.keys)
 
 	theme := e.cfg.GetTheme()
 	commands := []ui.Command{
 		{Name: "Save", Shortcut: "Ctrl+S", Action: func() { e.saveCurrentFile() }},
 		{Name: "Save As", Shortcut: "", Action: func() { e.openSaveAsDialog() }},
 		{Name: "Reload", Shortcut: "", Action: func() { e.reloadFile() }},
+		{Name: "Toggle Follow Mode", Shortcut: "", Action: func() { e.toggleFollow() }},
+		{Name: "Toggle Hex Editor", Shortcut: "", Action: func() { e.toggleHexView() }},
+		{Name: "Reopen with Encoding", Shortcut: "", Action: func() { e.reopenWithEncoding() }},
+		{Name: "Save with Encoding", Shortcut: "", Action: func() { e.saveWithEncoding() }},
+		{Name: "Convert Line Endings to LF", Shortcut: "", Action: func() { e.convertLineEndings("LF") }},
+		{Name: "Convert Line Endings to CRLF", Shortcut: "", Action: func() { e.convertLineEndings("CRLF") }},
+		{Name: "Convert Line Endings to CR", Shortcut: "", Action: func() { e.convertLineEndings("CR") }},
 		{Name: "New File", Shortcut: "Ctrl+N", Action: func() { e.openEmptyBuffer() }},
 		{Name: "Close Tab", Shortcut: "Ctrl+W", Action: func() { e.closeTab(e.activeTab) }},
 		{Name: "Find", Shortcut: "Ctrl+F", Action: func() { e.openFindDialog() }},
 		{Name: "Find and Replace", Shortcut: "Ctrl+R", Action: func() { e.openFindReplaceDialog() }},
+		{Name: "Find in Files", Shortcut: "Ctrl+Shift+F", Action: func() { e.openProjectSearch() }},
 		{Name: "Go to Line", Shortcut: "Ctrl+G", Action: func() { e.openGotoLineDialog() }},
+		{Name: "Show Hover", Shortcut: "Ctrl+K", Action: func() { e.showHoverInfo() }},
 		{Name: "Quick Open", Shortcut: "", Action: func() { e.openQuickOpen() }},
 		{Name: "Toggle Word Wrap", Shortcut: "Alt+Z", Action: func() {
 			e.cfg.WordWrap = !e.cfg.WordWrap
@@ -1308,6 +1440,13 @@ func (e *Editor) openCommandPalette() {
 		}},
 		{Name: "Toggle File Tree", Shortcut: "Ctrl+B", Action: func() { e.toggleTree() }},
 		{Name: "Toggle Terminal", Shortcut: "Ctrl+T", Action: func() { e.toggleTerminal() }},
+		{Name: "Split Right", Shortcut: "Ctrl+\\", Action: func() { e.splitPane(true, false) }},
+		{Name: "Split Down", Shortcut: "Alt+\\", Action: func() { e.splitPane(false, false) }},
+		{Name: "Focus Next Pane", Shortcut: "F6", Action: func() { e.focusNextPane(1) }},
+		{Name: "Focus Previous Pane", Shortcut: "Shift+F6", Action: func() { e.focusNextPane(-1) }},
+		{Name: "Move Tab to Next Pane", Shortcut: "Ctrl+Alt+Right", Action: func() { e.moveTabToPane(1) }},
+		{Name: "Move Tab to Previous Pane", Shortcut: "Ctrl+Alt+Left", Action: func() { e.moveTabToPane(-1) }},
+		{Name: "Close Pane", Shortcut: "", Action: func() { e.closeFocusedPane() }},
 		{Name: "Toggle Code Fold", Shortcut: "Ctrl+.", Action: func() {
 			buf := e.activeBuffer()
 			if buf != nil {
@@ -1323,6 +1462,7 @@ func (e *Editor) openCommandPalette() {
 				e.updateStatus()
 			}
 		}},
+		{Name: "Undo Workspace Edit", Shortcut: "", Action: func() { e.undoWorkspaceEdit() }},
 		{Name: "Redo", Shortcut: "Ctrl+Shift+Z", Action: func() {
 			buf := e.activeBuffer()
 			if buf != nil {
@@ -1330,6 +1470,16 @@ func (e *Editor) openCommandPalette() {
 				e.updateStatus()
 			}
 		}},
+		{Name: "Undo Tree", Shortcut: "", Action: func() { e.openUndoTree() }},
+		{Name: "Go Back in Time", Shortcut: "", Action: func() { e.openGoBackInTimeDialog() }},
+		{Name: "File History", Shortcut: "", Action: func() { e.openFileHistory() }},
+		{Name: "Save Session As", Shortcut: "", Action: func() { e.openSaveSessionDialog() }},
+		{Name: "Switch Session", Shortcut: "", Action: func() { e.openSwitchSessionPicker() }},
+		{Name: "Delete Session", Shortcut: "", Action: func() { e.openDeleteSessionPicker() }},
+		{Name: "Save Workspace As", Shortcut: "", Action: func() { e.openSaveWorkspaceDialog() }},
+		{Name: "Open Workspace", Shortcut: "", Action: func() { e.openWorkspacePicker() }},
+		{Name: "Add Folder to Workspace", Shortcut: "", Action: func() { e.openAddFolderDialog() }},
+		{Name: "Remove Folder from Workspace", Shortcut: "", Action: func() { e.openRemoveFolderPicker() }},
 		{Name: "Copy", Shortcut: "Ctrl+C", Action: func() { e.copySelection() }},
 		{Name: "Paste", Shortcut: "Ctrl+V", Action: func() { e.pasteClipboard() }},
 		{Name: "Cut", Shortcut: "Ctrl+X", Action: func() { e.cutSelection() }},
@@ -1339,6 +1489,21 @@ func (e *Editor) openCommandPalette() {
 				buf.SelectAll()
 			}
 		}},
+		{Name: "Add Next Occurrence", Shortcut: "Ctrl+D", Action: func() { e.selectNextOccurrence() }},
+		{Name: "Skip Occurrence", Shortcut: "Alt+D", Action: func() { e.skipOccurrence() }},
+		{Name: "Select All Occurrences", Shortcut: "Ctrl+Shift+L", Action: func() { e.selectAllOccurrences() }},
+		{Name: "Add Cursor Above", Shortcut: "Ctrl+Alt+Up", Action: func() { e.addCursorVertical(-1) }},
+		{Name: "Add Cursor Below", Shortcut: "Ctrl+Alt+Down", Action: func() { e.addCursorVertical(1) }},
+		{Name: "Add Cursors to Line Ends", Shortcut: "Alt+Shift+I", Action: func() { e.addCursorsToLineEnds() }},
+		{Name: "Start/Stop Macro Recording", Shortcut: "F7", Action: e.macroCommand(e.toggleMacroRecording)},
+		{Name: "Play Macro", Shortcut: "F8", Action: e.macroCommand(func() { e.playLastMacro(1) })},
+		{Name: "Play Macro Multiple Times", Shortcut: "", Action: e.macroCommand(e.openPlayMacroTimesDialog)},
+		{Name: "Play Macro on Selected Lines", Shortcut: "", Action: e.macroCommand(e.playMacroOnLines)},
+		{Name: "Save Macro", Shortcut: "", Action: e.macroCommand(e.openSaveMacroDialog)},
+		{Name: "Play Saved Macro", Shortcut: "", Action: e.macroCommand(e.playSavedMacro)},
+		{Name: "Delete Saved Macro", Shortcut: "", Action: e.macroCommand(e.deleteSavedMacro)},
+		{Name: "Paste from History", Shortcut: "", Action: e.openClipboardHistory},
+		{Name: "Cycle Paste", Shortcut: "Alt+V", Action: e.cyclePaste},
 		{Name: "Toggle Line Comment", Shortcut: "Ctrl+/", Action: func() {
 			buf := e.activeBuffer()
 			if buf != nil {
@@ -1368,6 +1533,9 @@ func (e *Editor) openCommandPalette() {
 	if e.fileTree != nil {
 		cp.SetWorkDir(e.fileTree.GetRoot())
 	}
+	if e.screen != nil {
+		cp.Post = e.screen.PostEventWait
+	}
 	e.commandPalette = cp
 }
 
@@ -1399,7 +1567,7 @@ func (e *Editor) navigateToLocation(path string, line int) {
 	// Navigate to the line
 	if tabIdx >= 0 && tabIdx < len(e.buffers) {
 		buf := e.buffers[tabIdx]
-		if line > 0 && line <= len(buf.Lines) {
+		if line > 0 && line <= buf.LineCount() {
 			buf.Cursor.Line = line - 1 // Convert to 0-based
 			buf.Cursor.Col = 0
 			buf.Selection = nil // Clear selection
@@ -1532,6 +1700,20 @@ func (e *Editor) addWatchRecursive(root string) {
 	})
 }
 
+// inTreeFolder reports whether path is under one of the explorer's folders.
+func (e *Editor) inTreeFolder(path string) bool {
+	roots := []string{e.watchedRoot}
+	if e.fileTree != nil {
+		roots = append(roots, e.fileTree.Roots()...)
+	}
+	for _, root := range roots {
+		if strings.HasPrefix(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Editor) shouldIgnorePath(path string) bool {
 	base := filepath.Base(path)
 	// Ignore hidden files/dirs, build artifacts, version control
@@ -1547,14 +1729,18 @@ func (e *Editor) shouldIgnorePath(path string) bool {
 func (e *Editor) handleFileWatchEvent(ev *FileWatchEvent) {
 	// Check if this file is open in a buffer
 	var affectedBuf *buffer.Buffer
-	var bufIdx int
-	for i, buf := range e.buffers {
+	bufIdx := -1 // tab in the focused pane; other panes' tabs are synced on render
+	for _, buf := range e.allBuffers() {
 		if buf.Path == ev.Path {
 			affectedBuf = buf
-			bufIdx = i
 			break
 		}
 	}
+	for i, buf := range e.buffers {
+		if buf == affectedBuf {
+			bufIdx = i
+		}
+	}
 
 	if affectedBuf != nil {
 		// File is open in editor
@@ -1563,6 +1749,23 @@ func (e *Editor) handleFileWatchEvent(ev *FileWatchEvent) {
 			// File was deleted
 			e.statusBar.Message = "Warning: " + filepath.Base(ev.Path) + " was deleted externally"
 
+		case e.hexViews[affectedBuf] != nil && ev.Op&(fsnotify.Write|fsnotify.Create) != 0:
+			hv := e.hexViews[affectedBuf]
+			if info, err := os.Stat(ev.Path); err != nil || info.ModTime().Sub(affectedBuf.LastSaveTime) <= time.Second {
+				break
+			}
+			if hv.Modified() {
+				affectedBuf.ExternallyModified = true
+				e.tabBar.SetExternallyModified(bufIdx, true)
+				e.statusBar.Message = "⚠ " + filepath.Base(ev.Path) + " was modified externally! (unsaved hex edits)"
+			} else if hv.Reload() == nil {
+				e.statusBar.Message = "↻ " + filepath.Base(ev.Path) + " (reloaded)"
+			}
+
+		case affectedBuf.Following() && ev.Op&(fsnotify.Write|fsnotify.Create) != 0:
+			// Appends to a followed file aren't external modifications
+			e.followFile(bufIdx, affectedBuf)
+
 		case ev.Op&fsnotify.Write != 0 || ev.Op&fsnotify.Create != 0:
 			// File was modified externally
 			// Check if we just saved it (to avoid reload loop)
@@ -1579,9 +1782,19 @@ func (e *Editor) handleFileWatchEvent(ev *FileWatchEvent) {
 					affectedBuf.ExternallyModified = true
 					e.tabBar.SetExternallyModified(bufIdx, true)
 					e.statusBar.Message = "⚠ " + filepath.Base(ev.Path) + " was modified externally! (unsaved changes)"
+				} else if lf := affectedBuf.Large(); lf != nil {
+					// Large files pick up appends without reloading
+					lf.Refresh()
+					affectedBuf.FileSize = lf.Size()
+					if affectedBuf.Cursor.Line >= affectedBuf.LineCount() {
+						affectedBuf.Cursor = buffer.Cursor{Line: affectedBuf.LineCount() - 1}
+						affectedBuf.Selection = nil
+					}
 				} else {
-					// Buffer is clean - reload silently
-					newBuf, err := buffer.NewBufferFromFile(ev.Path, e.cfg.TabSize)
+					// Buffer is clean - reload silently, keeping the
+					// undo history if only the timestamp changed
+					e.saveUndo(affectedBuf)
+					newBuf, err := e.reloadBuffer(affectedBuf)
 					if err == nil {
 						// Preserve cursor position if possible
 						oldCursor := affectedBuf.Cursor
@@ -1589,16 +1802,16 @@ func (e *Editor) handleFileWatchEvent(ev *FileWatchEvent) {
 						e.applyFileSettings(newBuf)
 						newBuf.LastSaveTime = modTime
 
-						// Replace buffer
-						e.buffers[bufIdx] = newBuf
-						e.views[newBuf] = e.views[affectedBuf]
-						delete(e.views, affectedBuf)
+						// Replace buffer in place, for every pane showing it
+						affectedBuf.Close()
+						*affectedBuf = *newBuf
+						newBuf = affectedBuf
 
 						// Restore cursor if still valid
-						if oldCursor.Line < len(newBuf.Lines) {
+						if oldCursor.Line < newBuf.LineCount() {
 							newBuf.Cursor = oldCursor
-							if newBuf.Cursor.Col > len(newBuf.Lines[newBuf.Cursor.Line]) {
-								newBuf.Cursor.Col = len(newBuf.Lines[newBuf.Cursor.Line])
+							if newBuf.Cursor.Col > len(newBuf.Line(newBuf.Cursor.Line)) {
+								newBuf.Cursor.Col = len(newBuf.Line(newBuf.Cursor.Line))
 							}
 						}
 
@@ -1610,8 +1823,8 @@ func (e *Editor) handleFileWatchEvent(ev *FileWatchEvent) {
 		}
 	}
 
-	// Refresh file tree if event is in watched directory
-	if strings.HasPrefix(ev.Path, e.watchedRoot) {
+	// Refresh file tree if event is in one of its folders
+	if e.inTreeFolder(ev.Path) {
 		if ev.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
 			// File/directory was added, removed, or renamed
 			e.fileTree.Refresh()
@@ -0,0 +1,121 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"editor/buffer"
+	"editor/ui"
+)
+
+// reloadBuffer loads buf's file again, keeping an encoding chosen with
+// Reopen with Encoding.
+func (e *Editor) reloadBuffer(buf *buffer.Buffer) (*buffer.Buffer, error) {
+	if buf.ForcedEncoding != "" && buf.Large() == nil && !e.isLargeFile(buf.Path) {
+		newBuf, err := buffer.NewBufferFromFileEncoding(buf.Path, e.cfg.TabSize, buf.ForcedEncoding)
+		if err != nil {
+			return nil, err
+		}
+		e.restoreUndo(newBuf)
+		return newBuf, nil
+	}
+	return e.loadBuffer(buf.Path)
+}
+
+// openPicker lists choices in the command palette, marking current, and
+// calls onPick with the one chosen.
+func (e *Editor) openPicker(choices []string, current string, onPick func(choice string)) {
+	e.closeFragileModals()
+	commands := make([]ui.Command, 0, len(choices))
+	for _, choice := range choices {
+		cmd := ui.Command{Name: choice, Action: func() { onPick(choice) }}
+		if choice == current {
+			cmd.Shortcut = "current"
+		}
+		commands = append(commands, cmd)
+	}
+	cp := ui.NewCommandPalette(commands, e.cfg.GetTheme())
+	cp.OnClose = func() {
+		e.commandPalette = nil
+	}
+	e.commandPalette = cp
+}
+
+// encodingUsable reports whether the active buffer can be reopened or saved
+// in another encoding, explaining why not in the status bar.
+func (e *Editor) encodingUsable(buf *buffer.Buffer) bool {
+	switch {
+	case buf == nil:
+		return false
+	case buf.Large() != nil:
+		e.setTemporaryError("Large files can't change encoding")
+	case e.hexViews[buf] != nil, e.imageViews[buf] != nil:
+		e.setTemporaryError("Not a text file")
+	default:
+		return true
+	}
+	return false
+}
+
+// reopenWithEncoding reloads the active file decoded from a chosen
+// encoding, for files whose encoding was guessed wrong.
+func (e *Editor) reopenWithEncoding() {
+	buf := e.activeBuffer()
+	if !e.encodingUsable(buf) {
+		return
+	}
+	if buf.Path == "" {
+		e.setTemporaryError("Cannot reopen: no file path")
+		return
+	}
+	if _, err := os.Stat(buf.Path); err != nil {
+		e.setTemporaryError("Cannot reopen: file doesn't exist on disk")
+		return
+	}
+	e.openPicker(buffer.Encodings, buf.Encoding, func(enc string) {
+		reopen := func() {
+			old := buf.ForcedEncoding
+			buf.ForcedEncoding = enc
+			e.performReload()
+			if buf.Encoding != enc {
+				// The reload failed and left the buffer as it was
+				buf.ForcedEncoding = old
+				return
+			}
+			e.setTemporaryMessage("Reopened " + filepath.Base(buf.Path) + " as " + enc)
+			e.updateStatus()
+		}
+		if !buf.Dirty {
+			reopen()
+			return
+		}
+		d := ui.NewReloadConfirmDialog(filepath.Base(buf.Path))
+		d.OnConfirm = func(answer rune) {
+			e.dialog = nil
+			if answer == 'y' {
+				reopen()
+			}
+		}
+		e.dialog = d
+	})
+}
+
+// saveWithEncoding saves the active buffer in a chosen encoding, which
+// later saves keep using.
+func (e *Editor) saveWithEncoding() {
+	buf := e.activeBuffer()
+	if !e.encodingUsable(buf) {
+		return
+	}
+	e.openPicker(buffer.Encodings, buf.Encoding, func(enc string) {
+		lost := buf.UnencodableRunes(enc)
+		buf.SetEncoding(enc)
+		buf.ForcedEncoding = enc
+		e.saveCurrentFile()
+		if lost > 0 && !buf.Dirty {
+			e.setTemporaryError(fmt.Sprintf("Saved as %s; %d characters it can't represent were written as '?'", enc, lost))
+		}
+		e.updateStatus()
+	})
+}
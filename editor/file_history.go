@@ -0,0 +1,358 @@
+package editor
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"editor/buffer"
+	"editor/ui"
+)
+
+// maxFileVersions caps how many saved versions are kept per file;
+// file_history_mb caps them all together.
+const maxFileVersions = 100
+
+// maxDiffCells bounds the table lineDiff fills in; larger changes are shown
+// as the old lines removed and the new ones added.
+const maxDiffCells = 4 << 20
+
+// maxFileDiffLines caps the diff shown for one version.
+const maxFileDiffLines = 500
+
+// diffContext is how many unchanged lines are shown around a change.
+const diffContext = 2
+
+// fileVersion is a saved version of a file kept in its local history.
+type fileVersion struct {
+	Path string // where the version is stored
+	Time time.Time
+	Size int64
+}
+
+// fileHistoryMeta names the file a history directory belongs to.
+type fileHistoryMeta struct {
+	Path string `json:"path"`
+}
+
+func fileHistoryDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "aln", "history")
+}
+
+// fileHistoryDirFor returns the directory holding path's saved versions,
+// one file per version named by when it was saved.
+func fileHistoryDirFor(path string) string {
+	hash := sha256.Sum256([]byte(path))
+	return filepath.Join(fileHistoryDir(), fmt.Sprintf("%x", hash[:8]))
+}
+
+// keepsFileHistory reports whether saving buf records a version of it.
+func (e *Editor) keepsFileHistory(buf *buffer.Buffer) bool {
+	return e.cfg.FileHistoryMB > 0 && buf.Path != "" && buf.Large() == nil && !buf.IsBinary &&
+		e.hexViews[buf] == nil && e.imageViews[buf] == nil && fileHistoryDir() != ""
+}
+
+// fileVersions lists the saved versions of the file in dir, newest first.
+func fileVersions(dir string) []fileVersion {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var versions []fileVersion
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".txt")
+		if !ok {
+			continue
+		}
+		nanos, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, fileVersion{
+			Path: filepath.Join(dir, entry.Name()),
+			Time: time.Unix(0, nanos),
+			Size: info.Size(),
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Time.After(versions[j].Time) })
+	return versions
+}
+
+// recordFileVersion adds buf's text, as just saved, to its file's history,
+// unless it is the same as the newest version there.
+func (e *Editor) recordFileVersion(buf *buffer.Buffer) error {
+	if !e.keepsFileHistory(buf) {
+		return nil
+	}
+	dir := fileHistoryDirFor(buf.Path)
+	text := buf.Text()
+	versions := fileVersions(dir)
+	if len(versions) > 0 && versions[0].Size == int64(len(text)) {
+		if data, err := os.ReadFile(versions[0].Path); err == nil && string(data) == text {
+			return nil
+		}
+	}
+
+	// Saved files may come from places like /etc, so only the user can read them
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(fileHistoryMeta{Path: buf.Path})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), meta, 0600); err != nil {
+		return err
+	}
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + ".txt"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0600); err != nil {
+		return err
+	}
+
+	if len(versions)+1 > maxFileVersions {
+		for _, v := range versions[maxFileVersions-1:] {
+			os.Remove(v.Path)
+		}
+	}
+	pruneFileHistory(int64(e.cfg.FileHistoryMB) << 20)
+	return nil
+}
+
+// pruneFileHistory drops the oldest versions of any file until all of them
+// together take at most limit bytes.
+func pruneFileHistory(limit int64) {
+	root := fileHistoryDir()
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	var all []fileVersion
+	var total int64
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		for _, v := range fileVersions(filepath.Join(root, d.Name())) {
+			all = append(all, v)
+			total += v.Size
+		}
+	}
+	if total <= limit {
+		return
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+	for _, v := range all {
+		if total <= limit {
+			break
+		}
+		if os.Remove(v.Path) == nil {
+			total -= v.Size
+		}
+		dir := filepath.Dir(v.Path)
+		if len(fileVersions(dir)) == 0 {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+// openFileHistory shows the saved versions of the active file, each with
+// what restoring it would change, and restores the one picked into the
+// buffer.
+func (e *Editor) openFileHistory() {
+	buf := e.cursorBuffer()
+	if buf == nil {
+		return
+	}
+	if buf.Path == "" {
+		e.setTemporaryMessage("Save the file to start its history")
+		return
+	}
+	versions := fileVersions(fileHistoryDirFor(buf.Path))
+	if len(versions) == 0 {
+		e.setTemporaryMessage("No saved versions of " + filepath.Base(buf.Path))
+		return
+	}
+
+	text := buf.Text()
+	now := time.Now()
+	items := make([]ui.TimelineItem, len(versions))
+	for i, v := range versions {
+		items[i] = ui.TimelineItem{
+			ID:      i,
+			Label:   fmt.Sprintf("%s %s", v.Time.Format("2006-01-02 15:04:05"), timeAgo(now.Sub(v.Time))),
+			Summary: formatFileSize(v.Size),
+		}
+		if v.Size == int64(len(text)) {
+			data, err := os.ReadFile(v.Path)
+			items[i].Current = err == nil && string(data) == text
+		}
+	}
+
+	p := ui.NewTimelinePanel("File History: "+filepath.Base(buf.Path), items)
+	p.Hint = "↑↓ select · Enter restore into the buffer · Esc close · diff: - buffer, + version"
+	p.LoadDiff = func(item ui.TimelineItem) []ui.TimelineDiffLine {
+		data, err := os.ReadFile(versions[item.ID].Path)
+		if err != nil {
+			return []ui.TimelineDiffLine{{Text: err.Error()}}
+		}
+		return lineDiff(strings.Split(buf.Text(), "\n"), strings.Split(string(data), "\n"))
+	}
+	p.OnSelect = func(item ui.TimelineItem) {
+		e.timeline = nil
+		e.restoreFileVersion(buf, versions[item.ID])
+	}
+	p.OnCancel = func() {
+		e.timeline = nil
+	}
+	e.timeline = p
+}
+
+// restoreFileVersion puts v's text in buf as one undoable edit, leaving it
+// to be saved.
+func (e *Editor) restoreFileVersion(buf *buffer.Buffer, v fileVersion) {
+	if e.activeBuffer() != buf {
+		return
+	}
+	data, err := os.ReadFile(v.Path)
+	if err != nil {
+		e.setTemporaryError("Error reading saved version: " + err.Error())
+		return
+	}
+	if string(data) == buf.Text() {
+		e.setTemporaryMessage("The buffer already has that version")
+		return
+	}
+	buf.ClearExtraCursors()
+	buf.ApplyEdits([]buffer.TextEdit{{
+		End:     buffer.Cursor{Line: buf.LineCount()},
+		NewText: string(data),
+	}})
+	e.markDirty()
+	e.setTemporaryMessage("Restored the version saved " + v.Time.Format("2006-01-02 15:04:05"))
+}
+
+func formatFileSize(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
+
+// lineDiff shows how to get from a to b, as runs of changed lines with a
+// few unchanged ones around them.
+func lineDiff(a, b []string) []ui.TimelineDiffLine {
+	// Lines the same at both ends need no table
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	am, bm := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(am) == 0 && len(bm) == 0 {
+		return []ui.TimelineDiffLine{{Text: "Same as the buffer"}}
+	}
+
+	// steps is the edit script: each line kept (0), removed from a (-1) or
+	// added from b (1)
+	type step struct {
+		kind int
+		text string
+		line int // line in a the step is at
+	}
+	var steps []step
+	for i := 0; i < pre; i++ {
+		steps = append(steps, step{0, a[i], i})
+	}
+	n, m := len(am), len(bm)
+	if n*m > maxDiffCells {
+		for i, s := range am {
+			steps = append(steps, step{-1, s, pre + i})
+		}
+		for _, s := range bm {
+			steps = append(steps, step{1, s, pre + n})
+		}
+	} else {
+		// lcs[i][j] is the longest common run of am[i:] and bm[j:]
+		lcs := make([]int32, (n+1)*(m+1))
+		at := func(i, j int) int32 { return lcs[i*(m+1)+j] }
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if am[i] == bm[j] {
+					lcs[i*(m+1)+j] = at(i+1, j+1) + 1
+				} else {
+					lcs[i*(m+1)+j] = max(at(i+1, j), at(i, j+1))
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && am[i] == bm[j]:
+				steps = append(steps, step{0, am[i], pre + i})
+				i++
+				j++
+			case i < n && (j == m || at(i+1, j) >= at(i, j+1)):
+				steps = append(steps, step{-1, am[i], pre + i})
+				i++
+			default:
+				steps = append(steps, step{1, bm[j], pre + i})
+				j++
+			}
+		}
+	}
+	for i := len(a) - suf; i < len(a); i++ {
+		steps = append(steps, step{0, a[i], i})
+	}
+
+	// Keep the changes and the context around them, a heading before each run
+	var lines []ui.TimelineDiffLine
+	last := -1
+	for k, s := range steps {
+		if s.kind == 0 {
+			near := false
+			for d := max(k-diffContext, 0); d <= min(k+diffContext, len(steps)-1); d++ {
+				if steps[d].kind != 0 {
+					near = true
+					break
+				}
+			}
+			if !near {
+				continue
+			}
+		}
+		if len(lines) >= maxFileDiffLines {
+			lines = append(lines, ui.TimelineDiffLine{Text: "…"})
+			break
+		}
+		if last < 0 || k != last+1 {
+			lines = append(lines, ui.TimelineDiffLine{Text: fmt.Sprintf("line %d", s.line+1)})
+		}
+		text := s.text
+		if s.kind == 0 {
+			text = "  " + text
+		}
+		lines = append(lines, ui.TimelineDiffLine{Text: text, Kind: s.kind})
+		last = k
+	}
+	return lines
+}
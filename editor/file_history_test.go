@@ -0,0 +1,60 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"editor/ui"
+)
+
+func TestFileHistoryRecordsAndRestores(t *testing.T) {
+	e, b := newBlockTestEditor(t, "one")
+	b.Path = filepath.Join(t.TempDir(), "hosts")
+
+	e.recordFileVersion(b)
+	e.recordFileVersion(b) // unchanged, so not kept again
+	b.InsertText("two ")
+	e.recordFileVersion(b)
+	versions := fileVersions(fileHistoryDirFor(b.Path))
+	if len(versions) != 2 {
+		t.Fatalf("%d versions, want 2", len(versions))
+	}
+
+	e.restoreFileVersion(b, versions[1])
+	checkLines(t, b, "one")
+	b.ApplyUndo()
+	checkLines(t, b, "two one")
+
+	// Past the size limit the oldest versions go first
+	pruneFileHistory(versions[0].Size)
+	versions = fileVersions(fileHistoryDirFor(b.Path))
+	if len(versions) != 1 {
+		t.Fatalf("%d versions after pruning, want 1", len(versions))
+	}
+	if data, _ := os.ReadFile(versions[0].Path); string(data) != "two one" {
+		t.Fatalf("kept version %q", data)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	a := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}
+	b := []string{"a", "b", "c", "D", "e", "f", "g", "h", "i", "j", "k", "l", "m"}
+	want := []ui.TimelineDiffLine{
+		{Text: "line 2"},
+		{Text: "  b"},
+		{Text: "  c"},
+		{Text: "d", Kind: -1},
+		{Text: "D", Kind: 1},
+		{Text: "  e"},
+		{Text: "  f"},
+		{Text: "line 11"},
+		{Text: "  k"},
+		{Text: "  l"},
+		{Text: "m", Kind: 1},
+	}
+	if got := lineDiff(a, b); !reflect.DeepEqual(got, want) {
+		t.Fatalf("diff = %+v", got)
+	}
+}
@@ -0,0 +1,86 @@
+package editor
+
+import (
+	"errors"
+	"path/filepath"
+
+	"editor/buffer"
+)
+
+// toggleFollow starts or stops following appends to the active buffer's
+// file, like tail -f.
+func (e *Editor) toggleFollow() {
+	buf := e.activeBuffer()
+	if buf == nil {
+		return
+	}
+	if buf.Following() {
+		buf.StopFollow()
+		e.setTemporaryMessage("Follow: OFF")
+		e.updateStatus()
+		return
+	}
+	if err := buf.StartFollow(); err != nil {
+		e.setTemporaryError("Cannot follow: " + err.Error())
+		return
+	}
+	// The file may live outside the watched tree
+	if e.fileWatcher != nil {
+		e.fileWatcher.Add(filepath.Dir(buf.Path))
+	}
+	e.pinToBottom(buf)
+	e.setTemporaryMessage("Following " + filepath.Base(buf.Path))
+	e.updateStatus()
+}
+
+// followFile handles a change to a followed file: appends are added to the
+// buffer, and a truncated or rotated file is reloaded and followed again.
+func (e *Editor) followFile(bufIdx int, buf *buffer.Buffer) {
+	changed, err := buf.FollowAppend()
+	switch {
+	case errors.Is(err, buffer.ErrFollowReset):
+		if buf.Dirty {
+			buf.ExternallyModified = true
+			e.tabBar.SetExternallyModified(bufIdx, true)
+			e.statusBar.Message = "⚠ " + filepath.Base(buf.Path) + " was truncated or replaced! (unsaved changes)"
+			return
+		}
+		e.reloadFollowed(buf)
+	case err != nil:
+		e.setTemporaryError("Follow: " + err.Error())
+	case changed:
+		e.pinToBottom(buf)
+	}
+}
+
+// reloadFollowed reloads a followed buffer in place after its file was
+// truncated or replaced, and keeps following the new file.
+func (e *Editor) reloadFollowed(buf *buffer.Buffer) {
+	newBuf, err := e.reloadBuffer(buf)
+	if err != nil {
+		// Rotation may not have created the new file yet
+		return
+	}
+	buf.Close()
+	newBuf.Language = buf.Language
+	e.applyFileSettings(newBuf)
+	*buf = *newBuf
+	if err := buf.StartFollow(); err != nil {
+		e.setTemporaryError("Follow: " + err.Error())
+		return
+	}
+	e.highlight.InvalidateCache(buf.Path)
+	e.pinToBottom(buf)
+	e.statusBar.Message = "↻ " + filepath.Base(buf.Path) + " was truncated or replaced; following from the start"
+}
+
+// pinToBottom moves the cursor of a followed buffer to its last line so the
+// view scrolls along with the file.
+func (e *Editor) pinToBottom(buf *buffer.Buffer) {
+	buf.Cursor = buffer.Cursor{Line: buf.LineCount() - 1}
+	buf.Selection = nil
+	buf.ClearExtraCursors()
+	if buf == e.activeBuffer() {
+		e.mouseScrolling = false
+	}
+}
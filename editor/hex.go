@@ -0,0 +1,212 @@
+package editor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"editor/buffer"
+	"editor/ui"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// attachHexView opens buf's file in a hex view, which then takes over the
+// tab. Binary files get one when they are opened.
+func (e *Editor) attachHexView(buf *buffer.Buffer) error {
+	hv, err := ui.NewHexView(buf.Path)
+	if err != nil {
+		return err
+	}
+	hv.Theme = e.cfg.GetTheme()
+	e.hexViews[buf] = hv
+	// Text editing is off while the hex editor has the file
+	buf.ReadOnly = true
+	return nil
+}
+
+// openBinaryInHex gives a newly loaded binary buffer a hex view.
+func (e *Editor) openBinaryInHex(buf *buffer.Buffer) error {
+	if !buf.IsBinary || buf.Large() != nil {
+		return nil
+	}
+	return e.attachHexView(buf)
+}
+
+// toggleHexView switches the active tab between the hex editor and the
+// text view of its file.
+func (e *Editor) toggleHexView() {
+	buf := e.activeBuffer()
+	if buf == nil {
+		return
+	}
+	if hv, ok := e.hexViews[buf]; ok {
+		if hv.Modified() {
+			e.setTemporaryError("Save or undo the hex edits first")
+			return
+		}
+		delete(e.hexViews, buf)
+		// The hex editor may have patched the file
+		e.performReload()
+		e.updateStatus()
+		return
+	}
+	switch {
+	case buf.Path == "":
+		e.setTemporaryError("Save the file before opening it in the hex editor")
+	case buf.Dirty:
+		e.setTemporaryError("Save or discard changes before opening the hex editor")
+	case buf.Large() != nil:
+		e.setTemporaryError("Large files can't be opened in the hex editor")
+	case e.imageViews[buf] != nil:
+		e.setTemporaryError("Images can't be opened in the hex editor")
+	default:
+		if err := e.attachHexView(buf); err != nil {
+			e.setTemporaryError("Error: " + err.Error())
+			return
+		}
+		e.updateStatus()
+	}
+}
+
+// handleHexKey handles keys for a tab showing the hex editor.
+func (e *Editor) handleHexKey(buf *buffer.Buffer, hv *ui.HexView, ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyCtrlB:
+		e.toggleTree()
+	case tcell.KeyCtrlW:
+		e.closeTab(e.activeTab)
+	case tcell.KeyCtrlF:
+		e.openHexFindDialog(hv)
+	case tcell.KeyCtrlG:
+		e.openHexGotoDialog(hv)
+	case tcell.KeyF3:
+		e.hexFindNext(hv, ev.Modifiers()&tcell.ModShift != 0)
+	case tcell.KeyEscape:
+		e.dialog = nil
+	case tcell.KeyTab:
+		if ev.Modifiers()&tcell.ModCtrl != 0 {
+			if ev.Modifiers()&tcell.ModShift != 0 {
+				e.prevTab()
+			} else {
+				e.nextTab()
+			}
+			return
+		}
+		hv.HandleKey(ev)
+	default:
+		if hv.HandleKey(ev) {
+			e.syncHexModified(buf, hv)
+		}
+	}
+	e.updateStatus()
+}
+
+// syncHexModified mirrors the hex editor's unsaved state on its buffer, so
+// closing the tab and quitting ask before dropping edits.
+func (e *Editor) syncHexModified(buf *buffer.Buffer, hv *ui.HexView) {
+	buf.Dirty = hv.Modified()
+	for i, b := range e.buffers {
+		if b == buf {
+			e.tabBar.SetModified(i, buf.Dirty)
+			if buf.Dirty && e.previewTab == i && i < len(e.tabBar.Tabs) {
+				e.tabBar.Tabs[i].Preview = false
+				e.previewTab = -1
+			}
+		}
+	}
+}
+
+// saveHexView writes the hex editor's changed bytes back to its file.
+func (e *Editor) saveHexView(buf *buffer.Buffer, hv *ui.HexView) error {
+	if err := hv.Save(); err != nil {
+		return err
+	}
+	buf.LastSaveTime = time.Now()
+	e.syncHexModified(buf, hv)
+	return nil
+}
+
+func (e *Editor) openHexFindDialog(hv *ui.HexView) {
+	d := ui.NewInputDialog("Find bytes (hex, or \"text\"): ")
+	d.Input = e.hexQuery
+	d.Cursor = len(d.Input)
+	d.OnSubmit = func(value string) {
+		e.dialog = nil
+		e.hexQuery = value
+		e.hexFindNext(hv, false)
+	}
+	d.OnCancel = func() { e.dialog = nil }
+	e.dialog = d
+}
+
+// hexFindNext repeats the last hex editor search.
+func (e *Editor) hexFindNext(hv *ui.HexView, backward bool) {
+	if e.hexQuery == "" {
+		e.openHexFindDialog(hv)
+		return
+	}
+	pattern, err := ui.ParseHexQuery(e.hexQuery)
+	if err != nil {
+		e.setTemporaryError(err.Error())
+		return
+	}
+	found, wrapped := hv.Find(pattern, backward)
+	switch {
+	case !found:
+		e.setTemporaryError("Not found: " + e.hexQuery)
+	case wrapped:
+		e.setTemporaryMessage("Search wrapped")
+	}
+}
+
+func (e *Editor) openHexGotoDialog(hv *ui.HexView) {
+	d := ui.NewInputDialog("Go to offset (0x hex or decimal): ")
+	d.OnSubmit = func(value string) {
+		e.dialog = nil
+		off, err := parseOffset(value)
+		if err != nil {
+			e.setTemporaryError("Invalid offset: " + value)
+			return
+		}
+		if off >= int64(hv.Len()) {
+			e.setTemporaryError(fmt.Sprintf("Offset %s is past the end of the file (%d bytes)", value, hv.Len()))
+			return
+		}
+		hv.Goto(int(off))
+		e.updateStatus()
+	}
+	d.OnCancel = func() { e.dialog = nil }
+	e.dialog = d
+}
+
+// parseOffset parses a decimal offset, or a hex one with a 0x prefix or an
+// h suffix.
+func parseOffset(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		return strconv.ParseInt(s[2:], 16, 64)
+	case strings.HasSuffix(s, "h"), strings.HasSuffix(s, "H"):
+		return strconv.ParseInt(s[:len(s)-1], 16, 64)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// updateHexStatus fills the status bar for a hex editor tab.
+func (e *Editor) updateHexStatus(buf *buffer.Buffer, hv *ui.HexView) {
+	e.statusBar.Filename = filepath.Base(buf.Path)
+	e.statusBar.Line = 0
+	e.statusBar.Col = 0
+	e.statusBar.Language = fmt.Sprintf("hex 0x%X / %d bytes", hv.Cursor(), hv.Len())
+	e.statusBar.LineEnd = ""
+	e.statusBar.Encoding = ""
+	e.statusBar.Mode = "HEX"
+	if hv.InASCII() {
+		e.statusBar.Mode = "ASCII"
+	}
+	e.statusBar.SelChars = 0
+	e.statusBar.SelLines = 0
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"editor/buffer"
@@ -25,6 +27,22 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 		e.quitPending = false
 	}
 
+	// F7 and F8 record and play macros; other keys are recorded once handled
+	if e.handleMacroKey(ev) {
+		return
+	}
+	defer e.recordMacroKey(ev, e.macro.recording)
+
+	// Workspace edit preview is modal
+	if e.editPreview != nil {
+		e.editPreview.HandleKey(ev)
+		return
+	}
+	if e.timeline != nil {
+		e.timeline.HandleKey(ev)
+		return
+	}
+
 	// Check for Alt+, FIRST - it toggles settings dialog
 	if ev.Key() == tcell.KeyRune && ev.Rune() == ',' && ev.Modifiers()&tcell.ModAlt != 0 {
 		e.toggleSettingsDialog()
@@ -37,6 +55,13 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 		return
 	}
 
+	// Ctrl+Shift+F (or Alt+F where the terminal can't send it) opens find in files
+	if ev.Key() == tcell.KeyRune && (((ev.Rune() == 'F' || ev.Rune() == 'f') && ev.Modifiers()&tcell.ModCtrl != 0 && ev.Modifiers()&tcell.ModShift != 0) ||
+		(ev.Rune() == 'f' && ev.Modifiers() == tcell.ModAlt && e.focusTarget != "terminal")) {
+		e.openProjectSearch()
+		return
+	}
+
 	// Ctrl+P toggles command palette (open/close)
 	if ev.Key() == tcell.KeyCtrlP {
 		if e.commandPalette != nil {
@@ -72,20 +97,40 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 		return
 	}
 
+	if e.searchPanel != nil {
+		e.searchPanel.HandleKey(ev)
+		return
+	}
+
 	// Dialog gets priority for other keys
 	if e.dialog != nil {
+		query := e.dialog.Input
 		if e.dialog.HandleKey(ev) {
 			// After typing in find dialog, update matches
 			if e.dialog != nil && e.dialog.Type == ui.DialogFind {
 				buf := e.activeBuffer()
-				if buf != nil {
-					e.dialog.FindMatches(buf.Lines)
+				if buf != nil && buf.Large() != nil {
+					// Large files are searched on Enter and F3, not as you type
+					if e.dialog.Input != query {
+						e.cancelLargeFind()
+						e.dialog.MatchInfo = ""
+					}
+				} else if buf != nil {
+					e.dialog.FindMatches(buf.Lines())
 				}
 			}
 			return
 		}
 	}
 
+	// Hover popup scrolls with the navigation keys; any other key dismisses it
+	if e.hover != nil {
+		if e.hover.HandleKey(ev) {
+			return
+		}
+		e.hover = nil
+	}
+
 	// Autocomplete gets priority when visible
 	if e.autocomplete != nil && e.autocomplete.Visible {
 		if e.autocomplete.HandleKey(ev) {
@@ -123,6 +168,21 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 		return
 	}
 
+	// Alt+Shift+arrows select a block
+	if e.handleBlockSelectKey(ev) {
+		return
+	}
+
+	// Adding cursors and selecting occurrences
+	if e.handleMultiCursorKey(ev) {
+		return
+	}
+
+	// Splitting the editor and moving between panes
+	if e.handlePaneKey(ev) {
+		return
+	}
+
 	// Alt+Up/Down for terminal resizing OR moving lines (depends on focus)
 	if ev.Modifiers()&tcell.ModAlt != 0 {
 		if ev.Key() == tcell.KeyUp {
@@ -132,7 +192,7 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 				return
 			} else {
 				buf := e.activeBuffer()
-				if buf != nil {
+				if buf != nil && !buf.ReadOnly {
 					buf.MoveLineUp()
 					e.markDirty()
 				}
@@ -145,7 +205,7 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 				return
 			} else {
 				buf := e.activeBuffer()
-				if buf != nil {
+				if buf != nil && !buf.ReadOnly {
 					buf.MoveLineDown()
 					e.markDirty()
 				}
@@ -201,7 +261,20 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 	// Image view: allow navigation/close keys but block editing
 	buf := e.activeBuffer()
 	if buf != nil {
-		if _, isImg := e.imageViews[buf]; isImg {
+		if hv, ok := e.hexViews[buf]; ok {
+			e.handleHexKey(buf, hv, ev)
+			return
+		}
+		_, isImg := e.imageViews[buf]
+		if buf.ReadOnly && !isImg && isEditKey(ev) {
+			if buf.Large() != nil {
+				e.setTemporaryMessage("Large files are read-only")
+			} else {
+				e.setTemporaryMessage("Read-only file")
+			}
+			return
+		}
+		if isImg {
 			switch ev.Key() {
 			case tcell.KeyCtrlB:
 				e.toggleTree()
@@ -228,6 +301,11 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 		}
 	}
 
+	// A block selection takes typing, deleting and the clipboard keys
+	if buf != nil && buf.Block != nil && e.handleBlockKey(buf, ev) {
+		return
+	}
+
 	// Editor keybindings
 	switch ev.Key() {
 	case tcell.KeyCtrlB:
@@ -248,6 +326,9 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 	case tcell.KeyCtrlG:
 		e.openGotoLineDialog()
 		return
+	case tcell.KeyCtrlK:
+		e.showHoverInfo()
+		return
 	case tcell.KeyCtrlZ:
 		buf := e.activeBuffer()
 		if buf != nil {
@@ -286,10 +367,7 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 		}
 		return
 	case tcell.KeyCtrlD:
-		buf := e.activeBuffer()
-		if buf != nil {
-			buf.SelectNextOccurrence()
-		}
+		e.selectNextOccurrence()
 		return
 	case tcell.KeyEscape:
 		buf := e.activeBuffer()
@@ -316,7 +394,7 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 		} else {
 			buf := e.activeBuffer()
 			if buf != nil {
-				buf.InsertTab()
+				buf.EachCursor(buf.InsertTab)
 				e.markDirty()
 			}
 		}
@@ -375,6 +453,12 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 		return
 	}
 
+	// Alt+V swaps the text just pasted for an older clipboard entry
+	if ev.Key() == tcell.KeyRune && (ev.Rune() == 'v' || ev.Rune() == 'V') && ev.Modifiers() == tcell.ModAlt {
+		e.cyclePaste()
+		return
+	}
+
 	// Arrow keys and movement
 	buf = e.activeBuffer()
 	if buf == nil {
@@ -390,10 +474,62 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 	wordMod := ctrl || alt // both Ctrl+Arrow and Alt+Arrow do word movement
 
 	switch ev.Key() {
+	case tcell.KeyUp, tcell.KeyDown, tcell.KeyLeft, tcell.KeyRight,
+		tcell.KeyHome, tcell.KeyEnd, tcell.KeyPgUp, tcell.KeyPgDn:
+		buf.EachCursor(func() { e.moveCursor(buf, ev.Key(), shift, ctrl, wordMod) })
+
+	case tcell.KeyEnter:
+		buf.EachCursor(func() {
+			buf.ClearAutoClose()
+			buf.InsertNewline()
+		})
+		e.markDirty()
+
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		buf.EachCursor(func() {
+			if ctrl {
+				buf.ClearAutoClose()
+				buf.DeleteWordBackward()
+			} else {
+				buf.Backspace()
+			}
+		})
+		e.markDirty()
+
+	case tcell.KeyDelete:
+		buf.EachCursor(func() {
+			if ctrl {
+				buf.ClearAutoClose()
+				buf.DeleteWordForward()
+			} else {
+				buf.Delete()
+			}
+		})
+		e.markDirty()
+
+	case tcell.KeyRune:
+		r := ev.Rune()
+		buf.EachCursor(func() {
+			if (r == '"' || r == '\'') && e.cfg.QuoteWrapSelection && buf.WrapSelectionWith(r) {
+				return
+			}
+			buf.InsertChar(r)
+		})
+		e.markDirty()
+	}
+
+	e.updateStatus()
+}
+
+// moveCursor moves buf's cursor for a movement key, extending its selection
+// when shift is held.
+func (e *Editor) moveCursor(buf *buffer.Buffer, key tcell.Key, shift, ctrl, wordMod bool) {
+	var anchor buffer.Cursor
+	switch key {
 	case tcell.KeyUp:
 		buf.ClearAutoClose()
 		if shift {
-			e.startOrExtendSelection(buf)
+			anchor = selectionAnchor(buf)
 		} else {
 			buf.Selection = nil
 		}
@@ -405,39 +541,33 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 			}
 			e.clampCol(buf)
 		}
-		if buf.HasExtraCursors() {
-			buf.MoveCursorsUp()
-		}
 		if shift {
-			e.extendSelection(buf)
+			extendSelection(buf, anchor)
 		}
 
 	case tcell.KeyDown:
 		buf.ClearAutoClose()
 		if shift {
-			e.startOrExtendSelection(buf)
+			anchor = selectionAnchor(buf)
 		} else {
 			buf.Selection = nil
 		}
-		if buf.Cursor.Line < len(buf.Lines)-1 {
+		if buf.Cursor.Line < buf.LineCount()-1 {
 			buf.Cursor.Line++
 			// Skip lines hidden by folds
-			for buf.Cursor.Line < len(buf.Lines)-1 && buf.IsHiddenByFold(buf.Cursor.Line) {
+			for buf.Cursor.Line < buf.LineCount()-1 && buf.IsHiddenByFold(buf.Cursor.Line) {
 				buf.Cursor.Line++
 			}
 			e.clampCol(buf)
 		}
-		if buf.HasExtraCursors() {
-			buf.MoveCursorsDown()
-		}
 		if shift {
-			e.extendSelection(buf)
+			extendSelection(buf, anchor)
 		}
 
 	case tcell.KeyLeft:
 		buf.ClearAutoClose()
 		if shift {
-			e.startOrExtendSelection(buf)
+			anchor = selectionAnchor(buf)
 		} else {
 			buf.Selection = nil
 		}
@@ -448,43 +578,37 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 		} else if buf.Cursor.Line > 0 {
 			buf.Cursor.Line--
 			// Validate before accessing
-			if buf.Cursor.Line >= 0 && buf.Cursor.Line < len(buf.Lines) {
-				buf.Cursor.Col = buffer.RuneLen(buf.Lines[buf.Cursor.Line])
+			if buf.Cursor.Line >= 0 && buf.Cursor.Line < buf.LineCount() {
+				buf.Cursor.Col = buffer.RuneLen(buf.Line(buf.Cursor.Line))
 			}
 		}
-		if buf.HasExtraCursors() {
-			buf.MoveCursorsLeft()
-		}
 		if shift {
-			e.extendSelection(buf)
+			extendSelection(buf, anchor)
 		}
 
 	case tcell.KeyRight:
 		buf.ClearAutoClose()
 		if shift {
-			e.startOrExtendSelection(buf)
+			anchor = selectionAnchor(buf)
 		} else {
 			buf.Selection = nil
 		}
 		if wordMod {
 			buf.MoveWordRight()
-		} else if buf.Cursor.Line >= 0 && buf.Cursor.Line < len(buf.Lines) && buf.Cursor.Col < buffer.RuneLen(buf.Lines[buf.Cursor.Line]) {
+		} else if buf.Cursor.Line >= 0 && buf.Cursor.Line < buf.LineCount() && buf.Cursor.Col < buffer.RuneLen(buf.Line(buf.Cursor.Line)) {
 			buf.Cursor.Col++
-		} else if buf.Cursor.Line < len(buf.Lines)-1 {
+		} else if buf.Cursor.Line < buf.LineCount()-1 {
 			buf.Cursor.Line++
 			buf.Cursor.Col = 0
 		}
-		if buf.HasExtraCursors() {
-			buf.MoveCursorsRight()
-		}
 		if shift {
-			e.extendSelection(buf)
+			extendSelection(buf, anchor)
 		}
 
 	case tcell.KeyHome:
 		buf.ClearAutoClose()
 		if shift {
-			e.startOrExtendSelection(buf)
+			anchor = selectionAnchor(buf)
 		} else {
 			buf.Selection = nil
 		}
@@ -495,24 +619,24 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 			buf.Cursor.Col = 0
 		}
 		if shift {
-			e.extendSelection(buf)
+			extendSelection(buf, anchor)
 		}
 
 	case tcell.KeyEnd:
 		buf.ClearAutoClose()
 		if shift {
-			e.startOrExtendSelection(buf)
+			anchor = selectionAnchor(buf)
 		} else {
 			buf.Selection = nil
 		}
 		if ctrl {
-			buf.Cursor.Line = len(buf.Lines) - 1
+			buf.Cursor.Line = buf.LineCount() - 1
 		}
-		if buf.Cursor.Line >= 0 && buf.Cursor.Line < len(buf.Lines) {
-			buf.Cursor.Col = buffer.RuneLen(buf.Lines[buf.Cursor.Line])
+		if buf.Cursor.Line >= 0 && buf.Cursor.Line < buf.LineCount() {
+			buf.Cursor.Col = buffer.RuneLen(buf.Line(buf.Cursor.Line))
 		}
 		if shift {
-			e.extendSelection(buf)
+			extendSelection(buf, anchor)
 		}
 
 	case tcell.KeyPgUp:
@@ -529,55 +653,29 @@ func (e *Editor) handleKey(ev *tcell.EventKey) {
 		buf.ClearAutoClose()
 		_, _, _, h := e.editorLayout()
 		buf.Cursor.Line += h
-		if buf.Cursor.Line >= len(buf.Lines) {
-			buf.Cursor.Line = len(buf.Lines) - 1
+		if buf.Cursor.Line >= buf.LineCount() {
+			buf.Cursor.Line = buf.LineCount() - 1
 		}
 		e.clampCol(buf)
 		buf.Selection = nil
+	}
+}
 
-	case tcell.KeyEnter:
-		buf.ClearAutoClose()
-		buf.InsertNewline()
-		e.markDirty()
-
-	case tcell.KeyBackspace, tcell.KeyBackspace2:
-		if ctrl {
-			buf.ClearAutoClose()
-			buf.DeleteWordBackward()
-		} else if buf.HasExtraCursors() {
-			buf.ClearAutoClose()
-			buf.DeleteCharMulti()
-		} else {
-			buf.Backspace()
-		}
-		e.markDirty()
-
-	case tcell.KeyDelete:
-		if ctrl {
-			buf.ClearAutoClose()
-			buf.DeleteWordForward()
-		} else if buf.HasExtraCursors() {
-			buf.ClearAutoClose()
-			buf.DeleteForwardMulti()
-		} else {
-			buf.Delete()
-		}
-		e.markDirty()
-
+// isEditKey reports whether ev would change the text of the active buffer.
+func isEditKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyCtrlZ, tcell.KeyCtrlX, tcell.KeyCtrlV, tcell.KeyCtrlR,
+		tcell.KeyBacktab, tcell.KeyEnter, tcell.KeyBackspace, tcell.KeyBackspace2, tcell.KeyDelete:
+		return true
+	case tcell.KeyTab:
+		return ev.Modifiers()&tcell.ModCtrl == 0
 	case tcell.KeyRune:
-		if (ev.Rune() == '"' || ev.Rune() == '\'') && e.cfg.QuoteWrapSelection && buf.WrapSelectionWith(ev.Rune()) {
-			e.markDirty()
-			break
+		if ev.Rune() == '/' && ev.Modifiers()&tcell.ModCtrl != 0 {
+			return true
 		}
-		if buf.HasExtraCursors() {
-			buf.InsertCharMulti(ev.Rune())
-		} else {
-			buf.InsertChar(ev.Rune())
-		}
-		e.markDirty()
+		return ev.Modifiers()&(tcell.ModCtrl|tcell.ModAlt) == 0
 	}
-
-	e.updateStatus()
+	return false
 }
 
 func (e *Editor) handleMouse(ev *tcell.EventMouse) {
@@ -590,13 +688,47 @@ func (e *Editor) handleMouse(ev *tcell.EventMouse) {
 	screenW, screenH := e.screen.Size()
 	_ = screenW
 
-	// Always update tab bar hover state - reset if mouse is not on tab bar row
-	if my != 0 {
-		e.tabBar.HandleMouse(ev) // This will reset mouseX/mouseY to -1,-1
+	// Always update tab bar hover state - reset if mouse is not on a tab bar row
+	e.layoutPanes()
+	for _, p := range e.panes() {
+		if my != p.y || mx < p.x || mx >= p.x+p.w {
+			e.paneTabBar(p).HandleMouse(ev) // This will reset mouseX/mouseY to -1,-1
+		}
+	}
+	// Let the status bar see presses and releases elsewhere, so a drag onto
+	// it isn't taken as a click
+	if my != screenH-1 {
+		e.statusBar.HandleMouse(ev)
 	}
 
-	// Status bar click has no action.
+	// Timelines and the workspace edit preview are modal
+	if e.timeline != nil {
+		e.timeline.HandleMouse(ev)
+		return
+	}
+	if e.editPreview != nil {
+		e.editPreview.HandleMouse(ev)
+		return
+	}
+
+	if e.searchPanel != nil {
+		e.searchPanel.HandleMouse(ev)
+		return
+	}
+
+	// Hover popup scrolls with the wheel; clicking elsewhere dismisses it
+	if e.hover != nil {
+		if e.hover.HandleMouse(ev) {
+			return
+		}
+		if btn != tcell.ButtonNone {
+			e.hover = nil
+		}
+	}
+
+	// Status bar segments open their pickers when clicked
 	if my == screenH-1 {
+		e.statusBar.HandleMouse(ev)
 		return
 	}
 
@@ -619,8 +751,35 @@ func (e *Editor) handleMouse(ev *tcell.EventMouse) {
 		}
 	}
 
+	// Dividers between split panes are dragged to resize them
+	if e.handleSplitMouse(ev) {
+		return
+	}
+
+	// A click in another pane focuses it; the wheel scrolls it in place
+	if p := e.paneAt(mx, my); p != nil && p != e.pane && !e.mouseDown {
+		if btn&(tcell.WheelUp|tcell.WheelDown|tcell.WheelLeft|tcell.WheelRight) != 0 {
+			focused := e.pane
+			e.usePane(p)
+			if my == p.y {
+				e.tabBar.HandleMouse(ev)
+			} else {
+				e.handleEditorMouse(ev)
+			}
+			e.usePane(focused)
+			return
+		}
+		if btn&(tcell.Button1|tcell.Button2|tcell.Button3) == 0 {
+			if my == p.y {
+				p.tabBar.HandleMouse(ev) // hover
+			}
+			return
+		}
+		e.focusPane(p)
+	}
+
 	// Tab bar
-	if my == 0 {
+	if p := e.pane; my == p.y && mx >= p.x && mx < p.x+p.w {
 		e.tabBar.HandleMouse(ev)
 		return
 	}
@@ -649,6 +808,11 @@ func (e *Editor) handleEditorMouse(ev *tcell.EventMouse) {
 	if buf == nil {
 		return
 	}
+	if hv, ok := e.hexViews[buf]; ok {
+		hv.HandleMouse(ev)
+		e.updateStatus()
+		return
+	}
 	view := e.activeView()
 	if view == nil {
 		return
@@ -681,7 +845,7 @@ func (e *Editor) handleEditorMouse(ev *tcell.EventMouse) {
 			view.scrollX += 3
 		} else {
 			view.scrollY += 3
-			maxScroll := len(buf.Lines) - eh + 1
+			maxScroll := buf.LineCount() - eh + 1
 			if maxScroll < 0 {
 				maxScroll = 0
 			}
@@ -713,26 +877,26 @@ func (e *Editor) handleEditorMouse(ev *tcell.EventMouse) {
 		// Map visual row to actual buffer line, skipping folded lines
 		line := view.scrollY
 		rowCount := 0
-		for line < len(buf.Lines) && rowCount < visualRow {
+		for line < buf.LineCount() && rowCount < visualRow {
 			if !buf.IsHiddenByFold(line) {
 				rowCount++
 			}
 			line++
 		}
 		// Skip any hidden lines at the target position
-		for line < len(buf.Lines) && buf.IsHiddenByFold(line) {
+		for line < buf.LineCount() && buf.IsHiddenByFold(line) {
 			line++
 		}
 
 		if line < 0 {
 			line = 0
 		}
-		if line >= len(buf.Lines) {
-			line = len(buf.Lines) - 1
+		if line >= buf.LineCount() {
+			line = buf.LineCount() - 1
 		}
 
-		// Additional safety check before accessing buf.Lines[line]
-		if line < 0 || line >= len(buf.Lines) {
+		// Additional safety check before accessing buf.Line(line)
+		if line < 0 || line >= buf.LineCount() {
 			return
 		}
 
@@ -740,17 +904,29 @@ func (e *Editor) handleEditorMouse(ev *tcell.EventMouse) {
 		if displayCol < 0 {
 			displayCol = 0
 		}
-		col := displayColToBufferCol(buf.Lines[line], displayCol, buf.TabSize)
-		if col > buffer.RuneLen(buf.Lines[line]) {
-			col = buffer.RuneLen(buf.Lines[line])
+		col := displayColToBufferCol(buf.Line(line), displayCol, buf.TabSize)
+		if col > buffer.RuneLen(buf.Line(line)) {
+			col = buffer.RuneLen(buf.Line(line))
 		}
 
-		if modifiers&tcell.ModShift != 0 {
+		if modifiers&tcell.ModAlt != 0 && !e.mouseDown {
+			// Alt+click starts a block selection, which dragging extends
+			pos := buffer.Cursor{Line: line, Col: displayCol}
+			buf.Selection = nil
+			buf.ClearExtraCursors()
+			buf.Block = &buffer.Block{Anchor: pos, Head: pos}
+			setBlockHead(buf, pos)
+			e.mouseDown = true
+			e.mouseScrolling = false
+		} else if buf.Block != nil && e.mouseDown {
+			setBlockHead(buf, buffer.Cursor{Line: line, Col: displayCol})
+		} else if modifiers&tcell.ModShift != 0 {
 			// Shift+click: extend selection
+			buf.Block = nil
 			buf.ClearExtraCursors()
-			e.startOrExtendSelection(buf)
+			anchor := selectionAnchor(buf)
 			buf.Cursor = buffer.Cursor{Line: line, Col: col}
-			e.extendSelection(buf)
+			extendSelection(buf, anchor)
 		} else if e.mouseDown {
 			// Dragging with button held — extend selection from anchor
 			newPos := buffer.Cursor{Line: line, Col: col}
@@ -762,6 +938,7 @@ func (e *Editor) handleEditorMouse(ev *tcell.EventMouse) {
 		} else {
 			// Regular click: place cursor, start drag tracking
 			buf.Selection = nil
+			buf.Block = nil
 			buf.ClearExtraCursors()
 			buf.Cursor = buffer.Cursor{Line: line, Col: col}
 			e.mouseDown = true
@@ -777,21 +954,21 @@ func (e *Editor) handleEditorMouse(ev *tcell.EventMouse) {
 
 		line := view.scrollY
 		rowCount := 0
-		for line < len(buf.Lines) && rowCount < visualRow {
+		for line < buf.LineCount() && rowCount < visualRow {
 			if !buf.IsHiddenByFold(line) {
 				rowCount++
 			}
 			line++
 		}
-		for line < len(buf.Lines) && buf.IsHiddenByFold(line) {
+		for line < buf.LineCount() && buf.IsHiddenByFold(line) {
 			line++
 		}
 
 		if line < 0 {
 			line = 0
 		}
-		if line >= len(buf.Lines) {
-			line = len(buf.Lines) - 1
+		if line >= buf.LineCount() {
+			line = buf.LineCount() - 1
 		}
 
 		if !e.middleMouseDown {
@@ -806,16 +983,16 @@ func (e *Editor) handleEditorMouse(ev *tcell.EventMouse) {
 
 			// Add cursor at clicked line, using anchor column
 			col := e.middleMouseAnchor.Col
-			if col > buffer.RuneLen(buf.Lines[line]) {
-				col = buffer.RuneLen(buf.Lines[line])
+			if col > buffer.RuneLen(buf.Line(line)) {
+				col = buffer.RuneLen(buf.Line(line))
 			}
 			buf.AddCursorAt(line, col)
 		} else if line != e.middleMouseLine {
 			// Dragging middle/right mouse - add cursor at each new line
 			// Use the anchor column to keep cursors in a straight vertical line
 			col := e.middleMouseAnchor.Col
-			if col > buffer.RuneLen(buf.Lines[line]) {
-				col = buffer.RuneLen(buf.Lines[line])
+			if col > buffer.RuneLen(buf.Line(line)) {
+				col = buffer.RuneLen(buf.Line(line))
 			}
 			buf.AddCursorAt(line, col)
 			e.middleMouseLine = line
@@ -839,19 +1016,19 @@ func (e *Editor) handleEditorMouse(ev *tcell.EventMouse) {
 					// Map visual row to actual buffer line
 					line := view.scrollY
 					rowCount := 0
-					for line < len(buf.Lines) && rowCount < visualRow {
+					for line < buf.LineCount() && rowCount < visualRow {
 						if !buf.IsHiddenByFold(line) {
 							rowCount++
 						}
 						line++
 					}
-					for line < len(buf.Lines) && buf.IsHiddenByFold(line) {
+					for line < buf.LineCount() && buf.IsHiddenByFold(line) {
 						line++
 					}
 
 					// Check if click was in gutter
 					gutterClickX := mx - ex
-					if gutterClickX >= 0 && gutterClickX < gutterW && line >= 0 && line < len(buf.Lines) {
+					if gutterClickX >= 0 && gutterClickX < gutterW && line >= 0 && line < buf.LineCount() {
 						if buf.IsFolded(line) || func() bool { s, _ := buf.FindFoldRange(line); return s >= 0 }() {
 							buf.ToggleFold(line)
 						}
@@ -868,51 +1045,68 @@ func (e *Editor) handleEditorMouse(ev *tcell.EventMouse) {
 }
 
 func (e *Editor) handleQuit() {
-	// Check for unsaved buffers
-	for _, buf := range e.buffers {
-		if buf.Dirty {
-			if e.quitPending {
-				e.quit = true // Second Ctrl+Q forces quit
-				return
-			}
-			e.statusBar.Message = "Unsaved changes! Press Ctrl+Q again to force quit."
-			e.quitPending = true
+	// Check for unsaved buffers; hot exit keeps them in the session instead
+	kept := false
+	for _, buf := range e.allBuffers() {
+		if !buf.Dirty {
+			continue
+		}
+		if e.cfg.HotExit && e.hotExitKeeps(buf) {
+			kept = true
+			continue
+		}
+		e.confirmQuit("Unsaved changes! Press Ctrl+Q again to force quit.")
+		return
+	}
+	if kept {
+		// Make sure the session holding them can be written before
+		// quitting without asking
+		if err := e.SaveSession(); err != nil {
+			e.confirmQuit("Could not keep unsaved changes (" + err.Error() + ")! Press Ctrl+Q again to force quit.")
 			return
 		}
 	}
 	e.quit = true
 }
 
-// Selection helpers
+// confirmQuit quits if quitting was already asked for, and otherwise shows
+// msg and waits for a second Ctrl+Q.
+func (e *Editor) confirmQuit(msg string) {
+	if e.quitPending {
+		e.quit = true // Second Ctrl+Q forces quit
+		return
+	}
+	e.statusBar.Message = msg
+	e.quitPending = true
+}
 
-var selectionAnchor *buffer.Cursor
+// Selection helpers
 
-func (e *Editor) startOrExtendSelection(buf *buffer.Buffer) {
-	if buf.Selection == nil {
-		selectionAnchor = &buffer.Cursor{Line: buf.Cursor.Line, Col: buf.Cursor.Col}
+// selectionAnchor returns the end of buf's selection that stays put while
+// the cursor moves: the end away from the cursor, or the cursor itself when
+// nothing is selected.
+func selectionAnchor(buf *buffer.Buffer) buffer.Cursor {
+	if sel := buf.Selection; sel != nil {
+		if buf.Cursor.Equal(sel.Start) {
+			return sel.End
+		}
+		return sel.Start
 	}
+	return buf.Cursor
 }
 
-func (e *Editor) extendSelection(buf *buffer.Buffer) {
-	if selectionAnchor != nil {
-		sel := buffer.NewSelection(*selectionAnchor, buf.Cursor)
-		buf.Selection = &sel
-	}
+func extendSelection(buf *buffer.Buffer, anchor buffer.Cursor) {
+	sel := buffer.NewSelection(anchor, buf.Cursor)
+	buf.Selection = &sel
 }
 
 func (e *Editor) clampCol(buf *buffer.Buffer) {
-	if len(buf.Lines) == 0 {
-		buf.Lines = []string{""}
-		buf.Cursor.Line = 0
-		buf.Cursor.Col = 0
-		return
-	}
 	if buf.Cursor.Line < 0 {
 		buf.Cursor.Line = 0
-	} else if buf.Cursor.Line >= len(buf.Lines) {
-		buf.Cursor.Line = len(buf.Lines) - 1
+	} else if buf.Cursor.Line >= buf.LineCount() {
+		buf.Cursor.Line = buf.LineCount() - 1
 	}
-	lineLen := buffer.RuneLen(buf.Lines[buf.Cursor.Line])
+	lineLen := buffer.RuneLen(buf.Line(buf.Cursor.Line))
 	if buf.Cursor.Col > lineLen {
 		buf.Cursor.Col = lineLen
 	}
@@ -934,14 +1128,20 @@ func (e *Editor) copySelection() {
 		return
 	}
 
+	if buf.HasExtraCursors() {
+		e.copyCursors(buf)
+		e.setTemporaryMessage("Copied")
+		return
+	}
+
 	var text string
 	if buf.Selection != nil && !buf.Selection.Empty() {
 		// Copy selection
 		text = buf.GetSelectedText()
 	} else {
 		// No selection - copy entire current line including newline (VSCode behavior)
-		if buf.Cursor.Line >= 0 && buf.Cursor.Line < len(buf.Lines) {
-			text = buf.Lines[buf.Cursor.Line] + "\n"
+		if buf.Cursor.Line >= 0 && buf.Cursor.Line < buf.LineCount() {
+			text = buf.Line(buf.Cursor.Line) + "\n"
 		}
 	}
 
@@ -953,7 +1153,14 @@ func (e *Editor) copySelection() {
 
 func (e *Editor) cutSelection() {
 	buf := e.activeBuffer()
-	if buf == nil {
+	if buf == nil || buf.ReadOnly {
+		return
+	}
+
+	if buf.HasExtraCursors() {
+		e.cutCursors(buf)
+		e.setTemporaryMessage("Cut")
+		e.markDirty()
 		return
 	}
 
@@ -965,22 +1172,19 @@ func (e *Editor) cutSelection() {
 		buf.DeleteSelection()
 	} else {
 		// No selection - cut entire current line (VSCode behavior)
-		if buf.Cursor.Line >= 0 && buf.Cursor.Line < len(buf.Lines) {
-			text = buf.Lines[buf.Cursor.Line] + "\n"
+		if buf.Cursor.Line >= 0 && buf.Cursor.Line < buf.LineCount() {
+			text = buf.Line(buf.Cursor.Line) + "\n"
 			clipboardWrite(text)
 			// Delete the line
-			buf.Lines = append(buf.Lines[:buf.Cursor.Line], buf.Lines[buf.Cursor.Line+1:]...)
-			if len(buf.Lines) == 0 {
-				buf.Lines = []string{""}
-			}
+			buf.DeleteLines(buf.Cursor.Line, buf.Cursor.Line+1)
 			// Clamp cursor manually
-			if buf.Cursor.Line >= len(buf.Lines) {
-				buf.Cursor.Line = len(buf.Lines) - 1
+			if buf.Cursor.Line >= buf.LineCount() {
+				buf.Cursor.Line = buf.LineCount() - 1
 			}
 			if buf.Cursor.Line < 0 {
 				buf.Cursor.Line = 0
 			}
-			lineLen := buffer.RuneLen(buf.Lines[buf.Cursor.Line])
+			lineLen := buffer.RuneLen(buf.Line(buf.Cursor.Line))
 			if buf.Cursor.Col > lineLen {
 				buf.Cursor.Col = lineLen
 			}
@@ -995,17 +1199,35 @@ func (e *Editor) cutSelection() {
 }
 
 func (e *Editor) pasteClipboard() {
-	text := clipboardRead()
+	e.pasteText(clipboardRead())
+}
+
+// pasteText pastes text at every cursor, as a column if it was copied as a
+// block.
+func (e *Editor) pasteText(text string) {
 	if text == "" {
 		return
 	}
 	buf := e.activeBuffer()
-	if buf == nil {
+	if buf == nil || buf.ReadOnly {
+		return
+	}
+
+	// A copied block pastes as a column
+	if text == e.blockClip && (buf.Selection == nil || buf.Selection.Empty()) && !buf.HasExtraCursors() {
+		e.pasteColumn(buf, text)
+		return
+	}
+
+	if buf.HasExtraCursors() {
+		e.pasteCursors(buf, text)
+		e.markDirty()
 		return
 	}
 
 	// Just insert the text as-is - InsertText will handle it correctly
 	buf.InsertText(text)
+	e.rememberPaste(buf, text)
 	e.markDirty()
 }
 
@@ -1047,6 +1269,17 @@ func (e *Editor) openFindDialog() {
 	d := ui.NewFindDialog()
 	buf := e.activeBuffer()
 
+	if buf != nil && buf.Large() != nil {
+		d.OnSubmit = func(string) { e.findInLargeFile(buf, d, false) }
+		d.OnFindNext = func(backward bool) { e.findInLargeFile(buf, d, backward) }
+		d.OnCancel = func() {
+			e.cancelLargeFind()
+			e.dialog = nil
+		}
+		e.dialog = d
+		return
+	}
+
 	d.OnSubmit = func(value string) {
 		// Jump to next match
 		if len(d.Matches) > 0 {
@@ -1098,7 +1331,7 @@ func (e *Editor) openFindReplaceDialog() {
 		buf.ReplaceAt(m.Line, m.Col, m.Length, replacement)
 		e.markDirty()
 		// Re-search to update matches
-		d.FindMatches(buf.Lines)
+		d.FindMatches(buf.Lines())
 		// Navigate to next match
 		if len(d.Matches) > 0 {
 			if matchIdx >= len(d.Matches) {
@@ -1117,7 +1350,7 @@ func (e *Editor) openFindReplaceDialog() {
 		}
 		count := buf.ReplaceAll(find, replacement)
 		e.markDirty()
-		d.FindMatches(buf.Lines)
+		d.FindMatches(buf.Lines())
 		e.statusBar.Message = fmt.Sprintf("Replaced %d occurrences", count)
 		return count
 	}
@@ -1128,6 +1361,10 @@ func (e *Editor) openFindReplaceDialog() {
 }
 
 func (e *Editor) openSaveAsDialog() {
+	if buf := e.activeBuffer(); buf != nil && e.hexViews[buf] != nil {
+		e.setTemporaryError("Save As isn't available in the hex editor")
+		return
+	}
 	d := ui.NewSaveAsDialog()
 	cwd, _ := os.Getwd()
 	d.Input = cwd + string(os.PathSeparator)
@@ -1189,9 +1426,15 @@ func (e *Editor) openGotoLineDialog() {
 		buf := e.activeBuffer()
 		if buf != nil {
 			lineNum-- // convert to 0-indexed
-			if lineNum >= len(buf.Lines) {
-				e.setTemporaryError(fmt.Sprintf("Line %d exceeds file length (%d lines)", lineNum+1, len(buf.Lines)))
-				lineNum = len(buf.Lines) - 1
+			if lf := buf.Large(); lf != nil && lineNum >= buf.LineCount() {
+				if _, done := lf.Progress(); !done {
+					e.setTemporaryError(fmt.Sprintf("Line %d isn't indexed yet (%d lines so far)", lineNum+1, buf.LineCount()))
+					lineNum = buf.LineCount() - 1
+				}
+			}
+			if lineNum >= buf.LineCount() {
+				e.setTemporaryError(fmt.Sprintf("Line %d exceeds file length (%d lines)", lineNum+1, buf.LineCount()))
+				lineNum = buf.LineCount() - 1
 			}
 			buf.Cursor = buffer.Cursor{Line: lineNum, Col: 0}
 			buf.Selection = nil
@@ -1258,6 +1501,13 @@ func (e *Editor) openSettingsDialog() {
 		"Insert Final Newline",
 		"Image Temp Tabs",
 		"Image Protocol",
+		"Preserve Mixed Line Endings",
+		"Clipboard History Size",
+		"Persist Clipboard History",
+		"File History Size",
+		"Hot Exit",
+		"Render Whitespace",
+		"Rulers",
 	}
 	values := []string{
 		e.cfg.Theme,
@@ -1271,14 +1521,22 @@ func (e *Editor) openSettingsDialog() {
 		boolSettingValue(e.cfg.InsertFinalNewline),
 		boolSettingValue(e.cfg.ImageTempTabs),
 		e.cfg.ImageProtocol,
+		boolSettingValue(e.cfg.PreserveMixedLineEndings),
+		strconv.Itoa(e.cfg.ClipboardHistorySize),
+		boolSettingValue(e.cfg.PersistClipboardHistory),
+		fileHistorySettingValue(e.cfg.FileHistoryMB),
+		boolSettingValue(e.cfg.HotExit),
+		e.cfg.RenderWhitespace,
+		rulersSettingValue(e.cfg.Rulers),
 	}
 
 	sections := []ui.SettingsSection{
 		{Name: "Appearance", Options: []string{"Theme"}, Indices: []int{0}},
 		{Name: "Layout", Options: []string{"Space Size", "Tree Width", "Terminal Ratio"}, Indices: []int{1, 2, 3}},
-		{Name: "Editor", Options: []string{"Word Wrap", "Auto Close", "Quote Wrap Selection"}, Indices: []int{4, 5, 6}},
-		{Name: "Files", Options: []string{"Trim Trailing Whitespace", "Insert Final Newline"}, Indices: []int{7, 8}},
+		{Name: "Editor", Options: []string{"Word Wrap", "Auto Close", "Quote Wrap Selection", "Render Whitespace", "Rulers"}, Indices: []int{4, 5, 6, 16, 17}},
+		{Name: "Files", Options: []string{"Trim Trailing Whitespace", "Insert Final Newline", "Preserve Mixed Line Endings", "File History Size", "Hot Exit"}, Indices: []int{7, 8, 11, 14, 15}},
 		{Name: "Images", Options: []string{"Image Temp Tabs", "Image Protocol"}, Indices: []int{9, 10}},
+		{Name: "Clipboard", Options: []string{"Clipboard History Size", "Persist Clipboard History"}, Indices: []int{12, 13}},
 	}
 
 	d := ui.NewSettingsDialog(options, values)
@@ -1311,6 +1569,25 @@ func boolSettingValue(v bool) string {
 	return "OFF"
 }
 
+func fileHistorySettingValue(mb int) string {
+	if mb <= 0 {
+		return "OFF"
+	}
+	return strconv.Itoa(mb) + " MB"
+}
+
+// rulersSettingValue shows ruler columns as "80, 120", or OFF for none.
+func rulersSettingValue(rulers []int) string {
+	if len(rulers) == 0 {
+		return "OFF"
+	}
+	cols := make([]string, len(rulers))
+	for i, c := range rulers {
+		cols[i] = strconv.Itoa(c)
+	}
+	return strings.Join(cols, ", ")
+}
+
 func (e *Editor) applySettingByDirection(index int, direction int, d *ui.Dialog) {
 	switch index {
 	case 0: // Theme
@@ -1344,7 +1621,7 @@ func (e *Editor) applySettingByDirection(index int, direction int, d *ui.Dialog)
 		d.SettingsValues[4] = boolSettingValue(e.cfg.WordWrap)
 	case 5: // Auto Close
 		e.cfg.AutoClose = !e.cfg.AutoClose
-		for _, b := range e.buffers {
+		for _, b := range e.allBuffers() {
 			b.AutoCloseEnabled = e.cfg.AutoClose
 			if !e.cfg.AutoClose {
 				b.ClearAutoClose()
@@ -1370,6 +1647,40 @@ func (e *Editor) applySettingByDirection(index int, direction int, d *ui.Dialog)
 		for _, iv := range e.imageViews {
 			iv.SetProtocol(e.cfg.ImageProtocol)
 		}
+	case 11: // Preserve Mixed Line Endings
+		e.cfg.PreserveMixedLineEndings = !e.cfg.PreserveMixedLineEndings
+		for _, b := range e.allBuffers() {
+			b.PreserveLineEndings = e.cfg.PreserveMixedLineEndings
+		}
+		d.SettingsValues[11] = boolSettingValue(e.cfg.PreserveMixedLineEndings)
+	case 12: // Clipboard History Size
+		sizes := []int{10, 30, 50, 100}
+		e.cfg.ClipboardHistorySize = cycleInt(sizes, e.cfg.ClipboardHistorySize, direction)
+		clipboardx.SetHistoryLimit(e.cfg.ClipboardHistorySize)
+		d.SettingsValues[12] = strconv.Itoa(e.cfg.ClipboardHistorySize)
+	case 13: // Persist Clipboard History
+		e.cfg.PersistClipboardHistory = !e.cfg.PersistClipboardHistory
+		d.SettingsValues[13] = boolSettingValue(e.cfg.PersistClipboardHistory)
+	case 14: // File History Size
+		sizes := []int{0, 20, 50, 200}
+		e.cfg.FileHistoryMB = cycleInt(sizes, e.cfg.FileHistoryMB, direction)
+		d.SettingsValues[14] = fileHistorySettingValue(e.cfg.FileHistoryMB)
+	case 15: // Hot Exit
+		e.cfg.HotExit = !e.cfg.HotExit
+		d.SettingsValues[15] = boolSettingValue(e.cfg.HotExit)
+	case 16: // Render Whitespace
+		modes := []string{"none", "trailing", "all"}
+		e.cfg.RenderWhitespace = cycleString(modes, e.cfg.RenderWhitespace, direction)
+		d.SettingsValues[16] = e.cfg.RenderWhitespace
+	case 17: // Rulers
+		presets := [][]int{nil, {80}, {100}, {120}, {80, 120}}
+		values := make([]string, len(presets))
+		for i, p := range presets {
+			values[i] = rulersSettingValue(p)
+		}
+		next := cycleString(values, rulersSettingValue(e.cfg.Rulers), direction)
+		e.cfg.Rulers = presets[slices.Index(values, next)]
+		d.SettingsValues[17] = next
 	}
 	e.cfg.Save()
 }
@@ -1412,10 +1723,11 @@ func cycleFloat(values []float64, current float64, direction int) float64 {
 
 func (e *Editor) triggerAutocomplete() {
 	buf := e.activeBuffer()
-	if buf == nil || e.lspManager == nil {
+	if buf == nil || buf.Large() != nil || e.lspManager == nil {
 		return
 	}
 
+	e.syncDocuments()
 	lspItems := e.lspManager.Completion(buf.Language, buf.Path, buf.Cursor.Line, buf.Cursor.Col)
 	if len(lspItems) == 0 {
 		e.setTemporaryMessage("No completions")
@@ -1434,22 +1746,10 @@ func (e *Editor) triggerAutocomplete() {
 	}
 
 	// Calculate screen position for the popup
-	view := e.activeView()
-	if view == nil {
+	screenX, screenY, ok := e.cursorScreenPos()
+	if !ok {
 		return
 	}
-	ex, ey, _, _ := e.editorLayout()
-	gutterW := e.gutterWidth()
-
-	screenX := ex + gutterW + buf.Cursor.Col - view.scrollX
-	// Count visible lines from scrollY to cursor line
-	visualRow := 0
-	for i := view.scrollY; i < buf.Cursor.Line && i < len(buf.Lines); i++ {
-		if !buf.IsHiddenByFold(i) {
-			visualRow++
-		}
-	}
-	screenY := ey + visualRow
 
 	theme := e.cfg.GetTheme()
 	ac := ui.NewAutocomplete(items, screenX, screenY, theme)
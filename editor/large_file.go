@@ -0,0 +1,206 @@
+package editor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+
+	"editor/buffer"
+	"editor/config"
+	"editor/search"
+	"editor/ui"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// LargeFileEvent is posted while a large file is being indexed, so the line
+// count and status bar keep up.
+type LargeFileEvent struct {
+	tcell.EventTime
+}
+
+// LargeFindEvent carries the result of a find in a large file.
+type LargeFindEvent struct {
+	tcell.EventTime
+	buf         *buffer.Buffer
+	gen         int
+	line        int
+	col, endCol int
+	found       bool
+	wrapped     bool
+	err         error
+}
+
+// largeFind tracks the running find in a large file; only the latest one
+// is shown.
+type largeFind struct {
+	gen    int
+	cancel context.CancelFunc
+}
+
+// maxFullLoadMB caps large_file_mb: bigger files always open in large-file
+// mode rather than being read into memory whole.
+const maxFullLoadMB = 1024
+
+// loadBuffer opens path as a text buffer, or in large-file mode when it is
+// bigger than the large_file_mb setting.
+func (e *Editor) loadBuffer(path string) (*buffer.Buffer, error) {
+	if e.isLargeFile(path) {
+		return buffer.NewLargeFileBuffer(path, e.cfg.TabSize, e.postLargeFileEvent)
+	}
+	buf, err := buffer.NewBufferFromFile(path, e.cfg.TabSize)
+	if err != nil {
+		return nil, err
+	}
+	e.restoreUndo(buf)
+	return buf, nil
+}
+
+// isLargeFile reports whether path is too big to read into memory whole,
+// going by large_file_mb, which is the default when 0 and no more than
+// maxFullLoadMB.
+func (e *Editor) isLargeFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	limit := e.cfg.LargeFileMB
+	if limit <= 0 {
+		limit = config.Default().LargeFileMB
+	}
+	return info.Size() > int64(min(limit, maxFullLoadMB))<<20
+}
+
+// postLargeFileEvent is called from the indexing goroutine.
+func (e *Editor) postLargeFileEvent() {
+	if e.screen == nil {
+		return
+	}
+	ev := &LargeFileEvent{}
+	ev.SetEventNow()
+	e.screen.PostEvent(ev)
+}
+
+// largeFileMode returns the status bar mode for a large-file buffer.
+func largeFileMode(lf *buffer.LargeFile) string {
+	if progress, done := lf.Progress(); !done {
+		return fmt.Sprintf("INDEX %d%%", int(progress*100))
+	}
+	return "VIEW"
+}
+
+func (e *Editor) cancelLargeFind() {
+	if e.largeFind.cancel != nil {
+		e.largeFind.cancel()
+		e.largeFind.cancel = nil
+	}
+	e.largeFind.gen++
+}
+
+// findInLargeFile looks for the find dialog's query from the cursor of a
+// large-file buffer, wrapping around once. The file is read in the
+// background and the result arrives as a LargeFindEvent.
+func (e *Editor) findInLargeFile(buf *buffer.Buffer, d *ui.Dialog, backward bool) {
+	e.cancelLargeFind()
+	if d.Input == "" {
+		d.MatchInfo = ""
+		return
+	}
+	q, err := search.Compile(search.Options{Query: d.Input, Regex: d.UseRegex})
+	if err != nil {
+		d.MatchInfo = "invalid pattern"
+		return
+	}
+
+	// Forwards, a match must start at or after the cursor (the end of the
+	// last match); backwards it must start before the selection
+	pos := buf.Cursor
+	if backward && buf.Selection != nil && !buf.Selection.Empty() {
+		pos = buf.Selection.Start
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.largeFind.cancel = cancel
+	gen := e.largeFind.gen
+	d.MatchInfo = "searching..."
+
+	lf := buf.Large()
+	go func() {
+		ev := &LargeFindEvent{buf: buf, gen: gen}
+		visit := func(wrap bool) func(int, string) bool {
+			return func(line int, text string) bool {
+				if wrap && (backward && line < pos.Line || !backward && line > pos.Line) {
+					return false // back where we started
+				}
+				matches := q.FindInLines("", []string{text})
+				for i := range matches {
+					m := matches[i]
+					if backward {
+						m = matches[len(matches)-1-i]
+					}
+					// On the cursor line the first pass takes the matches on
+					// the search's side of the cursor and the wrapped pass
+					// the rest
+					if line == pos.Line && (m.Col < pos.Col) != (backward != wrap) {
+						continue
+					}
+					ev.line, ev.col, ev.endCol, ev.found, ev.wrapped = line, m.Col, m.EndCol, true, wrap
+					return false
+				}
+				return true
+			}
+		}
+		ev.err = lf.ScanLines(ctx, pos.Line, backward, visit(false))
+		if !ev.found && ev.err == nil {
+			from := 0
+			if backward {
+				from = math.MaxInt
+			}
+			ev.err = lf.ScanLines(ctx, from, backward, visit(true))
+		}
+		if ctx.Err() != nil || e.screen == nil {
+			return
+		}
+		ev.SetEventNow()
+		e.screen.PostEvent(ev)
+	}()
+}
+
+func (e *Editor) handleLargeFindEvent(ev *LargeFindEvent) {
+	if ev.gen != e.largeFind.gen {
+		return
+	}
+	e.largeFind.cancel = nil
+	var d *ui.Dialog
+	if e.dialog != nil && e.dialog.Type == ui.DialogFind {
+		d = e.dialog
+	}
+	setInfo := func(s string) {
+		if d != nil {
+			d.MatchInfo = s
+		}
+	}
+	switch {
+	case ev.err != nil:
+		setInfo("")
+		e.setTemporaryError("Search failed: " + ev.err.Error())
+		return
+	case !ev.found:
+		setInfo("not found")
+		return
+	}
+	setInfo(fmt.Sprintf("line %d", ev.line+1))
+	if ev.wrapped {
+		e.setTemporaryMessage("Search wrapped")
+	}
+	if e.activeBuffer() != ev.buf {
+		return
+	}
+	start := buffer.Cursor{Line: ev.line, Col: ev.col}
+	end := buffer.Cursor{Line: ev.line, Col: ev.endCol}
+	sel := buffer.NewSelection(start, end)
+	ev.buf.Selection = &sel
+	ev.buf.Cursor = end
+	e.mouseScrolling = false
+	e.updateStatus()
+}
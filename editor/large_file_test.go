@@ -0,0 +1,43 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"editor/config"
+)
+
+func TestLargeFileThreshold(t *testing.T) {
+	e := New(config.Default())
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	size := func(mb int64) {
+		if err := os.Truncate(path, mb<<20+1); err != nil {
+			t.Fatalf("truncate failed: %v", err)
+		}
+	}
+
+	size(2)
+	e.cfg.LargeFileMB = 1
+	if !e.isLargeFile(path) {
+		t.Fatal("2 MB file under a 1 MB threshold read whole")
+	}
+	// 0 is the default threshold, not no limit
+	e.cfg.LargeFileMB = 0
+	if e.isLargeFile(path) {
+		t.Fatal("2 MB file opened in large-file mode with the default threshold")
+	}
+	size(int64(config.Default().LargeFileMB))
+	if !e.isLargeFile(path) {
+		t.Fatal("large_file_mb 0 read a file over the default threshold whole")
+	}
+
+	size(maxFullLoadMB)
+	e.cfg.LargeFileMB = 1 << 20
+	if !e.isLargeFile(path) {
+		t.Fatal("threshold above the cap read the file whole")
+	}
+}
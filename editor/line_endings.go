@@ -0,0 +1,56 @@
+package editor
+
+import (
+	"path/filepath"
+
+	"editor/buffer"
+)
+
+// convertLineEndings makes every line of the active buffer end with the
+// named line ending when it is next saved.
+func (e *Editor) convertLineEndings(name string) {
+	buf := e.activeBuffer()
+	if buf == nil {
+		return
+	}
+	if buf.ReadOnly || e.hexViews[buf] != nil || e.imageViews[buf] != nil {
+		e.setTemporaryError("Read-only buffer")
+		return
+	}
+	buf.ConvertLineEndings(name)
+	e.markDirty()
+	e.setTemporaryMessage("Line endings: " + name)
+	e.updateStatus()
+}
+
+// openLineEndingPicker lets the user pick the line ending to convert the
+// active buffer to.
+func (e *Editor) openLineEndingPicker() {
+	buf := e.activeBuffer()
+	if buf == nil {
+		return
+	}
+	current := buf.LineEnding
+	if buf.MixedLineEndings {
+		current = ""
+	}
+	e.openPicker(buffer.LineEndings, current, e.convertLineEndings)
+}
+
+// lineEndingLabel is the status bar text for buf's line endings.
+func lineEndingLabel(buf *buffer.Buffer) string {
+	if buf.MixedLineEndings && buf.PreserveLineEndings {
+		return "Mixed"
+	}
+	return buf.LineEnding
+}
+
+// mixedLineEndingsWarning is shown when a file with mixed line endings is
+// opened.
+func mixedLineEndingsWarning(buf *buffer.Buffer) string {
+	msg := "⚠ " + filepath.Base(buf.Path) + " has mixed line endings (" + buf.LineEndingSummary() + ")"
+	if buf.PreserveLineEndings {
+		return msg + "; each line keeps its own on save"
+	}
+	return msg + "; saving converts them to " + buf.LineEnding
+}
@@ -0,0 +1,324 @@
+package editor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"editor/buffer"
+	"editor/config"
+	"editor/ui"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// maxMacroRuns caps how many times one command plays a macro.
+const maxMacroRuns = 10000
+
+// MacroKey is one key press of a keyboard macro.
+type MacroKey struct {
+	Key  tcell.Key     `json:"key"`
+	Rune string        `json:"rune,omitempty"`
+	Mod  tcell.ModMask `json:"mod,omitempty"`
+}
+
+func macroKeyOf(ev *tcell.EventKey) MacroKey {
+	k := MacroKey{Key: ev.Key(), Mod: ev.Modifiers()}
+	if ev.Key() == tcell.KeyRune {
+		k.Rune = string(ev.Rune())
+	}
+	return k
+}
+
+func (k MacroKey) event() *tcell.EventKey {
+	var r rune
+	for _, ch := range k.Rune {
+		r = ch
+		break
+	}
+	return tcell.NewEventKey(k.Key, r, k.Mod)
+}
+
+// macroRecorder holds the keyboard macro being recorded and the last one
+// recorded or played.
+type macroRecorder struct {
+	recording bool
+	playing   bool
+	keys      []MacroKey // recorded so far
+	paletteAt int        // len(keys) when the command palette last opened
+	last      []MacroKey
+}
+
+// macrosPath returns the file named macros are saved in, next to the
+// settings.
+func macrosPath() string {
+	path := config.ConfigPath()
+	if path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(path), "macros.json")
+}
+
+func loadMacros() (map[string][]MacroKey, error) {
+	macros := make(map[string][]MacroKey)
+	data, err := os.ReadFile(macrosPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return macros, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &macros); err != nil {
+		return nil, err
+	}
+	return macros, nil
+}
+
+func saveMacros(macros map[string][]MacroKey) error {
+	path := macrosPath()
+	if path == "" {
+		return fmt.Errorf("no config directory")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(macros, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// handleMacroKey handles the record (F7) and play (F8) keys, which are
+// never recorded themselves. While the terminal has focus they are left for
+// the program running in it.
+func (e *Editor) handleMacroKey(ev *tcell.EventKey) bool {
+	if e.focusTarget == "terminal" {
+		return false
+	}
+	switch ev.Key() {
+	case tcell.KeyF7:
+		e.toggleMacroRecording()
+	case tcell.KeyF8:
+		e.playLastMacro(1)
+	default:
+		return false
+	}
+	return true
+}
+
+// recordMacroKey adds ev to the macro being recorded once it has been
+// handled, unless handling it stopped the recording.
+func (e *Editor) recordMacroKey(ev *tcell.EventKey, wasRecording bool) {
+	if wasRecording && e.macro.recording && !e.macro.playing {
+		e.macro.keys = append(e.macro.keys, macroKeyOf(ev))
+	}
+}
+
+func (e *Editor) toggleMacroRecording() {
+	if e.macro.playing {
+		return
+	}
+	if e.macro.recording {
+		e.stopMacroRecording()
+		return
+	}
+	e.macro.recording = true
+	e.macro.keys = nil
+	e.setTemporaryMessage("Recording macro (F7 to stop)")
+	e.updateStatus()
+}
+
+func (e *Editor) stopMacroRecording() {
+	e.macro.recording = false
+	if len(e.macro.keys) == 0 {
+		e.setTemporaryMessage("Macro recording stopped: no keys recorded")
+	} else {
+		e.macro.last = e.macro.keys
+		e.setTemporaryMessage(fmt.Sprintf("Recorded macro of %d keys (F8 to play)", len(e.macro.keys)))
+	}
+	e.macro.keys = nil
+	e.updateStatus()
+}
+
+// macroCommand wraps a macro palette command. Run while recording, it ends
+// the recording, leaving out the keys that opened the palette and chose the
+// command.
+func (e *Editor) macroCommand(fn func()) func() {
+	return func() {
+		if e.macro.recording {
+			e.macro.keys = e.macro.keys[:min(e.macro.paletteAt, len(e.macro.keys))]
+			e.stopMacroRecording()
+		}
+		fn()
+	}
+}
+
+// playMacro replays keys times over, as if typed. The edits it makes to
+// the active buffer undo in one step.
+func (e *Editor) playMacro(keys []MacroKey, times int) {
+	if e.macro.playing {
+		return
+	}
+	if e.macro.recording {
+		e.setTemporaryError("Can't play a macro while recording one")
+		return
+	}
+	if len(keys) == 0 {
+		e.setTemporaryError("No macro recorded (F7 to record)")
+		return
+	}
+	e.macro.playing = true
+	defer func() { e.macro.playing = false }()
+	if buf := e.activeBuffer(); buf != nil {
+		buf.Undo.BeginGroup()
+		defer buf.Undo.EndGroup()
+	}
+	for i := 0; i < times && !e.quit; i++ {
+		for _, k := range keys {
+			e.handleKey(k.event())
+		}
+	}
+}
+
+func (e *Editor) playLastMacro(times int) {
+	e.playMacro(e.macro.last, times)
+}
+
+// openPlayMacroTimesDialog asks how many times to play the last macro.
+func (e *Editor) openPlayMacroTimesDialog() {
+	if len(e.macro.last) == 0 {
+		e.setTemporaryError("No macro recorded (F7 to record)")
+		return
+	}
+	d := ui.NewInputDialog("Play macro how many times: ")
+	d.OnSubmit = func(value string) {
+		e.dialog = nil
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 1 || n > maxMacroRuns {
+			e.setTemporaryError(fmt.Sprintf("Enter a number from 1 to %d", maxMacroRuns))
+			return
+		}
+		e.playLastMacro(n)
+	}
+	d.OnCancel = func() {
+		e.dialog = nil
+	}
+	e.dialog = d
+}
+
+// playMacroOnLines plays the last macro once on each line of the selection,
+// starting from the beginning of the line. Lines are done from the bottom
+// up so a macro that adds or removes lines doesn't shift the ones to come.
+func (e *Editor) playMacroOnLines() {
+	buf := e.cursorBuffer()
+	if buf == nil {
+		return
+	}
+	if buf.Selection == nil || buf.Selection.Empty() {
+		e.setTemporaryError("Select the lines to play the macro on")
+		return
+	}
+	if len(e.macro.last) == 0 {
+		e.setTemporaryError("No macro recorded (F7 to record)")
+		return
+	}
+	sel := *buf.Selection
+	last := sel.End.Line
+	if sel.End.Col == 0 && last > sel.Start.Line {
+		last--
+	}
+	buf.Undo.BeginGroup()
+	defer buf.Undo.EndGroup()
+	for line := last; line >= sel.Start.Line && e.activeBuffer() == buf; line-- {
+		if line >= buf.LineCount() {
+			continue
+		}
+		buf.Selection = nil
+		buf.ClearExtraCursors()
+		buf.Cursor = buffer.Cursor{Line: line}
+		e.playLastMacro(1)
+	}
+}
+
+// openSaveMacroDialog saves the last macro under a name for later sessions.
+func (e *Editor) openSaveMacroDialog() {
+	if len(e.macro.last) == 0 {
+		e.setTemporaryError("No macro recorded (F7 to record)")
+		return
+	}
+	keys := e.macro.last
+	d := ui.NewInputDialog("Save macro as: ")
+	d.OnSubmit = func(name string) {
+		e.dialog = nil
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return
+		}
+		macros, err := loadMacros()
+		if err != nil {
+			e.setTemporaryError("Error reading macros: " + err.Error())
+			return
+		}
+		macros[name] = keys
+		if err := saveMacros(macros); err != nil {
+			e.setTemporaryError("Error saving macro: " + err.Error())
+			return
+		}
+		e.setTemporaryMessage("Saved macro " + name)
+	}
+	d.OnCancel = func() {
+		e.dialog = nil
+	}
+	e.dialog = d
+}
+
+// openSavedMacroPicker lists the saved macros and calls onPick with the
+// name and keys of the one chosen.
+func (e *Editor) openSavedMacroPicker(onPick func(name string, keys []MacroKey)) {
+	macros, err := loadMacros()
+	if err != nil {
+		e.setTemporaryError("Error reading macros: " + err.Error())
+		return
+	}
+	if len(macros) == 0 {
+		e.setTemporaryError("No saved macros")
+		return
+	}
+	names := make([]string, 0, len(macros))
+	for name := range macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e.openPicker(names, "", func(name string) {
+		onPick(name, macros[name])
+	})
+}
+
+// playSavedMacro plays a saved macro, which becomes the one F8 plays.
+func (e *Editor) playSavedMacro() {
+	e.openSavedMacroPicker(func(_ string, keys []MacroKey) {
+		e.macro.last = keys
+		e.playLastMacro(1)
+	})
+}
+
+func (e *Editor) deleteSavedMacro() {
+	e.openSavedMacroPicker(func(name string, _ []MacroKey) {
+		macros, err := loadMacros()
+		if err != nil {
+			e.setTemporaryError("Error reading macros: " + err.Error())
+			return
+		}
+		delete(macros, name)
+		if err := saveMacros(macros); err != nil {
+			e.setTemporaryError("Error saving macros: " + err.Error())
+			return
+		}
+		e.setTemporaryMessage("Deleted macro " + name)
+	})
+}
@@ -0,0 +1,95 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+
+	"editor/buffer"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func pressKeys(e *Editor, keys ...*tcell.EventKey) {
+	for _, ev := range keys {
+		e.handleKey(ev)
+	}
+}
+
+func TestMacroRecordAndPlay(t *testing.T) {
+	e, b := newBlockTestEditor(t, "a", "b", "c", "d")
+	pressKeys(e,
+		tcell.NewEventKey(tcell.KeyF7, 0, 0),
+		tcell.NewEventKey(tcell.KeyEnd, 0, 0),
+		tcell.NewEventKey(tcell.KeyRune, ';', 0),
+		tcell.NewEventKey(tcell.KeyDown, 0, 0),
+		tcell.NewEventKey(tcell.KeyF7, 0, 0),
+	)
+	if len(e.macro.last) != 3 {
+		t.Fatalf("recorded %d keys, want 3", len(e.macro.last))
+	}
+	checkLines(t, b, "a;", "b", "c", "d")
+
+	e.handleKey(tcell.NewEventKey(tcell.KeyF8, 0, 0))
+	checkLines(t, b, "a;", "b;", "c", "d")
+	e.playLastMacro(2)
+	checkLines(t, b, "a;", "b;", "c;", "d;")
+
+	// A playback undoes in one step
+	b.ApplyUndo()
+	checkLines(t, b, "a;", "b;", "c", "d")
+}
+
+func TestMacroKeysGoToFocusedTerminal(t *testing.T) {
+	e, _ := newBlockTestEditor(t, "a")
+	e.focusTarget = "terminal"
+	pressKeys(e, tcell.NewEventKey(tcell.KeyF7, 0, 0))
+	if e.macro.recording {
+		t.Fatal("F7 started recording while the terminal had focus")
+	}
+	e.focusTarget = "editor"
+	pressKeys(e, tcell.NewEventKey(tcell.KeyF7, 0, 0))
+	if !e.macro.recording {
+		t.Fatal("F7 did not start recording in the editor")
+	}
+}
+
+func TestMacroOnSelectedLines(t *testing.T) {
+	e, b := newBlockTestEditor(t, "one", "two", "three")
+	e.macro.last = []MacroKey{{Key: tcell.KeyRune, Rune: "-"}, {Key: tcell.KeyRune, Rune: " "}}
+	b.Selection = &buffer.Selection{Start: buffer.Cursor{Line: 0, Col: 1}, End: buffer.Cursor{Line: 2, Col: 0}}
+	e.playMacroOnLines()
+	checkLines(t, b, "- one", "- two", "three")
+}
+
+func TestMacroCommandLeavesOutPaletteKeys(t *testing.T) {
+	e, _ := newBlockTestEditor(t, "")
+	e.toggleMacroRecording()
+	e.handleKey(tcell.NewEventKey(tcell.KeyRune, 'x', 0))
+	e.openCommandPalette()
+	pressKeys(e,
+		tcell.NewEventKey(tcell.KeyRune, 's', 0),
+		tcell.NewEventKey(tcell.KeyRune, 't', 0),
+	)
+	e.macroCommand(func() {})()
+	want := []MacroKey{{Key: tcell.KeyRune, Rune: "x"}}
+	if e.macro.recording || !reflect.DeepEqual(e.macro.last, want) {
+		t.Fatalf("recording %v, macro %v", e.macro.recording, e.macro.last)
+	}
+}
+
+func TestSavedMacrosRoundTrip(t *testing.T) {
+	newWorkspaceTestEditor(t)
+	want := map[string][]MacroKey{
+		"semi": {{Key: tcell.KeyEnd}, {Key: tcell.KeyRune, Rune: ";"}, {Key: tcell.KeyDown, Mod: tcell.ModShift}},
+	}
+	if err := saveMacros(want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, err := loadMacros()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("loaded %v, want %v", got, want)
+	}
+}
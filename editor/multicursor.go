@@ -0,0 +1,199 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"editor/buffer"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// cursorBuffer returns the active buffer if it is text that can take more
+// cursors.
+func (e *Editor) cursorBuffer() *buffer.Buffer {
+	buf := e.activeBuffer()
+	if buf == nil || buf.Large() != nil || e.hexViews[buf] != nil || e.imageViews[buf] != nil {
+		return nil
+	}
+	return buf
+}
+
+// handleMultiCursorKey handles the keys that add and select with cursors:
+// Ctrl+Alt+Up/Down, Ctrl+Shift+L (or Alt+L), Alt+D and Alt+Shift+I.
+func (e *Editor) handleMultiCursorKey(ev *tcell.EventKey) bool {
+	if e.focusTarget != "editor" {
+		return false
+	}
+	mods := ev.Modifiers()
+	switch {
+	case ev.Key() == tcell.KeyUp && mods&(tcell.ModCtrl|tcell.ModAlt) == tcell.ModCtrl|tcell.ModAlt:
+		e.addCursorVertical(-1)
+	case ev.Key() == tcell.KeyDown && mods&(tcell.ModCtrl|tcell.ModAlt) == tcell.ModCtrl|tcell.ModAlt:
+		e.addCursorVertical(1)
+	case ev.Key() != tcell.KeyRune:
+		return false
+	case (ev.Rune() == 'L' || ev.Rune() == 'l') && mods&(tcell.ModCtrl|tcell.ModShift) == tcell.ModCtrl|tcell.ModShift,
+		ev.Rune() == 'l' && mods == tcell.ModAlt:
+		e.selectAllOccurrences()
+	case ev.Rune() == 'd' && mods == tcell.ModAlt:
+		e.skipOccurrence()
+	case ev.Rune() == 'I' && mods&tcell.ModAlt != 0:
+		e.addCursorsToLineEnds()
+	default:
+		return false
+	}
+	e.mouseScrolling = false
+	e.updateStatus()
+	return true
+}
+
+func (e *Editor) selectNextOccurrence() {
+	buf := e.cursorBuffer()
+	if buf == nil {
+		return
+	}
+	buf.Block = nil
+	if !buf.SelectNextOccurrence() && buf.Selection != nil {
+		e.setTemporaryMessage("No more occurrences")
+	}
+}
+
+func (e *Editor) skipOccurrence() {
+	buf := e.cursorBuffer()
+	if buf == nil {
+		return
+	}
+	buf.Block = nil
+	if !buf.SkipOccurrence() && buf.Selection != nil {
+		e.setTemporaryMessage("No other occurrence")
+	}
+}
+
+func (e *Editor) selectAllOccurrences() {
+	buf := e.cursorBuffer()
+	if buf == nil {
+		return
+	}
+	buf.Block = nil
+	if n := buf.SelectAllOccurrences(); n > 1 {
+		e.setTemporaryMessage(fmt.Sprintf("%d occurrences selected", n))
+	}
+}
+
+func (e *Editor) addCursorsToLineEnds() {
+	buf := e.cursorBuffer()
+	if buf == nil {
+		return
+	}
+	buf.Block = nil
+	if !buf.AddCursorsToLineEnds() {
+		e.setTemporaryMessage("Select lines to add cursors to")
+	}
+}
+
+// addCursorVertical adds a cursor on the line above the topmost cursor, or
+// below the bottommost one, at the primary cursor's display column.
+func (e *Editor) addCursorVertical(dir int) {
+	buf := e.cursorBuffer()
+	if buf == nil {
+		return
+	}
+	buf.Block = nil
+	cursors := buf.Cursors()
+	edge := cursors[0].Line
+	for _, c := range cursors[1:] {
+		if (dir < 0 && c.Line < edge) || (dir > 0 && c.Line > edge) {
+			edge = c.Line
+		}
+	}
+	line := edge + dir
+	for line >= 0 && line < buf.LineCount() && buf.IsHiddenByFold(line) {
+		line += dir
+	}
+	if line < 0 || line >= buf.LineCount() {
+		return
+	}
+	col := cursorDisplayPos(buf).Col
+	buf.AddCursorAt(line, displayColToBufferCol(buf.Line(line), col, buf.TabSize))
+}
+
+// cursorsText returns the text of every cursor in buffer order: each one's
+// selection or, when none has a selection, each one's line. lines reports
+// which it is.
+func cursorsText(buf *buffer.Buffer) (texts []string, lines bool) {
+	lines = buf.Selection == nil || buf.Selection.Empty()
+	for _, ec := range buf.ExtraCursors {
+		if ec.Selection != nil && !ec.Selection.Empty() {
+			lines = false
+		}
+	}
+	seen := make(map[int]bool)
+	buf.EachCursor(func() {
+		switch {
+		case !lines:
+			texts = append(texts, buf.GetSelectedText())
+		case !seen[buf.Cursor.Line]:
+			seen[buf.Cursor.Line] = true
+			texts = append(texts, buf.Line(buf.Cursor.Line))
+		}
+	})
+	// EachCursor goes from the end of the buffer back
+	for i, j := 0, len(texts)-1; i < j; i, j = i+1, j-1 {
+		texts[i], texts[j] = texts[j], texts[i]
+	}
+	return texts, lines
+}
+
+// copyCursors copies the text of every cursor, one per line.
+func (e *Editor) copyCursors(buf *buffer.Buffer) bool {
+	texts, lines := cursorsText(buf)
+	text := strings.Join(texts, "\n")
+	if lines {
+		text += "\n"
+	}
+	clipboardWrite(text)
+	return lines
+}
+
+// cutCursors cuts the text of every cursor: its selection, or its line when
+// nothing is selected.
+func (e *Editor) cutCursors(buf *buffer.Buffer) {
+	if !e.copyCursors(buf) {
+		buf.EachCursor(buf.DeleteSelection)
+		return
+	}
+	cut := make(map[int]bool)
+	buf.EachCursor(func() {
+		line, col := buf.Cursor.Line, buf.Cursor.Col
+		if cut[line] {
+			return
+		}
+		cut[line] = true
+		sel := buffer.Selection{Start: buffer.Cursor{Line: line}, End: buffer.Cursor{Line: line + 1}}
+		if line == buf.LineCount()-1 {
+			sel.End = buffer.Cursor{Line: line, Col: buffer.RuneLen(buf.Line(line))}
+			if line > 0 {
+				sel.Start = buffer.Cursor{Line: line - 1, Col: buffer.RuneLen(buf.Line(line - 1))}
+			}
+		}
+		buf.Selection = &sel
+		buf.DeleteSelection()
+		buf.Cursor.Col = min(col, buffer.RuneLen(buf.Line(buf.Cursor.Line)))
+	})
+}
+
+// pasteCursors pastes text at every cursor. Text with one line per cursor
+// is spread over them, a line each.
+func (e *Editor) pasteCursors(buf *buffer.Buffer, text string) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) != buf.CursorCount() {
+		buf.EachCursor(func() { buf.InsertText(text) })
+		return
+	}
+	i := len(lines)
+	buf.EachCursor(func() {
+		i--
+		buf.InsertText(lines[i])
+	})
+}
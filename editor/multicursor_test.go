@@ -0,0 +1,57 @@
+package editor
+
+import (
+	"testing"
+
+	"editor/buffer"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestMultiCursorKeysActOnEveryCursor(t *testing.T) {
+	e, b := newBlockTestEditor(t, "foo bar", "foo bar")
+	b.Cursor = buffer.Cursor{Line: 0, Col: 0}
+	e.handleKey(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModCtrl|tcell.ModAlt))
+	if len(b.ExtraCursors) != 1 {
+		t.Fatalf("%d extra cursors, want 1", len(b.ExtraCursors))
+	}
+
+	// Word movement and selection run per cursor, each with its own anchor
+	e.handleKey(tcell.NewEventKey(tcell.KeyRight, 0, tcell.ModCtrl))
+	e.handleKey(tcell.NewEventKey(tcell.KeyRight, 0, tcell.ModShift))
+	e.handleKey(tcell.NewEventKey(tcell.KeyRight, 0, tcell.ModShift))
+	if b.GetSelectedText() != "ba" || b.ExtraCursors[0].Selection == nil || *b.ExtraCursors[0].Selection != (buffer.Selection{Start: buffer.Cursor{Line: 1, Col: 4}, End: buffer.Cursor{Line: 1, Col: 6}}) {
+		t.Fatalf("selections %v and %v", b.Selection, b.ExtraCursors[0].Selection)
+	}
+
+	e.handleKey(tcell.NewEventKey(tcell.KeyRune, 'X', 0))
+	checkLines(t, b, "foo Xr", "foo Xr")
+	e.handleKey(tcell.NewEventKey(tcell.KeyBackspace2, 0, tcell.ModCtrl))
+	checkLines(t, b, "foo r", "foo r")
+
+	b.ApplyUndo()
+	checkLines(t, b, "foo Xr", "foo Xr")
+	if got := b.Cursors(); len(got) != 2 || got[0] != (buffer.Cursor{Line: 0, Col: 5}) || got[1] != (buffer.Cursor{Line: 1, Col: 5}) {
+		t.Fatalf("cursors after undo = %v", got)
+	}
+}
+
+func TestPasteSpreadsLinesOverCursors(t *testing.T) {
+	e, b := newBlockTestEditor(t, "a", "b", "c")
+	b.Cursor = buffer.Cursor{Line: 0, Col: 1}
+	b.AddCursorAt(1, 1)
+	b.AddCursorAt(2, 1)
+
+	e.pasteCursors(b, "1\n2\n3\n")
+	checkLines(t, b, "a1", "b2", "c3")
+
+	// Text that doesn't have a line per cursor goes in whole at each
+	e.pasteCursors(b, "x\ny")
+	checkLines(t, b, "a1x", "y", "b2x", "y", "c3x", "y")
+
+	// Without selections, copying takes each cursor's line
+	texts, lines := cursorsText(b)
+	if !lines || len(texts) != 3 || texts[0] != "y" {
+		t.Fatalf("cursor texts %q, lines %v", texts, lines)
+	}
+}
@@ -0,0 +1,249 @@
+package editor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"editor/clipboardx"
+	"editor/ui"
+)
+
+func namedSessionDir() string {
+	if dir := sessionDir(); dir != "" {
+		return filepath.Join(dir, "named")
+	}
+	return ""
+}
+
+func namedSessionPath(name string) string {
+	return filepath.Join(namedSessionDir(), name+".json")
+}
+
+// validSessionName reports whether name can be used as a file name.
+func validSessionName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
+
+// namedSessions lists the saved session names, sorted.
+func namedSessions() []string {
+	entries, err := os.ReadDir(namedSessionDir())
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".json"); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeSessionFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// saveNamedSession saves the tabs, folders and layout under name, which
+// becomes the current session.
+func (e *Editor) saveNamedSession(name string) error {
+	if !validSessionName(name) {
+		return errors.New("session names can't contain slashes or start with a dot")
+	}
+	session := e.captureSession()
+	if err := writeSessionFile(namedSessionPath(name), session); err != nil {
+		return err
+	}
+	e.sessionName, e.workspacePath = name, ""
+	return nil
+}
+
+// saveCurrentSession writes the named session or workspace in use, if
+// any, so switching away or quitting keeps its latest layout.
+func (e *Editor) saveCurrentSession() error {
+	switch {
+	case e.workspacePath != "":
+		return e.saveWorkspace(e.workspacePath)
+	case e.sessionName != "":
+		return writeSessionFile(namedSessionPath(e.sessionName), e.captureSession())
+	}
+	return nil
+}
+
+// switchToSession saves the session in use, then replaces the open tabs,
+// folders, layout and workspace settings with those of session. Unsaved
+// changes would be lost, so it refuses while any buffer is dirty.
+func (e *Editor) switchToSession(session *SessionData, settings json.RawMessage) error {
+	for _, buf := range e.allBuffers() {
+		if buf.Dirty {
+			return errors.New("save or close unsaved changes first")
+		}
+	}
+	if err := e.saveCurrentSession(); err != nil {
+		return err
+	}
+	e.sessionName, e.workspacePath = "", ""
+	e.cfg.ClearOverrides()
+	if len(settings) > 0 {
+		if err := e.cfg.ApplyOverrides(settings); err != nil {
+			e.setTemporaryError("Error in workspace settings: " + err.Error())
+		}
+	}
+
+	e.closeFragileModals()
+	for len(e.buffers) > 0 {
+		e.dropTab(len(e.buffers) - 1)
+	}
+	e.activeTab = -1
+
+	folders := session.Folders
+	if len(folders) == 0 {
+		folders = []string{e.watchedRoot}
+	}
+	if e.fileTree != nil {
+		e.fileTree.SetRoots(folders)
+	}
+	if e.fileWatcher != nil {
+		for _, folder := range folders {
+			if folder != e.watchedRoot {
+				e.addWatchRecursive(folder)
+			}
+		}
+	}
+	e.applyConfig()
+	e.applyLayout(session.Layout, session.Terminal)
+
+	if !e.openSessionFiles(session, false) {
+		e.openEmptyBuffer()
+	}
+	if session.ActiveTab >= 0 && session.ActiveTab < len(e.buffers) {
+		e.switchTab(session.ActiveTab)
+	}
+	e.updateFocus()
+	return nil
+}
+
+// applyLayout puts the explorer, the terminal and focus as they were.
+func (e *Editor) applyLayout(layout *LayoutState, term *TerminalState) {
+	if term != nil {
+		if term.Ratio > 0 {
+			e.termRatio = term.Ratio
+		}
+		if term.Open != e.termOpen && e.screen != nil {
+			e.toggleTerminal()
+		}
+	}
+	if layout != nil {
+		e.treeOpen = layout.TreeOpen
+		if layout.TreeWidth > 0 {
+			e.treeWidth = layout.TreeWidth
+		}
+		switch {
+		case layout.Focus == "tree" && e.treeOpen,
+			layout.Focus == "terminal" && e.termOpen,
+			layout.Focus == "editor":
+			e.focusTarget = layout.Focus
+		}
+	}
+	if e.focusTarget == "tree" && !e.treeOpen || e.focusTarget == "terminal" && !e.termOpen {
+		e.focusTarget = "editor"
+	}
+	e.updateFocus()
+}
+
+// applyConfig passes settings that may have changed, such as with a
+// workspace's, on to the parts of the editor that copy them.
+func (e *Editor) applyConfig() {
+	e.treeWidth = e.cfg.TreeWidth
+	e.termRatio = e.cfg.TermRatio
+	clipboardx.SetHistoryLimit(e.cfg.ClipboardHistorySize)
+	for _, buf := range e.allBuffers() {
+		buf.AutoCloseEnabled = e.cfg.AutoClose
+		buf.PreserveLineEndings = e.cfg.PreserveMixedLineEndings
+	}
+}
+
+func (e *Editor) openSaveSessionDialog() {
+	d := ui.NewInputDialog("Save session as: ")
+	d.Input = e.sessionName
+	d.Cursor = len([]rune(d.Input))
+	d.OnSubmit = func(name string) {
+		e.dialog = nil
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return
+		}
+		if err := e.saveNamedSession(name); err != nil {
+			e.setTemporaryError("Error saving session: " + err.Error())
+			return
+		}
+		e.setTemporaryMessage("Saved session " + name)
+	}
+	d.OnCancel = func() {
+		e.dialog = nil
+	}
+	e.dialog = d
+}
+
+// openSwitchSessionPicker lists the named sessions and switches to the one
+// picked.
+func (e *Editor) openSwitchSessionPicker() {
+	names := namedSessions()
+	if len(names) == 0 {
+		e.setTemporaryError("No saved sessions (Save Session As to add one)")
+		return
+	}
+	e.openPicker(names, e.sessionName, func(name string) {
+		if err := e.switchToNamedSession(name); err != nil {
+			e.setTemporaryError("Can't switch session: " + err.Error())
+			return
+		}
+		e.setTemporaryMessage("Switched to session " + name)
+	})
+}
+
+func (e *Editor) switchToNamedSession(name string) error {
+	data, err := os.ReadFile(namedSessionPath(name))
+	if err != nil {
+		return err
+	}
+	var session SessionData
+	if err := json.Unmarshal(data, &session); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := e.switchToSession(&session, nil); err != nil {
+		return err
+	}
+	e.sessionName = name
+	return nil
+}
+
+func (e *Editor) openDeleteSessionPicker() {
+	names := namedSessions()
+	if len(names) == 0 {
+		e.setTemporaryError("No saved sessions")
+		return
+	}
+	e.openPicker(names, e.sessionName, func(name string) {
+		if err := os.Remove(namedSessionPath(name)); err != nil {
+			e.setTemporaryError("Error deleting session: " + err.Error())
+			return
+		}
+		if e.sessionName == name {
+			e.sessionName = ""
+		}
+		e.setTemporaryMessage("Deleted session " + name)
+	})
+}
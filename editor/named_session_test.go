@@ -0,0 +1,161 @@
+package editor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"editor/config"
+	"editor/lsp"
+	"editor/ui"
+)
+
+func newSessionTestEditor(t *testing.T) (*Editor, string) {
+	t.Helper()
+	e, wd := newWorkspaceTestEditor(t)
+	e.lspManager = lsp.NewManager(wd)
+	e.fileTree = ui.NewFileTree(wd)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(wd, name), []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	return e, wd
+}
+
+func TestSwitchNamedSessions(t *testing.T) {
+	e, wd := newSessionTestEditor(t)
+	e.openFile(filepath.Join(wd, "a.txt"))
+	e.activeBuffer().FoldedLines[0] = 2
+	e.treeOpen = false
+	if err := e.saveNamedSession("feature"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	e.dropTab(0)
+	e.openFile(filepath.Join(wd, "b.txt"))
+	e.treeOpen = true
+	if err := e.saveNamedSession("main"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if got := namedSessions(); len(got) != 2 || got[0] != "feature" || got[1] != "main" {
+		t.Fatalf("sessions = %q", got)
+	}
+
+	if err := e.switchToNamedSession("feature"); err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+	if len(e.buffers) != 1 || filepath.Base(e.buffers[0].Path) != "a.txt" || e.treeOpen {
+		t.Fatalf("after switch: %d tabs, tree open %v", len(e.buffers), e.treeOpen)
+	}
+	if end := e.buffers[0].FoldedLines[0]; end != 2 {
+		t.Fatalf("fold not restored: %v", e.buffers[0].FoldedLines)
+	}
+
+	// Unsaved changes would be lost, so switching waits for them
+	e.buffers[0].InsertText("x")
+	if err := e.switchToNamedSession("main"); err == nil {
+		t.Fatalf("switched away from a dirty buffer")
+	}
+}
+
+func TestWorkspaceFile(t *testing.T) {
+	e, wd := newSessionTestEditor(t)
+	other := t.TempDir()
+	e.fileTree.SetRoots([]string{wd, other})
+	e.openFile(filepath.Join(wd, "a.txt"))
+	path := filepath.Join(wd, "proj"+workspaceExt)
+	if err := e.saveWorkspace(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// Paths inside the workspace's directory are stored relative to it
+	var ws workspaceFile
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &ws); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if ws.Folders[0] != "." || ws.Folders[1] != other || ws.Files[0].Path != "a.txt" {
+		t.Fatalf("folders %q, files %+v", ws.Folders, ws.Files)
+	}
+
+	// Settings apply while the workspace is open, without being saved as
+	// the user's own
+	ws.Settings = json.RawMessage(`{"tab_size": 8, "word_wrap": true, "shell": "/tmp/evil", "large_file_mb": 0}`)
+	data, _ = json.Marshal(ws)
+	os.WriteFile(path, data, 0o600)
+	e.workspacePath = ""
+	if err := e.openWorkspace(path); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if !e.cfg.WordWrap || e.cfg.TabSize != 8 {
+		t.Fatalf("workspace settings not applied: %+v", e.cfg)
+	}
+	if e.cfg.Shell != config.Default().Shell || e.cfg.LargeFileMB != config.Default().LargeFileMB {
+		t.Fatalf("workspace set a setting outside the allowlist: %+v", e.cfg)
+	}
+	if roots := e.fileTree.Roots(); len(roots) != 2 || roots[1] != other {
+		t.Fatalf("roots = %q", roots)
+	}
+	e.cfg.Save()
+	saved, err := config.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if saved.WordWrap || saved.TabSize != config.Default().TabSize {
+		t.Fatalf("workspace settings leaked into settings.json: %+v", saved)
+	}
+
+	// Reopening keeps the settings written in the file
+	if err := e.saveWorkspace(path); err != nil {
+		t.Fatalf("save again: %v", err)
+	}
+	reread, err := readWorkspace(path)
+	if err != nil || string(reread.Settings) == "" {
+		t.Fatalf("settings dropped on save: %v", err)
+	}
+}
+
+func TestWorkspaceKeepsSplitLayout(t *testing.T) {
+	e, wd := newSessionTestEditor(t)
+	e.openFile(filepath.Join(wd, "a.txt"))
+	e.openFile(filepath.Join(wd, "b.txt"))
+	e.splitPane(true, true)
+	e.layout.ratio = 0.3
+	e.openFile(filepath.Join(wd, "a.txt"))
+	e.activeBuffer().Cursor.Line = 2
+	e.focusPane(e.panes()[0])
+	path := filepath.Join(wd, "proj"+workspaceExt)
+	if err := e.saveWorkspace(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	e.splitPane(false, false)
+	e.workspacePath = ""
+	if err := e.openWorkspace(path); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	panes := e.panes()
+	if len(panes) != 2 || !e.layout.vertical || e.layout.ratio != 0.3 || e.pane != panes[0] {
+		t.Fatalf("%d panes, vertical %v, ratio %v", len(panes), e.layout.vertical, e.layout.ratio)
+	}
+	var names [][]string
+	for _, p := range panes {
+		var tabs []string
+		for _, buf := range e.paneBuffers(p) {
+			tabs = append(tabs, filepath.Base(buf.Path))
+		}
+		names = append(names, tabs)
+	}
+	if len(names[0]) != 1 || names[0][0] != "a.txt" || len(names[1]) != 2 || names[1][0] != "b.txt" || names[1][1] != "a.txt" {
+		t.Fatalf("tabs = %q", names)
+	}
+	if line := e.activeBuffer().Cursor.Line; line != 0 {
+		t.Fatalf("focused pane's cursor on line %d", line)
+	}
+	e.focusPane(panes[1])
+	if e.activeTab != 1 || e.activeBuffer().Cursor.Line != 2 {
+		t.Fatalf("second pane: tab %d, cursor line %d", e.activeTab, e.activeBuffer().Cursor.Line)
+	}
+}
@@ -0,0 +1,684 @@
+package editor
+
+import (
+	"path/filepath"
+
+	"editor/buffer"
+	"editor/config"
+	"editor/ui"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// minPaneSize is the fewest columns or rows a pane is squeezed to when
+// there is room for it.
+const minPaneSize = 8
+
+// pane is an editing area of its own: a tab bar and a view of each of its
+// buffers. A buffer can be shown in several panes, each with its own
+// scrolling and cursors. The focused pane's tabs live in the Editor's
+// buffers, activeTab, tabBar, views, previewTab and gitGutter fields;
+// the others keep theirs here until they are focused.
+type pane struct {
+	buffers    []*buffer.Buffer
+	activeTab  int
+	tabBar     *ui.TabBar
+	views      map[*buffer.Buffer]*EditorView
+	previewTab int
+	gitGutter  *GitGutter
+
+	x, y, w, h int // where the pane was last laid out, tab bar included
+}
+
+// split divides an area between two parts, side by side if vertical or
+// one above the other, with a divider between them. A leaf holds a pane
+// instead.
+type split struct {
+	pane          *pane
+	vertical      bool
+	ratio         float64 // share of the area the first part takes
+	first, second *split
+	parent        *split
+
+	x, y, w, h int // where the split was last laid out
+}
+
+// viewCursors are a view's cursors while its pane isn't focused.
+type viewCursors struct {
+	cursor    buffer.Cursor
+	selection *buffer.Selection
+	extra     []buffer.ExtraCursor
+}
+
+func newPane() *pane {
+	return &pane{
+		activeTab:  -1,
+		views:      make(map[*buffer.Buffer]*EditorView),
+		previewTab: -1,
+		gitGutter:  NewGitGutter(),
+	}
+}
+
+// newTabBar returns a tab bar acting on the focused pane's tabs, which is
+// the one clicked since a click focuses its pane first.
+func (e *Editor) newTabBar() *ui.TabBar {
+	tb := ui.NewTabBar()
+	tb.OnSwitch = func(idx int) { e.switchTab(idx) }
+	tb.OnClose = func(idx int) { e.closeTab(idx) }
+	return tb
+}
+
+// place lays out s and the splits under it in the given area.
+func (s *split) place(x, y, w, h int) {
+	s.x, s.y, s.w, s.h = x, y, w, h
+	if s.pane != nil {
+		s.pane.x, s.pane.y, s.pane.w, s.pane.h = x, y, w, h
+		return
+	}
+	if s.vertical {
+		fw := s.firstSize(w)
+		s.first.place(x, y, fw, h)
+		s.second.place(x+fw+1, y, w-fw-1, h)
+	} else {
+		fh := s.firstSize(h)
+		s.first.place(x, y, w, fh)
+		s.second.place(x, y+fh+1, w, h-fh-1)
+	}
+}
+
+// firstSize is how much of size, the divider included, the first part
+// takes.
+func (s *split) firstSize(size int) int {
+	avail := size - 1
+	first := int(float64(avail)*s.ratio + 0.5)
+	if avail >= 2*minPaneSize {
+		first = max(minPaneSize, min(first, avail-minPaneSize))
+	}
+	return max(0, min(first, avail))
+}
+
+// divider returns the line between the parts of s.
+func (s *split) divider() (x, y, w, h int) {
+	if s.vertical {
+		return s.x + s.firstSize(s.w), s.y, 1, s.h
+	}
+	return s.x, s.y + s.firstSize(s.h), s.w, 1
+}
+
+// leaves returns the panes under s, left to right and top to bottom.
+func (s *split) leaves() []*pane {
+	if s.pane != nil {
+		return []*pane{s.pane}
+	}
+	return append(s.first.leaves(), s.second.leaves()...)
+}
+
+// find returns the leaf holding p.
+func (s *split) find(p *pane) *split {
+	if s.pane != nil {
+		if s.pane == p {
+			return s
+		}
+		return nil
+	}
+	if found := s.first.find(p); found != nil {
+		return found
+	}
+	return s.second.find(p)
+}
+
+// dividerAt returns the split whose divider is at x, y.
+func (s *split) dividerAt(x, y int) *split {
+	if s.pane != nil {
+		return nil
+	}
+	dx, dy, dw, dh := s.divider()
+	if x >= dx && x < dx+dw && y >= dy && y < dy+dh {
+		return s
+	}
+	if found := s.first.dividerAt(x, y); found != nil {
+		return found
+	}
+	return s.second.dividerAt(x, y)
+}
+
+// panes returns every pane, left to right and top to bottom.
+func (e *Editor) panes() []*pane {
+	return e.layout.leaves()
+}
+
+// paneBuffers returns the buffers of p's tabs.
+func (e *Editor) paneBuffers(p *pane) []*buffer.Buffer {
+	if p == e.pane {
+		return e.buffers
+	}
+	return p.buffers
+}
+
+// allBuffers returns every open buffer once, the focused pane's first in
+// tab order.
+func (e *Editor) allBuffers() []*buffer.Buffer {
+	bufs := append([]*buffer.Buffer(nil), e.buffers...)
+	if e.layout.pane != nil {
+		return bufs
+	}
+	seen := make(map[*buffer.Buffer]bool, len(bufs))
+	for _, buf := range bufs {
+		seen[buf] = true
+	}
+	for _, p := range e.panes() {
+		for _, buf := range e.paneBuffers(p) {
+			if !seen[buf] {
+				seen[buf] = true
+				bufs = append(bufs, buf)
+			}
+		}
+	}
+	return bufs
+}
+
+// paneTabBar returns p's tab bar.
+func (e *Editor) paneTabBar(p *pane) *ui.TabBar {
+	if p == e.pane {
+		return e.tabBar
+	}
+	return p.tabBar
+}
+
+// inOtherPane reports whether a pane other than the focused one shows buf.
+func (e *Editor) inOtherPane(buf *buffer.Buffer) bool {
+	for _, p := range e.panes() {
+		if p == e.pane {
+			continue
+		}
+		for _, b := range p.buffers {
+			if b == buf {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bufferInOtherPane returns the buffer another pane has open for path.
+func (e *Editor) bufferInOtherPane(path string) *buffer.Buffer {
+	for _, p := range e.panes() {
+		if p == e.pane {
+			continue
+		}
+		for _, b := range p.buffers {
+			if b.Path == path {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// usePane puts p's tabs in the Editor's fields, keeping the focused
+// pane's in it, and gives p's buffers the cursors they have in p. It
+// changes nothing else, so it can be undone by using the old pane again.
+func (e *Editor) usePane(p *pane) {
+	cur := e.pane
+	if p == cur {
+		return
+	}
+	cur.buffers, cur.activeTab, cur.tabBar = e.buffers, e.activeTab, e.tabBar
+	cur.views, cur.previewTab, cur.gitGutter = e.views, e.previewTab, e.gitGutter
+	for buf, view := range cur.views {
+		view.saveCursors(buf)
+	}
+
+	e.pane = p
+	e.buffers, e.activeTab, e.tabBar = p.buffers, p.activeTab, p.tabBar
+	e.views, e.previewTab, e.gitGutter = p.views, p.previewTab, p.gitGutter
+	for buf, view := range p.views {
+		view.loadCursors(buf)
+	}
+}
+
+// focusPane moves the focus to p.
+func (e *Editor) focusPane(p *pane) {
+	if p == e.pane {
+		return
+	}
+	e.mouseDown = false
+	e.autocomplete = nil
+	e.hover = nil
+	e.usePane(p)
+	if buf := e.activeBuffer(); buf != nil {
+		e.gitGutter.Update(buf.Path)
+		if e.treeOpen && e.fileTree != nil {
+			e.fileTree.SelectPath(buf.Path)
+		}
+	}
+	e.focusTarget = "editor"
+	e.updateFocus()
+	e.updateStatus()
+}
+
+// saveCursors keeps buf's cursors in the view while its pane isn't focused.
+func (v *EditorView) saveCursors(buf *buffer.Buffer) {
+	v.cursors = &viewCursors{
+		cursor: buf.Cursor,
+		extra:  append([]buffer.ExtraCursor(nil), buf.ExtraCursors...),
+	}
+	if buf.Selection != nil {
+		sel := *buf.Selection
+		v.cursors.selection = &sel
+	}
+}
+
+// loadCursors gives buf back the cursors saved in the view, as far as they
+// still fit after edits made in other panes.
+func (v *EditorView) loadCursors(buf *buffer.Buffer) {
+	c := v.cursors
+	if c == nil {
+		return
+	}
+	v.cursors = nil
+	if !fitsCursor(buf, c.cursor) {
+		return
+	}
+	buf.Cursor = c.cursor
+	// Kept as it was, even empty, as a mouse drag starts one
+	buf.Selection = nil
+	if s := c.selection; s != nil && fitsCursor(buf, s.Start) && fitsCursor(buf, s.End) {
+		buf.Selection = s
+	}
+	buf.ClearExtraCursors()
+	for _, ec := range c.extra {
+		if fitsCursor(buf, ec.Cursor) {
+			buf.ExtraCursors = append(buf.ExtraCursors, ec)
+		}
+	}
+}
+
+// showBuffer adds a tab for buf, already open in another pane, to the
+// focused pane.
+func (e *Editor) showBuffer(buf *buffer.Buffer) {
+	e.buffers = append(e.buffers, buf)
+	e.views[buf] = &EditorView{}
+	title := "untitled"
+	if buf.Path != "" {
+		title = filepath.Base(buf.Path)
+	}
+	// AddTab would merge untitled tabs, so the tab is added directly
+	e.tabBar.Tabs = append(e.tabBar.Tabs, ui.Tab{
+		Title:              title,
+		Path:               buf.Path,
+		Modified:           buf.Dirty,
+		ExternallyModified: buf.ExternallyModified,
+	})
+	e.switchTab(len(e.buffers) - 1)
+}
+
+// splitPane splits the focused pane in two, the new pane to the right of
+// it or below, and focuses the new one. If move, the active tab moves
+// there; otherwise the new pane shows the same buffer at the same place.
+func (e *Editor) splitPane(vertical, move bool) {
+	buf := e.activeBuffer()
+	if buf == nil {
+		return
+	}
+	if move && len(e.buffers) < 2 {
+		e.setTemporaryMessage("Only one tab: split the pane to show it twice")
+		return
+	}
+	leaf := e.layout.find(e.pane)
+	if leaf == nil {
+		return
+	}
+	old := e.activeView()
+	view := &EditorView{}
+	if old != nil {
+		view.scrollY, view.scrollX = old.scrollY, old.scrollX
+	}
+	if move {
+		e.detachTab(e.activeTab)
+	}
+
+	p := newPane()
+	p.tabBar = e.newTabBar()
+	leaf.first = &split{pane: leaf.pane, parent: leaf}
+	leaf.second = &split{pane: p, parent: leaf}
+	leaf.pane, leaf.vertical, leaf.ratio = nil, vertical, 0.5
+
+	cursors := buf.Cursors()
+	selection := buf.Selection
+	e.focusPane(p)
+	e.showBuffer(buf)
+	e.views[buf] = view
+	buf.Cursor = cursors[0]
+	buf.Selection = selection
+}
+
+// detachTab takes a tab out of the focused pane without closing its
+// buffer, which is moving to another pane.
+func (e *Editor) detachTab(idx int) {
+	buf := e.buffers[idx]
+	buf.ClearExtraCursors()
+	e.buffers = append(e.buffers[:idx], e.buffers[idx+1:]...)
+	delete(e.views, buf)
+	e.tabBar.RemoveTab(idx)
+	if e.previewTab == idx {
+		e.previewTab = -1
+	} else if e.previewTab > idx {
+		e.previewTab--
+	}
+	if e.activeTab >= len(e.buffers) {
+		e.activeTab = len(e.buffers) - 1
+	}
+	e.tabBar.Active = e.activeTab
+	if e.activeTab >= 0 {
+		e.gitGutter.Update(e.buffers[e.activeTab].Path)
+	}
+}
+
+// closePane removes the focused pane, which has no tabs left, and focuses
+// the one taking its place. It reports false for the last pane.
+func (e *Editor) closePane() bool {
+	leaf := e.layout.find(e.pane)
+	if leaf == nil || leaf.parent == nil {
+		return false
+	}
+	parent := leaf.parent
+	wasSecond := leaf == parent.second
+	sibling := parent.first
+	if !wasSecond {
+		sibling = parent.second
+	}
+	// The sibling takes the parent's place
+	parent.pane, parent.vertical, parent.ratio = sibling.pane, sibling.vertical, sibling.ratio
+	parent.first, parent.second = sibling.first, sibling.second
+	if parent.first != nil {
+		parent.first.parent = parent
+		parent.second.parent = parent
+	}
+
+	// Focus the pane nearest the closed one
+	leaves := parent.leaves()
+	next := leaves[0]
+	if wasSecond {
+		next = leaves[len(leaves)-1]
+	}
+	e.usePane(next)
+	e.focusTarget = "editor"
+	e.updateFocus()
+	e.updateStatus()
+	return true
+}
+
+// focusNextPane moves the focus to the next pane, or the previous one if
+// delta is negative.
+func (e *Editor) focusNextPane(delta int) {
+	panes := e.panes()
+	if len(panes) < 2 {
+		e.setTemporaryMessage("No other pane (Ctrl+\\ splits)")
+		return
+	}
+	e.focusPane(panes[(paneIndex(panes, e.pane)+delta+len(panes))%len(panes)])
+}
+
+// moveTabToPane moves the active tab to the next pane, or the previous one
+// if delta is negative, splitting the pane when there is no other.
+func (e *Editor) moveTabToPane(delta int) {
+	buf := e.activeBuffer()
+	if buf == nil {
+		return
+	}
+	panes := e.panes()
+	if len(panes) < 2 {
+		e.splitPane(true, true)
+		return
+	}
+	target := panes[(paneIndex(panes, e.pane)+delta+len(panes))%len(panes)]
+	view := e.activeView()
+	cursors := buf.Cursors()
+	selection := buf.Selection
+	shown := -1 // the tab the target already has for buf
+	for i, b := range target.buffers {
+		if b == buf {
+			shown = i
+		}
+	}
+
+	e.detachTab(e.activeTab)
+	if len(e.buffers) == 0 {
+		// The pane closes as its last tab leaves
+		e.closePane()
+	}
+	e.focusPane(target)
+	if shown >= 0 {
+		e.switchTab(shown)
+		return
+	}
+	e.showBuffer(buf)
+	if view != nil {
+		e.views[buf] = view
+	}
+	buf.Cursor = cursors[0]
+	buf.Selection = selection
+}
+
+// closeFocusedPane closes the focused pane, moving its tabs to the pane
+// that takes its place rather than closing them.
+func (e *Editor) closeFocusedPane() {
+	if len(e.panes()) < 2 {
+		e.setTemporaryMessage("Only one pane")
+		return
+	}
+	bufs := append([]*buffer.Buffer(nil), e.buffers...)
+	for len(e.buffers) > 0 {
+		e.detachTab(len(e.buffers) - 1)
+	}
+	e.closePane()
+	for _, buf := range bufs {
+		if !containsBuffer(e.buffers, buf) {
+			e.showBuffer(buf)
+		}
+	}
+}
+
+func containsBuffer(bufs []*buffer.Buffer, buf *buffer.Buffer) bool {
+	for _, b := range bufs {
+		if b == buf {
+			return true
+		}
+	}
+	return false
+}
+
+func paneIndex(panes []*pane, p *pane) int {
+	for i, q := range panes {
+		if q == p {
+			return i
+		}
+	}
+	return 0
+}
+
+// removeTabsWhere closes, in every pane, the tabs whose buffer matches,
+// without asking about unsaved changes. If no tab is left, it opens an empty
+// one rather than quitting.
+func (e *Editor) removeTabsWhere(match func(*buffer.Buffer) bool) {
+	focused := e.pane
+	for _, p := range e.panes() {
+		if e.layout.find(p) == nil {
+			continue // closed as its last tab went
+		}
+		e.usePane(p)
+		for i := len(e.buffers) - 1; i >= 0; i-- {
+			if i < len(e.buffers) && match(e.buffers[i]) {
+				e.dropTab(i)
+			}
+		}
+	}
+	if e.layout.find(focused) != nil {
+		e.usePane(focused)
+	}
+	if len(e.buffers) == 0 {
+		e.openEmptyBuffer()
+	}
+}
+
+// syncTabs brings every pane's tab titles and markers up to date with
+// their buffers, which may have been saved, edited or renamed in another
+// pane.
+func (e *Editor) syncTabs() {
+	for _, p := range e.panes() {
+		tb := e.paneTabBar(p)
+		for i, buf := range e.paneBuffers(p) {
+			if i >= len(tb.Tabs) {
+				break
+			}
+			tab := &tb.Tabs[i]
+			tab.Modified = buf.Dirty
+			tab.ExternallyModified = buf.ExternallyModified
+			if buf.Path != "" && tab.Path != buf.Path {
+				tab.Path = buf.Path
+				tab.Title = filepath.Base(buf.Path)
+			}
+		}
+	}
+}
+
+// layoutPanes places the panes in the area beside the explorer and above
+// the terminal and status bar.
+func (e *Editor) layoutPanes() {
+	screenW, screenH := e.screen.Size()
+	left := e.treeLeft()
+	bottom := screenH - 1 // status bar
+	if e.termOpen {
+		_, bottom, _, _ = e.termLayout()
+	}
+	e.layout.place(left, 0, screenW-left, bottom)
+}
+
+// paneAt returns the pane at x, y.
+func (e *Editor) paneAt(x, y int) *pane {
+	for _, p := range e.panes() {
+		if x >= p.x && x < p.x+p.w && y >= p.y && y < p.y+p.h {
+			return p
+		}
+	}
+	return nil
+}
+
+// renderPanes draws every pane with its tab bar, and the dividers between
+// them. The focused pane is drawn last, leaving its tabs in the Editor's
+// fields.
+func (e *Editor) renderPanes(theme *config.ColorScheme) {
+	e.layoutPanes()
+	e.syncTabs()
+	focused := e.pane
+	for _, p := range e.panes() {
+		if p != focused {
+			e.usePane(p)
+			e.renderPane(theme)
+		}
+	}
+	e.usePane(focused)
+	e.renderPane(theme)
+	e.renderDividers(e.layout, theme)
+}
+
+// renderPane draws the focused pane: its tab bar and the active tab.
+func (e *Editor) renderPane(theme *config.ColorScheme) {
+	p := e.pane
+	e.tabBar.Theme = theme
+	e.tabBar.Render(e.screen, p.x, p.y, p.w, 1)
+
+	ex, ey, ew, eh := p.x, p.y+1, p.w, p.h-1
+	buf := e.activeBuffer()
+	if buf != nil {
+		if iv, ok := e.imageViews[buf]; ok && iv != nil {
+			iv.SetTheme(theme)
+			iv.Render(e.screen, ex, ey, ew, eh)
+		} else if hv, ok := e.hexViews[buf]; ok {
+			hv.Theme = theme
+			hv.Render(e.screen, ex, ey, ew, eh)
+		} else {
+			e.renderEditor(ex, ey, ew, eh)
+		}
+	} else {
+		e.renderEditor(ex, ey, ew, eh)
+	}
+}
+
+func (e *Editor) renderDividers(s *split, theme *config.ColorScheme) {
+	if s.pane != nil {
+		return
+	}
+	style := tcell.StyleDefault.Background(theme.Background).Foreground(theme.TreeBorder)
+	if s == e.dragSplit {
+		style = style.Foreground(theme.LineNumberActive)
+	}
+	x, y, w, h := s.divider()
+	ch := '─'
+	if s.vertical {
+		ch = '│'
+	}
+	for cy := y; cy < y+h; cy++ {
+		for cx := x; cx < x+w; cx++ {
+			e.screen.SetContent(cx, cy, ch, nil, style)
+		}
+	}
+	e.renderDividers(s.first, theme)
+	e.renderDividers(s.second, theme)
+}
+
+// handleSplitMouse lets a divider be dragged to resize the panes on
+// either side of it.
+func (e *Editor) handleSplitMouse(ev *tcell.EventMouse) bool {
+	mx, my := ev.Position()
+	btn := ev.Buttons()
+	if s := e.dragSplit; s != nil {
+		if btn&tcell.Button1 == 0 {
+			e.dragSplit = nil
+			return true
+		}
+		if s.vertical && s.w > 1 {
+			s.ratio = float64(mx-s.x) / float64(s.w-1)
+		} else if !s.vertical && s.h > 1 {
+			s.ratio = float64(my-s.y) / float64(s.h-1)
+		}
+		s.ratio = max(0.05, min(s.ratio, 0.95))
+		return true
+	}
+	if btn != tcell.Button1 || e.mouseDown {
+		return false
+	}
+	e.layoutPanes()
+	if s := e.layout.dividerAt(mx, my); s != nil {
+		e.dragSplit = s
+		return true
+	}
+	return false
+}
+
+// handlePaneKey handles the keys that split the editor and move the focus
+// and tabs between panes.
+func (e *Editor) handlePaneKey(ev *tcell.EventKey) bool {
+	if e.focusTarget != "editor" {
+		return false
+	}
+	mods := ev.Modifiers()
+	switch {
+	case ev.Key() == tcell.KeyCtrlBackslash:
+		e.splitPane(true, false)
+	case ev.Key() == tcell.KeyRune && ev.Rune() == '\\' && mods == tcell.ModAlt:
+		e.splitPane(false, false)
+	case ev.Key() == tcell.KeyF6 && mods&tcell.ModShift != 0:
+		e.focusNextPane(-1)
+	case ev.Key() == tcell.KeyF6:
+		e.focusNextPane(1)
+	case ev.Key() == tcell.KeyLeft && mods&(tcell.ModCtrl|tcell.ModAlt) == tcell.ModCtrl|tcell.ModAlt:
+		e.moveTabToPane(-1)
+	case ev.Key() == tcell.KeyRight && mods&(tcell.ModCtrl|tcell.ModAlt) == tcell.ModCtrl|tcell.ModAlt:
+		e.moveTabToPane(1)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package editor
+
+import (
+	"path/filepath"
+	"testing"
+
+	"editor/buffer"
+)
+
+func TestSplitPanesShareBuffers(t *testing.T) {
+	e, wd := newSessionTestEditor(t)
+	e.openFile(filepath.Join(wd, "a.txt"))
+	a := e.activeBuffer()
+	a.Cursor = buffer.Cursor{Line: 1, Col: 1}
+	first := e.pane
+
+	e.splitPane(true, false)
+	if len(e.panes()) != 2 || e.pane == first || e.activeBuffer() != a {
+		t.Fatalf("split: %d panes, active buffer %v", len(e.panes()), e.activeBuffer())
+	}
+	if a.Cursor != (buffer.Cursor{Line: 1, Col: 1}) {
+		t.Fatalf("new pane cursor = %v", a.Cursor)
+	}
+
+	// Each pane keeps its own cursor in the shared buffer
+	a.Cursor = buffer.Cursor{Line: 2, Col: 0}
+	a.InsertText("x")
+	e.focusNextPane(1)
+	if e.pane != first || a.Cursor != (buffer.Cursor{Line: 1, Col: 1}) {
+		t.Fatalf("first pane cursor = %v", a.Cursor)
+	}
+	if a.Line(2) != "xthree" {
+		t.Fatalf("edit not shared: %q", a.Line(2))
+	}
+	e.focusNextPane(1)
+	if a.Cursor != (buffer.Cursor{Line: 2, Col: 1}) {
+		t.Fatalf("second pane cursor = %v", a.Cursor)
+	}
+
+	// Closing the second pane's tab closes the pane but not the buffer
+	a.RecomputeDirty()
+	e.closeTab(0)
+	if e.dialog != nil || len(e.panes()) != 1 || e.pane != first || e.activeBuffer() != a {
+		t.Fatalf("close: dialog %v, %d panes", e.dialog != nil, len(e.panes()))
+	}
+
+	// Moving a tab with only one pane splits it
+	e.openFile(filepath.Join(wd, "b.txt"))
+	b := e.activeBuffer()
+	e.moveTabToPane(1)
+	if len(e.panes()) != 2 || len(e.buffers) != 1 || e.activeBuffer() != b {
+		t.Fatalf("move: %d panes, %d tabs", len(e.panes()), len(e.buffers))
+	}
+	if len(first.buffers) != 1 || first.buffers[0] != a {
+		t.Fatalf("first pane tabs = %v", first.buffers)
+	}
+	if got := e.allBuffers(); len(got) != 2 || got[0] != b || got[1] != a {
+		t.Fatalf("all buffers = %v", got)
+	}
+
+	// Opening a file another pane has open shows the same buffer
+	e.openFile(filepath.Join(wd, "a.txt"))
+	if e.activeBuffer() != a || len(e.buffers) != 2 {
+		t.Fatalf("reopen: %d tabs", len(e.buffers))
+	}
+}
+
+func TestSplitLayout(t *testing.T) {
+	left, right := &pane{}, &pane{}
+	root := &split{vertical: true, ratio: 0.5}
+	root.first = &split{pane: left, parent: root}
+	root.second = &split{pane: right, parent: root}
+	root.place(10, 0, 81, 20)
+
+	if left.x != 10 || left.w != 40 || right.x != 51 || right.w != 40 || right.h != 20 {
+		t.Fatalf("left %d+%d, right %d+%d", left.x, left.w, right.x, right.w)
+	}
+	if s := root.dividerAt(50, 5); s != root {
+		t.Fatalf("divider not found at column 50")
+	}
+	if s := root.dividerAt(49, 5); s != nil {
+		t.Fatalf("divider found inside the left pane")
+	}
+
+	// A pane isn't squeezed below minPaneSize while there's room
+	root.ratio = 0.01
+	root.place(10, 0, 81, 20)
+	if left.w != minPaneSize {
+		t.Fatalf("left width = %d", left.w)
+	}
+}
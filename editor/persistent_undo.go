@@ -0,0 +1,133 @@
+package editor
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"editor/buffer"
+)
+
+// maxPersistedUndoOps caps how many undo operations are kept per file.
+const maxPersistedUndoOps = 10000
+
+// undoFile is a file's undo history as kept between sessions. Hash is the
+// hash of the text the history ends at; a file whose text differs when it
+// is opened again changed outside the editor, and the history is dropped.
+// Loading a file drops its blank lines at the end, so they are left out of
+// the hash and counted in Blank instead.
+type undoFile struct {
+	Path    string             `json:"path"`
+	Hash    string             `json:"hash"`
+	Blank   int                `json:"trailing_blank_lines,omitempty"`
+	History buffer.UndoHistory `json:"history"`
+}
+
+func undoDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "aln", "undo")
+}
+
+func undoPath(path string) string {
+	hash := sha256.Sum256([]byte(path))
+	return filepath.Join(undoDir(), fmt.Sprintf("%x.json", hash[:8]))
+}
+
+// contentHash returns the hash of buf's text without its blank lines at the
+// end, and how many there are.
+func contentHash(buf *buffer.Buffer) (string, int) {
+	text := buf.Text()
+	trimmed := strings.TrimRight(text, "\n")
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(trimmed))), len(text) - len(trimmed)
+}
+
+// keepsUndo reports whether buf's undo history is kept between sessions:
+// only text files have one worth keeping.
+func (e *Editor) keepsUndo(buf *buffer.Buffer) bool {
+	return buf.Path != "" && buf.Large() == nil && !buf.IsBinary &&
+		e.hexViews[buf] == nil && e.imageViews[buf] == nil && undoDir() != ""
+}
+
+// saveUndo writes buf's undo history for the next time the file is opened.
+func (e *Editor) saveUndo(buf *buffer.Buffer) error {
+	if !e.keepsUndo(buf) {
+		return nil
+	}
+	path := undoPath(buf.Path)
+	if !buf.Undo.CanUndo() && !buf.Undo.CanRedo() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	history, err := trimmedUndoHistory(buf)
+	if err != nil {
+		return err
+	}
+	hash, blank := contentHash(buf)
+	data, err := json.Marshal(undoFile{Path: buf.Path, Hash: hash, Blank: blank, History: history})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(undoDir(), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// trimmedUndoHistory returns buf's undo history cut down to what is kept
+// between sessions.
+func trimmedUndoHistory(buf *buffer.Buffer) (buffer.UndoHistory, error) {
+	// Trim a copy: the open buffer keeps its whole history
+	undo := buffer.NewUndoStack()
+	if err := undo.SetHistory(buf.Undo.History()); err != nil {
+		return buffer.UndoHistory{}, err
+	}
+	undo.TrimHistory(maxPersistedUndoOps)
+	return undo.History(), nil
+}
+
+// saveAllUndo writes the undo history of every open file.
+func (e *Editor) saveAllUndo() {
+	for _, buf := range e.allBuffers() {
+		e.saveUndo(buf)
+	}
+}
+
+// restoreUndo gives a freshly loaded buf the undo history saved for its
+// file, unless the file has changed since.
+func (e *Editor) restoreUndo(buf *buffer.Buffer) bool {
+	if !e.keepsUndo(buf) {
+		return false
+	}
+	data, err := os.ReadFile(undoPath(buf.Path))
+	if err != nil {
+		return false
+	}
+	var uf undoFile
+	if err := json.Unmarshal(data, &uf); err != nil || uf.Path != buf.Path {
+		return false
+	}
+	hash, blank := contentHash(buf)
+	undo := buffer.NewUndoStack()
+	if uf.Hash != hash || undo.SetHistory(uf.History) != nil {
+		// Stale, the file having changed outside the editor, or unreadable
+		os.Remove(undoPath(buf.Path))
+		return false
+	}
+	// Put back the blank lines the history's positions count on
+	if blank < uf.Blank {
+		n := buf.LineCount()
+		buf.ReplaceLines(n, n, make([]string, uf.Blank-blank)...)
+		buf.MarkSaved()
+	}
+	buf.Undo = undo
+	return true
+}
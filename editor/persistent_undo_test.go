@@ -0,0 +1,60 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUndoHistorySurvivesReopen(t *testing.T) {
+	e, wd := newWorkspaceTestEditor(t)
+	path := filepath.Join(wd, "notes.txt")
+	if err := os.WriteFile(path, []byte("one\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	b, err := e.loadBuffer(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	b.Cursor.Col = 3
+	b.InsertText(" two")
+	b.InsertText(" three")
+	b.ApplyUndo()
+	if err := b.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := e.saveUndo(b); err != nil {
+		t.Fatalf("save undo: %v", err)
+	}
+
+	b, err = e.loadBuffer(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	// The blank line saving added is back, as the history expects
+	checkLines(t, b, "one two", "")
+	if b.Dirty {
+		t.Fatalf("reopened buffer is dirty")
+	}
+	b.ApplyRedo()
+	checkLines(t, b, "one two three", "")
+	b.ApplyUndo()
+	b.ApplyUndo()
+	checkLines(t, b, "one", "")
+
+	// A file changed outside the editor drops its stale history
+	if err := os.WriteFile(path, []byte("changed\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	b, err = e.loadBuffer(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if b.Undo.CanUndo() || b.Undo.CanRedo() {
+		t.Fatalf("stale undo history restored")
+	}
+	if _, err := os.Stat(undoPath(path)); !os.IsNotExist(err) {
+		t.Fatalf("stale undo file kept, stat err=%v", err)
+	}
+}
@@ -0,0 +1,318 @@
+package editor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"editor/buffer"
+	"editor/lsp"
+	"editor/search"
+	"editor/ui"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// maxSearchMatches keeps the panel responsive on very common queries.
+const maxSearchMatches = 5000
+
+// projectSearch holds the state behind the find in files panel. It outlives
+// the panel so reopening it shows the last query and results.
+type projectSearch struct {
+	panel   *ui.SearchPanel
+	root    string
+	query   *search.Query
+	matches []search.Match
+
+	// gen counts searches so batches of a cancelled one are dropped
+	gen    int
+	cancel context.CancelFunc
+}
+
+func (e *Editor) searchRoot() string {
+	if e.fileTree != nil {
+		return e.fileTree.GetRoot()
+	}
+	if e.watchedRoot != "" {
+		return e.watchedRoot
+	}
+	cwd, _ := os.Getwd()
+	return cwd
+}
+
+func (e *Editor) openProjectSearch() {
+	e.closeFragileModals()
+
+	if e.findInFiles == nil {
+		e.findInFiles = &projectSearch{}
+	}
+	ps := e.findInFiles
+	if ps.panel == nil {
+		p := ui.NewSearchPanel(e.cfg.GetTheme())
+		p.OnSearch = e.runProjectSearch
+		p.OnReplaceChange = e.updateSearchReplacements
+		p.OnOpen = e.openSearchResult
+		p.OnReplace = e.replaceInFiles
+		p.OnClose = func() {
+			e.cancelProjectSearch()
+			e.searchPanel = nil
+		}
+		ps.panel = p
+	}
+
+	// A single-line selection becomes the query
+	if buf := e.activeBuffer(); buf != nil && buf.Selection != nil && !buf.Selection.Empty() {
+		if text := buf.GetSelectedText(); !strings.Contains(text, "\n") {
+			ps.panel.SetQuery(text)
+			e.searchPanel = ps.panel
+			e.runProjectSearch()
+			return
+		}
+	}
+	e.searchPanel = ps.panel
+	if ps.panel.Fields[ui.SearchFieldFind] != "" {
+		e.runProjectSearch() // files may have changed since the last search
+	}
+}
+
+// ProjectSearchEvent carries a batch of find in files matches from the
+// background search to the event loop.
+type ProjectSearchEvent struct {
+	tcell.EventTime
+	gen       int
+	matches   []search.Match
+	done      bool
+	truncated bool
+}
+
+// runProjectSearch starts searching the project with the panel's current
+// settings, cancelling the search for the previous query. Matches stream in
+// as ProjectSearchEvents. Open buffers are searched as edited, not as saved.
+func (e *Editor) runProjectSearch() {
+	ps := e.findInFiles
+	p := ps.panel
+	e.cancelProjectSearch()
+	ps.query, ps.matches = nil, nil
+	p.SetResults(nil)
+
+	opts := search.Options{
+		Query:         p.Fields[ui.SearchFieldFind],
+		Regex:         p.Regex,
+		CaseSensitive: p.CaseSensitive,
+		WholeWord:     p.WholeWord,
+		Include:       search.SplitGlobs(p.Fields[ui.SearchFieldInclude]),
+		Exclude:       search.SplitGlobs(p.Fields[ui.SearchFieldExclude]),
+	}
+	if opts.Query == "" {
+		p.Status = "Type to search, Enter to run"
+		return
+	}
+	q, err := search.Compile(opts)
+	if err != nil {
+		p.Status = "Invalid pattern: " + err.Error()
+		return
+	}
+	if e.screen == nil {
+		return
+	}
+
+	ps.root = e.searchRoot()
+	ps.query = q
+	p.Status = "Searching..."
+
+	// The search runs on other goroutines, so it gets a copy of the open
+	// buffers' lines rather than the buffers themselves
+	open := make(map[string][]string)
+	for _, buf := range e.allBuffers() {
+		if buf.Path != "" && buf.Large() == nil {
+			open[buf.Path] = buf.Lines()
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ps.cancel = cancel
+	go streamProjectSearch(ctx, cancel, q, ps.root, open, e.screen.PostEventWait, ps.gen)
+}
+
+// streamProjectSearch runs q and posts its matches in batches every 50ms so
+// the panel fills in while the search continues. It stops after
+// maxSearchMatches.
+func streamProjectSearch(ctx context.Context, cancel context.CancelFunc, q *search.Query, root string, open map[string][]string, post func(tcell.Event), gen int) {
+	defer cancel()
+	q.StreamBatches(ctx, root, func(path string) ([]string, bool) {
+		lines, ok := open[path]
+		return lines, ok
+	}, 50*time.Millisecond, maxSearchMatches, func(matches []search.Match, done, truncated bool) {
+		ev := &ProjectSearchEvent{gen: gen, matches: matches, done: done, truncated: truncated}
+		ev.SetEventNow()
+		post(ev)
+	})
+}
+
+func (e *Editor) cancelProjectSearch() {
+	ps := e.findInFiles
+	if ps == nil {
+		return
+	}
+	if ps.cancel != nil {
+		ps.cancel()
+		ps.cancel = nil
+	}
+	ps.gen++
+}
+
+// handleProjectSearchEvent adds a batch of matches from the current search,
+// keeping the results sorted by file and position. Batches of an earlier
+// query are dropped.
+func (e *Editor) handleProjectSearchEvent(ev *ProjectSearchEvent) {
+	ps := e.findInFiles
+	if ps == nil || ev.gen != ps.gen || ps.query == nil {
+		return
+	}
+	ps.matches = append(ps.matches, ev.matches...)
+	sort.SliceStable(ps.matches, func(i, j int) bool {
+		a, b := ps.matches[i], ps.matches[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+
+	files := make(map[string]bool)
+	for _, m := range ps.matches {
+		files[m.Path] = true
+	}
+	p := ps.panel
+	switch {
+	case !ev.done:
+		p.Status = fmt.Sprintf("Searching... %d results in %d files", len(ps.matches), len(files))
+	case len(ps.matches) == 0:
+		p.Status = "No results"
+	case ev.truncated:
+		p.Status = fmt.Sprintf("First %d results in %d files", len(ps.matches), len(files))
+	default:
+		p.Status = fmt.Sprintf("%d results in %d files", len(ps.matches), len(files))
+	}
+	if ev.done {
+		ps.cancel = nil
+	}
+	e.updateSearchReplacements()
+}
+
+// updateSearchReplacements rebuilds the result list so every match shows
+// what the replace field would turn it into.
+func (e *Editor) updateSearchReplacements() {
+	ps := e.findInFiles
+	if ps == nil || ps.query == nil {
+		return
+	}
+	template := ps.panel.Fields[ui.SearchFieldReplace]
+	// Keep matches the user unchecked unchecked while the template changes
+	// and while more results arrive
+	type matchPos struct {
+		path      string
+		line, col int
+	}
+	unchecked := make(map[matchPos]bool)
+	for _, r := range ps.panel.Results {
+		if !r.Enabled {
+			unchecked[matchPos{r.File, r.Line, r.Col}] = true
+		}
+	}
+	results := make([]ui.SearchPanelResult, len(ps.matches))
+	for i, m := range ps.matches {
+		enabled := !unchecked[matchPos{m.Path, m.Line, m.Col}]
+		results[i] = ui.SearchPanelResult{
+			File:        m.Path,
+			Line:        m.Line,
+			Col:         m.Col,
+			EndCol:      m.EndCol,
+			Text:        m.Text,
+			Replacement: ps.query.Replacement(m, template),
+			Enabled:     enabled,
+		}
+	}
+	ps.panel.SetResults(results)
+}
+
+func (e *Editor) openSearchResult(r ui.SearchPanelResult) {
+	e.searchPanel = nil
+	e.navigateToLocation(filepath.Join(e.findInFiles.root, r.File), r.Line+1)
+	buf := e.activeBuffer()
+	if buf == nil || r.Line >= buf.LineCount() {
+		return
+	}
+	start := buffer.Cursor{Line: r.Line, Col: r.Col}
+	end := buffer.Cursor{Line: r.Line, Col: r.EndCol}
+	sel := buffer.NewSelection(start, end)
+	buf.Selection = &sel
+	buf.Cursor = end
+}
+
+// replaceInFiles replaces the checked matches. Open buffers are edited
+// through their undo stacks and other files are rewritten on disk; the whole
+// replace is one workspace transaction for Undo Workspace Edit.
+func (e *Editor) replaceInFiles(results []ui.SearchPanelResult) {
+	ps := e.findInFiles
+	if ps == nil || ps.query == nil || len(results) != len(ps.matches) {
+		return
+	}
+	p := ps.panel
+
+	var changes []workspaceChange
+	stale := make(map[string]int)
+	lineCache := make(map[string][]string)
+	for i, r := range results {
+		if !r.Enabled {
+			continue
+		}
+		m := ps.matches[i]
+		path := filepath.Join(ps.root, m.Path)
+		// Skip files edited since the search; the match positions are stale
+		lines, ok := lineCache[path]
+		if !ok {
+			lines = e.linesForPath(path)
+			lineCache[path] = lines
+		}
+		if m.Line >= len(lines) || lines[m.Line] != m.Text {
+			stale[m.Path]++
+			continue
+		}
+		changes = append(changes, workspaceChange{Path: path, Edit: lsp.TextEdit{
+			Range: lsp.Range{
+				Start: lsp.Position{Line: m.Line, Character: m.Col},
+				End:   lsp.Position{Line: m.Line, Character: m.EndCol},
+			},
+			NewText: r.Replacement,
+		}})
+	}
+	if len(changes) == 0 && len(stale) == 0 {
+		e.setTemporaryMessage("No matches selected")
+		return
+	}
+
+	label := fmt.Sprintf("Replace '%s' → '%s'", p.Fields[ui.SearchFieldFind], p.Fields[ui.SearchFieldReplace])
+	applied, errs := e.applyWorkspaceChanges(label, changes)
+	skipped := 0
+	for path, n := range stale {
+		skipped += n
+		errs = append(errs, path+" changed since the search")
+	}
+	e.runProjectSearch()
+
+	files := make(map[string]bool)
+	for _, c := range changes {
+		files[c.Path] = true
+	}
+	if len(errs) > 0 {
+		e.setTemporaryError(fmt.Sprintf("Replaced %d of %d matches: %s", applied, len(changes)+skipped, errs[0]))
+		return
+	}
+	e.setTemporaryMessage(fmt.Sprintf("Replaced %d matches in %d files", applied, len(files)))
+}
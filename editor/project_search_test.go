@@ -0,0 +1,131 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"editor/buffer"
+	"editor/ui"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// finishProjectSearch feeds the editor the search results posted to its
+// screen until the current search is done.
+func finishProjectSearch(t *testing.T, e *Editor) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if !e.screen.HasPendingEvent() {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		ev, ok := e.screen.PollEvent().(*ProjectSearchEvent)
+		if !ok {
+			continue
+		}
+		e.handleProjectSearchEvent(ev)
+		if ev.done && ev.gen == e.findInFiles.gen {
+			return
+		}
+	}
+	t.Fatal("project search did not finish")
+}
+
+// newSearchTestScreen gives e a screen for search results to be posted to.
+func newSearchTestScreen(t *testing.T, e *Editor) {
+	t.Helper()
+	s := tcell.NewSimulationScreen("")
+	if err := s.Init(); err != nil {
+		t.Fatalf("screen: %v", err)
+	}
+	t.Cleanup(s.Fini)
+	e.screen = s
+}
+
+func TestReplaceInFilesEditsOpenAndClosedFilesAsOneTransaction(t *testing.T) {
+	e, wd := newWorkspaceTestEditor(t)
+	newSearchTestScreen(t, e)
+
+	openPath := filepath.Join(wd, "open.go")
+	if err := os.WriteFile(openPath, []byte("saved\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	b := buffer.NewBuffer(4)
+	b.Path = openPath
+	b.SetLines([]string{"v := get(a)", "w := get(b)"})
+	e.buffers = []*buffer.Buffer{b}
+	e.tabBar.AddTab(openPath, false)
+	e.activeTab = 0
+
+	closedPath := filepath.Join(wd, "closed.go")
+	if err := os.WriteFile(closedPath, []byte("get(c)\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	e.openProjectSearch()
+	p := e.searchPanel
+	p.Regex = true
+	p.Fields[ui.SearchFieldFind] = `get\((\w)\)`
+	p.Fields[ui.SearchFieldReplace] = "fetch($1)"
+	e.runProjectSearch()
+	finishProjectSearch(t, e)
+
+	if len(p.Results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(p.Results))
+	}
+	// Results are sorted by file: closed.go first, then open.go's two lines
+	if p.Results[1].Replacement != "fetch(a)" {
+		t.Fatalf("capture group not expanded: %q", p.Results[1].Replacement)
+	}
+	p.Results[2].Enabled = false
+
+	e.replaceInFiles(p.Results)
+
+	if b.Line(0) != "v := fetch(a)" || b.Line(1) != "w := get(b)" {
+		t.Fatalf("unexpected open buffer: %q", b.Lines())
+	}
+	data, _ := os.ReadFile(closedPath)
+	if string(data) != "fetch(c)\n" {
+		t.Fatalf("closed file not rewritten: %q", data)
+	}
+	if len(e.workspaceTxns) != 1 {
+		t.Fatalf("expected one workspace transaction, got %d", len(e.workspaceTxns))
+	}
+
+	finishProjectSearch(t, e) // the replace searches again
+
+	e.undoWorkspaceEdit()
+	data, _ = os.ReadFile(closedPath)
+	if b.Line(0) != "v := get(a)" || string(data) != "get(c)\n" {
+		t.Fatalf("undo did not revert the replace: %q / %q", b.Line(0), data)
+	}
+}
+
+func TestProjectSearchDropsResultsOfCancelledQuery(t *testing.T) {
+	e, wd := newWorkspaceTestEditor(t)
+	newSearchTestScreen(t, e)
+	for i, text := range []string{"alpha\n", "beta\n", "alpha beta\n"} {
+		path := filepath.Join(wd, string(rune('a'+i))+".txt")
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	e.openProjectSearch()
+	p := e.searchPanel
+	p.Fields[ui.SearchFieldFind] = "alpha"
+	e.runProjectSearch()
+	p.Fields[ui.SearchFieldFind] = "beta"
+	e.runProjectSearch()
+	finishProjectSearch(t, e)
+
+	if len(p.Results) != 2 || p.Results[0].File != "b.txt" || p.Results[1].File != "c.txt" {
+		t.Fatalf("unexpected results: %+v", p.Results)
+	}
+	if p.Status != "2 results in 2 files" {
+		t.Fatalf("status = %q", p.Status)
+	}
+}
@@ -2,6 +2,7 @@ package editor
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"editor/buffer"
@@ -77,7 +78,6 @@ func (e *Editor) render() {
 
 	// Update themes in components
 	e.statusBar.Theme = theme
-	e.tabBar.Theme = theme
 	if e.fileTree != nil {
 		e.fileTree.Theme = theme
 	}
@@ -90,23 +90,11 @@ func (e *Editor) render() {
 		e.fileTree.Render(e.screen, 0, 0, e.treeWidth, screenH-1)
 	}
 
-	// Tab bar
-	left := e.treeLeft()
-	e.tabBar.Render(e.screen, left, 0, screenW-left, 1)
-
-	// Editor area or image viewer
-	ex, ey, ew, eh := e.editorLayout()
+	// Editor panes, each with its tab bar and the editor, image viewer or
+	// hex editor of its active tab
+	e.renderPanes(theme)
+	ex, ey, ew, _ := e.editorLayout()
 	buf := e.activeBuffer()
-	if buf != nil {
-		if iv, ok := e.imageViews[buf]; ok && iv != nil {
-			iv.SetTheme(theme)
-			iv.Render(e.screen, ex, ey, ew, eh)
-		} else {
-			e.renderEditor(ex, ey, ew, eh)
-		}
-	} else {
-		e.renderEditor(ex, ey, ew, eh)
-	}
 
 	// Terminal
 	if e.termOpen && e.terminal != nil {
@@ -163,63 +151,46 @@ func (e *Editor) render() {
 		e.commandPalette.Render(e.screen, 0, 0, screenW, screenH)
 	}
 
+	// Find in files panel
+	if e.searchPanel != nil {
+		e.searchPanel.Theme = e.cfg.GetTheme()
+		e.searchPanel.Render(e.screen, 0, 0, screenW, screenH)
+	}
+
+	// Workspace edit preview overlay
+	if e.editPreview != nil {
+		e.editPreview.Theme = e.cfg.GetTheme()
+		e.editPreview.Render(e.screen, 0, 0, screenW, screenH)
+	}
+
+	// Undo tree or file history
+	if e.timeline != nil {
+		e.timeline.Theme = e.cfg.GetTheme()
+		e.timeline.Render(e.screen, 0, 0, screenW, screenH)
+	}
+
 	// Autocomplete popup overlay
 	if e.autocomplete != nil && e.autocomplete.Visible {
 		e.autocomplete.Theme = e.cfg.GetTheme()
 		e.autocomplete.Render(e.screen, 0, 0, screenW, screenH)
 	}
 
+	// Hover documentation popup
+	if e.hover != nil {
+		e.hover.Theme = e.cfg.GetTheme()
+		e.hover.Render(e.screen, 0, 0, screenW, screenH-1)
+	}
+
 	// Show cursor in editor when focused (with blinking)
 	_, isImageView := e.imageViews[buf]
-	if e.focusTarget == "editor" && e.dialog == nil && e.quickOpen == nil && e.commandPalette == nil && !isImageView {
+	_, isHexView := e.hexViews[buf]
+	if e.focusTarget == "editor" && e.dialog == nil && e.quickOpen == nil && e.commandPalette == nil && e.editPreview == nil && e.timeline == nil && e.searchPanel == nil && !isImageView && !isHexView {
 		view := e.activeView()
 		cursorShown := false
 		if buf != nil && view != nil && e.cursorVisible {
-			gutterW := e.gutterWidth()
-			if e.cfg.WordWrap {
-				textW := ew - gutterW
-				if textW > 0 {
-					// Calculate visual cursor position with word wrap
-					visualRow := 0
-					for i := view.scrollY; i < buf.Cursor.Line && i < len(buf.Lines); i++ {
-						lineLen := len([]rune(buf.Lines[i]))
-						wrapRows := 1
-						if lineLen > textW {
-							wrapRows = (lineLen + textW - 1) / textW
-						}
-						visualRow += wrapRows
-					}
-					cursorWrapRow := buf.Cursor.Col / textW
-					cursorWrapCol := buf.Cursor.Col % textW
-					visualRow += cursorWrapRow
-
-					cursorScreenX := ex + gutterW + cursorWrapCol
-					cursorScreenY := ey + visualRow
-					if buf.Cursor.Line >= view.scrollY &&
-						cursorScreenX >= ex+gutterW && cursorScreenX < ex+ew &&
-						cursorScreenY >= ey && cursorScreenY < ey+eh {
-						e.screen.ShowCursor(cursorScreenX, cursorScreenY)
-						cursorShown = true
-					}
-				}
-			} else if buf.Cursor.Line >= 0 && buf.Cursor.Line < len(buf.Lines) {
-				// Convert buffer column to display column for tabs
-				cursorDisplayCol := bufferColToDisplayCol(buf.Lines[buf.Cursor.Line], buf.Cursor.Col, buf.TabSize)
-				cursorScreenX := ex + gutterW + cursorDisplayCol - view.scrollX
-				// Count visible lines between scrollY and cursor to get visual row
-				visualRow := 0
-				for i := view.scrollY; i < buf.Cursor.Line && i < len(buf.Lines); i++ {
-					if !buf.IsHiddenByFold(i) {
-						visualRow++
-					}
-				}
-				cursorScreenY := ey + visualRow
-				if buf.Cursor.Line >= view.scrollY &&
-					cursorScreenX >= ex+gutterW && cursorScreenX < ex+ew &&
-					cursorScreenY >= ey && cursorScreenY < ey+eh {
-					e.screen.ShowCursor(cursorScreenX, cursorScreenY)
-					cursorShown = true
-				}
+			if x, y, ok := e.cursorScreenPos(); ok {
+				e.screen.ShowCursor(x, y)
+				cursorShown = true
 			}
 		}
 		if !cursorShown {
@@ -229,7 +200,7 @@ func (e *Editor) render() {
 		e.screen.HideCursor()
 	}
 
-	overlayVisible := e.dialog != nil || e.quickOpen != nil || e.commandPalette != nil || (e.autocomplete != nil && e.autocomplete.Visible)
+	overlayVisible := e.dialog != nil || e.quickOpen != nil || e.commandPalette != nil || e.editPreview != nil || e.timeline != nil || e.searchPanel != nil || (e.autocomplete != nil && e.autocomplete.Visible) || e.hover != nil
 	var protocolIV *ui.ImageView
 	if buf != nil {
 		if iv, ok := e.imageViews[buf]; ok && iv != nil && iv.NeedsProtocolRender() {
@@ -307,6 +278,7 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 	emptyLineStyle := tcell.StyleDefault.Background(theme.Background).Foreground(theme.LineNumber)
 	bracketStyle := tcell.StyleDefault.Background(theme.Background).Foreground(theme.Foreground).Bold(true).Underline(true)
 	indentGuideStyle := tcell.StyleDefault.Background(theme.Background).Foreground(theme.IndentGuide)
+	activeGuideStyle := tcell.StyleDefault.Background(theme.Background).Foreground(theme.IndentGuideActive)
 	extraCursorStyle := tcell.StyleDefault.Background(theme.Foreground).Foreground(theme.Background)
 	_ = matchStyle
 
@@ -335,13 +307,13 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 	// Get highlighted lines
 	startLine := view.scrollY
 	endLine := startLine + h
-	if endLine > len(buf.Lines) {
-		endLine = len(buf.Lines)
+	if endLine > buf.LineCount() {
+		endLine = buf.LineCount()
 	}
 
 	// Build visible lines list (skip lines hidden by folds)
 	visibleLines := make([]int, 0, h)
-	for lineIdx := startLine; lineIdx < len(buf.Lines) && len(visibleLines) < h; lineIdx++ {
+	for lineIdx := startLine; lineIdx < buf.LineCount() && len(visibleLines) < h; lineIdx++ {
 		if buf.IsHiddenByFold(lineIdx) {
 			continue
 		}
@@ -356,13 +328,16 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 		}
 	}
 
-	code := strings.Join(buf.Lines, "\n")
 	var styledLines []highlight.StyledLine
 	if buf.Language != "" {
-		styledLines = e.highlight.HighlightLines(code, buf.Language, startLine, endLine)
+		styledLines = e.highlightWindow(buf, startLine, endLine)
 	}
+	pairs := findBracketPairs(buf, startLine, endLine, theme.BracketColors, theme.BracketUnmatched)
+	scope := findScopeGuide(buf, buf.Cursor.Line)
 
 	foldStyle := tcell.StyleDefault.Background(theme.Background).Foreground(theme.LineNumber)
+	rulers := e.rulers(buf)
+	rulerStyle := tcell.StyleDefault.Background(theme.Background).Foreground(theme.IndentGuide)
 
 	for row := 0; row < h; row++ {
 		screenY := y + row
@@ -372,6 +347,8 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 			for col := x; col < x+w; col++ {
 				if col == x {
 					screen.SetContent(col, screenY, '~', nil, emptyLineStyle)
+				} else if c := col - x - gutterW; c >= 0 && c < textW && slices.Contains(rulers, c+view.scrollX) {
+					screen.SetContent(col, screenY, '│', nil, rulerStyle)
 				} else {
 					screen.SetContent(col, screenY, ' ', nil, lineStyle)
 				}
@@ -442,7 +419,8 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 		e.screen.SetContent(x+gutterW-1, screenY, foldCh, nil, diagGutterStyle)
 
 		// Text content
-		line := buf.Lines[lineIdx]
+		line := buf.Line(lineIdx)
+		wsFrom := whitespaceFrom(e.cfg.RenderWhitespace, line)
 		styledIdx := lineIdx - startLine
 
 		var tokens []highlight.Token
@@ -463,7 +441,7 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 						for i := 0; i < tabWidth; i++ {
 							screenDisplayCol := displayCol - view.scrollX
 							if screenDisplayCol >= 0 && screenDisplayCol < textW {
-								style := tok.Style.Background(theme.Background)
+								style := rulerBackground(tok.Style.Background(theme.Background), rulers, displayCol, theme)
 								if e.isSelected(buf, lineIdx, col) {
 									style = selStyle
 								}
@@ -473,7 +451,12 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 								if (lineIdx == bracketLine1 && col == bracketCol1) || (lineIdx == bracketLine2 && col == bracketCol2) {
 									style = bracketStyle
 								}
-								e.screen.SetContent(screenCol+screenDisplayCol, screenY, ' ', nil, style)
+								glyph := ' '
+								if i == 0 && col >= wsFrom {
+									glyph = whitespaceGlyph('\t')
+									style = style.Foreground(theme.LineNumber)
+								}
+								e.screen.SetContent(screenCol+screenDisplayCol, screenY, glyph, nil, style)
 							}
 							displayCol++
 						}
@@ -481,7 +464,7 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 					} else {
 						screenDisplayCol := displayCol - view.scrollX
 						if screenDisplayCol >= 0 && screenDisplayCol < textW {
-							style := tok.Style.Background(theme.Background)
+							style := rulerBackground(pairs.style(tok.Style.Background(theme.Background), lineIdx, col), rulers, displayCol, theme)
 							if e.isSelected(buf, lineIdx, col) {
 								style = selStyle
 							}
@@ -489,9 +472,14 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 								style = matchStyle
 							}
 							if (lineIdx == bracketLine1 && col == bracketCol1) || (lineIdx == bracketLine2 && col == bracketCol2) {
-								style = bracketStyle
+								style = pairs.style(bracketStyle, lineIdx, col)
+							}
+							glyph := ch
+							if ch == ' ' && col >= wsFrom {
+								glyph = whitespaceGlyph(ch)
+								style = style.Foreground(theme.LineNumber)
 							}
-							e.screen.SetContent(screenCol+screenDisplayCol, screenY, ch, nil, style)
+							e.screen.SetContent(screenCol+screenDisplayCol, screenY, glyph, nil, style)
 						}
 						w := runewidth.RuneWidth(ch)
 						displayCol += w
@@ -507,7 +495,7 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 					for i := 0; i < tabWidth; i++ {
 						screenDisplayCol := displayCol - view.scrollX
 						if screenDisplayCol >= 0 && screenDisplayCol < textW {
-							style := lineStyle
+							style := rulerBackground(lineStyle, rulers, displayCol, theme)
 							if e.isSelected(buf, lineIdx, col) {
 								style = selStyle
 							}
@@ -517,7 +505,12 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 							if (lineIdx == bracketLine1 && col == bracketCol1) || (lineIdx == bracketLine2 && col == bracketCol2) {
 								style = bracketStyle
 							}
-							e.screen.SetContent(screenCol+screenDisplayCol, screenY, ' ', nil, style)
+							glyph := ' '
+							if i == 0 && col >= wsFrom {
+								glyph = whitespaceGlyph('\t')
+								style = style.Foreground(theme.LineNumber)
+							}
+							e.screen.SetContent(screenCol+screenDisplayCol, screenY, glyph, nil, style)
 						}
 						displayCol++
 					}
@@ -525,7 +518,7 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 				} else {
 					screenDisplayCol := displayCol - view.scrollX
 					if screenDisplayCol >= 0 && screenDisplayCol < textW {
-						style := lineStyle
+						style := rulerBackground(pairs.style(lineStyle, lineIdx, col), rulers, displayCol, theme)
 						if e.isSelected(buf, lineIdx, col) {
 							style = selStyle
 						}
@@ -533,9 +526,14 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 							style = matchStyle
 						}
 						if (lineIdx == bracketLine1 && col == bracketCol1) || (lineIdx == bracketLine2 && col == bracketCol2) {
-							style = bracketStyle
+							style = pairs.style(bracketStyle, lineIdx, col)
+						}
+						glyph := ch
+						if ch == ' ' && col >= wsFrom {
+							glyph = whitespaceGlyph(ch)
+							style = style.Foreground(theme.LineNumber)
 						}
-						e.screen.SetContent(screenCol+screenDisplayCol, screenY, ch, nil, style)
+						e.screen.SetContent(screenCol+screenDisplayCol, screenY, glyph, nil, style)
 					}
 					w := runewidth.RuneWidth(ch)
 					displayCol += w
@@ -551,12 +549,19 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 		}
 		lineRuneLen := buffer.RuneLen(line)
 		for c := startClear; c < textW; c++ {
-			style := lineStyle
+			ch, style := ' ', lineStyle
+			if slices.Contains(rulers, c+view.scrollX) {
+				ch, style = '│', rulerStyle
+			}
 			// Past end of line, use rune length for selection check
-			if e.isSelected(buf, lineIdx, lineRuneLen) {
+			if buf.Block != nil {
+				if inBlock(buf, lineIdx, c+view.scrollX) {
+					style = selStyle
+				}
+			} else if e.isSelected(buf, lineIdx, lineRuneLen) {
 				style = selStyle
 			}
-			e.screen.SetContent(screenCol+c, screenY, ' ', nil, style)
+			e.screen.SetContent(screenCol+c, screenY, ch, nil, style)
 		}
 
 		// Fold indicator after line content
@@ -598,7 +603,7 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 			if isEmpty && indentDisplayCol == 0 {
 				// Look at previous non-empty line's indent
 				for prevIdx := lineIdx - 1; prevIdx >= 0; prevIdx-- {
-					prevLine := buf.Lines[prevIdx]
+					prevLine := buf.Line(prevIdx)
 					if len(strings.TrimSpace(prevLine)) > 0 {
 						// Found a non-empty line, use its indent
 						prevRunes := []rune(prevLine)
@@ -616,8 +621,8 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 				}
 			}
 
-			// Draw guides up to the indent level
-			for c := tabSize; c < indentDisplayCol; c += tabSize {
+			// Draw guides up to the indent level, the current scope's brighter
+			for c := 0; c < indentDisplayCol; c += tabSize {
 				screenDisplayCol := c - view.scrollX
 				if screenDisplayCol >= 0 && screenDisplayCol < textW {
 					// Find buffer column at this display position for selection check
@@ -634,13 +639,34 @@ func (e *Editor) renderEditor(x, y, w, h int) {
 						}
 						bufCol++
 					}
-					if !e.isSelected(buf, lineIdx, bufCol) {
-						e.screen.SetContent(screenCol+screenDisplayCol, screenY, '│', nil, indentGuideStyle)
+					// Leave a visible tab's arrow showing
+					tabGlyph := dispCol == c && bufCol >= wsFrom && bufCol < len(lineRunes) && lineRunes[bufCol] == '\t'
+					if !tabGlyph && !e.isSelected(buf, lineIdx, bufCol) {
+						style := indentGuideStyle
+						if scope.has(lineIdx, c) {
+							style = activeGuideStyle
+						}
+						e.screen.SetContent(screenCol+screenDisplayCol, screenY, '│', nil, style)
 					}
 				}
 			}
 		}
 
+		// A zero-width block shows a cursor on each of its lines
+		if buf.Block != nil && lineIdx != buf.Cursor.Line {
+			top, bottom := buf.Block.Lines()
+			left, right := buf.Block.Cols()
+			screenDisplayCol := left - view.scrollX
+			if left == right && lineIdx >= top && lineIdx <= bottom && screenDisplayCol >= 0 && screenDisplayCol < textW {
+				ch := ' '
+				lineRunes := []rune(line)
+				if bc := displayColToBufferCol(line, left, buf.TabSize); bc < len(lineRunes) && bufferColToDisplayCol(line, bc, buf.TabSize) == left {
+					ch = lineRunes[bc]
+				}
+				e.screen.SetContent(screenCol+screenDisplayCol, screenY, ch, nil, extraCursorStyle)
+			}
+		}
+
 		// Render extra cursors on this line
 		for _, ec := range buf.ExtraCursors {
 			if ec.Line == lineIdx {
@@ -703,7 +729,7 @@ func (e *Editor) renderScrollbar(x, y, w, h int, buf *buffer.Buffer, view *Edito
 		return
 	}
 
-	totalLines := len(buf.Lines)
+	totalLines := buf.LineCount()
 	if totalLines <= 0 {
 		totalLines = 1
 	}
@@ -782,22 +808,36 @@ func (e *Editor) renderEditorWrapped(x, y, w, h int, buf *buffer.Buffer, view *E
 	// Get highlighted lines - request more than visible to handle wrap
 	startLine := view.scrollY
 	endLine := startLine + h // might need more, but this is a good estimate
-	if endLine > len(buf.Lines) {
-		endLine = len(buf.Lines)
+	if endLine > buf.LineCount() {
+		endLine = buf.LineCount()
 	}
 
-	code := strings.Join(buf.Lines, "\n")
 	var styledLines []highlight.StyledLine
 	if buf.Language != "" {
-		styledLines = e.highlight.HighlightLines(code, buf.Language, startLine, endLine)
+		styledLines = e.highlightWindow(buf, startLine, endLine)
 	}
 
+	// Folds can bring lines past endLine on screen, but never more than one per row
+	pairsEnd := startLine
+	for shown := 0; pairsEnd < buf.LineCount() && shown < h; pairsEnd++ {
+		if !buf.IsHiddenByFold(pairsEnd) {
+			shown++
+		}
+	}
+	pairs := findBracketPairs(buf, startLine, pairsEnd, theme.BracketColors, theme.BracketUnmatched)
+	scope := findScopeGuide(buf, buf.Cursor.Line)
+	indentGuideStyle := tcell.StyleDefault.Background(theme.Background).Foreground(theme.IndentGuide)
+	activeGuideStyle := tcell.StyleDefault.Background(theme.Background).Foreground(theme.IndentGuideActive)
+	rulers := e.rulers(buf)
+	rulerStyle := tcell.StyleDefault.Background(theme.Background).Foreground(theme.IndentGuide)
+
 	screenRow := 0
-	for lineIdx := startLine; lineIdx < len(buf.Lines) && screenRow < h; lineIdx++ {
+	for lineIdx := startLine; lineIdx < buf.LineCount() && screenRow < h; lineIdx++ {
 		if buf.IsHiddenByFold(lineIdx) {
 			continue
 		}
-		line := buf.Lines[lineIdx]
+		line := buf.Line(lineIdx)
+		wsFrom := whitespaceFrom(e.cfg.RenderWhitespace, line)
 		styledIdx := lineIdx - startLine
 
 		var tokens []highlight.Token
@@ -805,15 +845,8 @@ func (e *Editor) renderEditorWrapped(x, y, w, h int, buf *buffer.Buffer, view *E
 			tokens = styledLines[styledIdx].Tokens
 		}
 
-		// Calculate wrap segments
-		lineLen := len([]rune(line))
-		if lineLen == 0 {
-			lineLen = 1 // at least one visual row for empty lines
-		}
-		wrapRows := (lineLen + textW - 1) / textW
-		if wrapRows == 0 {
-			wrapRows = 1
-		}
+		// Rows are textW display columns wide, tabs expanded
+		wrapRows := wrappedRows(line, textW, buf.TabSize)
 
 		for wrapIdx := 0; wrapIdx < wrapRows && screenRow < h; wrapIdx++ {
 			screenY := y + screenRow
@@ -865,56 +898,104 @@ func (e *Editor) renderEditorWrapped(x, y, w, h int, buf *buffer.Buffer, view *E
 			}
 
 			// Render text segment for this wrap row
-			colStart := wrapIdx * textW
-			colEnd := colStart + textW
+			rowStart := wrapIdx * textW
+			rowEnd := rowStart + textW
 			screenCol := x + gutterW
 
 			col := 0
 			displayCol := 0
+			// draw puts the rune at buffer column col on screen, over the
+			// cells of this row it covers; a tab covers up to the next stop.
+			draw := func(ch rune, base tcell.Style) {
+				width := runewidth.RuneWidth(ch)
+				if ch == '\t' {
+					width = buf.TabSize - displayCol%buf.TabSize
+				}
+				for i := 0; i < width && displayCol+i < rowEnd; i++ {
+					dc := displayCol + i
+					if dc < rowStart {
+						continue
+					}
+					if i > 0 && ch != '\t' {
+						if displayCol < rowStart {
+							// The rest of a wide rune wrapped from the row above
+							e.screen.SetContent(screenCol+dc-rowStart, screenY, ' ', nil, lineStyle)
+						}
+						continue
+					}
+					style := rulerBackground(pairs.style(base, lineIdx, col), rulers, dc-rowStart, theme)
+					if e.isSelected(buf, lineIdx, col) {
+						style = selStyle
+					}
+					if e.isSearchMatch(lineIdx, col) {
+						style = matchStyle
+					}
+					if (lineIdx == bracketLine1 && col == bracketCol1) || (lineIdx == bracketLine2 && col == bracketCol2) {
+						style = pairs.style(bracketStyle, lineIdx, col)
+					}
+					glyph := ch
+					if ch == '\t' {
+						glyph = ' '
+					}
+					if (ch == ' ' || ch == '\t') && col >= wsFrom && i == 0 {
+						glyph = whitespaceGlyph(ch)
+						style = style.Foreground(theme.LineNumber)
+					}
+					e.screen.SetContent(screenCol+dc-rowStart, screenY, glyph, nil, style)
+				}
+				displayCol += width
+				col++
+			}
 
 			if tokens != nil {
 				for _, tok := range tokens {
 					for _, ch := range tok.Text {
-						if col >= colStart && col < colEnd {
-							style := tok.Style.Background(theme.Background)
-							if e.isSelected(buf, lineIdx, col) {
-								style = selStyle
-							}
-							if e.isSearchMatch(lineIdx, col) {
-								style = matchStyle
-							}
-							if (lineIdx == bracketLine1 && col == bracketCol1) || (lineIdx == bracketLine2 && col == bracketCol2) {
-								style = bracketStyle
-							}
-							e.screen.SetContent(screenCol+displayCol, screenY, ch, nil, style)
-							displayCol += runewidth.RuneWidth(ch)
+						if displayCol >= rowEnd {
+							break
 						}
-						col++
+						draw(ch, tok.Style.Background(theme.Background))
 					}
 				}
 			} else {
 				for _, ch := range line {
-					if col >= colStart && col < colEnd {
-						style := lineStyle
-						if e.isSelected(buf, lineIdx, col) {
-							style = selStyle
-						}
-						if e.isSearchMatch(lineIdx, col) {
-							style = matchStyle
-						}
-						if (lineIdx == bracketLine1 && col == bracketCol1) || (lineIdx == bracketLine2 && col == bracketCol2) {
-							style = bracketStyle
-						}
-						e.screen.SetContent(screenCol+displayCol, screenY, ch, nil, style)
-						displayCol += runewidth.RuneWidth(ch)
+					if displayCol >= rowEnd {
+						break
 					}
-					col++
+					draw(ch, lineStyle)
 				}
 			}
 
 			// Clear rest of row
-			for c := displayCol; c < textW; c++ {
-				e.screen.SetContent(screenCol+c, screenY, ' ', nil, lineStyle)
+			for c := max(displayCol-rowStart, 0); c < textW; c++ {
+				if slices.Contains(rulers, c) {
+					e.screen.SetContent(screenCol+c, screenY, '│', nil, rulerStyle)
+				} else {
+					e.screen.SetContent(screenCol+c, screenY, ' ', nil, lineStyle)
+				}
+			}
+
+			// Indent guides over the leading spaces of the first row; tab
+			// indents get none.
+			if wrapIdx == 0 && buf.TabSize > 0 {
+				lead := wrappedIndent(line)
+				if line == "" {
+					for prevIdx := lineIdx - 1; prevIdx >= 0; prevIdx-- {
+						if prevLine := buf.Line(prevIdx); strings.TrimSpace(prevLine) != "" {
+							lead = wrappedIndent(prevLine)
+							break
+						}
+					}
+				}
+				for c := 0; c < lead && c < textW; c += buf.TabSize {
+					if e.isSelected(buf, lineIdx, c) {
+						continue
+					}
+					style := indentGuideStyle
+					if scope.has(lineIdx, c) {
+						style = activeGuideStyle
+					}
+					e.screen.SetContent(screenCol+c, screenY, '│', nil, style)
+				}
 			}
 
 			screenRow++
@@ -927,6 +1008,8 @@ func (e *Editor) renderEditorWrapped(x, y, w, h int, buf *buffer.Buffer, view *E
 		for col := x; col < x+w; col++ {
 			if col == x {
 				e.screen.SetContent(col, screenY, '~', nil, emptyLineStyle)
+			} else if c := col - x - gutterW; c >= 0 && c < textW && slices.Contains(rulers, c) {
+				e.screen.SetContent(col, screenY, '│', nil, rulerStyle)
 			} else {
 				e.screen.SetContent(col, screenY, ' ', nil, lineStyle)
 			}
@@ -935,11 +1018,67 @@ func (e *Editor) renderEditorWrapped(x, y, w, h int, buf *buffer.Buffer, view *E
 	}
 }
 
+// wrappedIndent is the number of spaces line starts with, which is where its
+// text begins on screen when wrapping.
+func wrappedIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// whitespaceFrom is the rune column from which line's spaces and tabs are
+// drawn as visible glyphs under the render_whitespace setting: 0 for "all",
+// the end of the text for "trailing" and the line's length, so none, otherwise.
+func whitespaceFrom(mode, line string) int {
+	switch mode {
+	case "all":
+		return 0
+	case "trailing":
+		return buffer.RuneLen(strings.TrimRight(line, " \t"))
+	}
+	return buffer.RuneLen(line)
+}
+
+// whitespaceGlyph is the glyph a visible space or tab is drawn with.
+func whitespaceGlyph(ch rune) rune {
+	if ch == '\t' {
+		return '→'
+	}
+	return '·'
+}
+
+// rulers returns the columns vertical rulers are drawn at in buf: the rulers
+// setting and the file's .editorconfig max_line_length.
+func (e *Editor) rulers(buf *buffer.Buffer) []int {
+	rulers := e.cfg.Rulers
+	if buf.MaxLineLength > 0 && !slices.Contains(rulers, buf.MaxLineLength) {
+		rulers = append(slices.Clone(rulers), buf.MaxLineLength)
+	}
+	return rulers
+}
+
+// rulerBackground gives style the ruler colour as its background when there
+// is a ruler at display column col, so rulers show under text crossing them.
+func rulerBackground(style tcell.Style, rulers []int, col int, theme *config.ColorScheme) tcell.Style {
+	if slices.Contains(rulers, col) {
+		return style.Background(theme.IndentGuide)
+	}
+	return style
+}
+
+// wrappedRows is the number of screen rows line takes up when wrapped at
+// textW display columns, with tabs expanded to tabSize.
+func wrappedRows(line string, textW, tabSize int) int {
+	width := bufferColToDisplayCol(line, buffer.RuneLen(line), tabSize)
+	if textW <= 0 || width <= textW {
+		return 1
+	}
+	return (width + textW - 1) / textW
+}
+
 // ensureCursorVisibleWrap handles cursor visibility when word wrap is enabled.
 func (e *Editor) ensureCursorVisibleWrap(view *EditorView, buf *buffer.Buffer, textW, textH int) {
 	// Validate cursor is in bounds
-	if buf.Cursor.Line >= len(buf.Lines) {
-		buf.Cursor.Line = len(buf.Lines) - 1
+	if buf.Cursor.Line >= buf.LineCount() {
+		buf.Cursor.Line = buf.LineCount() - 1
 	}
 	if buf.Cursor.Line < 0 {
 		buf.Cursor.Line = 0
@@ -955,15 +1094,15 @@ func (e *Editor) ensureCursorVisibleWrap(view *EditorView, buf *buffer.Buffer, t
 
 	// Count visual rows from scrollY to cursor line
 	visualRows := 0
-	for i := view.scrollY; i <= buf.Cursor.Line && i < len(buf.Lines); i++ {
-		lineLen := len([]rune(buf.Lines[i]))
-		wrapRows := 1
-		if textW > 0 && lineLen > textW {
-			wrapRows = (lineLen + textW - 1) / textW
+	for i := view.scrollY; i <= buf.Cursor.Line && i < buf.LineCount(); i++ {
+		if buf.IsHiddenByFold(i) {
+			continue
 		}
+		line := buf.Line(i)
+		wrapRows := wrappedRows(line, textW, buf.TabSize)
 		if i == buf.Cursor.Line {
 			// Add the wrap row the cursor is on
-			cursorWrapRow := buf.Cursor.Col / textW
+			cursorWrapRow := bufferColToDisplayCol(line, buf.Cursor.Col, buf.TabSize) / textW
 			if cursorWrapRow >= wrapRows {
 				cursorWrapRow = wrapRows - 1
 			}
@@ -976,13 +1115,10 @@ func (e *Editor) ensureCursorVisibleWrap(view *EditorView, buf *buffer.Buffer, t
 	// If cursor is below visible area, scroll down
 	for visualRows > textH {
 		// Move scrollY forward by one line
-		if view.scrollY < len(buf.Lines) {
-			lineLen := len([]rune(buf.Lines[view.scrollY]))
-			wrapRows := 1
-			if textW > 0 && lineLen > textW {
-				wrapRows = (lineLen + textW - 1) / textW
+		if view.scrollY < buf.LineCount() {
+			if !buf.IsHiddenByFold(view.scrollY) {
+				visualRows -= wrappedRows(buf.Line(view.scrollY), textW, buf.TabSize)
 			}
-			visualRows -= wrapRows
 			view.scrollY++
 		} else {
 			break
@@ -997,7 +1133,7 @@ func (e *Editor) gutterWidth() int {
 	}
 
 	digits := 1
-	for lines := len(buf.Lines); lines >= 10; lines /= 10 {
+	for lines := buf.LineCount(); lines >= 10; lines /= 10 {
 		digits++
 	}
 	w := digits + 1 // digits + indicator column
@@ -1007,12 +1143,54 @@ func (e *Editor) gutterWidth() int {
 	return w
 }
 
+// cursorScreenPos returns the screen cell of the primary cursor, used to
+// anchor popups. ok is false when the cursor is scrolled out of view.
+func (e *Editor) cursorScreenPos() (x, y int, ok bool) {
+	buf := e.activeBuffer()
+	view := e.activeView()
+	if buf == nil || view == nil || buf.Cursor.Line < view.scrollY || buf.Cursor.Line >= buf.LineCount() {
+		return 0, 0, false
+	}
+	ex, ey, ew, eh := e.editorLayout()
+	gutterW := e.gutterWidth()
+
+	if e.cfg.WordWrap {
+		textW := ew - gutterW
+		if textW <= 0 {
+			return 0, 0, false
+		}
+		visualRow := 0
+		for i := view.scrollY; i < buf.Cursor.Line; i++ {
+			if !buf.IsHiddenByFold(i) {
+				visualRow += wrappedRows(buf.Line(i), textW, buf.TabSize)
+			}
+		}
+		displayCol := bufferColToDisplayCol(buf.Line(buf.Cursor.Line), buf.Cursor.Col, buf.TabSize)
+		x = ex + gutterW + displayCol%textW
+		y = ey + visualRow + displayCol/textW
+	} else {
+		visualRow := 0
+		for i := view.scrollY; i < buf.Cursor.Line; i++ {
+			if !buf.IsHiddenByFold(i) {
+				visualRow++
+			}
+		}
+		x = ex + gutterW + bufferColToDisplayCol(buf.Line(buf.Cursor.Line), buf.Cursor.Col, buf.TabSize) - view.scrollX
+		y = ey + visualRow
+	}
+
+	if x < ex+gutterW || x >= ex+ew || y < ey || y >= ey+eh {
+		return x, y, false
+	}
+	return x, y, true
+}
+
 func (e *Editor) ensureCursorVisible(view *EditorView, buf *buffer.Buffer, textW, textH int) {
 	const scrollMargin = 5 // keep cursor this many lines from edge
 
 	// Validate cursor is in bounds
-	if buf.Cursor.Line >= len(buf.Lines) {
-		buf.Cursor.Line = len(buf.Lines) - 1
+	if buf.Cursor.Line >= buf.LineCount() {
+		buf.Cursor.Line = buf.LineCount() - 1
 	}
 	if buf.Cursor.Line < 0 {
 		buf.Cursor.Line = 0
@@ -1027,7 +1205,7 @@ func (e *Editor) ensureCursorVisible(view *EditorView, buf *buffer.Buffer, textW
 
 	// Scroll up if cursor is too close to the top
 	visibleAbove := 0
-	for i := view.scrollY; i < buf.Cursor.Line && i < len(buf.Lines); i++ {
+	for i := view.scrollY; i < buf.Cursor.Line && i < buf.LineCount(); i++ {
 		if !buf.IsHiddenByFold(i) {
 			visibleAbove++
 		}
@@ -1047,14 +1225,14 @@ func (e *Editor) ensureCursorVisible(view *EditorView, buf *buffer.Buffer, textW
 
 	// Scroll down if cursor is too close to the bottom
 	visibleCount := 0
-	for i := view.scrollY; i <= buf.Cursor.Line && i < len(buf.Lines); i++ {
+	for i := view.scrollY; i <= buf.Cursor.Line && i < buf.LineCount(); i++ {
 		if !buf.IsHiddenByFold(i) {
 			visibleCount++
 		}
 	}
 	for visibleCount > textH-margin {
 		view.scrollY++
-		for view.scrollY < len(buf.Lines) && buf.IsHiddenByFold(view.scrollY) {
+		for view.scrollY < buf.LineCount() && buf.IsHiddenByFold(view.scrollY) {
 			view.scrollY++
 		}
 		visibleCount--
@@ -1066,7 +1244,7 @@ func (e *Editor) ensureCursorVisible(view *EditorView, buf *buffer.Buffer, textW
 	}
 
 	// Horizontal — scrollX is in display columns
-	cursorDisplayCol := bufferColToDisplayCol(buf.Lines[buf.Cursor.Line], buf.Cursor.Col, buf.TabSize)
+	cursorDisplayCol := bufferColToDisplayCol(buf.Line(buf.Cursor.Line), buf.Cursor.Col, buf.TabSize)
 	if cursorDisplayCol < view.scrollX {
 		view.scrollX = cursorDisplayCol
 	}
@@ -1083,12 +1261,22 @@ func (e *Editor) ensureCursorVisible(view *EditorView, buf *buffer.Buffer, textW
 }
 
 func (e *Editor) isSelected(buf *buffer.Buffer, line, col int) bool {
-	if buf.Selection == nil {
-		return false
+	if buf.Block != nil {
+		return inBlock(buf, line, bufferColToDisplayCol(buf.Line(line), col, buf.TabSize))
 	}
-	sel := *buf.Selection
 	pos := buffer.Cursor{Line: line, Col: col}
-	return sel.Contains(pos) && !pos.Equal(sel.End)
+	inSel := func(sel *buffer.Selection) bool {
+		return sel != nil && sel.Contains(pos) && !pos.Equal(sel.End)
+	}
+	if inSel(buf.Selection) {
+		return true
+	}
+	for _, ec := range buf.ExtraCursors {
+		if inSel(ec.Selection) {
+			return true
+		}
+	}
+	return false
 }
 
 // findMatchingBracket finds the matching bracket for the character at or just
@@ -1098,10 +1286,10 @@ func (e *Editor) findMatchingBracket(buf *buffer.Buffer, line, col int) (int, in
 	closers := map[rune]rune{')': '(', ']': '[', '}': '{'}
 
 	getRune := func(l, c int) rune {
-		if l < 0 || l >= len(buf.Lines) {
+		if l < 0 || l >= buf.LineCount() {
 			return 0
 		}
-		runes := []rune(buf.Lines[l])
+		runes := []rune(buf.Line(l))
 		if c < 0 || c >= len(runes) {
 			return 0
 		}
@@ -1119,8 +1307,8 @@ func (e *Editor) findMatchingBracket(buf *buffer.Buffer, line, col int) (int, in
 			// Scan forward for matching closer
 			depth := 1
 			l, c := line, pos+1
-			for l < len(buf.Lines) {
-				runes := []rune(buf.Lines[l])
+			for l < buf.LineCount() {
+				runes := []rune(buf.Line(l))
 				for c < len(runes) {
 					if runes[c] == ch {
 						depth++
@@ -1142,7 +1330,7 @@ func (e *Editor) findMatchingBracket(buf *buffer.Buffer, line, col int) (int, in
 			depth := 1
 			l, c := line, pos-1
 			for l >= 0 {
-				runes := []rune(buf.Lines[l])
+				runes := []rune(buf.Line(l))
 				if c < 0 {
 					c = len(runes) - 1
 				}
@@ -1159,7 +1347,7 @@ func (e *Editor) findMatchingBracket(buf *buffer.Buffer, line, col int) (int, in
 				}
 				l--
 				if l >= 0 {
-					c = len([]rune(buf.Lines[l])) - 1
+					c = len([]rune(buf.Line(l))) - 1
 				}
 			}
 			return -1, -1
@@ -1173,10 +1361,10 @@ func (e *Editor) findMatchingBracket(buf *buffer.Buffer, line, col int) (int, in
 func (e *Editor) bracketAtCursor(buf *buffer.Buffer, line, col int) (int, int) {
 	brackets := map[rune]bool{'(': true, ')': true, '[': true, ']': true, '{': true, '}': true}
 	getRune := func(l, c int) rune {
-		if l < 0 || l >= len(buf.Lines) {
+		if l < 0 || l >= buf.LineCount() {
 			return 0
 		}
-		runes := []rune(buf.Lines[l])
+		runes := []rune(buf.Line(l))
 		if c < 0 || c >= len(runes) {
 			return 0
 		}
@@ -1204,3 +1392,15 @@ func (e *Editor) isSearchMatch(line, col int) bool {
 	}
 	return false
 }
+
+// highlightWindow highlights lines [start, end) of buf, handing the
+// highlighter only the visible lines and the context it tokenizes before
+// them, so rendering never joins the whole buffer.
+func (e *Editor) highlightWindow(buf *buffer.Buffer, start, end int) []highlight.StyledLine {
+	from := start - highlight.ContextLines
+	if from < 0 {
+		from = 0
+	}
+	code := strings.Join(buf.LinesRange(from, end), "\n")
+	return e.highlight.HighlightLines(code, buf.Language, start-from, end-from)
+}
@@ -0,0 +1,134 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"editor/buffer"
+	"editor/config"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestWhitespaceFrom(t *testing.T) {
+	tests := []struct {
+		mode, line string
+		want       int
+	}{
+		{"all", "\tx = 1  ", 0},
+		{"trailing", "\tx = 1  ", 6},
+		{"trailing", " \t ", 0},
+		{"trailing", "x", 1},
+		{"none", "\tx = 1  ", 8},
+		{"", "x ", 2},
+	}
+	for _, tt := range tests {
+		if got := whitespaceFrom(tt.mode, tt.line); got != tt.want {
+			t.Fatalf("whitespaceFrom(%q, %q) = %d, want %d", tt.mode, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestRulersHonourEditorConfig(t *testing.T) {
+	dir := t.TempDir()
+	ec := "root = true\n\n[*.go]\nmax_line_length = 100\n\n[*.md]\nmax_line_length = off\n"
+	if err := os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte(ec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := New(config.Default())
+	e.cfg.Rulers = []int{80, 100}
+
+	goBuf := buffer.NewBuffer(4)
+	goBuf.Path = filepath.Join(dir, "main.go")
+	e.applyFileSettings(goBuf)
+	if goBuf.MaxLineLength != 100 {
+		t.Fatalf("MaxLineLength = %d, want 100", goBuf.MaxLineLength)
+	}
+	if got := e.rulers(goBuf); !slices.Equal(got, []int{80, 100}) {
+		t.Fatalf("rulers = %v, want [80 100]", got)
+	}
+
+	e.cfg.Rulers = []int{80}
+	if got := e.rulers(goBuf); !slices.Equal(got, []int{80, 100}) {
+		t.Fatalf("rulers = %v, want [80 100]", got)
+	}
+	if !slices.Equal(e.cfg.Rulers, []int{80}) {
+		t.Fatalf("rulers setting changed to %v", e.cfg.Rulers)
+	}
+
+	mdBuf := buffer.NewBuffer(4)
+	mdBuf.Path = filepath.Join(dir, "README.md")
+	e.applyFileSettings(mdBuf)
+	if got := e.rulers(mdBuf); !slices.Equal(got, []int{80}) {
+		t.Fatalf("rulers with max_line_length = off: %v, want [80]", got)
+	}
+}
+
+// renderWrapTest renders lines, wrapped or not, with a ruler at column 6 and
+// returns the screen and the column text starts at.
+func renderWrapTest(t *testing.T, wrap bool, lines ...string) (tcell.SimulationScreen, int) {
+	t.Helper()
+	e, _ := newWorkspaceTestEditor(t)
+	newSearchTestScreen(t, e)
+	e.cfg.WordWrap = wrap
+	e.cfg.RenderWhitespace = "all"
+	e.cfg.Rulers = []int{6}
+	b := buffer.NewBuffer(4)
+	b.SetLines(lines)
+	e.buffers = []*buffer.Buffer{b}
+	e.views[b] = &EditorView{}
+	e.tabBar.AddTab("", false)
+	e.activeTab = 0
+	e.renderEditor(0, 0, 20, 6)
+	return e.screen.(tcell.SimulationScreen), e.gutterWidth()
+}
+
+func TestRulersShowUnderText(t *testing.T) {
+	theme := config.Default().GetTheme()
+	for _, wrap := range []bool{false, true} {
+		s, x := renderWrapTest(t, wrap, "abcdefgh", "ab")
+		if ch, _, style, _ := s.GetContent(x+6, 0); ch != 'g' {
+			t.Fatalf("wrap %v: cell under the ruler = %q, want the text", wrap, ch)
+		} else if _, bg, _ := style.Decompose(); bg != theme.IndentGuide {
+			t.Fatalf("wrap %v: text under the ruler has background %v", wrap, bg)
+		}
+		if ch, _, _, _ := s.GetContent(x+6, 1); ch != '│' {
+			t.Fatalf("wrap %v: ruler past the end of a line = %q", wrap, ch)
+		}
+	}
+}
+
+func TestWrappedTabsTakeTheirWidth(t *testing.T) {
+	s, x := renderWrapTest(t, true, "a\tb")
+	var got []rune
+	for c := 0; c < 6; c++ {
+		ch, _, _, _ := s.GetContent(x+c, 0)
+		got = append(got, ch)
+	}
+	if string(got) != "a→  b " {
+		t.Fatalf("wrapped row = %q, want %q", string(got), "a→  b ")
+	}
+}
+
+func TestWrappedCursorScreenPosExpandsTabsAndSkipsFolds(t *testing.T) {
+	e, _ := newWorkspaceTestEditor(t)
+	newSearchTestScreen(t, e)
+	e.cfg.WordWrap = true
+	b := buffer.NewBuffer(4)
+	b.SetLines([]string{"func f() {", "\t" + strings.Repeat("x", 300), "}", "\ty"})
+	b.FoldRegion(0, 1)
+	b.Cursor = buffer.Cursor{Line: 3, Col: 1}
+	e.buffers = []*buffer.Buffer{b}
+	e.views[b] = &EditorView{}
+	e.tabBar.AddTab("", false)
+	e.activeTab = 0
+
+	ex, ey, _, _ := e.editorLayout()
+	x, y, ok := e.cursorScreenPos()
+	if !ok || x != ex+e.gutterWidth()+4 || y != ey+2 {
+		t.Fatalf("cursor at %d,%d (%v), want %d,%d", x, y, ok, ex+e.gutterWidth()+4, ey+2)
+	}
+}
@@ -6,14 +6,59 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"editor/buffer"
 )
 
 type SessionData struct {
-	WorkingDir string      `json:"working_dir"`
+	WorkingDir string      `json:"working_dir,omitempty"`
 	ActiveTab  int         `json:"active_tab"`
 	Files      []FileState `json:"files"`
+
+	// Named sessions and workspaces also keep the explorer's root folders,
+	// the main one first, and the layout around the tabs.
+	Folders  []string       `json:"folders,omitempty"`
+	Layout   *LayoutState   `json:"layout,omitempty"`
+	Terminal *TerminalState `json:"terminal,omitempty"`
+
+	// Split is the panes' layout when there are several. Files then
+	// lists each pane's tabs in turn, in the order of its leaves.
+	Split *SplitState `json:"split,omitempty"`
+
+	// Expanded lists the explorer's open folders; WordWrap is nil in
+	// sessions saved before it was kept.
+	Expanded []string `json:"expanded,omitempty"`
+	WordWrap *bool    `json:"word_wrap,omitempty"`
+}
+
+// LayoutState is how the window is split between the explorer and the
+// editor, and which of them, or the terminal, has focus.
+type LayoutState struct {
+	TreeOpen  bool   `json:"tree_open"`
+	TreeWidth int    `json:"tree_width"`
+	Focus     string `json:"focus"`
+}
+
+// TerminalState is whether the terminal is open and how much of the
+// height it takes.
+type TerminalState struct {
+	Open  bool    `json:"open"`
+	Ratio float64 `json:"ratio"`
+}
+
+// SplitState is a split of the editor area into two parts, or a pane
+// with the number of Files that are its tabs.
+type SplitState struct {
+	Vertical bool        `json:"vertical,omitempty"`
+	Ratio    float64     `json:"ratio,omitempty"`
+	First    *SplitState `json:"first,omitempty"`
+	Second   *SplitState `json:"second,omitempty"`
+
+	Tabs      int  `json:"tabs,omitempty"`
+	ActiveTab int  `json:"active_tab,omitempty"`
+	Focused   bool `json:"focused,omitempty"`
 }
 
 type FileState struct {
@@ -22,6 +67,53 @@ type FileState struct {
 	Col     int    `json:"cursor_col"`
 	ScrollY int    `json:"scroll_y"`
 	ScrollX int    `json:"scroll_x"`
+
+	Folds     map[int]int       `json:"folds,omitempty"` // fold start line -> end line (exclusive)
+	Selection *buffer.Selection `json:"selection,omitempty"`
+	Cursors   []CursorState     `json:"cursors,omitempty"` // extra cursors
+	Preview   bool              `json:"preview,omitempty"`
+
+	// Unsaved holds the changes of a dirty buffer kept by hot exit.
+	// Untitled buffers have no Path and are only kept this way.
+	Unsaved *UnsavedState `json:"unsaved,omitempty"`
+}
+
+// CursorState is an extra cursor and its selection.
+type CursorState struct {
+	buffer.Cursor
+	Selection *buffer.Selection `json:"selection,omitempty"`
+}
+
+// UnsavedState is a dirty buffer's text and undo history, kept in the
+// session on hot exit. ModTime and Size describe the file as it was then,
+// so a file changed before the next start can be flagged.
+type UnsavedState struct {
+	Text     string             `json:"text"`
+	Undo     buffer.UndoHistory `json:"undo"`
+	Untitled string             `json:"untitled,omitempty"`
+	ModTime  time.Time          `json:"mod_time,omitzero"`
+	Size     int64              `json:"size,omitempty"`
+}
+
+// hotExitKeeps reports whether hot exit can keep buf's unsaved changes in
+// the session: hex, image and large-file tabs aren't kept.
+func (e *Editor) hotExitKeeps(buf *buffer.Buffer) bool {
+	return buf.Large() == nil && !buf.IsBinary && e.hexViews[buf] == nil && e.imageViews[buf] == nil
+}
+
+// unsavedState captures buf's unsaved changes for the session.
+func (e *Editor) unsavedState(buf *buffer.Buffer) *UnsavedState {
+	st := &UnsavedState{Text: buf.Text(), Untitled: buf.UntitledID}
+	if h, err := trimmedUndoHistory(buf); err == nil {
+		st.Undo = h
+	}
+	if buf.Path != "" {
+		if info, err := os.Stat(buf.Path); err == nil {
+			st.ModTime = info.ModTime()
+			st.Size = info.Size()
+		}
+	}
+	return st
 }
 
 func sessionDir() string {
@@ -37,53 +129,164 @@ func sessionPath(workDir string) string {
 	return filepath.Join(sessionDir(), fmt.Sprintf("%x.json", hash[:8]))
 }
 
-func (e *Editor) SaveSession() {
+// SaveSession writes the working directory's session. Hot exit relies on
+// it to keep unsaved changes, so failing to write it is an error.
+func (e *Editor) SaveSession() error {
 	wd, err := os.Getwd()
 	if err != nil {
-		return
+		return err
 	}
 	path := sessionPath(wd)
 
-	session := SessionData{
-		WorkingDir: wd,
-		ActiveTab:  e.activeTab,
-	}
-
-	for _, buf := range e.buffers {
-		if buf.Path == "" {
-			continue
-		}
-		view := e.views[buf]
-		fs := FileState{
-			Path: buf.Path,
-			Line: buf.Cursor.Line,
-			Col:  buf.Cursor.Col,
-		}
-		if view != nil {
-			fs.ScrollY = view.scrollY
-			fs.ScrollX = view.scrollX
-		}
-		session.Files = append(session.Files, fs)
-	}
+	// The directory's own session keeps the tabs and their panes, open
+	// folders and word wrap; root folders and layout belong to named
+	// sessions and workspaces
+	session := e.captureSession()
+	session.WorkingDir = wd
+	session.Folders, session.Layout, session.Terminal = nil, nil, nil
 
 	if len(session.Files) == 0 {
 		// No open file-backed tabs: clear any stale session so closed tabs don't return.
 		_ = os.Remove(path)
-		return
+		return nil
 	}
 
 	dir := sessionDir()
-	os.MkdirAll(dir, 0755)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
 
 	data, err := json.MarshalIndent(session, "", "  ")
 	if err != nil {
-		return
+		return err
 	}
 
-	os.WriteFile(path, data, 0644)
+	// Unsaved text kept by hot exit may be private
+	return os.WriteFile(path, data, 0600)
+}
+
+// captureSplit records the panes under s, appending their tabs to
+// session.Files. Unsaved changes are kept with a buffer's first tab.
+func (e *Editor) captureSplit(s *split, session *SessionData, seen map[*buffer.Buffer]bool) *SplitState {
+	if s.pane == nil {
+		return &SplitState{
+			Vertical: s.vertical,
+			Ratio:    s.ratio,
+			First:    e.captureSplit(s.first, session, seen),
+			Second:   e.captureSplit(s.second, session, seen),
+		}
+	}
+	p := s.pane
+	views, active, preview := p.views, p.activeTab, p.previewTab
+	if p == e.pane {
+		views, active, preview = e.views, e.activeTab, e.previewTab
+	}
+	st := &SplitState{Focused: p == e.pane}
+	for i, buf := range e.paneBuffers(p) {
+		fs, ok := e.tabState(buf, views[buf], i == active, i == preview, seen)
+		if !ok {
+			continue
+		}
+		if i == active {
+			st.ActiveTab = st.Tabs
+			if p == e.pane {
+				session.ActiveTab = st.Tabs
+			}
+		}
+		session.Files = append(session.Files, fs)
+		st.Tabs++
+	}
+	return st
+}
+
+// tabState records a tab showing buf in view, or reports false for an
+// untitled buffer hot exit doesn't keep. A view whose pane isn't focused
+// has the tab's cursors. Only an active tab has extra cursors, as
+// switching tabs clears them. Once a buffer is in seen, its unsaved
+// changes aren't recorded again, nor is it if untitled.
+func (e *Editor) tabState(buf *buffer.Buffer, view *EditorView, active, preview bool, seen map[*buffer.Buffer]bool) (FileState, bool) {
+	hot := e.cfg.HotExit && buf.Dirty && e.hotExitKeeps(buf)
+	if buf.Path == "" && (!hot || seen[buf]) {
+		return FileState{}, false
+	}
+	cursor, selection, extra := buf.Cursor, buf.Selection, buf.ExtraCursors
+	if view != nil && view.cursors != nil {
+		cursor, selection, extra = view.cursors.cursor, view.cursors.selection, view.cursors.extra
+	}
+	fs := FileState{
+		Path:      buf.Path,
+		Line:      cursor.Line,
+		Col:       cursor.Col,
+		Selection: selection,
+		Preview:   preview,
+	}
+	for _, ec := range extra {
+		if active {
+			fs.Cursors = append(fs.Cursors, CursorState{Cursor: ec.Cursor, Selection: ec.Selection})
+		}
+	}
+	if hot && !seen[buf] {
+		fs.Unsaved = e.unsavedState(buf)
+	}
+	if seen != nil {
+		seen[buf] = true
+	}
+	if view != nil {
+		fs.ScrollY = view.scrollY
+		fs.ScrollX = view.scrollX
+	}
+	if len(buf.FoldedLines) > 0 {
+		fs.Folds = make(map[int]int, len(buf.FoldedLines))
+		for start, end := range buf.FoldedLines {
+			fs.Folds[start] = end
+		}
+	}
+	return fs, true
+}
+
+// captureSession records the open tabs, the explorer's folders and the
+// layout.
+func (e *Editor) captureSession() SessionData {
+	wrap := e.cfg.WordWrap
+	session := SessionData{
+		ActiveTab: e.activeTab,
+		WordWrap:  &wrap,
+		Layout: &LayoutState{
+			TreeOpen:  e.treeOpen,
+			TreeWidth: e.treeWidth,
+			Focus:     e.focusTarget,
+		},
+		Terminal: &TerminalState{Open: e.termOpen, Ratio: e.termRatio},
+	}
+	if e.fileTree != nil {
+		session.Folders = e.fileTree.Roots()
+		session.Expanded = e.fileTree.ExpandedPaths()
+	}
+
+	// One pane keeps the old format; several list their tabs pane by pane
+	if e.layout.pane != nil {
+		for i, buf := range e.buffers {
+			if fs, ok := e.tabState(buf, e.views[buf], i == e.activeTab, i == e.previewTab, nil); ok {
+				session.Files = append(session.Files, fs)
+			}
+		}
+		return session
+	}
+	session.Split = e.captureSplit(e.layout, &session, make(map[*buffer.Buffer]bool))
+	return session
 }
 
 func (e *Editor) RestoreSession() bool {
+	return e.restoreSession(false)
+}
+
+// RestoreUnsaved reopens only the buffers hot exit kept unsaved changes
+// for, so they aren't lost when the editor is started on other files.
+func (e *Editor) RestoreUnsaved() bool {
+	return e.restoreSession(true)
+}
+
+func (e *Editor) restoreSession(onlyUnsaved bool) bool {
 	wd, err := os.Getwd()
 	if err != nil {
 		return false
@@ -103,22 +306,149 @@ func (e *Editor) RestoreSession() bool {
 	if session.WorkingDir != wd {
 		return false
 	}
+	return e.openSessionFiles(&session, onlyUnsaved)
+}
+
+// openSessionFiles reopens the tabs of session, with their cursors,
+// selections, scrolling, folds and unsaved changes, and reports whether
+// any were. Unless onlyUnsaved, it also puts back the explorer's open
+// folders and word wrap.
+func (e *Editor) openSessionFiles(session *SessionData, onlyUnsaved bool) bool {
+	if !onlyUnsaved {
+		// A workspace's own word_wrap setting wins
+		if session.WordWrap != nil && !e.cfg.Overridden("word_wrap") {
+			e.cfg.WordWrap = *session.WordWrap
+		}
+		if e.fileTree != nil && len(session.Expanded) > 0 {
+			e.fileTree.SetExpandedPaths(session.Expanded)
+		}
+	}
+
+	if !onlyUnsaved && session.Split != nil && e.layout.pane != nil && session.Split.tabs() == len(session.Files) {
+		return e.openSessionSplit(session)
+	}
+	return e.openSessionTabs(session.Files, session.ActiveTab, onlyUnsaved)
+}
+
+// openSessionSplit splits the editor area as it was in session and
+// reopens each pane's tabs. A pane none of whose tabs could be reopened
+// is closed again.
+func (e *Editor) openSessionSplit(session *SessionData) bool {
+	var leaves []*SplitState
+	var panes []*pane
+	e.restoreSplit(session.Split, e.layout, &leaves, &panes)
 
 	restored := false
-	for _, fs := range session.Files {
-		if _, err := os.Stat(fs.Path); err != nil {
+	focus := e.pane
+	files := session.Files
+	for i, p := range panes {
+		e.usePane(p)
+		if e.openSessionTabs(files[:leaves[i].Tabs], leaves[i].ActiveTab, false) {
+			restored = true
+		}
+		files = files[leaves[i].Tabs:]
+		if leaves[i].Focused {
+			focus = p
+		}
+	}
+	for _, p := range panes {
+		if len(e.paneBuffers(p)) == 0 && e.layout.find(p) != nil {
+			e.usePane(p)
+			e.closePane()
+		}
+	}
+	if e.layout.find(focus) != nil {
+		e.usePane(focus)
+	}
+	if buf := e.activeBuffer(); buf != nil {
+		e.gitGutter.Update(buf.Path)
+	}
+	return restored
+}
+
+// restoreSplit divides the leaf s as st is divided, with a new pane for
+// every part after the first, and appends st's panes and their states to
+// panes and leaves in order.
+func (e *Editor) restoreSplit(st *SplitState, s *split, leaves *[]*SplitState, panes *[]*pane) {
+	if st.First == nil || st.Second == nil {
+		*leaves = append(*leaves, st)
+		*panes = append(*panes, s.pane)
+		return
+	}
+	p := newPane()
+	p.tabBar = e.newTabBar()
+	ratio := st.Ratio
+	if ratio <= 0 || ratio >= 1 {
+		ratio = 0.5
+	}
+	s.first = &split{pane: s.pane, parent: s}
+	s.second = &split{pane: p, parent: s}
+	s.pane, s.vertical, s.ratio = nil, st.Vertical, ratio
+	e.restoreSplit(st.First, s.first, leaves, panes)
+	e.restoreSplit(st.Second, s.second, leaves, panes)
+}
+
+// tabs returns how many tabs st's panes have, or -1 if st is malformed.
+func (st *SplitState) tabs() int {
+	if st.First == nil || st.Second == nil {
+		if st.Tabs < 0 || st.First != st.Second {
+			return -1
+		}
+		return st.Tabs
+	}
+	first, second := st.First.tabs(), st.Second.tabs()
+	if first < 0 || second < 0 {
+		return -1
+	}
+	return first + second
+}
+
+// openSessionTabs reopens files as tabs of the focused pane, switches to
+// the one at index active and reports whether any were reopened.
+func (e *Editor) openSessionTabs(files []FileState, active int, onlyUnsaved bool) bool {
+	restored := false
+	states := make(map[*buffer.Buffer]FileState)
+	for _, fs := range files {
+		if onlyUnsaved && fs.Unsaved == nil {
 			continue
 		}
-		e.openFile(fs.Path)
-		buf := e.activeBuffer()
-		if buf != nil && buf.Path == fs.Path {
-			if fs.Line < len(buf.Lines) {
+		var buf *buffer.Buffer
+		if _, err := os.Stat(fs.Path); err != nil {
+			if fs.Unsaved == nil {
+				continue
+			}
+			// Unsaved text outlives its file: keep it in an untitled tab
+			e.openEmptyBuffer()
+			buf = e.activeBuffer()
+		} else if fs.Preview && fs.Unsaved == nil {
+			e.openFilePreview(fs.Path)
+			if b := e.activeBuffer(); b != nil && b.Path == fs.Path {
+				buf = b
+			}
+		} else {
+			e.openFile(fs.Path)
+			if b := e.activeBuffer(); b != nil && b.Path == fs.Path {
+				buf = b
+			}
+		}
+		if buf != nil {
+			if fs.Unsaved != nil {
+				e.restoreUnsaved(buf, fs.Unsaved)
+			}
+			for start, end := range fs.Folds {
+				if buf.FoldedLines != nil && start >= 0 && start < end && end <= buf.LineCount() {
+					buf.FoldedLines[start] = end
+				}
+			}
+			if fs.Line < buf.LineCount() {
 				buf.Cursor.Line = fs.Line
-				lineLen := buffer.RuneLen(buf.Lines[fs.Line])
+				lineLen := buffer.RuneLen(buf.Line(fs.Line))
 				if fs.Col <= lineLen {
 					buf.Cursor.Col = fs.Col
 				}
 			}
+			restoreSelection(buf, fs.Selection)
+			states[buf] = fs
 			view := e.activeView()
 			if view != nil {
 				view.scrollY = fs.ScrollY
@@ -128,9 +458,84 @@ func (e *Editor) RestoreSession() bool {
 		}
 	}
 
-	if restored && session.ActiveTab >= 0 && session.ActiveTab < len(e.buffers) {
-		e.switchTab(session.ActiveTab)
+	if restored && !onlyUnsaved && active >= 0 && active < len(e.buffers) {
+		e.switchTab(active)
+	}
+	// Only the active tab has extra cursors; switching tabs clears them
+	if buf := e.activeBuffer(); buf != nil {
+		if fs, ok := states[buf]; ok {
+			restoreExtraCursors(buf, fs.Cursors)
+		}
 	}
 
 	return restored
 }
+
+// fitsCursor reports whether c is a position in buf's text.
+func fitsCursor(buf *buffer.Buffer, c buffer.Cursor) bool {
+	return c.Line >= 0 && c.Line < buf.LineCount() && c.Col >= 0 && c.Col <= buffer.RuneLen(buf.Line(c.Line))
+}
+
+// sessionSelection returns a copy of sel if it still fits in buf.
+func sessionSelection(buf *buffer.Buffer, sel *buffer.Selection) *buffer.Selection {
+	if sel == nil || !fitsCursor(buf, sel.Start) || !fitsCursor(buf, sel.End) || !sel.Start.Before(sel.End) {
+		return nil
+	}
+	s := *sel
+	return &s
+}
+
+func restoreSelection(buf *buffer.Buffer, sel *buffer.Selection) {
+	if buf.Large() == nil && !buf.IsBinary {
+		buf.Selection = sessionSelection(buf, sel)
+	}
+}
+
+// restoreExtraCursors puts back the extra cursors of a session, leaving
+// out any that no longer fit in buf.
+func restoreExtraCursors(buf *buffer.Buffer, cursors []CursorState) {
+	if buf.Large() != nil || buf.IsBinary {
+		return
+	}
+	buf.ClearExtraCursors()
+	for _, c := range cursors {
+		if !fitsCursor(buf, c.Cursor) || c.Cursor.Equal(buf.Cursor) {
+			continue
+		}
+		buf.ExtraCursors = append(buf.ExtraCursors, buffer.ExtraCursor{
+			Cursor:    c.Cursor,
+			Selection: sessionSelection(buf, c.Selection),
+		})
+	}
+}
+
+// restoreUnsaved puts the changes hot exit kept back into buf, which holds
+// the file as it is on disk, or nothing if it is untitled.
+func (e *Editor) restoreUnsaved(buf *buffer.Buffer, st *UnsavedState) {
+	if !e.hotExitKeeps(buf) {
+		return
+	}
+	buf.SetLines(strings.Split(st.Text, "\n"))
+	undo := buffer.NewUndoStack()
+	if undo.SetHistory(st.Undo) == nil {
+		buf.Undo = undo
+	} else {
+		buf.Undo = buffer.NewUndoStack()
+	}
+	if buf.Path == "" && st.Untitled != "" {
+		buf.UntitledID = st.Untitled
+	}
+	buf.RecomputeDirty()
+	if buf.Path != "" {
+		// The file changed since: the kept text no longer builds on it
+		if info, err := os.Stat(buf.Path); err == nil && (!info.ModTime().Equal(st.ModTime) || info.Size() != st.Size) {
+			buf.ExternallyModified = true
+		}
+	}
+	for i, b := range e.buffers {
+		if b == buf {
+			e.tabBar.SetModified(i, buf.Dirty)
+			e.tabBar.SetExternallyModified(i, buf.ExternallyModified)
+		}
+	}
+}
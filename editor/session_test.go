@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"editor/buffer"
 	"editor/config"
+	"editor/lsp"
+	"editor/ui"
 )
 
 func TestSaveSessionRemovesStaleFileWhenNoOpenFileTabs(t *testing.T) {
@@ -77,3 +80,145 @@ func TestSaveSessionWritesOpenFiles(t *testing.T) {
 		t.Fatalf("unexpected session data: %+v", got)
 	}
 }
+
+func TestHotExitRestoresUnsavedBuffers(t *testing.T) {
+	e, wd := newWorkspaceTestEditor(t)
+	e.lspManager = lsp.NewManager(wd)
+	e.cfg.HotExit = true
+	prevWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd failed: %v", err)
+	}
+	if err := os.Chdir(wd); err != nil {
+		t.Fatalf("chdir failed: %v", err)
+	}
+	defer func() { _ = os.Chdir(prevWD) }()
+
+	path := filepath.Join(wd, "notes.txt")
+	if err := os.WriteFile(path, []byte("one\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	e.openFile(path)
+	b := e.activeBuffer()
+	b.Cursor.Col = 3
+	b.InsertText(" two")
+	e.openEmptyBuffer()
+	scratch := e.activeBuffer()
+	scratch.InsertText("scratch")
+
+	// Quitting doesn't ask about the unsaved changes
+	e.handleQuit()
+	if !e.quit {
+		t.Fatalf("hot exit asked before quitting")
+	}
+	e.SaveSession()
+
+	e2 := New(config.Default())
+	e2.tabBar = e.tabBar
+	e2.tabBar.Tabs = nil
+	e2.statusBar = e.statusBar
+	e2.lspManager = e.lspManager
+	if !e2.RestoreSession() || len(e2.buffers) != 2 {
+		t.Fatalf("restored %d buffers", len(e2.buffers))
+	}
+	r := e2.buffers[0]
+	checkLines(t, r, "one two")
+	if !r.Dirty || r.Cursor.Col != 7 {
+		t.Fatalf("restored file dirty %v cursor %+v", r.Dirty, r.Cursor)
+	}
+	r.ApplyUndo()
+	r.RecomputeDirty()
+	checkLines(t, r, "one")
+	if r.Dirty {
+		t.Fatalf("file still dirty after undoing the kept change")
+	}
+
+	s := e2.buffers[1]
+	checkLines(t, s, "scratch")
+	if !s.Dirty || s.Path != "" || s.UntitledID != scratch.UntitledID {
+		t.Fatalf("restored scratch dirty %v path %q id %q", s.Dirty, s.Path, s.UntitledID)
+	}
+}
+
+func TestHotExitAsksWhenSessionCannotBeWritten(t *testing.T) {
+	e, wd := newWorkspaceTestEditor(t)
+	e.lspManager = lsp.NewManager(wd)
+	e.cfg.HotExit = true
+	t.Chdir(wd)
+	// A file where the session directory should go
+	home, _ := os.UserHomeDir()
+	os.MkdirAll(filepath.Join(home, ".local", "share"), 0o755)
+	if err := os.WriteFile(filepath.Join(home, ".local", "share", "aln"), nil, 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	path := filepath.Join(wd, "notes.txt")
+	if err := os.WriteFile(path, []byte("one\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	e.openFile(path)
+	e.activeBuffer().InsertText("zero ")
+
+	e.handleQuit()
+	if e.quit || !strings.Contains(e.statusBar.Message, "Could not keep unsaved changes") {
+		t.Fatalf("quit %v with message %q, want a prompt", e.quit, e.statusBar.Message)
+	}
+	e.handleQuit()
+	if !e.quit {
+		t.Fatalf("second Ctrl+Q did not quit")
+	}
+}
+
+func TestSessionKeepsSelectionsAndView(t *testing.T) {
+	e, wd := newSessionTestEditor(t)
+	if err := os.Mkdir(filepath.Join(wd, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	e.fileTree.Refresh()
+	e.fileTree.SetExpandedPaths([]string{wd, filepath.Join(wd, "sub")})
+
+	e.openFilePreview(filepath.Join(wd, "b.txt"))
+	e.openFile(filepath.Join(wd, "a.txt"))
+	a := e.activeBuffer()
+	a.Cursor = buffer.Cursor{Line: 0, Col: 3}
+	a.Selection = &buffer.Selection{Start: buffer.Cursor{Line: 0, Col: 0}, End: buffer.Cursor{Line: 0, Col: 3}}
+	a.AddCursorAt(2, 5)
+	a.FoldedLines[1] = 2
+	e.cfg.WordWrap = true
+	session := e.captureSession()
+	e.buffers[0].AddCursorAt(1, 1)
+	if session := e.captureSession(); len(session.Files[0].Cursors) != 0 {
+		t.Fatalf("inactive tab saved extra cursors %v", session.Files[0].Cursors)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var loaded SessionData
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+
+	e2, _ := newSessionTestEditor(t)
+	e2.fileTree = ui.NewFileTree(wd)
+	if !e2.openSessionFiles(&loaded, false) || len(e2.buffers) != 2 {
+		t.Fatalf("restored %d buffers", len(e2.buffers))
+	}
+	a2 := e2.buffers[1]
+	if a2.Selection == nil || a2.Selection.End != (buffer.Cursor{Line: 0, Col: 3}) {
+		t.Fatalf("selection = %v", a2.Selection)
+	}
+	if len(a2.ExtraCursors) != 1 || a2.ExtraCursors[0].Cursor != (buffer.Cursor{Line: 2, Col: 5}) {
+		t.Fatalf("extra cursors = %v", a2.ExtraCursors)
+	}
+	if a2.FoldedLines[1] != 2 {
+		t.Fatalf("folds = %v", a2.FoldedLines)
+	}
+	if e2.previewTab != 0 || !e2.cfg.WordWrap {
+		t.Fatalf("preview tab %d, word wrap %v", e2.previewTab, e2.cfg.WordWrap)
+	}
+	if got := e2.fileTree.ExpandedPaths(); len(got) != 2 || got[1] != filepath.Join(wd, "sub") {
+		t.Fatalf("expanded = %q", got)
+	}
+}
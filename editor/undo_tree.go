@@ -0,0 +1,181 @@
+package editor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"editor/buffer"
+	"editor/ui"
+)
+
+// maxUndoDiffLines caps the diff shown for one state in the undo tree.
+const maxUndoDiffLines = 200
+
+// openUndoTree shows the undo tree of the active buffer, every branch
+// included, and goes to the state picked.
+func (e *Editor) openUndoTree() {
+	buf := e.cursorBuffer()
+	if buf == nil {
+		return
+	}
+	states := buf.Undo.States()
+	if len(states) == 1 {
+		e.setTemporaryMessage("No undo history")
+		return
+	}
+
+	items := undoTreeItems(states, time.Now())
+	p := ui.NewTimelinePanel("Undo Tree", items)
+	p.Hint = "↑↓ select · Enter go to state · Esc close"
+	p.OnSelect = func(item ui.TimelineItem) {
+		e.timeline = nil
+		e.goToUndoState(buf, item.ID)
+	}
+	p.OnCancel = func() {
+		e.timeline = nil
+	}
+	e.timeline = p
+}
+
+// undoTreeItems lists states newest first. A state's first branch
+// continues its parent's column; later branches are indented one more.
+func undoTreeItems(states []buffer.UndoState, now time.Time) []ui.TimelineItem {
+	indent := make(map[int]int, len(states))
+	branched := make(map[int]bool, len(states))
+	items := make([]ui.TimelineItem, 0, len(states))
+	for _, st := range states {
+		if st.Parent >= 0 {
+			indent[st.ID] = indent[st.Parent]
+			if branched[st.Parent] {
+				indent[st.ID]++
+			}
+			branched[st.Parent] = true
+		}
+		item := ui.TimelineItem{
+			ID:      st.ID,
+			Indent:  indent[st.ID],
+			Label:   fmt.Sprintf("#%d %s %s", st.ID, st.Time.Format("15:04:05"), timeAgo(now.Sub(st.Time))),
+			Current: st.Current,
+		}
+		if st.Parent < 0 {
+			item.Summary = "opened"
+		} else {
+			item.Summary = undoSummary(st.Ops)
+			item.Diff = undoDiff(st.Ops)
+		}
+		items = append(items, item)
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items
+}
+
+func timeAgo(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+}
+
+// undoSummary describes an edit by the characters it added and removed, or
+// the line endings it converted to.
+func undoSummary(ops []buffer.Operation) string {
+	added, removed := 0, 0
+	var endings string
+	for _, op := range ops {
+		n := len([]rune(op.Text))
+		if op.Type == buffer.OpLineEndings {
+			endings = op.Endings.To
+		} else if op.Type == buffer.OpInsert {
+			added += n
+		} else {
+			removed += n
+		}
+	}
+	var parts []string
+	if added > 0 {
+		parts = append(parts, fmt.Sprintf("+%d", added))
+	}
+	if removed > 0 {
+		parts = append(parts, fmt.Sprintf("-%d", removed))
+	}
+	if endings != "" {
+		parts = append(parts, "→ "+endings)
+	}
+	return strings.Join(parts, " ")
+}
+
+// undoDiff shows the text each operation of an edit removed and added,
+// under the line it starts on.
+func undoDiff(ops []buffer.Operation) []ui.TimelineDiffLine {
+	var lines []ui.TimelineDiffLine
+	for _, op := range ops {
+		if len(lines) >= maxUndoDiffLines {
+			lines = append(lines, ui.TimelineDiffLine{Text: "…"})
+			break
+		}
+		if op.Type == buffer.OpLineEndings {
+			lines = append(lines, ui.TimelineDiffLine{Text: "line endings " + op.Endings.From + " → " + op.Endings.To})
+			continue
+		}
+		kind := 1
+		if op.Type == buffer.OpDelete {
+			kind = -1
+		}
+		lines = append(lines, ui.TimelineDiffLine{Text: fmt.Sprintf("line %d, col %d", op.Pos.Line+1, op.Pos.Col+1)})
+		for _, text := range strings.Split(op.Text, "\n") {
+			lines = append(lines, ui.TimelineDiffLine{Text: text, Kind: kind})
+		}
+	}
+	return lines
+}
+
+func (e *Editor) goToUndoState(buf *buffer.Buffer, id int) {
+	if e.activeBuffer() != buf || !buf.GoToUndoState(id) {
+		return
+	}
+	buf.ClearExtraCursors()
+	e.markDirty()
+	e.setTemporaryMessage(fmt.Sprintf("Went to undo state #%d", id))
+}
+
+// openGoBackInTimeDialog asks how many minutes to go back and goes to the
+// state the text was in then.
+func (e *Editor) openGoBackInTimeDialog() {
+	buf := e.cursorBuffer()
+	if buf == nil {
+		return
+	}
+	d := ui.NewInputDialog("Go back how many minutes: ")
+	d.OnSubmit = func(value string) {
+		e.dialog = nil
+		minutes, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || minutes <= 0 {
+			e.setTemporaryError("Enter a number of minutes")
+			return
+		}
+		e.goBackInTime(buf, time.Duration(minutes*float64(time.Minute)))
+	}
+	d.OnCancel = func() {
+		e.dialog = nil
+	}
+	e.dialog = d
+}
+
+// goBackInTime goes to the state the text was in d ago.
+func (e *Editor) goBackInTime(buf *buffer.Buffer, d time.Duration) {
+	id := buf.Undo.StateAt(time.Now().Add(-d))
+	if id == buf.Undo.CurrentState() {
+		e.setTemporaryMessage("The text is already as it was then")
+		return
+	}
+	e.goToUndoState(buf, id)
+}
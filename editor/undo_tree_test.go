@@ -0,0 +1,41 @@
+package editor
+
+import (
+	"testing"
+	"time"
+
+	"editor/buffer"
+)
+
+func TestUndoTreeBrowsesBranches(t *testing.T) {
+	e, b := newBlockTestEditor(t, "x")
+	b.Cursor = buffer.Cursor{Line: 0, Col: 1}
+	b.InsertText("one")
+	b.InsertText(" two")
+	b.ApplyUndo()
+	b.InsertText(" 2")
+
+	// Newest first, the abandoned branch indented under its parent
+	items := undoTreeItems(b.Undo.States(), time.Now())
+	var ids, indents []int
+	for _, item := range items {
+		ids = append(ids, item.ID)
+		indents = append(indents, item.Indent)
+	}
+	if len(items) != 4 || ids[0] != 3 || ids[3] != 0 || indents[0] != 1 || indents[1] != 0 {
+		t.Fatalf("items ids %v indents %v", ids, indents)
+	}
+	if !items[0].Current || items[0].Summary != "+2" {
+		t.Fatalf("newest item = %+v", items[0])
+	}
+
+	e.goToUndoState(b, 2)
+	checkLines(t, b, "xone two")
+
+	// An hour back is before any edit
+	e.goBackInTime(b, time.Hour)
+	checkLines(t, b, "x")
+	if b.Dirty {
+		t.Fatalf("buffer dirty at the state it was opened in")
+	}
+}
@@ -0,0 +1,435 @@
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"editor/buffer"
+	"editor/highlight"
+	"editor/lsp"
+	"editor/ui"
+)
+
+// workspaceChange is one step of a WorkspaceEdit, in application order:
+// either a text edit in Path or a create/rename/delete file operation.
+type workspaceChange struct {
+	Path    string
+	Edit    lsp.TextEdit
+	Version *int // document version the edit was computed against, if any
+
+	Op      string // "", "create", "rename" or "delete"
+	NewPath string // rename target
+	Options lsp.FileOperationOptions
+}
+
+// flattenWorkspaceEdit turns a WorkspaceEdit into an ordered change list.
+// documentChanges is preferred when present, as the spec requires.
+func flattenWorkspaceEdit(edit *lsp.WorkspaceEdit) []workspaceChange {
+	var changes []workspaceChange
+	if len(edit.DocumentChanges) > 0 {
+		for _, dc := range edit.DocumentChanges {
+			var opts lsp.FileOperationOptions
+			if dc.Options != nil {
+				opts = *dc.Options
+			}
+			switch dc.Kind {
+			case "create", "delete":
+				changes = append(changes, workspaceChange{Path: lsp.URIToPath(dc.URI), Op: dc.Kind, Options: opts})
+			case "rename":
+				changes = append(changes, workspaceChange{
+					Path:    lsp.URIToPath(dc.OldURI),
+					NewPath: lsp.URIToPath(dc.NewURI),
+					Op:      "rename",
+					Options: opts,
+				})
+			default:
+				if dc.TextDocument == nil {
+					continue
+				}
+				path := lsp.URIToPath(dc.TextDocument.URI)
+				for _, te := range sortedTextEdits(dc.Edits) {
+					changes = append(changes, workspaceChange{Path: path, Edit: te, Version: dc.TextDocument.Version})
+				}
+			}
+		}
+		return changes
+	}
+
+	uris := make([]string, 0, len(edit.Changes))
+	for uri := range edit.Changes {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		path := lsp.URIToPath(uri)
+		for _, te := range sortedTextEdits(edit.Changes[uri]) {
+			changes = append(changes, workspaceChange{Path: path, Edit: te})
+		}
+	}
+	return changes
+}
+
+// sortedTextEdits returns edits top-to-bottom so the preview reads in file order.
+func sortedTextEdits(edits []lsp.TextEdit) []lsp.TextEdit {
+	sorted := make([]lsp.TextEdit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Range.Start, sorted[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+	return sorted
+}
+
+// previewWorkspaceEdit shows every change of edit for review. Only the
+// changes left selected are applied; done runs after a successful apply.
+func (e *Editor) previewWorkspaceEdit(title string, edit *lsp.WorkspaceEdit, done func(applied int)) {
+	changes := flattenWorkspaceEdit(edit)
+	if len(changes) == 0 {
+		e.setTemporaryError("Nothing to change")
+		return
+	}
+
+	lineCache := make(map[string][]string)
+	items := make([]ui.EditPreviewItem, len(changes))
+	for i, c := range changes {
+		items[i] = e.previewItem(c, lineCache)
+	}
+
+	p := ui.NewEditPreview(title, items)
+	p.OnApply = func(items []ui.EditPreviewItem) {
+		e.editPreview = nil
+		var selected []workspaceChange
+		for i, item := range items {
+			if item.Enabled {
+				selected = append(selected, changes[i])
+			}
+		}
+		if len(selected) == 0 {
+			e.setTemporaryMessage("No changes selected")
+			return
+		}
+		applied, errs := e.applyWorkspaceChanges(title, selected)
+		if len(errs) > 0 {
+			e.setTemporaryError(fmt.Sprintf("Applied %d change(s), %d failed: %s", applied, len(errs), errs[0]))
+			return
+		}
+		if done != nil {
+			done(applied)
+		}
+	}
+	p.OnCancel = func() {
+		e.editPreview = nil
+		e.setTemporaryMessage("Edit cancelled")
+	}
+	e.editPreview = p
+}
+
+func (e *Editor) previewItem(c workspaceChange, lineCache map[string][]string) ui.EditPreviewItem {
+	item := ui.EditPreviewItem{File: e.displayPath(c.Path), Enabled: true}
+	switch c.Op {
+	case "create":
+		item.Label = "Create file " + e.displayPath(c.Path)
+		return item
+	case "rename":
+		item.Label = "Rename to " + e.displayPath(c.NewPath)
+		return item
+	case "delete":
+		item.Label = "Delete " + e.displayPath(c.Path)
+		return item
+	}
+
+	lines, ok := lineCache[c.Path]
+	if !ok {
+		lines = e.linesForPath(c.Path)
+		lineCache[c.Path] = lines
+	}
+	start, end := c.Edit.Range.Start, c.Edit.Range.End
+	item.Line = start.Line
+	if start.Line >= len(lines) {
+		item.After = strings.ReplaceAll(c.Edit.NewText, "\n", "⏎")
+		return item
+	}
+	first := []rune(lines[start.Line])
+	last := first
+	if end.Line != start.Line && end.Line < len(lines) {
+		last = []rune(lines[end.Line])
+	}
+	item.Before = lines[start.Line]
+	if end.Line > start.Line {
+		item.Before += " …"
+	}
+	prefix := string(first[:clampIndex(start.Character, len(first))])
+	suffix := ""
+	if end.Line < len(lines) {
+		suffix = string(last[clampIndex(end.Character, len(last)):])
+	}
+	item.After = strings.ReplaceAll(prefix+c.Edit.NewText+suffix, "\n", "⏎")
+	return item
+}
+
+func clampIndex(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+// linesForPath returns the current text of path: the open buffer if there is
+// one, otherwise the file on disk.
+func (e *Editor) linesForPath(path string) []string {
+	if buf := e.bufferForPath(path); buf != nil {
+		return buf.Lines()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	return strings.Split(text, "\n")
+}
+
+func (e *Editor) bufferForPath(path string) *buffer.Buffer {
+	for _, b := range e.allBuffers() {
+		if b.Path == path {
+			return b
+		}
+	}
+	return nil
+}
+
+// displayPath shortens paths inside the working directory for display.
+func (e *Editor) displayPath(path string) string {
+	if e.watchedRoot != "" {
+		if rel, err := filepath.Rel(e.watchedRoot, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// applyWorkspaceChanges applies changes in order and records them as one
+// workspace transaction under label. Consecutive text edits to one file
+// become a single undo step in that file's buffer; files that aren't open are
+// edited on disk.
+func (e *Editor) applyWorkspaceChanges(label string, changes []workspaceChange) (applied int, errs []string) {
+	txn := &workspaceTxn{Label: label, Time: time.Now()}
+	fileOps := false
+
+	for i := 0; i < len(changes); {
+		c := changes[i]
+		if c.Op != "" {
+			fileOps = true
+			step, err := e.applyFileOperation(c)
+			if err != nil {
+				errs = append(errs, err.Error())
+			} else {
+				applied++
+				if step != nil {
+					txn.steps = append(txn.steps, *step)
+				}
+			}
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(changes) && changes[j].Op == "" && changes[j].Path == c.Path {
+			j++
+		}
+		batch := changes[i:j]
+		i = j
+
+		buf := e.bufferForPath(c.Path)
+		if c.Version != nil && buf != nil && documentVersion(buf) != *c.Version {
+			errs = append(errs, filepath.Base(c.Path)+" changed since the edit was computed")
+			continue
+		}
+
+		edits := make([]buffer.TextEdit, len(batch))
+		for k, bc := range batch {
+			edits[k] = buffer.TextEdit{
+				Start:   buffer.Cursor{Line: bc.Edit.Range.Start.Line, Col: bc.Edit.Range.Start.Character},
+				End:     buffer.Cursor{Line: bc.Edit.Range.End.Line, Col: bc.Edit.Range.End.Character},
+				NewText: bc.Edit.NewText,
+			}
+		}
+
+		if buf == nil {
+			before, after, err := applyEditsOnDisk(c.Path, edits)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			txn.steps = append(txn.steps, txnStep{kind: txnFileEdit, path: c.Path, before: before, after: after})
+			applied += len(batch)
+			continue
+		}
+		if buf.ReadOnly {
+			errs = append(errs, "cannot edit "+filepath.Base(c.Path))
+			continue
+		}
+
+		if group := buf.ApplyEdits(edits); group != 0 {
+			txn.steps = append(txn.steps, txnStep{kind: txnBufferEdit, buf: buf, group: group})
+		}
+		applied += len(batch)
+		e.refreshBufferTab(buf)
+	}
+
+	if len(txn.steps) > 0 {
+		e.pushWorkspaceTxn(txn)
+	}
+	if fileOps && e.fileTree != nil {
+		e.fileTree.Refresh()
+	}
+	e.updateStatus()
+	return applied, errs
+}
+
+// refreshBufferTab updates highlighting and the modified marker after a
+// buffer was changed outside normal typing.
+func (e *Editor) refreshBufferTab(buf *buffer.Buffer) {
+	e.highlight.InvalidateCache(buf.Path)
+	for i, b := range e.buffers {
+		if b == buf {
+			e.tabBar.SetModified(i, buf.Dirty)
+			break
+		}
+	}
+}
+
+// applyEditsOnDisk edits a file that isn't open in a tab, keeping its BOM and
+// line endings. It returns the file contents before and after.
+func applyEditsOnDisk(path string, edits []buffer.TextEdit) (before, after []byte, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	before, err = os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.IndexByte(before, 0) >= 0 || !utf8.Valid(before) {
+		return nil, nil, fmt.Errorf("%s is not a UTF-8 text file", filepath.Base(path))
+	}
+
+	text := string(before)
+	bom := ""
+	if strings.HasPrefix(text, "\uFEFF") {
+		bom = "\uFEFF"
+		text = strings.TrimPrefix(text, bom)
+	}
+
+	tmp := buffer.NewBufferKeepingLineEndings(text, 4)
+	tmp.ApplyEdits(edits)
+	after = []byte(bom + tmp.BuildSaveContent(false, false))
+
+	if err := os.WriteFile(path, after, info.Mode().Perm()); err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+func (e *Editor) applyFileOperation(c workspaceChange) (*txnStep, error) {
+	switch c.Op {
+	case "create":
+		step := &txnStep{kind: txnCreate, path: c.Path}
+		if _, err := os.Stat(c.Path); err == nil {
+			if c.Options.IgnoreIfExists && !c.Options.Overwrite {
+				return nil, nil
+			}
+			if !c.Options.Overwrite {
+				return nil, fmt.Errorf("%s already exists", filepath.Base(c.Path))
+			}
+			data, err := os.ReadFile(c.Path)
+			if err != nil {
+				return nil, err
+			}
+			step.existed, step.before = true, data
+		}
+		if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+			return nil, err
+		}
+		return step, os.WriteFile(c.Path, nil, 0644)
+
+	case "rename":
+		step := &txnStep{kind: txnRename, path: c.Path, newPath: c.NewPath}
+		if _, err := os.Stat(c.NewPath); err == nil {
+			if c.Options.IgnoreIfExists && !c.Options.Overwrite {
+				return nil, nil
+			}
+			if !c.Options.Overwrite {
+				return nil, fmt.Errorf("%s already exists", filepath.Base(c.NewPath))
+			}
+			if data, err := os.ReadFile(c.NewPath); err == nil {
+				step.existed, step.before = true, data
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(c.NewPath), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(c.Path, c.NewPath); err != nil {
+			return nil, err
+		}
+		e.retargetBuffers(c.Path, c.NewPath)
+		return step, nil
+
+	case "delete":
+		if _, err := os.Stat(c.Path); os.IsNotExist(err) {
+			if c.Options.IgnoreIfNotExists {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("%s does not exist", filepath.Base(c.Path))
+		}
+		// Deleting would close its tabs, and lose what they haven't saved
+		for _, buf := range e.allBuffers() {
+			if buf.Dirty && isSameOrUnder(buf.Path, c.Path) {
+				return nil, fmt.Errorf("%s has unsaved changes", filepath.Base(buf.Path))
+			}
+		}
+		saved, err := snapshotTree(c.Path)
+		if err != nil {
+			return nil, err
+		}
+		if c.Options.Recursive {
+			err = os.RemoveAll(c.Path)
+		} else {
+			err = os.Remove(c.Path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		e.removeTabsWhere(func(buf *buffer.Buffer) bool { return isSameOrUnder(buf.Path, c.Path) })
+		return &txnStep{kind: txnDelete, path: c.Path, files: saved}, nil
+	}
+	return nil, fmt.Errorf("unknown file operation %q", c.Op)
+}
+
+// retargetBuffers points open buffers at their new location after a file or
+// directory was renamed on disk.
+func (e *Editor) retargetBuffers(oldPath, newPath string) {
+	for _, buf := range e.allBuffers() {
+		if !isSameOrUnder(buf.Path, oldPath) {
+			continue
+		}
+		buf.Path = newPath + strings.TrimPrefix(buf.Path, oldPath)
+		buf.Language = highlight.DetectLanguage(buf.Path)
+	}
+	e.syncTabs()
+}
+
+func isSameOrUnder(path, root string) bool {
+	return path != "" && (path == root || strings.HasPrefix(path, root+string(filepath.Separator)))
+}
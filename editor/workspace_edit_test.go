@@ -0,0 +1,147 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"editor/buffer"
+	"editor/lsp"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestEditPreviewAppliesOnlySelectedChanges(t *testing.T) {
+	e, wd := newWorkspaceTestEditor(t)
+
+	openPath := filepath.Join(wd, "open.go")
+	b := buffer.NewBuffer(4)
+	b.Path = openPath
+	b.SetLines([]string{"a := old()", "b := old()"})
+	b.MarkSaved()
+	e.buffers = []*buffer.Buffer{b}
+	e.tabBar.AddTab(openPath, false)
+	e.activeTab = 0
+
+	closedPath := filepath.Join(wd, "closed.go")
+	gonePath := filepath.Join(wd, "gone.go")
+	for _, path := range []string{closedPath, gonePath} {
+		if err := os.WriteFile(path, []byte("func old() {}\n"), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	createdPath := filepath.Join(wd, "created.go")
+	renamedPath := filepath.Join(wd, "renamed.go")
+
+	edit := func(line, start, end int) lsp.TextEdit {
+		return lsp.TextEdit{Range: lsp.Range{
+			Start: lsp.Position{Line: line, Character: start},
+			End:   lsp.Position{Line: line, Character: end},
+		}, NewText: "fresh"}
+	}
+	var done int
+	e.previewWorkspaceEdit("Rename", &lsp.WorkspaceEdit{DocumentChanges: []lsp.DocumentChange{
+		{TextDocument: &lsp.VersionedTextDocumentIdentifier{URI: lsp.FileURI(openPath)}, Edits: []lsp.TextEdit{edit(0, 5, 8), edit(1, 5, 8)}},
+		{TextDocument: &lsp.VersionedTextDocumentIdentifier{URI: lsp.FileURI(closedPath)}, Edits: []lsp.TextEdit{edit(0, 5, 8)}},
+		{Kind: "rename", OldURI: lsp.FileURI(closedPath), NewURI: lsp.FileURI(renamedPath)},
+		{Kind: "create", URI: lsp.FileURI(createdPath)},
+		{Kind: "delete", URI: lsp.FileURI(gonePath)},
+	}}, func(applied int) { done = applied })
+
+	p := e.editPreview
+	if p == nil || len(p.Items) != 6 {
+		t.Fatalf("expected a preview of 6 changes, got %+v", p)
+	}
+	if p.Items[1].After != "b := fresh()" || p.Items[3].Label != "Rename to renamed.go" {
+		t.Fatalf("unexpected preview items: %+v", p.Items)
+	}
+	// Deselect the second edit in open.go with the keyboard, and the delete
+	e.handleKey(tcell.NewEventKey(tcell.KeyDown, 0, 0))
+	e.handleKey(tcell.NewEventKey(tcell.KeyRune, ' ', 0))
+	p.Items[5].Enabled = false
+	e.handleKey(tcell.NewEventKey(tcell.KeyEnter, 0, 0))
+
+	if e.editPreview != nil {
+		t.Fatal("preview still open after applying")
+	}
+	if done != 4 {
+		t.Fatalf("applied %d changes, want 4", done)
+	}
+	if b.Line(0) != "a := fresh()" || b.Line(1) != "b := old()" {
+		t.Fatalf("open buffer = %q", b.Lines())
+	}
+	if _, err := os.Stat(closedPath); !os.IsNotExist(err) {
+		t.Fatalf("closed.go was not renamed: %v", err)
+	}
+	if data, _ := os.ReadFile(renamedPath); string(data) != "func fresh() {}\n" {
+		t.Fatalf("renamed file = %q", data)
+	}
+	if _, err := os.Stat(createdPath); err != nil {
+		t.Fatalf("created.go was not created: %v", err)
+	}
+	if data, _ := os.ReadFile(gonePath); string(data) != "func old() {}\n" {
+		t.Fatalf("deselected delete removed gone.go: %q", data)
+	}
+}
+
+func TestWorkspaceDeleteRefusesUnsavedFile(t *testing.T) {
+	e, wd := newWorkspaceTestEditor(t)
+	e.lspManager = lsp.NewManager(wd)
+	path := filepath.Join(wd, "gone.txt")
+	if err := os.WriteFile(path, []byte("gone\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	e.openFile(path)
+	e.activeBuffer().InsertText("kept ")
+
+	applied, errs := e.applyWorkspaceChanges("Delete", []workspaceChange{{Op: "delete", Path: path}})
+	if applied != 0 || len(errs) != 1 {
+		t.Fatalf("applied %d, errors %q; want the delete refused", applied, errs)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file deleted: %v", err)
+	}
+	if len(e.buffers) != 1 || e.buffers[0].Path != path {
+		t.Fatalf("tab closed: %d tabs", len(e.buffers))
+	}
+
+	// Once saved, it goes, and its tab with it, without quitting
+	e.buffers[0].MarkSaved()
+	if applied, errs := e.applyWorkspaceChanges("Delete", []workspaceChange{{Op: "delete", Path: path}}); applied != 1 {
+		t.Fatalf("delete failed: %q", errs)
+	}
+	if e.quit || len(e.buffers) != 1 || e.buffers[0].Path != "" {
+		t.Fatalf("after delete: quit %v, %d tabs", e.quit, len(e.buffers))
+	}
+}
+
+func TestWorkspaceEditRefusesStaleDocumentVersion(t *testing.T) {
+	e, wd := newWorkspaceTestEditor(t)
+	path := filepath.Join(wd, "a.go")
+	b := buffer.NewBuffer(4)
+	b.Path = path
+	b.SetLines([]string{"x := old"})
+	e.buffers = []*buffer.Buffer{b}
+	e.tabBar.AddTab(path, false)
+	e.activeTab = 0
+
+	version := documentVersion(b)
+	change := func() []workspaceChange {
+		c := textChange(path, 0, 5, 8, "new")
+		c.Version = &version
+		return []workspaceChange{c}
+	}
+	b.Cursor = buffer.Cursor{Line: 0, Col: 8}
+	b.InsertText("er")
+	if applied, errs := e.applyWorkspaceChanges("Rename", change()); applied != 0 || len(errs) != 1 {
+		t.Fatalf("stale edit: applied %d, errors %q", applied, errs)
+	}
+
+	version = documentVersion(b)
+	if applied, errs := e.applyWorkspaceChanges("Rename", change()); applied != 1 {
+		t.Fatalf("current edit refused: %q", errs)
+	}
+	if b.Line(0) != "x := newer" {
+		t.Fatalf("line = %q", b.Line(0))
+	}
+}
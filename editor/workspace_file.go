@@ -0,0 +1,258 @@
+package editor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"editor/ui"
+)
+
+// workspaceExt marks workspace files.
+const workspaceExt = ".aln-workspace"
+
+// workspaceFile is the format of a .aln-workspace file: a session whose
+// paths are relative to the file where they are inside its directory, so
+// it can be checked in, plus settings that apply while it is open.
+type workspaceFile struct {
+	SessionData
+	Settings json.RawMessage `json:"settings,omitempty"`
+}
+
+func isWorkspaceFile(path string) bool {
+	return strings.HasSuffix(path, workspaceExt)
+}
+
+// relToWorkspace writes path relative to dir when it is inside it.
+func relToWorkspace(dir, path string) string {
+	if path == "" {
+		return ""
+	}
+	if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rel
+	}
+	return path
+}
+
+func absFromWorkspace(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// readWorkspace loads a workspace file, its paths made absolute.
+func readWorkspace(path string) (*workspaceFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ws workspaceFile
+	if err := json.Unmarshal(data, &ws); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	dir := filepath.Dir(path)
+	for i, folder := range ws.Folders {
+		ws.Folders[i] = absFromWorkspace(dir, folder)
+	}
+	for i := range ws.Files {
+		ws.Files[i].Path = absFromWorkspace(dir, ws.Files[i].Path)
+	}
+	return &ws, nil
+}
+
+// saveWorkspace writes the tabs, folders and layout to a workspace file,
+// keeping the settings it already has, and makes it the current one.
+func (e *Editor) saveWorkspace(path string) error {
+	ws := workspaceFile{SessionData: e.captureSession()}
+	if old, err := readWorkspace(path); err == nil {
+		ws.Settings = old.Settings
+	}
+	dir := filepath.Dir(path)
+	for i, folder := range ws.Folders {
+		ws.Folders[i] = relToWorkspace(dir, folder)
+	}
+	for i := range ws.Files {
+		ws.Files[i].Path = relToWorkspace(dir, ws.Files[i].Path)
+	}
+	if err := writeSessionFile(path, ws); err != nil {
+		return err
+	}
+	e.workspacePath, e.sessionName = path, ""
+	return nil
+}
+
+// openWorkspace switches to the tabs, folders, layout and settings of a
+// workspace file.
+func (e *Editor) openWorkspace(path string) error {
+	ws, err := readWorkspace(path)
+	if err != nil {
+		return err
+	}
+	if err := e.switchToSession(&ws.SessionData, ws.Settings); err != nil {
+		return err
+	}
+	e.workspacePath = path
+	return nil
+}
+
+func (e *Editor) openSaveWorkspaceDialog() {
+	d := ui.NewInputDialog("Save workspace as: ")
+	d.Input = e.workspacePath
+	if d.Input == "" {
+		d.Input = filepath.Join(e.watchedRoot, filepath.Base(e.watchedRoot)+workspaceExt)
+	}
+	d.Cursor = len([]rune(d.Input))
+	d.OnSubmit = func(path string) {
+		e.dialog = nil
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return
+		}
+		if !isWorkspaceFile(path) {
+			path += workspaceExt
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if err := e.saveWorkspace(path); err != nil {
+			e.setTemporaryError("Error saving workspace: " + err.Error())
+			return
+		}
+		e.fileTree.Refresh()
+		e.setTemporaryMessage("Saved workspace " + filepath.Base(path))
+	}
+	d.OnCancel = func() {
+		e.dialog = nil
+	}
+	e.dialog = d
+}
+
+// workspaceFilesNear lists the workspace files in the explorer's folders
+// and the directory above the main one, where worktrees share them.
+func (e *Editor) workspaceFilesNear() []string {
+	dirs := []string{filepath.Dir(e.watchedRoot), e.watchedRoot}
+	if e.fileTree != nil {
+		dirs = append(dirs, e.fileTree.Roots()...)
+	}
+	seen := make(map[string]bool)
+	var paths []string
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"+workspaceExt))
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				paths = append(paths, m)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// openWorkspacePicker lists nearby workspace files to open, or asks for a
+// path when there are none.
+func (e *Editor) openWorkspacePicker() {
+	paths := e.workspaceFilesNear()
+	if len(paths) == 0 {
+		e.openWorkspaceDialog()
+		return
+	}
+	const other = "Other…"
+	e.openPicker(append(paths, other), e.workspacePath, func(path string) {
+		if path == other {
+			e.openWorkspaceDialog()
+			return
+		}
+		e.switchToWorkspace(path)
+	})
+}
+
+func (e *Editor) openWorkspaceDialog() {
+	d := ui.NewInputDialog("Open workspace: ")
+	d.Input = e.watchedRoot + string(filepath.Separator)
+	d.Cursor = len([]rune(d.Input))
+	d.OnSubmit = func(path string) {
+		e.dialog = nil
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		e.switchToWorkspace(path)
+	}
+	d.OnCancel = func() {
+		e.dialog = nil
+	}
+	e.dialog = d
+}
+
+func (e *Editor) switchToWorkspace(path string) {
+	if err := e.openWorkspace(path); err != nil {
+		e.setTemporaryError("Can't open workspace: " + err.Error())
+		return
+	}
+	e.setTemporaryMessage("Opened workspace " + filepath.Base(path))
+}
+
+// openAddFolderDialog adds a root folder to the explorer.
+func (e *Editor) openAddFolderDialog() {
+	d := ui.NewInputDialog("Add folder: ")
+	d.Input = filepath.Dir(e.watchedRoot) + string(filepath.Separator)
+	d.Cursor = len([]rune(d.Input))
+	d.OnSubmit = func(path string) {
+		e.dialog = nil
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			e.setTemporaryError("Not a folder: " + path)
+			return
+		}
+		roots := e.fileTree.Roots()
+		for _, root := range roots {
+			if root == path {
+				e.setTemporaryMessage(filepath.Base(path) + " is already in the explorer")
+				return
+			}
+		}
+		e.fileTree.SetRoots(append(roots, path))
+		if e.fileWatcher != nil {
+			e.addWatchRecursive(path)
+		}
+		e.setTemporaryMessage("Added folder " + filepath.Base(path))
+	}
+	d.OnCancel = func() {
+		e.dialog = nil
+	}
+	e.dialog = d
+}
+
+// openRemoveFolderPicker removes one of the added root folders from the
+// explorer; the main one stays.
+func (e *Editor) openRemoveFolderPicker() {
+	roots := e.fileTree.Roots()
+	if len(roots) < 2 {
+		e.setTemporaryError("No added folders")
+		return
+	}
+	e.openPicker(roots[1:], "", func(path string) {
+		var kept []string
+		for _, root := range e.fileTree.Roots() {
+			if root != path {
+				kept = append(kept, root)
+			}
+		}
+		e.fileTree.SetRoots(kept)
+		e.setTemporaryMessage("Removed folder " + filepath.Base(path))
+	})
+}
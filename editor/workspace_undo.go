@@ -0,0 +1,237 @@
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"editor/buffer"
+)
+
+// maxWorkspaceTxns bounds how many multi-file operations can be undone.
+const maxWorkspaceTxns = 20
+
+type txnStepKind int
+
+const (
+	txnBufferEdit txnStepKind = iota // edits applied to an open buffer as one undo group
+	txnFileEdit                      // edits written straight to a file that wasn't open
+	txnCreate
+	txnRename
+	txnDelete
+)
+
+// txnStep is one reversible piece of a workspace transaction.
+type txnStep struct {
+	kind    txnStepKind
+	buf     *buffer.Buffer
+	group   int
+	path    string
+	newPath string
+	existed bool   // create/rename replaced an existing file, saved in before
+	before  []byte // file contents before the step
+	after   []byte // file contents after a txnFileEdit
+	files   []savedFile
+}
+
+// savedFile is a file or directory removed by a delete operation.
+type savedFile struct {
+	path string
+	mode os.FileMode
+	data []byte
+}
+
+// workspaceTxn groups every change made by one multi-file operation (an LSP
+// rename, a project-wide replace) so it can be reverted as a unit.
+type workspaceTxn struct {
+	Label string
+	Time  time.Time
+	steps []txnStep
+}
+
+func (e *Editor) pushWorkspaceTxn(txn *workspaceTxn) {
+	e.workspaceTxns = append(e.workspaceTxns, txn)
+	if len(e.workspaceTxns) > maxWorkspaceTxns {
+		e.workspaceTxns = e.workspaceTxns[len(e.workspaceTxns)-maxWorkspaceTxns:]
+	}
+}
+
+// undoWorkspaceEdit reverts the most recent workspace transaction. Every file
+// is checked first, so either all of them are reverted or none is.
+func (e *Editor) undoWorkspaceEdit() {
+	if len(e.workspaceTxns) == 0 {
+		e.setTemporaryMessage("No workspace edit to undo")
+		return
+	}
+	txn := e.workspaceTxns[len(e.workspaceTxns)-1]
+
+	// Only the last step touching a file can be compared with its current
+	// state; earlier steps are reverted on top of the later ones.
+	seen := make(map[interface{}]bool)
+	for i := len(txn.steps) - 1; i >= 0; i-- {
+		st := txn.steps[i]
+		keys := txnStepKeys(st)
+		checked := false
+		for _, k := range keys {
+			checked = checked || seen[k]
+			seen[k] = true
+		}
+		if checked {
+			continue
+		}
+		if err := e.checkTxnStep(st); err != nil {
+			e.setTemporaryError("Cannot undo workspace edit: " + err.Error())
+			return
+		}
+	}
+
+	e.workspaceTxns = e.workspaceTxns[:len(e.workspaceTxns)-1]
+	var errs []string
+	fileOps := false
+	for i := len(txn.steps) - 1; i >= 0; i-- {
+		st := txn.steps[i]
+		if st.kind != txnBufferEdit && st.kind != txnFileEdit {
+			fileOps = true
+		}
+		if err := e.revertTxnStep(st); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if fileOps && e.fileTree != nil {
+		e.fileTree.Refresh()
+	}
+	e.updateStatus()
+
+	if len(errs) > 0 {
+		e.setTemporaryError(fmt.Sprintf("Undo of '%s' incomplete: %s", txn.Label, errs[0]))
+		return
+	}
+	e.setTemporaryMessage(fmt.Sprintf("Undid '%s' (%d changes)", txn.Label, len(txn.steps)))
+}
+
+func txnStepKeys(st txnStep) []interface{} {
+	switch st.kind {
+	case txnBufferEdit:
+		return []interface{}{st.buf}
+	case txnRename:
+		return []interface{}{st.path, st.newPath}
+	}
+	return []interface{}{st.path}
+}
+
+// checkTxnStep verifies that nothing changed a file since the transaction.
+func (e *Editor) checkTxnStep(st txnStep) error {
+	name := filepath.Base(st.path)
+	switch st.kind {
+	case txnBufferEdit:
+		if e.bufferForPath(st.buf.Path) != st.buf {
+			return fmt.Errorf("%s was closed", filepath.Base(st.buf.Path))
+		}
+		if st.buf.Undo.LastGroup() != st.group {
+			return fmt.Errorf("%s was edited since", filepath.Base(st.buf.Path))
+		}
+	case txnFileEdit, txnCreate:
+		data, err := os.ReadFile(st.path)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, st.after) {
+			return fmt.Errorf("%s changed on disk since", name)
+		}
+	case txnRename:
+		if _, err := os.Stat(st.newPath); err != nil {
+			return fmt.Errorf("%s no longer exists", filepath.Base(st.newPath))
+		}
+		if _, err := os.Stat(st.path); err == nil {
+			return fmt.Errorf("%s exists again", name)
+		}
+	case txnDelete:
+		if _, err := os.Stat(st.path); err == nil {
+			return fmt.Errorf("%s exists again", name)
+		}
+	}
+	return nil
+}
+
+func (e *Editor) revertTxnStep(st txnStep) error {
+	switch st.kind {
+	case txnBufferEdit:
+		st.buf.ApplyUndo()
+		st.buf.RecomputeDirty()
+		e.refreshBufferTab(st.buf)
+		return nil
+
+	case txnFileEdit:
+		return writeFileKeepMode(st.path, st.before)
+
+	case txnCreate:
+		if st.existed {
+			return writeFileKeepMode(st.path, st.before)
+		}
+		return os.Remove(st.path)
+
+	case txnRename:
+		if err := os.Rename(st.newPath, st.path); err != nil {
+			return err
+		}
+		e.retargetBuffers(st.newPath, st.path)
+		if st.existed {
+			return os.WriteFile(st.newPath, st.before, 0644)
+		}
+		return nil
+
+	case txnDelete:
+		// Parents sort before their children
+		files := make([]savedFile, len(st.files))
+		copy(files, st.files)
+		sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+		for _, f := range files {
+			var err error
+			if f.mode.IsDir() {
+				err = os.MkdirAll(f.path, f.mode.Perm())
+			} else {
+				err = os.WriteFile(f.path, f.data, f.mode.Perm())
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+func writeFileKeepMode(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return os.WriteFile(path, data, mode)
+}
+
+// snapshotTree reads everything under path so a delete can be reverted.
+func snapshotTree(path string) ([]savedFile, error) {
+	var files []savedFile
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil // symlinks and devices can't be restored from a snapshot
+		}
+		f := savedFile{path: p, mode: info.Mode()}
+		if info.Mode().IsRegular() {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			f.data = data
+		}
+		files = append(files, f)
+		return nil
+	})
+	return files, err
+}
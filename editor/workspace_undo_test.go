@@ -0,0 +1,130 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"editor/buffer"
+	"editor/config"
+	"editor/lsp"
+	"editor/ui"
+)
+
+func newWorkspaceTestEditor(t *testing.T) (*Editor, string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	wd := t.TempDir()
+
+	e := New(config.Default())
+	e.tabBar = ui.NewTabBar()
+	e.statusBar = ui.NewStatusBar()
+	e.watchedRoot = wd
+	return e, wd
+}
+
+func textChange(path string, line, start, end int, newText string) workspaceChange {
+	return workspaceChange{Path: path, Edit: lsp.TextEdit{
+		Range: lsp.Range{
+			Start: lsp.Position{Line: line, Character: start},
+			End:   lsp.Position{Line: line, Character: end},
+		},
+		NewText: newText,
+	}}
+}
+
+func TestUndoWorkspaceEditRevertsOpenAndClosedFiles(t *testing.T) {
+	e, wd := newWorkspaceTestEditor(t)
+
+	openPath := filepath.Join(wd, "open.go")
+	b := buffer.NewBuffer(4)
+	b.Path = openPath
+	b.SetLines([]string{"x := old()"})
+	b.MarkSaved()
+	e.buffers = []*buffer.Buffer{b}
+	e.tabBar.AddTab(openPath, false)
+	e.activeTab = 0
+
+	closedPath := filepath.Join(wd, "closed.go")
+	original := "func old() {}\r\n"
+	if err := os.WriteFile(closedPath, []byte(original), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	applied, errs := e.applyWorkspaceChanges("Rename", []workspaceChange{
+		textChange(closedPath, 0, 5, 8, "fresh"),
+		textChange(openPath, 0, 5, 8, "fresh"),
+	})
+	if applied != 2 || len(errs) != 0 {
+		t.Fatalf("expected 2 applied changes, got %d (errs %v)", applied, errs)
+	}
+	if b.Line(0) != "x := fresh()" {
+		t.Fatalf("open buffer not edited: %q", b.Line(0))
+	}
+	data, _ := os.ReadFile(closedPath)
+	if string(data) != "func fresh() {}\r\n" {
+		t.Fatalf("closed file not edited on disk (line endings must be kept): %q", data)
+	}
+	if len(e.buffers) != 1 {
+		t.Fatalf("closed file should not be opened in a tab")
+	}
+
+	e.undoWorkspaceEdit()
+	if b.Line(0) != "x := old()" || b.Dirty {
+		t.Fatalf("open buffer not reverted: %q dirty=%v", b.Line(0), b.Dirty)
+	}
+	data, _ = os.ReadFile(closedPath)
+	if string(data) != original {
+		t.Fatalf("closed file not reverted: %q", data)
+	}
+	if len(e.workspaceTxns) != 0 {
+		t.Fatalf("expected transaction to be consumed")
+	}
+}
+
+func TestUndoWorkspaceEditRefusesWhenFileChangedSince(t *testing.T) {
+	e, wd := newWorkspaceTestEditor(t)
+
+	path := filepath.Join(wd, "a.txt")
+	if err := os.WriteFile(path, []byte("alpha\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	e.applyWorkspaceChanges("Replace", []workspaceChange{textChange(path, 0, 0, 5, "beta")})
+
+	if err := os.WriteFile(path, []byte("gamma\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	e.undoWorkspaceEdit()
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "gamma\n" {
+		t.Fatalf("undo must not overwrite a file changed since the edit, got %q", data)
+	}
+	if len(e.workspaceTxns) != 1 {
+		t.Fatalf("expected transaction to stay on the stack after a refused undo")
+	}
+}
+
+func TestApplyEditsOnDiskKeepsMixedLineEndings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mixed.txt")
+	const content = "\uFEFFget(a)\r\nkeep\nget(b)\r\nlast\n\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	edits := []buffer.TextEdit{
+		{Start: buffer.Cursor{Line: 0, Col: 0}, End: buffer.Cursor{Line: 0, Col: 3}, NewText: "fetch"},
+		{Start: buffer.Cursor{Line: 2, Col: 0}, End: buffer.Cursor{Line: 2, Col: 3}, NewText: "fetch"},
+	}
+	before, after, err := applyEditsOnDisk(path, edits)
+	if err != nil {
+		t.Fatalf("applyEditsOnDisk: %v", err)
+	}
+	if string(before) != content {
+		t.Fatalf("before = %q", before)
+	}
+	const want = "\uFEFFfetch(a)\r\nkeep\nfetch(b)\r\nlast\n\n"
+	data, _ := os.ReadFile(path)
+	if string(after) != want || string(data) != want {
+		t.Fatalf("after = %q, on disk %q, want %q", after, data, want)
+	}
+}
@@ -19,6 +19,13 @@ type StyledLine struct {
 	Tokens []Token
 }
 
+// ContextLines is how many lines before the requested range are tokenized
+// so that multi-line constructs are styled correctly.
+const ContextLines = 50
+
+// maxCacheEntries bounds the cache; it is simply reset once full.
+const maxCacheEntries = 512
+
 type Highlighter struct {
 	cache map[string][]StyledLine
 }
@@ -54,7 +61,7 @@ func (h *Highlighter) HighlightLines(code string, lang string, startLine, endLin
 	lexer = chroma.Coalesce(lexer)
 
 	// Tokenize the subset of lines we need with a bit of context
-	contextStart := startLine - 50
+	contextStart := startLine - ContextLines
 	if contextStart < 0 {
 		contextStart = 0
 	}
@@ -109,6 +116,9 @@ func (h *Highlighter) HighlightLines(code string, lang string, startLine, endLin
 	}
 	result := styledLines[offset:end]
 
+	if len(h.cache) >= maxCacheEntries {
+		h.cache = make(map[string][]StyledLine)
+	}
 	h.cache[key] = result
 	return result
 }
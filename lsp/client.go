@@ -17,7 +17,7 @@ type Client struct {
 	stdout  *bufio.Reader
 	mu      sync.Mutex
 	nextID  int
-	pending map[int]chan json.RawMessage
+	pending map[int]chan Response
 
 	// OnDiagnostics is called when the server publishes diagnostics.
 	OnDiagnostics func(params PublishDiagnosticsParams)
@@ -46,7 +46,7 @@ func NewClient(command string, args ...string) (*Client, error) {
 		stdin:   stdin,
 		stdout:  bufio.NewReader(stdout),
 		nextID:  1,
-		pending: make(map[int]chan json.RawMessage),
+		pending: make(map[int]chan Response),
 	}
 
 	go c.readLoop()
@@ -94,7 +94,7 @@ func (c *Client) readLoop() {
 			}
 			c.mu.Unlock()
 			if ok {
-				ch <- msg.Result
+				ch <- msg
 			}
 		} else if msg.Method != "" {
 			// Server notification
@@ -119,7 +119,7 @@ func (c *Client) sendRequest(method string, params interface{}) (json.RawMessage
 	c.mu.Lock()
 	id := c.nextID
 	c.nextID++
-	ch := make(chan json.RawMessage, 1)
+	ch := make(chan Response, 1)
 	c.pending[id] = ch
 	c.mu.Unlock()
 
@@ -137,8 +137,11 @@ func (c *Client) sendRequest(method string, params interface{}) (json.RawMessage
 		return nil, err
 	}
 
-	result := <-ch
-	return result, nil
+	resp := <-ch
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.Result, nil
 }
 
 func (c *Client) sendNotification(method string, params interface{}) error {
@@ -2,7 +2,7 @@ package lsp
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -38,6 +38,7 @@ var languageIDs = map[string]string{
 type Manager struct {
 	clients     map[string]*Client   // language -> client
 	diagnostics map[string][]Diagnostic // URI -> diagnostics
+	versions    map[string]int          // URI -> last version sent to the server
 	rootURI     string
 }
 
@@ -45,6 +46,7 @@ func NewManager(workDir string) *Manager {
 	return &Manager{
 		clients:     make(map[string]*Client),
 		diagnostics: make(map[string][]Diagnostic),
+		versions:    make(map[string]int),
 		rootURI:     FileURI(workDir),
 	}
 }
@@ -99,10 +101,19 @@ func (m *Manager) EnsureServer(language string) *Client {
 					},
 				},
 				"hover": map[string]interface{}{
-					"contentFormat": []string{"plaintext"},
+					"contentFormat": []string{"markdown", "plaintext"},
+				},
+				"rename": map[string]interface{}{
+					"prepareSupport": true,
 				},
 				"publishDiagnostics": map[string]interface{}{},
 			},
+			"workspace": map[string]interface{}{
+				"workspaceEdit": map[string]interface{}{
+					"documentChanges":    true,
+					"resourceOperations": []string{"create", "rename", "delete"},
+				},
+			},
 		},
 	}
 
@@ -138,10 +149,12 @@ func (m *Manager) DidOpen(language, path, content string) {
 			Text:       content,
 		},
 	})
+	m.versions[FileURI(path)] = 1
 }
 
 // DidChange notifies servers of a full document change.
 func (m *Manager) DidChange(path, content string, version int) {
+	m.versions[FileURI(path)] = version
 	for _, client := range m.clients {
 		client.sendNotification("textDocument/didChange", map[string]interface{}{
 			"textDocument": map[string]interface{}{
@@ -189,7 +202,7 @@ func (m *Manager) Completion(language, path string, line, col int) []CompletionI
 	return items
 }
 
-// Hover gets hover info at the given position.
+// Hover gets hover info at the given position as markdown.
 func (m *Manager) Hover(language, path string, line, col int) string {
 	client := m.EnsureServer(language)
 	if client == nil {
@@ -208,18 +221,50 @@ func (m *Manager) Hover(language, path string, line, col int) string {
 	if err := json.Unmarshal(result, &hover); err != nil {
 		return ""
 	}
+	return strings.TrimSpace(hoverMarkdown(hover.Contents))
+}
 
-	switch v := hover.Contents.(type) {
+// hoverMarkdown flattens the three shapes hover contents can take
+// (MarkupContent, MarkedString and MarkedString[]) into one markdown string.
+func hoverMarkdown(contents interface{}) string {
+	switch v := contents.(type) {
 	case string:
 		return v
 	case map[string]interface{}:
-		if val, ok := v["value"]; ok {
-			return fmt.Sprintf("%v", val)
+		value, _ := v["value"].(string)
+		if lang, ok := v["language"].(string); ok {
+			// MarkedString with a language is a code block
+			return "```" + lang + "\n" + value + "\n```"
 		}
+		if kind, _ := v["kind"].(string); kind == "plaintext" {
+			return escapeMarkdown(value)
+		}
+		return value
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			if part := hoverMarkdown(item); strings.TrimSpace(part) != "" {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, "\n\n---\n\n")
 	}
 	return ""
 }
 
+// escapeMarkdown keeps plaintext hover from being interpreted as markdown.
+func escapeMarkdown(s string) string {
+	var b strings.Builder
+	for _, ch := range s {
+		switch ch {
+		case '\\', '`', '*', '_', '#', '[', ']':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
+
 // Definition goes to the definition of the symbol at the given position.
 func (m *Manager) Definition(language, path string, line, col int) *Location {
 	client := m.EnsureServer(language)
@@ -271,6 +316,50 @@ func (m *Manager) Rename(language, path string, line, col int, newName string) *
 	return &edit
 }
 
+// PrepareRename checks that the symbol at the given position can be renamed.
+// It returns the symbol's range and the server's suggested placeholder when
+// the server provides them. Servers without prepareRename accept any position.
+func (m *Manager) PrepareRename(language, path string, line, col int) (*Range, string, error) {
+	client := m.EnsureServer(language)
+	if client == nil {
+		return nil, "", nil
+	}
+
+	result, err := client.sendRequest("textDocument/prepareRename", TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: FileURI(path)},
+		Position:     Position{Line: line, Character: col},
+	})
+	if rerr, ok := err.(*ResponseError); ok && rerr.Code == ErrMethodNotFound {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(result) == 0 || string(result) == "null" {
+		return nil, "", errors.New("symbol cannot be renamed")
+	}
+
+	// Result is a Range, {range, placeholder} or {defaultBehavior}
+	var withPlaceholder struct {
+		Range       *Range `json:"range"`
+		Placeholder string `json:"placeholder"`
+	}
+	if err := json.Unmarshal(result, &withPlaceholder); err == nil && withPlaceholder.Range != nil {
+		return withPlaceholder.Range, withPlaceholder.Placeholder, nil
+	}
+	var rng Range
+	if err := json.Unmarshal(result, &rng); err == nil && rng != (Range{}) {
+		return &rng, "", nil
+	}
+	return nil, "", nil
+}
+
+// DocumentVersion returns the version the server last saw for an open
+// document, or 0 if the document was never opened.
+func (m *Manager) DocumentVersion(path string) int {
+	return m.versions[FileURI(path)]
+}
+
 // GetDiagnostics returns diagnostics for a file.
 func (m *Manager) GetDiagnostics(path string) []Diagnostic {
 	return m.diagnostics[FileURI(path)]
@@ -24,6 +24,11 @@ type ResponseError struct {
 	Message string `json:"message"`
 }
 
+func (e *ResponseError) Error() string { return e.Message }
+
+// ErrMethodNotFound is the JSON-RPC code for requests a server doesn't implement.
+const ErrMethodNotFound = -32601
+
 // LSP Position and Range
 type Position struct {
 	Line      int `json:"line"`
@@ -94,9 +99,45 @@ type MarkupContent struct {
 	Value string `json:"value"`
 }
 
-// WorkspaceEdit represents changes to apply across files
+// WorkspaceEdit represents changes to apply across files. Servers send
+// either Changes or, when the client supports it, DocumentChanges.
 type WorkspaceEdit struct {
-	Changes map[string][]TextEdit `json:"changes"`
+	Changes         map[string][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []DocumentChange      `json:"documentChanges,omitempty"`
+}
+
+// Empty reports whether the edit has nothing to apply.
+func (w *WorkspaceEdit) Empty() bool {
+	return len(w.Changes) == 0 && len(w.DocumentChanges) == 0
+}
+
+// DocumentChange is one entry of WorkspaceEdit.DocumentChanges: either a
+// TextDocumentEdit (TextDocument and Edits set) or a file operation (Kind is
+// "create", "rename" or "delete").
+type DocumentChange struct {
+	TextDocument *VersionedTextDocumentIdentifier `json:"textDocument,omitempty"`
+	Edits        []TextEdit                       `json:"edits,omitempty"`
+
+	Kind    string                `json:"kind,omitempty"`
+	URI     string                `json:"uri,omitempty"`
+	OldURI  string                `json:"oldUri,omitempty"`
+	NewURI  string                `json:"newUri,omitempty"`
+	Options *FileOperationOptions `json:"options,omitempty"`
+}
+
+// VersionedTextDocumentIdentifier pins a text edit to a document version.
+// Version is nil when the edit applies to whatever is on disk.
+type VersionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version *int   `json:"version"`
+}
+
+// FileOperationOptions covers the options of create, rename and delete.
+type FileOperationOptions struct {
+	Overwrite         bool `json:"overwrite,omitempty"`
+	IgnoreIfExists    bool `json:"ignoreIfExists,omitempty"`
+	Recursive         bool `json:"recursive,omitempty"`
+	IgnoreIfNotExists bool `json:"ignoreIfNotExists,omitempty"`
 }
 
 type TextEdit struct {
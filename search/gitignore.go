@@ -0,0 +1,110 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one pattern line of a .gitignore file.
+type ignoreRule struct {
+	re       *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	anchored bool // the pattern contains a slash, so it matches from its directory
+}
+
+// gitignore evaluates the .gitignore files of a tree. Rules are loaded per
+// directory on first use; deeper files take precedence, as in git.
+type gitignore struct {
+	root  string
+	rules map[string][]ignoreRule // keyed by slash-separated directory, "" for root
+}
+
+func newGitignore(root string) *gitignore {
+	g := &gitignore{root: root, rules: make(map[string][]ignoreRule)}
+	rules := parseGitignore(filepath.Join(root, ".git", "info", "exclude"))
+	g.rules[""] = append(rules, parseGitignore(filepath.Join(root, ".gitignore"))...)
+	return g
+}
+
+func (g *gitignore) dirRules(dir string) []ignoreRule {
+	rules, ok := g.rules[dir]
+	if !ok {
+		rules = parseGitignore(filepath.Join(g.root, filepath.FromSlash(dir), ".gitignore"))
+		g.rules[dir] = rules
+	}
+	return rules
+}
+
+// ignored reports whether rel, a slash-separated path relative to the root,
+// is excluded. Parents are expected to have been checked already, as a walk
+// that skips ignored directories does.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	ignored := false
+	dir := ""
+	for {
+		sub := rel
+		if dir != "" {
+			sub = strings.TrimPrefix(rel, dir+"/")
+		}
+		for _, r := range g.dirRules(dir) {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			target := sub
+			if !r.anchored {
+				target = sub[strings.LastIndex(sub, "/")+1:]
+			}
+			if r.re.MatchString(target) {
+				ignored = !r.negate
+			}
+		}
+		i := strings.Index(sub, "/")
+		if i < 0 {
+			return ignored
+		}
+		if dir == "" {
+			dir = sub[:i]
+		} else {
+			dir += "/" + sub[:i]
+		}
+	}
+}
+
+func parseGitignore(path string) []ignoreRule {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var rules []ignoreRule
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			r.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if r.re = globRegexp(line); r.re != nil {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,448 @@
+// Package search finds and replaces text across the files of a project.
+package search
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxFileSize skips files too large to be worth searching line by line.
+const maxFileSize = 8 << 20
+
+// ignoredDirs are never descended into, matching the quick open file list.
+var ignoredDirs = map[string]bool{
+	".git": true, "node_modules": true, ".next": true,
+	"__pycache__": true, "vendor": true, "dist": true, "build": true,
+	".idea": true, ".vscode": true, "target": true,
+}
+
+// Options describes what to look for and where.
+type Options struct {
+	Query         string
+	Regex         bool // Query is a regular expression; otherwise it's literal text
+	CaseSensitive bool
+	WholeWord     bool
+	Include       []string // globs; when set, a file must match one of them
+	Exclude       []string // globs; matching files and directories are skipped
+}
+
+// Match is one occurrence of the query on a line.
+type Match struct {
+	Path   string // relative to the search root
+	Line   int    // 0-based
+	Col    int    // rune column where the match starts
+	EndCol int    // rune column just past the match
+	Text   string // the whole line
+
+	groups []int // byte offsets of the match and its capture groups in Text
+}
+
+// Query is a compiled search.
+type Query struct {
+	opts Options
+	re   *regexp.Regexp
+}
+
+// Compile validates opts and builds the matcher.
+func Compile(opts Options) (*Query, error) {
+	pattern := opts.Query
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.WholeWord {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if !opts.CaseSensitive {
+		pattern = `(?i)` + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &Query{opts: opts, re: re}, nil
+}
+
+// FindInLines returns every non-empty match in lines.
+func (q *Query) FindInLines(path string, lines []string) []Match {
+	var matches []Match
+	for i, line := range lines {
+		for _, loc := range q.re.FindAllStringSubmatchIndex(line, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			col := utf8.RuneCountInString(line[:loc[0]])
+			matches = append(matches, Match{
+				Path:   path,
+				Line:   i,
+				Col:    col,
+				EndCol: col + utf8.RuneCountInString(line[loc[0]:loc[1]]),
+				Text:   line,
+				groups: loc,
+			})
+		}
+	}
+	return matches
+}
+
+// Replacement returns the text that replaces m. In regex mode the template
+// may refer to capture groups as $1 or ${name}; otherwise it is literal.
+func (q *Query) Replacement(m Match, template string) string {
+	if !q.opts.Regex || m.groups == nil {
+		return template
+	}
+	return string(q.re.ExpandString(nil, template, m.Text, m.groups))
+}
+
+// Search looks through the files under root and returns the matches sorted
+// by path and position. Files for which open returns lines are searched in
+// that text instead of their contents on disk, so unsaved edits are found;
+// open may be nil and is called from several goroutines. At most limit
+// matches are returned; truncated reports whether more were left.
+func (q *Query) Search(root string, open func(path string) ([]string, bool), limit int) (matches []Match, truncated bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Stream(ctx, root, open, func(found []Match) {
+		matches = append(matches, found...)
+		if limit > 0 && len(matches) > limit {
+			truncated = true
+			cancel()
+		}
+	})
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	if truncated {
+		matches = matches[:limit]
+	}
+	return matches, truncated
+}
+
+// Stream searches the files under root concurrently and calls emit with the
+// matches of each file as soon as it has been searched, in no particular
+// order. emit is only called from the calling goroutine. Cancelling ctx
+// stops the search; Stream returns once every worker has finished.
+func (q *Query) Stream(ctx context.Context, root string, open func(path string) ([]string, bool), emit func([]Match)) error {
+	paths := make(chan string, 256)
+	found := make(chan []Match, 64)
+
+	go func() {
+		defer close(paths)
+		walkFiles(ctx, root, q.opts.Include, q.opts.Exclude, func(rel string) {
+			select {
+			case paths <- rel:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range paths {
+				if ctx.Err() != nil {
+					continue // drain so the walker can exit
+				}
+				path := filepath.Join(root, filepath.FromSlash(rel))
+				var lines []string
+				ok := false
+				if open != nil {
+					lines, ok = open(path)
+				}
+				if !ok {
+					if lines, ok = readLines(path); !ok {
+						continue
+					}
+				}
+				if matches := q.FindInLines(rel, lines); len(matches) > 0 {
+					select {
+					case found <- matches:
+					case <-ctx.Done():
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	for matches := range found {
+		if ctx.Err() == nil {
+			emit(matches)
+		}
+	}
+	return ctx.Err()
+}
+
+// StreamBatches runs Stream and calls emit with the matches found every
+// interval, so a list can fill in while the search continues. Once limit
+// matches are found, if limit > 0, the search stops and truncated is set.
+// The last call has done set, and comes even if ctx is cancelled. emit is
+// only called from the calling goroutine.
+func (q *Query) StreamBatches(ctx context.Context, root string, open func(path string) ([]string, bool), interval time.Duration, limit int, emit func(matches []Match, done, truncated bool)) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	found := make(chan []Match, 16)
+	go func() {
+		defer close(found)
+		q.Stream(ctx, root, open, func(matches []Match) {
+			select {
+			case found <- matches:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	var pending []Match
+	total := 0
+	truncated := false
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case matches, ok := <-found:
+			if !ok {
+				emit(pending, true, truncated)
+				return
+			}
+			if truncated {
+				continue // drain what was found before the search stopped
+			}
+			if limit > 0 && total+len(matches) > limit {
+				matches = matches[:limit-total]
+				truncated = true
+				cancel()
+			}
+			pending = append(pending, matches...)
+			total += len(matches)
+		case <-ticker.C:
+			if len(pending) > 0 {
+				emit(pending, false, truncated)
+				pending = nil
+			}
+		}
+	}
+}
+
+// Files lists the files under root, relative to it and sorted, that pass the
+// include and exclude globs and aren't ignored by git.
+func Files(root string, include, exclude []string) []string {
+	var files []string
+	walkFiles(context.Background(), root, include, exclude, func(rel string) {
+		files = append(files, rel)
+	})
+	sort.Strings(files)
+	return files
+}
+
+// walkFiles calls fn with the slash-separated relative path of every file
+// worth searching under root. Hidden entries, well-known dependency and
+// build directories, paths matched by .gitignore and files that are too
+// large are skipped.
+func walkFiles(ctx context.Context, root string, include, exclude []string, fn func(rel string)) {
+	ignore := newGitignore(root)
+	includes, excludes := compileGlobs(include), compileGlobs(exclude)
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		if err != nil || path == root {
+			return nil
+		}
+		base := filepath.Base(path)
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if ignoredDirs[base] || strings.HasPrefix(base, ".") || matchGlobs(excludes, rel) || ignore.ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(base, ".") || !info.Mode().IsRegular() || info.Size() > maxFileSize {
+			return nil
+		}
+		if matchGlobs(excludes, rel) || ignore.ignored(rel, false) {
+			return nil
+		}
+		if len(includes) > 0 && !matchGlobs(includes, rel) {
+			return nil
+		}
+		fn(rel)
+		return nil
+	})
+}
+
+// readLines loads a text file the way the editor would show it. Binary and
+// non-UTF-8 files are skipped.
+func readLines(path string) ([]string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	head := data
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	if bytes.IndexByte(head, 0) >= 0 || !utf8.Valid(data) {
+		return nil, false
+	}
+	text := strings.TrimPrefix(string(data), "\uFEFF")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(text, "\n"), true
+}
+
+// SplitGlobs parses a comma-separated list such as "*.go, docs/**". Commas
+// inside braces belong to the pattern: "*.{js,ts}" is one glob.
+func SplitGlobs(s string) []string {
+	var globs []string
+	depth, start := 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch s[i] {
+			case '{':
+				depth++
+				continue
+			case '}':
+				if depth > 0 {
+					depth--
+				}
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if g := strings.TrimSpace(s[start:i]); g != "" {
+			globs = append(globs, g)
+		}
+		start = i + 1
+	}
+	return globs
+}
+
+// MatchGlobs reports whether the slash-separated relative path matches any
+// of the patterns. A pattern without a slash matches any single path element,
+// so "*.go" selects Go files anywhere and "testdata" a directory anywhere.
+// Patterns with a slash match from the root, where "**" spans directories.
+func MatchGlobs(patterns []string, rel string) bool {
+	return matchGlobs(compileGlobs(patterns), rel)
+}
+
+type glob struct {
+	re       *regexp.Regexp
+	fullPath bool // the pattern has a slash and matches the whole path
+}
+
+func compileGlobs(patterns []string) []glob {
+	var globs []glob
+	for _, p := range patterns {
+		p = strings.TrimSuffix(strings.TrimPrefix(p, "./"), "/")
+		if p == "" {
+			continue
+		}
+		if re := globRegexp(p); re != nil {
+			globs = append(globs, glob{re: re, fullPath: strings.Contains(p, "/")})
+		}
+	}
+	return globs
+}
+
+func matchGlobs(globs []glob, rel string) bool {
+	for _, g := range globs {
+		if g.fullPath {
+			if g.re.MatchString(rel) {
+				return true
+			}
+			continue
+		}
+		for _, elem := range strings.Split(rel, "/") {
+			if g.re.MatchString(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// globRegexp translates a glob with *, **, ?, [a-z] and {a,b} into an anchored
+// regular expression.
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	inBrace := false
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			i++
+			if i+1 < len(glob) && glob[i+1] == '/' {
+				// "**/" also matches no directory at all
+				i++
+				b.WriteString("(?:.*/)?")
+			} else {
+				b.WriteString(".*")
+			}
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			i += end + 1
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+		case c == '{':
+			inBrace = true
+			b.WriteString("(?:")
+		case c == '}' && inBrace:
+			inBrace = false
+			b.WriteString(")")
+		case c == ',' && inBrace:
+			b.WriteString("|")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil
+	}
+	return re
+}
@@ -0,0 +1,167 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReplacementExpandsCaptureGroups(t *testing.T) {
+	q, err := Compile(Options{Query: `(\w+)\.Get\((\w+)\)`, Regex: true, CaseSensitive: true})
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	matches := q.FindInLines("a.go", []string{"x := cache.Get(key) // ünïcode"})
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	m := matches[0]
+	if m.Col != 5 || m.EndCol != 19 {
+		t.Fatalf("unexpected match columns %d-%d", m.Col, m.EndCol)
+	}
+	if got := q.Replacement(m, "${1}[$2]"); got != "cache[key]" {
+		t.Fatalf("unexpected replacement %q", got)
+	}
+}
+
+func TestLiteralWholeWordAndCase(t *testing.T) {
+	q, _ := Compile(Options{Query: "a.b", WholeWord: true})
+	matches := q.FindInLines("f", []string{"A.B axb a.bc a.b"})
+	if len(matches) != 2 || matches[0].Col != 0 || matches[1].Col != 13 {
+		t.Fatalf("unexpected matches %+v", matches)
+	}
+	if got := q.Replacement(matches[0], "$1"); got != "$1" {
+		t.Fatalf("literal mode must not expand templates, got %q", got)
+	}
+
+	q, _ = Compile(Options{Query: "a.b", CaseSensitive: true})
+	if n := len(q.FindInLines("f", []string{"A.B a.b"})); n != 1 {
+		t.Fatalf("expected case-sensitive search to find 1 match, got %d", n)
+	}
+}
+
+func TestGlobs(t *testing.T) {
+	if got := SplitGlobs("*.go, src/**/*.{js,ts} ,"); !reflect.DeepEqual(got, []string{"*.go", "src/**/*.{js,ts}"}) {
+		t.Fatalf("unexpected split %q", got)
+	}
+	cases := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.go", "pkg/a.go", true},
+		{"*.go", "pkg/a.gox", false},
+		{"testdata", "pkg/testdata/x.txt", true},
+		{"src/**/*.ts", "src/a.ts", true},
+		{"src/**/*.ts", "src/x/y/a.ts", true},
+		{"src/*.ts", "src/x/a.ts", false},
+		{"*.{js,ts}", "a.ts", true},
+	}
+	for _, c := range cases {
+		if got := MatchGlobs([]string{c.pattern}, c.path); got != c.want {
+			t.Errorf("MatchGlobs(%q, %q) = %v, want %v", c.pattern, c.path, got, c.want)
+		}
+	}
+}
+
+func TestSearchUsesOpenBuffersAndGlobs(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, data string) {
+		path := filepath.Join(root, rel)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	write("a.go", "needle\r\n")
+	write("b.txt", "needle\n")
+	write("skip/c.go", "needle\n")
+	write("bin.go", "needle\x00")
+	write("open.go", "nothing here\n")
+
+	q, _ := Compile(Options{Query: "needle", Include: []string{"*.go"}, Exclude: []string{"skip"}})
+	open := func(path string) ([]string, bool) {
+		if filepath.Base(path) == "open.go" {
+			return []string{"unsaved needle"}, true
+		}
+		return nil, false
+	}
+	matches, truncated := q.Search(root, open, 0)
+	if truncated {
+		t.Fatalf("unexpected truncation")
+	}
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.Path+":"+m.Text)
+	}
+	want := []string{"a.go:needle", "open.go:unsaved needle"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestFilesRespectsGitignore(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, data string) {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	write(".gitignore", "# comment\n*.log\n!keep.log\nout/\n/top.txt\n")
+	write("a.log", "")
+	write("keep.log", "")
+	write("out/x.go", "")
+	write("top.txt", "")
+	write("sub/top.txt", "")
+	write("sub/.gitignore", "secret.txt\n")
+	write("sub/secret.txt", "")
+	write("other/secret.txt", "")
+
+	got := Files(root, nil, nil)
+	want := []string{"keep.log", "other/secret.txt", "sub/top.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestStreamStopsWhenCancelled(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 50; i++ {
+		os.WriteFile(filepath.Join(root, fmt.Sprintf("f%02d.txt", i)), []byte("hit\n"), 0o644)
+	}
+	q, _ := Compile(Options{Query: "hit"})
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := q.Stream(ctx, root, nil, func([]Match) {
+		calls++
+		cancel()
+	})
+	if err != context.Canceled || calls != 1 {
+		t.Fatalf("expected one batch before cancellation, got %d (err %v)", calls, err)
+	}
+}
+
+func TestStreamBatchesStopsAtLimit(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 50; i++ {
+		os.WriteFile(filepath.Join(root, fmt.Sprintf("f%02d.txt", i)), []byte("hit\nhit\n"), 0o644)
+	}
+	q, _ := Compile(Options{Query: "hit"})
+	total, dones := 0, 0
+	truncated := false
+	q.StreamBatches(context.Background(), root, nil, time.Millisecond, 25, func(matches []Match, done, trunc bool) {
+		total += len(matches)
+		if done {
+			dones++
+			truncated = trunc
+		}
+	})
+	if total != 25 || dones != 1 || !truncated {
+		t.Fatalf("got %d matches, %d final batches, truncated %v", total, dones, truncated)
+	}
+}
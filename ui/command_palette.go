@@ -1,14 +1,15 @@
 package ui
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	"editor/config"
+	"editor/search"
 
 	"github.com/gdamore/tcell/v2"
 )
@@ -47,6 +48,12 @@ type CommandPalette struct {
 	scrollOff     int
 	workDir       string // Working directory for search
 	isSearchMode  bool   // True when input starts with %
+
+	// Post delivers SearchResultsEvents to the event loop (screen.PostEventWait)
+	Post         func(ev tcell.Event)
+	searchGen    int
+	searchCancel context.CancelFunc
+	searching    bool
 }
 
 func NewCommandPalette(commands []Command, theme *config.ColorScheme) *CommandPalette {
@@ -80,6 +87,7 @@ func (cp *CommandPalette) updateFilter() {
 
 	// Regular command palette mode
 	cp.isSearchMode = false
+	cp.cancelSearch()
 	cp.SearchResults = nil
 
 	if cp.Input == "" {
@@ -117,112 +125,99 @@ func (cp *CommandPalette) updateFilter() {
 	cp.scrollOff = 0
 }
 
+// maxPaletteResults stops a project search once the list is long enough.
+const maxPaletteResults = 1000
+
+// SearchResultsEvent delivers a batch of project search results from the
+// background search to the main event loop.
+type SearchResultsEvent struct {
+	tcell.EventTime
+	Results []SearchResult
+	Done    bool
+
+	palette *CommandPalette
+	gen     int
+	cancel  context.CancelFunc
+}
+
+// Cancel stops the search that produced the event, e.g. because the palette
+// was closed.
+func (ev *SearchResultsEvent) Cancel() {
+	ev.cancel()
+}
+
+// performSearch starts a background search for query and cancels the one
+// for the previous query. Results arrive as SearchResultsEvents posted
+// through cp.Post and are added by HandleSearchEvent.
 func (cp *CommandPalette) performSearch(query string) {
+	cp.cancelSearch()
 	cp.SearchResults = nil
 
-	if cp.workDir == "" {
+	if cp.workDir == "" || cp.Post == nil {
 		return
 	}
 
-	// Try ripgrep first, fall back to grep
-	cmd := exec.Command("rg", "--line-number", "--column", "--no-heading", "--color=never", "-i", query)
-	cmd.Dir = cp.workDir
-
-	output, err := cmd.Output()
+	// Queries are regular expressions like rg's; a half-typed one such as
+	// "foo(" is searched literally instead of failing.
+	q, err := search.Compile(search.Options{Query: query, Regex: true})
 	if err != nil {
-		// Try fallback to grep if rg not found
-		cmd = exec.Command("grep", "-rni", "--with-filename", "--line-number", query, ".")
-		cmd.Dir = cp.workDir
-		output, err = cmd.Output()
-		if err != nil {
-			// No matches or grep failed
-			return
-		}
-		
-		// Parse grep output (format: filepath:line:text)
-		lines := strings.Split(string(output), "\n")
-		results := make([]SearchResult, 0, len(lines))
-
-		for _, line := range lines {
-			if line == "" {
-				continue
-			}
-
-			// Format: path:line:text
-			parts := strings.SplitN(line, ":", 3)
-			if len(parts) < 3 {
-				continue
-			}
+		q, _ = search.Compile(search.Options{Query: query})
+	}
 
-			lineNum, err := strconv.Atoi(parts[1])
-			if err != nil {
-				continue
-			}
+	ctx, cancel := context.WithCancel(context.Background())
+	cp.searchGen++
+	cp.searchCancel = cancel
+	cp.searching = true
+	go streamSearch(ctx, cancel, q, cp.workDir, cp.Post, &SearchResultsEvent{palette: cp, gen: cp.searchGen, cancel: cancel})
+}
 
-			text := parts[2]
-			text = strings.TrimSpace(text)
-			if len(text) > 100 {
-				text = text[:100] + "..."
+// streamSearch runs q and posts results in batches every 50ms so the list
+// fills in while the search continues.
+func streamSearch(ctx context.Context, cancel context.CancelFunc, q *search.Query, root string, post func(tcell.Event), proto *SearchResultsEvent) {
+	defer cancel()
+	q.StreamBatches(ctx, root, nil, 50*time.Millisecond, maxPaletteResults, func(matches []search.Match, done, truncated bool) {
+		results := make([]SearchResult, 0, len(matches))
+		for _, m := range matches {
+			text := strings.TrimSpace(m.Text)
+			if r := []rune(text); len(r) > 100 {
+				text = string(r[:100]) + "..."
 			}
-
 			results = append(results, SearchResult{
-				Path:    parts[0],
-				Line:    lineNum,
-				Col:     1,
+				Path:    m.Path,
+				Line:    m.Line + 1,
+				Col:     m.Col + 1,
 				Text:    text,
 				Preview: text,
 			})
-
-			if len(results) >= 1000 {
-				break
-			}
 		}
+		ev := *proto
+		ev.Results = results
+		ev.Done = done
+		ev.SetEventNow()
+		post(&ev)
+	})
+}
 
-		cp.SearchResults = results
-		return
+// HandleSearchEvent adds a batch of results from the current search. It
+// returns false for events of an earlier query or another palette.
+func (cp *CommandPalette) HandleSearchEvent(ev *SearchResultsEvent) bool {
+	if ev.palette != cp || ev.gen != cp.searchGen {
+		return false
 	}
-
-	// Parse ripgrep output (format: path:line:col:text)
-	lines := strings.Split(string(output), "\n")
-	results := make([]SearchResult, 0, len(lines))
-
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-
-		// Format: path:line:col:text
-		parts := strings.SplitN(line, ":", 4)
-		if len(parts) < 4 {
-			continue
-		}
-
-		lineNum, err1 := strconv.Atoi(parts[1])
-		colNum, err2 := strconv.Atoi(parts[2])
-		if err1 != nil || err2 != nil {
-			continue
-		}
-
-		text := parts[3]
-		text = strings.TrimSpace(text)
-		if len(text) > 100 {
-			text = text[:100] + "..."
-		}
-
-		results = append(results, SearchResult{
-			Path:    parts[0],
-			Line:    lineNum,
-			Col:     colNum,
-			Text:    text,
-			Preview: text,
-		})
-
-		if len(results) >= 1000 {
-			break
-		}
+	cp.SearchResults = append(cp.SearchResults, ev.Results...)
+	if ev.Done {
+		cp.searching = false
+		cp.searchCancel = nil
 	}
+	return true
+}
 
-	cp.SearchResults = results
+func (cp *CommandPalette) cancelSearch() {
+	if cp.searchCancel != nil {
+		cp.searchCancel()
+		cp.searchCancel = nil
+	}
+	cp.searching = false
 }
 
 func commandFuzzyScore(name, query string) (int, []int) {
@@ -312,6 +307,9 @@ func (cp *CommandPalette) Render(screen tcell.Screen, x, y, width, height int) {
 	}
 
 	listCount := len(cp.Filtered)
+	if cp.isSearchMode {
+		listCount = len(cp.SearchResults)
+	}
 	if listCount > maxVisible {
 		listCount = maxVisible
 	}
@@ -411,6 +409,9 @@ func (cp *CommandPalette) Render(screen tcell.Screen, x, y, width, height int) {
 	countStr := ""
 	if cp.isSearchMode {
 		countStr = fmt.Sprintf(" %d results ", len(cp.SearchResults))
+		if cp.searching {
+			countStr = fmt.Sprintf(" %d results, searching... ", len(cp.SearchResults))
+		}
 	} else {
 		countStr = fmt.Sprintf(" %d commands ", len(cp.Filtered))
 	}
@@ -554,12 +555,14 @@ func (cp *CommandPalette) Render(screen tcell.Screen, x, y, width, height int) {
 func (cp *CommandPalette) HandleKey(ev *tcell.EventKey) bool {
 	switch ev.Key() {
 	case tcell.KeyEscape:
+		cp.cancelSearch()
 		if cp.OnClose != nil {
 			cp.OnClose()
 		}
 		return true
 	case tcell.KeyEnter:
 		if cp.isSearchMode {
+			cp.cancelSearch()
 			// Navigate to search result and close
 			if cp.Selected >= 0 && cp.Selected < len(cp.SearchResults) {
 				result := cp.SearchResults[cp.Selected]
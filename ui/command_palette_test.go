@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// collectSearch feeds posted events back into the palette until the search
+// for the current query is done.
+func collectSearch(t *testing.T, cp *CommandPalette, events chan tcell.Event) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			sr := ev.(*SearchResultsEvent)
+			if cp.HandleSearchEvent(sr) && sr.Done {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("search did not finish")
+		}
+	}
+}
+
+func TestPaletteSearchStreamsResultsForLatestQuery(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a:b.txt"), []byte("one alpha\ntwo beta\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "c.txt"), []byte("Alpha again\n"), 0o644)
+
+	events := make(chan tcell.Event, 64)
+	cp := NewCommandPalette(nil, nil)
+	cp.SetWorkDir(root)
+	cp.Post = func(ev tcell.Event) { events <- ev }
+
+	cp.Input = "%beta"
+	cp.updateFilter()
+	cp.Input = "%alpha("
+	cp.updateFilter() // supersedes the first search; invalid regex falls back to literal
+	cp.Input = "%alpha"
+	cp.updateFilter()
+	collectSearch(t, cp, events)
+
+	if len(cp.SearchResults) != 2 {
+		t.Fatalf("expected 2 case-insensitive results, got %+v", cp.SearchResults)
+	}
+	for _, r := range cp.SearchResults {
+		if r.Path == "a:b.txt" && (r.Line != 1 || r.Col != 5) {
+			t.Fatalf("path with a colon parsed wrong: %+v", r)
+		}
+		if r.Text == "two beta" {
+			t.Fatalf("result of a superseded query leaked in")
+		}
+	}
+	if cp.searching {
+		t.Fatalf("expected search to be finished")
+	}
+}
@@ -35,6 +35,7 @@ type Dialog struct {
 	Matches    []Match
 	MatchIndex int
 	UseRegex   bool
+	MatchInfo  string // shown instead of the match count when set
 
 	// Replace state
 	ReplaceInput  string
@@ -57,6 +58,7 @@ type Dialog struct {
 	OnSubmit               func(value string)
 	OnCancel               func()
 	OnNavigate             func(line, col int) // for F3/Shift+F3 find navigation
+	OnFindNext             func(backward bool) // replaces Matches navigation when set
 	OnConfirm              func(answer rune)   // for save confirm: 'y', 'n', 'c'
 	OnSettingChange        func(index int, value string)
 	OnSettingChangeReverse func(index int, value string)          // for left arrow
@@ -159,6 +161,17 @@ func NewDeleteConfirmDialog(filename string) *Dialog {
 	}
 }
 
+// NewRecoverConfirmDialog asks whether to restore what, backed up before
+// the editor last stopped. N discards the backups; C keeps them for later.
+func NewRecoverConfirmDialog(what string) *Dialog {
+	return &Dialog{
+		Type:    DialogSaveConfirm,
+		Input:   what,
+		Prompt:  "recover",
+		focused: true,
+	}
+}
+
 func (d *Dialog) Render(screen tcell.Screen, x, y, width, height int) {
 	switch d.Type {
 	case DialogFind:
@@ -234,7 +247,9 @@ func (d *Dialog) renderInputBar(screen tcell.Screen, x, y, width int, prompt str
 		if d.UseRegex {
 			info = " [.*]"
 		}
-		if len(d.Matches) > 0 {
+		if d.MatchInfo != "" {
+			info += " (" + d.MatchInfo + ")"
+		} else if len(d.Matches) > 0 {
 			info += " (" + strconv.Itoa(d.MatchIndex+1) + "/" + strconv.Itoa(len(d.Matches)) + ")"
 		} else if d.Input != "" {
 			info += " (0)"
@@ -305,9 +320,12 @@ func (d *Dialog) renderInputBar2(screen tcell.Screen, x, y, width int, prompt st
 func (d *Dialog) renderSaveConfirm(screen tcell.Screen, x, y, width int) {
 	style := tcell.StyleDefault.Background(tcell.ColorDarkRed).Foreground(tcell.ColorWhite)
 	var msg string
-	if d.Prompt == "delete" {
+	switch d.Prompt {
+	case "delete":
 		msg = " Delete " + d.Input + "? [Y]es [N]o "
-	} else {
+	case "recover":
+		msg = " Restore " + d.Input + " from the last session? [Y]es [N]o, discard [C]ancel, ask next time "
+	default:
 		msg = " Save changes to " + d.Input + "? [Y]es [N]o [C]ancel "
 	}
 
@@ -374,25 +392,35 @@ func (d *Dialog) renderHelp(screen tcell.Screen, x, y, width, height int) {
 		{"", "Ctrl+C", "Copy (line if no sel.)"},
 		{"", "Ctrl+X", "Cut (line if no sel.)"},
 		{"", "Ctrl+V", "Paste"},
+		{"", "Alt+V", "Cycle paste through history"},
 		{"", "Ctrl+A", "Select all"},
-		{"", "Ctrl+D", "Duplicate line"},
+		{"", "Ctrl+D", "Select next occurrence"},
+		{"", "Alt+D", "Skip occurrence"},
+		{"", "Ctrl+Shift+L / Alt+L", "Select all occurrences"},
+		{"", "Ctrl+Alt+Up/Down", "Add cursor above/below"},
+		{"", "Alt+Shift+I", "Cursors at line ends"},
 		{"", "Ctrl+/", "Toggle line comment"},
 		{"", "Alt+Up/Down", "Move line up/down"},
 		{"", "Ctrl+Backspace", "Delete word backward"},
 		{"", "Ctrl+Delete", "Delete word forward"},
 		{"", "Tab / Shift+Tab", "Indent / Dedent"},
+		{"", "F7", "Start/stop macro recording"},
+		{"", "F8", "Play macro"},
 		{"", "", ""},
 		{"NAVIGATION", "", ""},
 		{"", "Ctrl+F", "Find text"},
 		{"", "Ctrl+R", "Find and replace"},
+		{"", "Ctrl+Shift+F / Alt+F", "Find/replace in files"},
 		{"", "F3 / Shift+F3", "Next / Previous match"},
 		{"", "Ctrl+G", "Go to line"},
 		{"", "F12", "Go to definition"},
 		{"", "F2", "Rename symbol"},
+		{"", "Ctrl+K", "Show hover docs"},
 		{"", "Ctrl+]", "Jump to matching bracket"},
 		{"", "Ctrl/Alt+Left/Right", "Word skip"},
 		{"", "Shift+Arrow", "Character selection"},
 		{"", "Ctrl+Shift+Arrow", "Word selection"},
+		{"", "Alt+Shift+Arrow", "Block (column) selection"},
 		{"", "", ""},
 		{"SEARCH", "", ""},
 		{"", "Ctrl+P / Ctrl+Shift+P", "Command palette"},
@@ -402,12 +430,16 @@ func (d *Dialog) renderHelp(screen tcell.Screen, x, y, width, height int) {
 		{"", "Ctrl+B", "Toggle file tree"},
 		{"", "Ctrl+E", "Toggle tree focus"},
 		{"", "Ctrl+T", "Toggle terminal"},
+		{"", "Ctrl+\\ / Alt+\\", "Split right / down"},
+		{"", "F6 / Shift+F6", "Next / Previous pane"},
+		{"", "Ctrl+Alt+Left/Right", "Move tab to pane"},
 		{"", "Ctrl+.", "Toggle code fold"},
 		{"", "Alt+Z", "Toggle word wrap"},
 		{"", "Alt+,", "Settings dialog"},
 		{"", "Shift+Wheel", "Horizontal scroll"},
 		{"", "Middle/Right drag", "Multi-cursor (vertical)"},
 		{"", "Shift+Click", "Extend selection"},
+		{"", "Alt+Drag", "Block (column) selection"},
 		{"", "Ctrl+H / F1", "Toggle help"},
 		{"", "Esc", "Close dialog / Clear sel."},
 	}
@@ -594,6 +626,10 @@ func (d *Dialog) handleInputKey(ev *tcell.EventKey) bool {
 	if d.Type == DialogFind {
 		switch ev.Key() {
 		case tcell.KeyF3:
+			if d.OnFindNext != nil {
+				d.OnFindNext(ev.Modifiers()&tcell.ModShift != 0)
+				return true
+			}
 			if ev.Modifiers()&tcell.ModShift != 0 {
 				d.PrevMatch()
 			} else {
@@ -0,0 +1,342 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"editor/config"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// EditPreviewItem is one change in an EditPreview: a line edit (Before/After)
+// or, when Label is set, a file operation such as a create or rename.
+type EditPreviewItem struct {
+	File    string // display path the item is grouped under
+	Line    int    // 0-based line of a text edit
+	Before  string
+	After   string
+	Label   string
+	Enabled bool
+}
+
+type previewRow struct {
+	header bool
+	file   string
+	item   int // index into Items for non-header rows
+}
+
+// EditPreview lists the changes of a multi-file edit grouped by file and lets
+// the user deselect individual changes before applying them.
+type EditPreview struct {
+	Title    string
+	Items    []EditPreviewItem
+	Selected int // index into rows
+	Theme    *config.ColorScheme
+	OnApply  func(items []EditPreviewItem)
+	OnCancel func()
+
+	rows      []previewRow
+	scrollOff int
+	listH     int
+}
+
+func NewEditPreview(title string, items []EditPreviewItem) *EditPreview {
+	p := &EditPreview{Title: title, Items: items}
+	lastFile := ""
+	for i, item := range items {
+		if i == 0 || item.File != lastFile {
+			p.rows = append(p.rows, previewRow{header: true, file: item.File})
+			lastFile = item.File
+		}
+		p.rows = append(p.rows, previewRow{file: item.File, item: i})
+	}
+	if len(p.rows) > 1 {
+		p.Selected = 1
+	}
+	return p
+}
+
+// rowHeight is 2 for line edits (before and after) and 1 otherwise.
+func (p *EditPreview) rowHeight(r previewRow) int {
+	if r.header || p.Items[r.item].Label != "" {
+		return 1
+	}
+	return 2
+}
+
+func (p *EditPreview) fileCounts(file string) (enabled, total int) {
+	for _, item := range p.Items {
+		if item.File == file {
+			total++
+			if item.Enabled {
+				enabled++
+			}
+		}
+	}
+	return enabled, total
+}
+
+func (p *EditPreview) enabledCount() int {
+	n := 0
+	for _, item := range p.Items {
+		if item.Enabled {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *EditPreview) toggleSelected() {
+	if p.Selected < 0 || p.Selected >= len(p.rows) {
+		return
+	}
+	row := p.rows[p.Selected]
+	if !row.header {
+		p.Items[row.item].Enabled = !p.Items[row.item].Enabled
+		return
+	}
+	// Toggling a file header flips the whole file
+	enabled, total := p.fileCounts(row.file)
+	on := enabled < total
+	for i := range p.Items {
+		if p.Items[i].File == row.file {
+			p.Items[i].Enabled = on
+		}
+	}
+}
+
+func (p *EditPreview) ensureVisible() {
+	if p.Selected < p.scrollOff {
+		p.scrollOff = p.Selected
+	}
+	for p.scrollOff < p.Selected {
+		h := 0
+		for i := p.scrollOff; i <= p.Selected; i++ {
+			h += p.rowHeight(p.rows[i])
+		}
+		if h <= p.listH {
+			break
+		}
+		p.scrollOff++
+	}
+}
+
+func (p *EditPreview) Render(screen tcell.Screen, x, y, width, height int) {
+	theme := p.Theme
+	if theme == nil {
+		theme = config.Themes["monokai"]
+	}
+
+	dialogW := width * 80 / 100
+	if dialogW < 50 {
+		dialogW = 50
+	}
+	if dialogW > width-2 {
+		dialogW = width - 2
+	}
+	dialogH := height - 4
+	if dialogH < 6 {
+		dialogH = 6
+	}
+	dialogX := x + (width-dialogW)/2
+	dialogY := y + 2
+	p.listH = dialogH - 4
+	p.ensureVisible()
+
+	borderStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.DialogFg)
+	bgStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.DialogFg)
+	titleStyle := tcell.StyleDefault.Background(theme.StatusBarModeBg).Foreground(tcell.ColorWhite).Bold(true)
+	selectedStyle := tcell.StyleDefault.Background(theme.Selection).Foreground(theme.Foreground)
+	headerStyle := bgStyle.Bold(true)
+	dimStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.LineNumber)
+	removedStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(tcell.ColorRed)
+	addedStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(tcell.ColorGreen)
+
+	// Background and border
+	for dy := 0; dy < dialogH; dy++ {
+		for dx := 0; dx < dialogW; dx++ {
+			screen.SetContent(dialogX+dx, dialogY+dy, ' ', nil, bgStyle)
+		}
+	}
+	for dx := 0; dx < dialogW; dx++ {
+		screen.SetContent(dialogX+dx, dialogY, '─', nil, borderStyle)
+		screen.SetContent(dialogX+dx, dialogY+dialogH-1, '─', nil, borderStyle)
+	}
+	for dy := 0; dy < dialogH; dy++ {
+		screen.SetContent(dialogX, dialogY+dy, '│', nil, borderStyle)
+		screen.SetContent(dialogX+dialogW-1, dialogY+dy, '│', nil, borderStyle)
+	}
+	screen.SetContent(dialogX, dialogY, '┌', nil, borderStyle)
+	screen.SetContent(dialogX+dialogW-1, dialogY, '┐', nil, borderStyle)
+	screen.SetContent(dialogX, dialogY+dialogH-1, '└', nil, borderStyle)
+	screen.SetContent(dialogX+dialogW-1, dialogY+dialogH-1, '┘', nil, borderStyle)
+
+	title := " " + p.Title + " "
+	titleX := dialogX + (dialogW-runewidth.StringWidth(title))/2
+	if titleX <= dialogX {
+		titleX = dialogX + 1
+	}
+	drawPreviewText(screen, titleX, dialogY, dialogX+dialogW-1, title, titleStyle)
+
+	// Summary and key hints
+	summary := fmt.Sprintf("%d of %d changes selected", p.enabledCount(), len(p.Items))
+	drawPreviewText(screen, dialogX+2, dialogY+1, dialogX+dialogW-2, summary, bgStyle)
+	hint := "Space toggle · Enter apply · Esc cancel"
+	hintX := dialogX + dialogW - 2 - runewidth.StringWidth(hint)
+	if hintX > dialogX+2+len(summary)+2 {
+		drawPreviewText(screen, hintX, dialogY+1, dialogX+dialogW-2, hint, dimStyle)
+	}
+	for dx := 1; dx < dialogW-1; dx++ {
+		screen.SetContent(dialogX+dx, dialogY+2, '─', nil, borderStyle)
+	}
+	screen.SetContent(dialogX, dialogY+2, '├', nil, borderStyle)
+	screen.SetContent(dialogX+dialogW-1, dialogY+2, '┤', nil, borderStyle)
+
+	left := dialogX + 1
+	right := dialogX + dialogW - 1
+	rowY := dialogY + 3
+	bottom := dialogY + dialogH - 1
+	for i := p.scrollOff; i < len(p.rows) && rowY < bottom; i++ {
+		row := p.rows[i]
+		selected := i == p.Selected
+		fill := bgStyle
+		if selected {
+			fill = selectedStyle
+		}
+		for dy := 0; dy < p.rowHeight(row) && rowY+dy < bottom; dy++ {
+			for cx := left; cx < right; cx++ {
+				screen.SetContent(cx, rowY+dy, ' ', nil, fill)
+			}
+		}
+
+		if row.header {
+			enabled, total := p.fileCounts(row.file)
+			style := headerStyle
+			if selected {
+				style = selectedStyle.Bold(true)
+			}
+			text := fmt.Sprintf(" %s %s (%d/%d)", checkMark(enabled == total, enabled > 0), row.file, enabled, total)
+			drawPreviewText(screen, left, rowY, right, text, style)
+			rowY++
+			continue
+		}
+
+		item := p.Items[row.item]
+		mark := "   " + checkMark(item.Enabled, false) + " "
+		style := bgStyle
+		if selected {
+			style = selectedStyle
+		}
+		if item.Label != "" {
+			drawPreviewText(screen, left, rowY, right, mark+item.Label, style)
+			rowY++
+			continue
+		}
+
+		lineNo := fmt.Sprintf("%5d ", item.Line+1)
+		col := drawPreviewText(screen, left, rowY, right, mark, style)
+		numStyle, rem, add := dimStyle, removedStyle, addedStyle
+		if selected {
+			numStyle = numStyle.Background(theme.Selection)
+			rem = rem.Background(theme.Selection)
+			add = add.Background(theme.Selection)
+		}
+		col = drawPreviewText(screen, col, rowY, right, lineNo, numStyle)
+		drawPreviewText(screen, col, rowY, right, "- "+strings.TrimSpace(item.Before), rem)
+		if rowY+1 < bottom {
+			drawPreviewText(screen, col, rowY+1, right, "+ "+strings.TrimSpace(item.After), add)
+		}
+		rowY += 2
+	}
+}
+
+func checkMark(all, some bool) string {
+	switch {
+	case all:
+		return "[x]"
+	case some:
+		return "[-]"
+	}
+	return "[ ]"
+}
+
+// drawPreviewText draws s from x up to (not including) maxX and returns the
+// column after the last cell drawn.
+func drawPreviewText(screen tcell.Screen, x, y, maxX int, s string, style tcell.Style) int {
+	for _, ch := range s {
+		if ch == '\t' {
+			ch = ' '
+		}
+		w := runewidth.RuneWidth(ch)
+		if x+w > maxX {
+			break
+		}
+		screen.SetContent(x, y, ch, nil, style)
+		x += w
+	}
+	return x
+}
+
+func (p *EditPreview) HandleKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		if p.OnCancel != nil {
+			p.OnCancel()
+		}
+		return true
+	case tcell.KeyEnter:
+		if p.OnApply != nil {
+			p.OnApply(p.Items)
+		}
+		return true
+	case tcell.KeyUp:
+		if p.Selected > 0 {
+			p.Selected--
+		}
+		return true
+	case tcell.KeyDown:
+		if p.Selected < len(p.rows)-1 {
+			p.Selected++
+		}
+		return true
+	case tcell.KeyPgUp:
+		p.Selected -= p.listH / 2
+		if p.Selected < 0 {
+			p.Selected = 0
+		}
+		return true
+	case tcell.KeyPgDn:
+		p.Selected += p.listH / 2
+		if p.Selected > len(p.rows)-1 {
+			p.Selected = len(p.rows) - 1
+		}
+		return true
+	case tcell.KeyRune:
+		if ev.Rune() == ' ' {
+			p.toggleSelected()
+			return true
+		}
+	}
+	return false
+}
+
+func (p *EditPreview) HandleMouse(ev *tcell.EventMouse) bool {
+	switch ev.Buttons() {
+	case tcell.WheelUp:
+		if p.Selected > 0 {
+			p.Selected--
+		}
+		return true
+	case tcell.WheelDown:
+		if p.Selected < len(p.rows)-1 {
+			p.Selected++
+		}
+		return true
+	}
+	return false
+}
+
+func (p *EditPreview) IsFocused() bool   { return true }
+func (p *EditPreview) SetFocused(f bool) {}
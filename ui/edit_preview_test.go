@@ -0,0 +1,52 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestEditPreviewDeselectsEditsAndFiles(t *testing.T) {
+	p := NewEditPreview("Rename", []EditPreviewItem{
+		{File: "a.go", Line: 0, Before: "old()", After: "fresh()", Enabled: true},
+		{File: "a.go", Line: 4, Before: "old()", After: "fresh()", Enabled: true},
+		{File: "b.go", Label: "Rename to c.go", Enabled: true},
+	})
+	var applied []EditPreviewItem
+	p.OnApply = func(items []EditPreviewItem) { applied = items }
+	key := func(k tcell.Key, r rune) { p.HandleKey(tcell.NewEventKey(k, r, 0)) }
+
+	// The first edit starts selected; Space on the second deselects it
+	key(tcell.KeyDown, 0)
+	key(tcell.KeyRune, ' ')
+	if !p.Items[0].Enabled || p.Items[1].Enabled || !p.Items[2].Enabled {
+		t.Fatalf("after deselecting one edit: %+v", p.Items)
+	}
+
+	// Space on a file header flips the whole file
+	key(tcell.KeyDown, 0)
+	key(tcell.KeyRune, ' ')
+	if p.Items[2].Enabled {
+		t.Fatal("file header did not deselect its file")
+	}
+	key(tcell.KeyRune, ' ')
+	if !p.Items[2].Enabled {
+		t.Fatal("file header did not reselect its file")
+	}
+	key(tcell.KeyUp, 0)
+	key(tcell.KeyUp, 0)
+	key(tcell.KeyUp, 0)
+	key(tcell.KeyRune, ' ')
+	if !p.Items[0].Enabled || !p.Items[1].Enabled {
+		t.Fatalf("partly selected file header should select all of it: %+v", p.Items)
+	}
+	key(tcell.KeyRune, ' ')
+	if p.Items[0].Enabled || p.Items[1].Enabled {
+		t.Fatalf("file header did not deselect its edits: %+v", p.Items)
+	}
+
+	key(tcell.KeyEnter, 0)
+	if len(applied) != 3 || applied[0].Enabled || applied[1].Enabled || !applied[2].Enabled {
+		t.Fatalf("applied items = %+v", applied)
+	}
+}
@@ -21,6 +21,7 @@ type FileNode struct {
 
 type FileTree struct {
 	root      *FileNode
+	extra     []*FileNode // further root folders, listed after root
 	flatList  []*FileNode
 	selected  int
 	scrollOff int
@@ -42,13 +43,7 @@ type FileTree struct {
 
 func NewFileTree(rootPath string) *FileTree {
 	ft := &FileTree{
-		root: &FileNode{
-			Name:     filepath.Base(rootPath),
-			Path:     rootPath,
-			IsDir:    true,
-			Expanded: true,
-			Depth:    0,
-		},
+		root:      newRootNode(rootPath),
 		mouseX:    -1,
 		mouseY:    -1,
 		selected:  0,
@@ -59,6 +54,63 @@ func NewFileTree(rootPath string) *FileTree {
 	return ft
 }
 
+func newRootNode(path string) *FileNode {
+	return &FileNode{
+		Name:     filepath.Base(path),
+		Path:     path,
+		IsDir:    true,
+		Expanded: true,
+		Depth:    0,
+	}
+}
+
+// SetRoots shows the folders in paths, the first as the main root. Folders
+// already shown keep their expanded state.
+func (ft *FileTree) SetRoots(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	old := make(map[string]*FileNode)
+	for _, r := range ft.roots() {
+		old[r.Path] = r
+	}
+	nodes := make([]*FileNode, len(paths))
+	for i, path := range paths {
+		if r, ok := old[path]; ok {
+			nodes[i] = r
+			continue
+		}
+		nodes[i] = newRootNode(path)
+		ft.loadChildren(nodes[i])
+	}
+	ft.root, ft.extra = nodes[0], nodes[1:]
+	ft.selected = 0
+	ft.scrollOff = 0
+	ft.flatten()
+}
+
+// Roots returns the paths of the root folders, the main one first.
+func (ft *FileTree) Roots() []string {
+	var paths []string
+	for _, r := range ft.roots() {
+		paths = append(paths, r.Path)
+	}
+	return paths
+}
+
+func (ft *FileTree) roots() []*FileNode {
+	return append([]*FileNode{ft.root}, ft.extra...)
+}
+
+func (ft *FileTree) isRoot(node *FileNode) bool {
+	for _, r := range ft.roots() {
+		if node == r {
+			return true
+		}
+	}
+	return false
+}
+
 func (ft *FileTree) loadChildren(node *FileNode) {
 	entries, err := os.ReadDir(node.Path)
 	if err != nil {
@@ -96,7 +148,9 @@ func (ft *FileTree) loadChildren(node *FileNode) {
 
 func (ft *FileTree) flatten() {
 	ft.flatList = ft.flatList[:0]
-	ft.flattenNode(ft.root)
+	for _, r := range ft.roots() {
+		ft.flattenNode(r)
+	}
 }
 
 func (ft *FileTree) flattenNode(node *FileNode) {
@@ -293,7 +347,7 @@ func (ft *FileTree) HandleKey(ev *tcell.EventKey) bool {
 	case tcell.KeyDelete:
 		if ft.selected >= 0 && ft.selected < len(ft.flatList) {
 			node := ft.flatList[ft.selected]
-			if node != ft.root && ft.OnDeleteFile != nil {
+			if !ft.isRoot(node) && ft.OnDeleteFile != nil {
 				ft.OnDeleteFile(node.Path)
 			}
 		}
@@ -318,7 +372,7 @@ func (ft *FileTree) HandleKey(ev *tcell.EventKey) bool {
 			// Delete
 			if ft.selected >= 0 && ft.selected < len(ft.flatList) {
 				node := ft.flatList[ft.selected]
-				if node != ft.root && ft.OnDeleteFile != nil {
+				if !ft.isRoot(node) && ft.OnDeleteFile != nil {
 					ft.OnDeleteFile(node.Path)
 				}
 			}
@@ -327,7 +381,7 @@ func (ft *FileTree) HandleKey(ev *tcell.EventKey) bool {
 			// Rename
 			if ft.selected >= 0 && ft.selected < len(ft.flatList) {
 				node := ft.flatList[ft.selected]
-				if node != ft.root && ft.OnRenameFile != nil {
+				if !ft.isRoot(node) && ft.OnRenameFile != nil {
 					ft.OnRenameFile(node.Path)
 				}
 			}
@@ -429,11 +483,18 @@ func (ft *FileTree) HandleMouse(ev *tcell.EventMouse) bool {
 
 // SelectPath expands the tree to reveal the given path and selects it.
 func (ft *FileTree) SelectPath(targetPath string) {
-	if !strings.HasPrefix(targetPath, ft.root.Path) {
+	var root *FileNode
+	for _, r := range ft.roots() {
+		if strings.HasPrefix(targetPath, r.Path) {
+			root = r
+			break
+		}
+	}
+	if root == nil {
 		return
 	}
 
-	rel, err := filepath.Rel(ft.root.Path, targetPath)
+	rel, err := filepath.Rel(root.Path, targetPath)
 	if err != nil || rel == "." {
 		return
 	}
@@ -441,7 +502,7 @@ func (ft *FileTree) SelectPath(targetPath string) {
 	// Split path into components
 	parts := strings.Split(rel, string(os.PathSeparator))
 	
-	current := ft.root
+	current := root
 	// Ensure root is expanded
 	current.Expanded = true
 	if current.Children == nil {
@@ -519,11 +580,11 @@ func (ft *FileTree) Refresh() {
 		selectedPath = ft.flatList[ft.selected].Path
 	}
 
-	// Reload root
-	ft.loadChildren(ft.root)
-
-	// Restore expanded state recursively
-	ft.restoreExpandedState(ft.root, expandedPaths)
+	// Reload the roots and restore expanded state recursively
+	for _, r := range ft.roots() {
+		ft.loadChildren(r)
+		ft.restoreExpandedState(r, expandedPaths)
+	}
 
 	// Rebuild flat list
 	ft.flatten()
@@ -539,6 +600,46 @@ func (ft *FileTree) Refresh() {
 	}
 }
 
+// ExpandedPaths returns the paths of the expanded folders that are shown.
+func (ft *FileTree) ExpandedPaths() []string {
+	var paths []string
+	for _, node := range ft.flatList {
+		if node.IsDir && node.Expanded {
+			paths = append(paths, node.Path)
+		}
+	}
+	return paths
+}
+
+// SetExpandedPaths expands exactly the folders in paths, as ExpandedPaths
+// listed them.
+func (ft *FileTree) SetExpandedPaths(paths []string) {
+	expanded := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		expanded[p] = true
+	}
+	for _, r := range ft.roots() {
+		ft.setExpanded(r, expanded)
+	}
+	ft.flatten()
+	if ft.selected >= len(ft.flatList) {
+		ft.selected = len(ft.flatList) - 1
+	}
+}
+
+func (ft *FileTree) setExpanded(node *FileNode, expanded map[string]bool) {
+	if !node.IsDir {
+		return
+	}
+	node.Expanded = expanded[node.Path]
+	if node.Expanded && node.Children == nil {
+		ft.loadChildren(node)
+	}
+	for _, child := range node.Children {
+		ft.setExpanded(child, expanded)
+	}
+}
+
 func (ft *FileTree) restoreExpandedState(node *FileNode, expandedPaths map[string]bool) {
 	if !node.IsDir {
 		return
@@ -0,0 +1,505 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"editor/config"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// HexView shows a file as an offset column with hex and ASCII panes and
+// edits it in overwrite mode. The file never changes size, and saving
+// writes back only the bytes that were changed.
+type HexView struct {
+	Path  string
+	Theme *config.ColorScheme
+
+	data    []byte
+	changed map[int]byte // original value of every changed byte
+	undo    []hexEdit
+	redo    []hexEdit
+
+	cursor int  // byte offset
+	low    bool // the next hex digit sets the low nibble
+	ascii  bool // typing goes to the ASCII pane
+	scroll int  // first row shown
+
+	// Last search result, highlighted until the cursor moves away
+	matchOff, matchLen int
+
+	// Layout of the last render
+	x, y       int
+	cols, rows int
+}
+
+type hexEdit struct {
+	off      int
+	old, new byte
+}
+
+// NewHexView loads path for hex viewing and editing.
+func NewHexView(path string) (*HexView, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &HexView{
+		Path:    path,
+		data:    data,
+		changed: make(map[int]byte),
+		cols:    16,
+		rows:    1,
+	}, nil
+}
+
+// Reload rereads the file, dropping edits and undo history.
+func (h *HexView) Reload() error {
+	data, err := os.ReadFile(h.Path)
+	if err != nil {
+		return err
+	}
+	h.data = data
+	h.changed = make(map[int]byte)
+	h.undo, h.redo = nil, nil
+	h.matchLen = 0
+	h.Goto(h.cursor)
+	return nil
+}
+
+// Len returns the size of the file in bytes.
+func (h *HexView) Len() int { return len(h.data) }
+
+// Cursor returns the offset of the byte under the cursor.
+func (h *HexView) Cursor() int { return h.cursor }
+
+// Modified reports whether any byte differs from the file as loaded or
+// last saved.
+func (h *HexView) Modified() bool { return len(h.changed) > 0 }
+
+// InASCII reports whether typing goes to the ASCII pane.
+func (h *HexView) InASCII() bool { return h.ascii }
+
+// Save writes the changed bytes back to the file in place.
+func (h *HexView) Save() error {
+	if len(h.changed) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(h.Path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	offs := make([]int, 0, len(h.changed))
+	for off := range h.changed {
+		offs = append(offs, off)
+	}
+	sort.Ints(offs)
+	// Write runs of adjacent changes together
+	for i := 0; i < len(offs); {
+		j := i + 1
+		for j < len(offs) && offs[j] == offs[j-1]+1 {
+			j++
+		}
+		start, end := offs[i], offs[j-1]+1
+		if _, err := f.WriteAt(h.data[start:end], int64(start)); err != nil {
+			f.Close()
+			return err
+		}
+		i = j
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	h.changed = make(map[int]byte)
+	return nil
+}
+
+// Goto moves the cursor to off, clamped to the file.
+func (h *HexView) Goto(off int) {
+	if off > len(h.data)-1 {
+		off = len(h.data) - 1
+	}
+	if off < 0 {
+		off = 0
+	}
+	h.cursor = off
+	h.low = false
+}
+
+// ParseHexQuery turns a search query into bytes. A quoted query is text;
+// otherwise hex digits (spaces and 0x prefixes allowed) are bytes, and
+// anything else is searched as text.
+func ParseHexQuery(q string) ([]byte, error) {
+	q = strings.TrimSpace(q)
+	if len(q) >= 2 && q[0] == '"' && q[len(q)-1] == '"' {
+		q = q[1 : len(q)-1]
+		if q == "" {
+			return nil, errors.New("empty search")
+		}
+		return []byte(q), nil
+	}
+	if q == "" {
+		return nil, errors.New("empty search")
+	}
+	digits := strings.NewReplacer(" ", "", "0x", "", "0X", "").Replace(q)
+	if b, err := hex.DecodeString(digits); err == nil && len(b) > 0 {
+		return b, nil
+	}
+	return []byte(q), nil
+}
+
+// Find moves the cursor to the next occurrence of pattern after the cursor,
+// or the previous one before it, wrapping around the file once. It reports
+// whether a match was found and whether the search wrapped.
+func (h *HexView) Find(pattern []byte, backward bool) (found, wrapped bool) {
+	if len(pattern) == 0 {
+		return false, false
+	}
+	off := -1
+	if backward {
+		end := h.cursor - 1 + len(pattern)
+		if end > len(h.data) {
+			end = len(h.data)
+		}
+		if end > 0 {
+			off = bytes.LastIndex(h.data[:end], pattern)
+		}
+		if off < 0 {
+			off, wrapped = bytes.LastIndex(h.data, pattern), true
+		}
+	} else {
+		if start := h.cursor + 1; start < len(h.data) {
+			if i := bytes.Index(h.data[start:], pattern); i >= 0 {
+				off = start + i
+			}
+		}
+		if off < 0 {
+			off, wrapped = bytes.Index(h.data, pattern), true
+		}
+	}
+	if off < 0 {
+		return false, false
+	}
+	h.Goto(off)
+	h.matchOff, h.matchLen = off, len(pattern)
+	return true, wrapped
+}
+
+func (h *HexView) set(off int, v byte) {
+	old := h.data[off]
+	if old == v {
+		return
+	}
+	h.apply(off, v)
+	h.undo = append(h.undo, hexEdit{off: off, old: old, new: v})
+	h.redo = nil
+}
+
+// apply writes v at off, keeping track of which bytes differ from the file.
+func (h *HexView) apply(off int, v byte) {
+	orig, ok := h.changed[off]
+	if !ok {
+		orig = h.data[off]
+		h.changed[off] = orig
+	}
+	h.data[off] = v
+	if v == orig {
+		delete(h.changed, off)
+	}
+}
+
+// Undo reverts the last edit.
+func (h *HexView) Undo() bool {
+	if len(h.undo) == 0 {
+		return false
+	}
+	ed := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	h.apply(ed.off, ed.old)
+	h.redo = append(h.redo, ed)
+	h.Goto(ed.off)
+	return true
+}
+
+// Redo reapplies the last undone edit.
+func (h *HexView) Redo() bool {
+	if len(h.redo) == 0 {
+		return false
+	}
+	ed := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	h.apply(ed.off, ed.new)
+	h.undo = append(h.undo, ed)
+	h.Goto(ed.off)
+	return true
+}
+
+// HandleKey moves the cursor and edits bytes. It returns false for keys it
+// doesn't use.
+func (h *HexView) HandleKey(ev *tcell.EventKey) bool {
+	ctrl := ev.Modifiers()&tcell.ModCtrl != 0
+	page := h.cols * h.rows
+	switch ev.Key() {
+	case tcell.KeyLeft:
+		if !h.ascii && h.low {
+			h.low = false
+		} else {
+			h.Goto(h.cursor - 1)
+		}
+	case tcell.KeyRight:
+		h.Goto(h.cursor + 1)
+	case tcell.KeyUp:
+		if h.cursor >= h.cols {
+			h.Goto(h.cursor - h.cols)
+		}
+	case tcell.KeyDown:
+		if h.cursor+h.cols < len(h.data) {
+			h.Goto(h.cursor + h.cols)
+		}
+	case tcell.KeyPgUp:
+		h.Goto(h.cursor - page)
+	case tcell.KeyPgDn:
+		h.Goto(h.cursor + page)
+	case tcell.KeyHome:
+		if ctrl {
+			h.Goto(0)
+		} else {
+			h.Goto(h.cursor - h.cursor%h.cols)
+		}
+	case tcell.KeyEnd:
+		if ctrl {
+			h.Goto(len(h.data) - 1)
+		} else {
+			h.Goto(h.cursor - h.cursor%h.cols + h.cols - 1)
+		}
+	case tcell.KeyTab, tcell.KeyBacktab:
+		h.ascii = !h.ascii
+		h.low = false
+	case tcell.KeyCtrlZ:
+		if ev.Modifiers()&tcell.ModShift != 0 {
+			h.Redo()
+		} else {
+			h.Undo()
+		}
+	case tcell.KeyCtrlY:
+		h.Redo()
+	case tcell.KeyRune:
+		if ctrl || ev.Modifiers()&tcell.ModAlt != 0 || len(h.data) == 0 {
+			return false
+		}
+		h.typeRune(ev.Rune())
+	default:
+		return false
+	}
+	if h.cursor < h.matchOff || h.cursor >= h.matchOff+h.matchLen {
+		h.matchLen = 0
+	}
+	return true
+}
+
+// HandleMouse scrolls with the wheel and moves the cursor to a clicked byte
+// in either pane.
+func (h *HexView) HandleMouse(ev *tcell.EventMouse) {
+	switch ev.Buttons() {
+	case tcell.WheelUp:
+		if h.cursor >= 3*h.cols {
+			h.Goto(h.cursor - 3*h.cols)
+		}
+	case tcell.WheelDown:
+		if h.cursor+3*h.cols < len(h.data) {
+			h.Goto(h.cursor + 3*h.cols)
+		}
+	case tcell.Button1:
+		mx, my := ev.Position()
+		row := h.scroll + my - h.y
+		hexX := h.x + h.offsetWidth() + 2
+		asciiX := hexX + hexColumn(h.cols) + 1
+		switch {
+		case mx >= asciiX && mx < asciiX+h.cols:
+			h.Goto(row*h.cols + mx - asciiX)
+			h.ascii = true
+		case mx >= hexX && mx < asciiX-1:
+			i := (mx - hexX) / 3
+			if h.cols > 8 && mx-hexX > hexColumn(8)-1 {
+				i = (mx - hexX - 1) / 3
+			}
+			if i >= h.cols {
+				i = h.cols - 1
+			}
+			h.Goto(row*h.cols + i)
+			h.ascii = false
+		}
+	}
+}
+
+// typeRune overwrites the byte under the cursor: a nibble at a time in the
+// hex pane, or with a printable ASCII character in the ASCII pane.
+func (h *HexView) typeRune(r rune) {
+	if h.ascii {
+		if r < 0x20 || r > 0x7e {
+			return
+		}
+		h.set(h.cursor, byte(r))
+		h.Goto(h.cursor + 1)
+		return
+	}
+	d, ok := hexDigit(r)
+	if !ok {
+		return
+	}
+	cur := h.data[h.cursor]
+	if !h.low {
+		h.set(h.cursor, d<<4|cur&0x0f)
+		h.low = true
+		return
+	}
+	h.set(h.cursor, cur&0xf0|d)
+	if h.cursor < len(h.data)-1 {
+		h.Goto(h.cursor + 1)
+	}
+	h.low = false
+}
+
+func hexDigit(r rune) (byte, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return byte(r - '0'), true
+	case r >= 'a' && r <= 'f':
+		return byte(r-'a') + 10, true
+	case r >= 'A' && r <= 'F':
+		return byte(r-'A') + 10, true
+	}
+	return 0, false
+}
+
+// offsetWidth is the number of hex digits in the offset column.
+func (h *HexView) offsetWidth() int {
+	w := 8
+	for n := len(h.data) >> 32; n > 0; n >>= 4 {
+		w++
+	}
+	return w
+}
+
+// layoutCols picks the widest row of 16, 8 or 4 bytes that fits width.
+func (h *HexView) layoutCols(width int) int {
+	for _, cols := range []int{16, 8, 4} {
+		if h.offsetWidth()+2+cols*3+cols/8+1+cols <= width {
+			return cols
+		}
+	}
+	return 4
+}
+
+// hexColumn returns the screen column of byte i of a row in the hex pane,
+// relative to its start. Rows of 16 get an extra space after 8 bytes.
+func hexColumn(i int) int {
+	return i*3 + i/8
+}
+
+func (h *HexView) Render(screen tcell.Screen, x, y, width, height int) {
+	theme := h.Theme
+	if theme == nil {
+		theme = config.Themes["dark"]
+	}
+	base := tcell.StyleDefault.Background(theme.Background).Foreground(theme.Foreground)
+	offStyle := base.Foreground(theme.LineNumber)
+	changedStyle := base.Foreground(tcell.ColorYellow).Bold(true)
+	cursorStyle := base.Reverse(true)
+	otherCursor := base.Background(theme.Selection).Underline(true)
+
+	for row := 0; row < height; row++ {
+		for col := 0; col < width; col++ {
+			screen.SetContent(x+col, y+row, ' ', nil, base)
+		}
+	}
+
+	h.x, h.y = x, y
+	h.cols = h.layoutCols(width)
+	h.rows = height
+	if h.rows < 1 {
+		h.rows = 1
+	}
+	curRow := h.cursor / h.cols
+	if curRow < h.scroll {
+		h.scroll = curRow
+	}
+	if curRow >= h.scroll+h.rows {
+		h.scroll = curRow - h.rows + 1
+	}
+
+	offW := h.offsetWidth()
+	hexX := x + offW + 2
+	asciiX := hexX + hexColumn(h.cols) + 1
+	for row := 0; row < height; row++ {
+		start := (h.scroll + row) * h.cols
+		if start >= len(h.data) && !(start == 0 && row == 0) {
+			break
+		}
+		drawText(screen, x, y+row, fmt.Sprintf("%0*X", offW, start), offStyle, width)
+		for i := 0; i < h.cols && start+i < len(h.data); i++ {
+			off := start + i
+			b := h.data[off]
+			style := base
+			if _, ok := h.changed[off]; ok {
+				style = changedStyle
+			}
+			if h.matchLen > 0 && off >= h.matchOff && off < h.matchOff+h.matchLen {
+				style = style.Background(theme.Selection)
+			}
+			hexStyle, asciiStyle := style, style
+			if off == h.cursor {
+				if h.ascii {
+					hexStyle, asciiStyle = otherCursor, cursorStyle
+				} else {
+					hexStyle, asciiStyle = cursorStyle, otherCursor
+				}
+			}
+			digits := fmt.Sprintf("%02X", b)
+			hx := hexX + hexColumn(i)
+			if off == h.cursor && !h.ascii {
+				// Only the nibble being typed is reversed
+				nibble := 0
+				if h.low {
+					nibble = 1
+				}
+				for n := 0; n < 2; n++ {
+					s := style.Underline(true)
+					if n == nibble {
+						s = cursorStyle
+					}
+					setHexCell(screen, hx+n, y+row, rune(digits[n]), s, x+width)
+				}
+			} else {
+				setHexCell(screen, hx, y+row, rune(digits[0]), hexStyle, x+width)
+				setHexCell(screen, hx+1, y+row, rune(digits[1]), hexStyle, x+width)
+			}
+			c := rune(b)
+			if b < 0x20 || b > 0x7e {
+				c = '.'
+			}
+			setHexCell(screen, asciiX+i, y+row, c, asciiStyle, x+width)
+		}
+	}
+}
+
+func setHexCell(screen tcell.Screen, x, y int, r rune, style tcell.Style, maxX int) {
+	if x < maxX {
+		screen.SetContent(x, y, r, nil, style)
+	}
+}
+
+func drawText(screen tcell.Screen, x, y int, s string, style tcell.Style, width int) {
+	for i, r := range s {
+		if i >= width {
+			return
+		}
+		screen.SetContent(x+i, y, r, nil, style)
+	}
+}
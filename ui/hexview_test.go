@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func typeHex(h *HexView, s string) {
+	for _, r := range s {
+		h.HandleKey(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+}
+
+func TestHexViewSavesOnlyEditedBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blob.bin")
+	if err := os.WriteFile(path, []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	h, err := NewHexView(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	h.Goto(1)
+	typeHex(h, "ab") // 0x11 -> 0xAB, cursor moves on to offset 2
+	h.HandleKey(tcell.NewEventKey(tcell.KeyTab, 0, tcell.ModNone))
+	typeHex(h, "Z") // ASCII pane: 0x22 -> 'Z'
+	if !h.Modified() || h.Cursor() != 3 {
+		t.Fatalf("expected edits with cursor at 3, got modified=%v cursor=%d", h.Modified(), h.Cursor())
+	}
+
+	// A byte changed on disk meanwhile must survive the save
+	f, _ := os.OpenFile(path, os.O_WRONLY, 0)
+	f.WriteAt([]byte{0xEE}, 5)
+	f.Close()
+
+	if err := h.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, _ := os.ReadFile(path)
+	if want := []byte{0x00, 0xAB, 'Z', 0x33, 0x44, 0xEE}; !bytes.Equal(got, want) {
+		t.Fatalf("expected % X, got % X", want, got)
+	}
+	if h.Modified() {
+		t.Fatalf("expected no pending edits after saving")
+	}
+}
+
+func TestHexViewUndoRestoresOriginal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blob.bin")
+	os.WriteFile(path, []byte{0x10, 0x20}, 0644)
+	h, err := NewHexView(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	typeHex(h, "ff")
+	h.Undo()
+	h.Undo()
+	if h.Modified() {
+		t.Fatalf("expected undo back to the original bytes to leave nothing modified")
+	}
+	h.Redo()
+	if !h.Modified() {
+		t.Fatalf("expected redo to reapply the edit")
+	}
+}
+
+func TestHexViewFind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blob.bin")
+	os.WriteFile(path, []byte("\x00MAGIC\x00\xde\xad\xbe\xefMAGIC"), 0644)
+	h, err := NewHexView(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	pattern, _ := ParseHexQuery("de ad 0xbe ef")
+	if found, _ := h.Find(pattern, false); !found || h.Cursor() != 7 {
+		t.Fatalf("expected hex pattern at 7, got %d (found %v)", h.Cursor(), found)
+	}
+	pattern, _ = ParseHexQuery(`"MAGIC"`)
+	if found, wrapped := h.Find(pattern, false); !found || wrapped || h.Cursor() != 11 {
+		t.Fatalf("expected text at 11, got %d", h.Cursor())
+	}
+	if found, wrapped := h.Find(pattern, false); !found || !wrapped || h.Cursor() != 1 {
+		t.Fatalf("expected wrapped match at 1, got %d", h.Cursor())
+	}
+	if found, wrapped := h.Find(pattern, true); !found || !wrapped || h.Cursor() != 11 {
+		t.Fatalf("expected backward wrapped match at 11, got %d", h.Cursor())
+	}
+}
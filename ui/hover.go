@@ -0,0 +1,684 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"editor/config"
+	"editor/highlight"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+type hoverSpanKind int
+
+const (
+	hoverText    hoverSpanKind = iota
+	hoverHeading               // markdown heading
+	hoverCode                  // inline `code`, or fenced code without a highlighter
+	hoverSyntax                // highlighted code token; Style carries the colors
+	hoverMarker                // list bullets, quote bars and rules
+)
+
+type hoverSpan struct {
+	Text   string
+	Kind   hoverSpanKind
+	Bold   bool
+	Italic bool
+	Style  tcell.Style
+}
+
+// hoverBlock is one logical markdown line: a paragraph, list item, heading,
+// rule or a single line of a code block.
+type hoverBlock struct {
+	Spans  []hoverSpan
+	Prefix string // bullet, number or quote bar; continuation rows are indented to match
+	Code   bool   // code lines are clipped instead of wrapped
+	Rule   bool
+}
+
+type hoverRow struct {
+	Spans []hoverSpan
+	Code  bool
+}
+
+// HoverPopup shows LSP hover documentation in a scrollable floating window
+// anchored at the cursor.
+type HoverPopup struct {
+	Visible bool
+	X, Y    int // cursor screen position the popup is anchored to
+	Theme   *config.ColorScheme
+	OnClose func()
+
+	blocks    []hoverBlock
+	rows      []hoverRow
+	wrapWidth int
+	scrollOff int
+	pageSize  int
+
+	// Last rendered box, used for mouse hit testing
+	boxX, boxY, boxW, boxH int
+}
+
+const (
+	hoverMaxWidth  = 80
+	hoverMaxHeight = 15
+)
+
+// NewHoverPopup parses markdown hover contents. Fenced code blocks without a
+// language use lang, the language of the buffer the hover came from.
+func NewHoverPopup(markdown, lang string, x, y int, hl *highlight.Highlighter, theme *config.ColorScheme) *HoverPopup {
+	blocks := parseHoverMarkdown(markdown, lang, hl)
+	return &HoverPopup{
+		Visible: len(blocks) > 0,
+		X:       x,
+		Y:       y,
+		Theme:   theme,
+		blocks:  blocks,
+	}
+}
+
+var (
+	hoverListRe    = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	hoverHeadingRe = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	hoverRuleRe    = regexp.MustCompile(`^(\*\s*){3,}$|^(-\s*){3,}$|^(_\s*){3,}$`)
+)
+
+func parseHoverMarkdown(md, lang string, hl *highlight.Highlighter) []hoverBlock {
+	var blocks []hoverBlock
+	var para []string
+	paraPrefix := ""
+
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, hoverBlock{
+				Spans:  parseHoverInline(strings.Join(para, " ")),
+				Prefix: paraPrefix,
+			})
+		}
+		para = nil
+		paraPrefix = ""
+	}
+	blank := func() {
+		flush()
+		if len(blocks) > 0 && !isBlankBlock(blocks[len(blocks)-1]) {
+			blocks = append(blocks, hoverBlock{})
+		}
+	}
+	addCode := func(code []string, codeLang string) {
+		for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+			code = code[:len(code)-1]
+		}
+		if len(code) == 0 {
+			return
+		}
+		if codeLang == "" {
+			codeLang = lang
+		}
+		var styled []highlight.StyledLine
+		if hl != nil && codeLang != "" {
+			styled = hl.HighlightLines(strings.Join(code, "\n"), codeLang, 0, len(code))
+		}
+		for i, line := range code {
+			block := hoverBlock{Code: true}
+			if i < len(styled) {
+				for _, tok := range styled[i].Tokens {
+					block.Spans = append(block.Spans, hoverSpan{Text: tok.Text, Kind: hoverSyntax, Style: tok.Style})
+				}
+			} else if line != "" {
+				block.Spans = []hoverSpan{{Text: line, Kind: hoverCode}}
+			}
+			blocks = append(blocks, block)
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.ReplaceAll(lines[i], "\t", "    ")
+		trimmed := strings.TrimSpace(line)
+
+		// Fenced code block
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			flush()
+			fence := trimmed[:3]
+			codeLang := strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1]))
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+				code = append(code, strings.ReplaceAll(lines[i], "\t", "    "))
+			}
+			addCode(code, codeLang)
+			continue
+		}
+
+		if trimmed == "" {
+			blank()
+			continue
+		}
+
+		// Indented code block (only where it can't be a paragraph or list continuation)
+		if strings.HasPrefix(line, "    ") && len(para) == 0 {
+			var code []string
+			for ; i < len(lines); i++ {
+				l := strings.ReplaceAll(lines[i], "\t", "    ")
+				if strings.TrimSpace(l) != "" && !strings.HasPrefix(l, "    ") {
+					break
+				}
+				code = append(code, strings.TrimPrefix(l, "    "))
+			}
+			i--
+			addCode(code, "")
+			continue
+		}
+
+		if m := hoverHeadingRe.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			spans := parseHoverInline(m[2])
+			for j := range spans {
+				if spans[j].Kind == hoverText {
+					spans[j].Kind = hoverHeading
+				}
+			}
+			blocks = append(blocks, hoverBlock{Spans: spans})
+			continue
+		}
+
+		if hoverRuleRe.MatchString(trimmed) {
+			flush()
+			blocks = append(blocks, hoverBlock{Rule: true})
+			continue
+		}
+
+		if m := hoverListRe.FindStringSubmatch(line); m != nil {
+			flush()
+			marker := "• "
+			if unicode.IsDigit(rune(m[2][0])) {
+				marker = m[2] + " "
+			}
+			paraPrefix = strings.Repeat("  ", len(m[1])/2) + marker
+			para = []string{m[3]}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, ">") {
+			if paraPrefix != "│ " {
+				flush()
+				paraPrefix = "│ "
+			}
+			para = append(para, strings.TrimSpace(strings.TrimPrefix(trimmed, ">")))
+			continue
+		}
+
+		if paraPrefix == "│ " {
+			flush()
+		}
+		para = append(para, trimmed)
+	}
+	flush()
+
+	// Drop trailing blank separators
+	for len(blocks) > 0 && isBlankBlock(blocks[len(blocks)-1]) {
+		blocks = blocks[:len(blocks)-1]
+	}
+	return blocks
+}
+
+func isBlankBlock(b hoverBlock) bool {
+	return len(b.Spans) == 0 && b.Prefix == "" && !b.Code && !b.Rule
+}
+
+// parseHoverInline handles `code`, **bold**, *italic*, [links](url) and
+// backslash escapes.
+func parseHoverInline(text string) []hoverSpan {
+	var spans []hoverSpan
+	var cur strings.Builder
+	bold, italic := false, false
+
+	emit := func() {
+		if cur.Len() > 0 {
+			spans = append(spans, hoverSpan{Text: cur.String(), Kind: hoverText, Bold: bold, Italic: italic})
+			cur.Reset()
+		}
+	}
+
+	runes := []rune(text)
+	isWordRune := func(i int) bool {
+		return i >= 0 && i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]))
+	}
+	isSpace := func(i int) bool {
+		return i < 0 || i >= len(runes) || unicode.IsSpace(runes[i])
+	}
+
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case ch == '\\' && i+1 < len(runes) && (unicode.IsPunct(runes[i+1]) || unicode.IsSymbol(runes[i+1])):
+			cur.WriteRune(runes[i+1])
+			i++
+
+		case ch == '`':
+			end := -1
+			for j := i + 1; j < len(runes); j++ {
+				if runes[j] == '`' {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				cur.WriteRune(ch)
+				continue
+			}
+			emit()
+			spans = append(spans, hoverSpan{Text: string(runes[i+1 : end]), Kind: hoverCode})
+			i = end
+
+		case ch == '[':
+			// [text](url) renders as just the text
+			closeIdx := -1
+			for j := i + 1; j < len(runes); j++ {
+				if runes[j] == ']' {
+					closeIdx = j
+					break
+				}
+			}
+			if closeIdx < 0 || closeIdx+1 >= len(runes) || runes[closeIdx+1] != '(' {
+				cur.WriteRune(ch)
+				continue
+			}
+			parenIdx := -1
+			for j := closeIdx + 2; j < len(runes); j++ {
+				if runes[j] == ')' {
+					parenIdx = j
+					break
+				}
+			}
+			if parenIdx < 0 {
+				cur.WriteRune(ch)
+				continue
+			}
+			cur.WriteString(string(runes[i+1 : closeIdx]))
+			i = parenIdx
+
+		case ch == '*' || ch == '_':
+			double := i+1 < len(runes) && runes[i+1] == ch
+			width := 1
+			if double {
+				width = 2
+			}
+			open := !isSpace(i + width)
+			closing := !isSpace(i - 1)
+			if ch == '_' && (isWordRune(i-1) && isWordRune(i+width)) {
+				// snake_case identifiers are not emphasis
+				open, closing = false, false
+			}
+			on := italic
+			if double {
+				on = bold
+			}
+			if (on && closing) || (!on && open) {
+				emit()
+				if double {
+					bold = !bold
+				} else {
+					italic = !italic
+				}
+				i += width - 1
+			} else {
+				cur.WriteString(string(runes[i : i+width]))
+				i += width - 1
+			}
+
+		default:
+			cur.WriteRune(ch)
+		}
+	}
+	emit()
+	return spans
+}
+
+// layout wraps the parsed blocks to the given content width.
+func (h *HoverPopup) layout(width int) {
+	if width == h.wrapWidth && h.rows != nil {
+		return
+	}
+	h.wrapWidth = width
+	h.rows = h.rows[:0]
+	for _, b := range h.blocks {
+		switch {
+		case b.Rule:
+			h.rows = append(h.rows, hoverRow{Spans: []hoverSpan{{Text: strings.Repeat("─", width), Kind: hoverMarker}}})
+		case b.Code:
+			h.rows = append(h.rows, hoverRow{Spans: b.Spans, Code: true})
+		default:
+			for _, spans := range wrapHoverSpans(b.Spans, b.Prefix, width) {
+				h.rows = append(h.rows, hoverRow{Spans: spans})
+			}
+		}
+	}
+}
+
+// wrapHoverSpans word-wraps a styled line, preferring to break at spaces.
+func wrapHoverSpans(spans []hoverSpan, prefix string, width int) [][]hoverSpan {
+	type cell struct {
+		r    rune
+		span int
+	}
+	var cells []cell
+	for i, s := range spans {
+		for _, r := range s.Text {
+			cells = append(cells, cell{r, i})
+		}
+	}
+
+	prefixW := runewidth.StringWidth(prefix)
+	avail := width - prefixW
+	if avail < 1 {
+		avail = 1
+	}
+
+	var rows [][]hoverSpan
+	for first := true; first || len(cells) > 0; first = false {
+		if !first {
+			for len(cells) > 0 && cells[0].r == ' ' {
+				cells = cells[1:]
+			}
+			if len(cells) == 0 {
+				break
+			}
+		}
+
+		end, w, lastSpace := 0, 0, -1
+		for end < len(cells) {
+			cw := runewidth.RuneWidth(cells[end].r)
+			if w+cw > avail {
+				break
+			}
+			if cells[end].r == ' ' {
+				lastSpace = end
+			}
+			w += cw
+			end++
+		}
+		if end < len(cells) && cells[end].r != ' ' && lastSpace > 0 {
+			end = lastSpace
+		}
+		if end == 0 && len(cells) > 0 {
+			end = 1
+		}
+
+		var row []hoverSpan
+		if prefix != "" {
+			p := prefix
+			if !first {
+				p = strings.Repeat(" ", prefixW)
+			}
+			row = append(row, hoverSpan{Text: p, Kind: hoverMarker})
+		}
+		for j := 0; j < end; {
+			k := j
+			for k < end && cells[k].span == cells[j].span {
+				k++
+			}
+			s := spans[cells[j].span]
+			var text strings.Builder
+			for _, c := range cells[j:k] {
+				text.WriteRune(c.r)
+			}
+			s.Text = text.String()
+			row = append(row, s)
+			j = k
+		}
+		rows = append(rows, row)
+		cells = cells[end:]
+	}
+	return rows
+}
+
+func hoverRowWidth(row hoverRow) int {
+	w := 0
+	for _, s := range row.Spans {
+		w += runewidth.StringWidth(s.Text)
+	}
+	return w
+}
+
+func (h *HoverPopup) Render(screen tcell.Screen, x, y, width, height int) {
+	if !h.Visible || len(h.blocks) == 0 {
+		return
+	}
+
+	theme := h.Theme
+	if theme == nil {
+		theme = config.Themes["monokai"]
+	}
+
+	// Wrap at the widest allowed size, then shrink the box to the content
+	maxW := hoverMaxWidth
+	if maxW > width-2 {
+		maxW = width - 2
+	}
+	if maxW < 10 {
+		return
+	}
+	h.layout(maxW - 4)
+	contentW := 0
+	for _, row := range h.rows {
+		if w := hoverRowWidth(row); w > contentW {
+			contentW = w
+		}
+	}
+	boxW := contentW + 4
+	if boxW > maxW {
+		boxW = maxW
+	}
+	if boxW < 20 {
+		boxW = 20
+	}
+
+	// Prefer showing above the cursor, like most editors do for hover
+	contentH := len(h.rows)
+	if contentH > hoverMaxHeight {
+		contentH = hoverMaxHeight
+	}
+	spaceAbove := h.Y - y
+	spaceBelow := y + height - h.Y - 1
+	boxY := h.Y - (contentH + 2)
+	if contentH+2 > spaceAbove {
+		if contentH+2 <= spaceBelow || spaceBelow > spaceAbove {
+			boxY = h.Y + 1
+			if contentH+2 > spaceBelow {
+				contentH = spaceBelow - 2
+			}
+		} else {
+			contentH = spaceAbove - 2
+			boxY = h.Y - (contentH + 2)
+		}
+	}
+	if contentH < 1 {
+		return
+	}
+	boxH := contentH + 2
+
+	boxX := h.X
+	if boxX+boxW > x+width {
+		boxX = x + width - boxW
+	}
+	if boxX < x {
+		boxX = x
+	}
+	h.boxX, h.boxY, h.boxW, h.boxH = boxX, boxY, boxW, boxH
+
+	h.pageSize = contentH
+	maxScroll := len(h.rows) - contentH
+	if h.scrollOff > maxScroll {
+		h.scrollOff = maxScroll
+	}
+	if h.scrollOff < 0 {
+		h.scrollOff = 0
+	}
+
+	bgStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.DialogFg)
+	borderStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.LineNumber)
+	codeBg := tcell.StyleDefault.Background(theme.DialogInputBg).Foreground(theme.Foreground)
+
+	// Background and border
+	for dy := 0; dy < boxH; dy++ {
+		for dx := 0; dx < boxW; dx++ {
+			screen.SetContent(boxX+dx, boxY+dy, ' ', nil, bgStyle)
+		}
+	}
+	for dx := 0; dx < boxW; dx++ {
+		screen.SetContent(boxX+dx, boxY, '─', nil, borderStyle)
+		screen.SetContent(boxX+dx, boxY+boxH-1, '─', nil, borderStyle)
+	}
+	for dy := 0; dy < boxH; dy++ {
+		screen.SetContent(boxX, boxY+dy, '│', nil, borderStyle)
+		screen.SetContent(boxX+boxW-1, boxY+dy, '│', nil, borderStyle)
+	}
+	screen.SetContent(boxX, boxY, '┌', nil, borderStyle)
+	screen.SetContent(boxX+boxW-1, boxY, '┐', nil, borderStyle)
+	screen.SetContent(boxX, boxY+boxH-1, '└', nil, borderStyle)
+	screen.SetContent(boxX+boxW-1, boxY+boxH-1, '┘', nil, borderStyle)
+
+	// Scroll position on the bottom border
+	if len(h.rows) > contentH {
+		pos := fmt.Sprintf(" %d-%d/%d ", h.scrollOff+1, h.scrollOff+contentH, len(h.rows))
+		posX := boxX + boxW - 1 - len(pos)
+		if posX > boxX {
+			for i, ch := range pos {
+				screen.SetContent(posX+i, boxY+boxH-1, ch, nil, borderStyle)
+			}
+		}
+	}
+
+	left := boxX + 2
+	right := boxX + boxW - 2
+	for i := 0; i < contentH; i++ {
+		idx := h.scrollOff + i
+		if idx >= len(h.rows) {
+			break
+		}
+		row := h.rows[idx]
+		rowY := boxY + 1 + i
+		if row.Code {
+			for cx := boxX + 1; cx < boxX+boxW-1; cx++ {
+				screen.SetContent(cx, rowY, ' ', nil, codeBg)
+			}
+		}
+
+		col := left
+		for _, span := range row.Spans {
+			style := hoverSpanStyle(span, theme)
+			if row.Code && span.Kind == hoverText {
+				style = codeBg
+			}
+			for _, ch := range span.Text {
+				cw := runewidth.RuneWidth(ch)
+				if col+cw > right {
+					break
+				}
+				screen.SetContent(col, rowY, ch, nil, style)
+				col += cw
+			}
+		}
+	}
+}
+
+func hoverSpanStyle(span hoverSpan, theme *config.ColorScheme) tcell.Style {
+	style := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.DialogFg)
+	switch span.Kind {
+	case hoverHeading:
+		style = style.Foreground(theme.StatusBarModeBg).Bold(true)
+	case hoverCode:
+		style = tcell.StyleDefault.Background(theme.DialogInputBg).Foreground(theme.Foreground)
+	case hoverSyntax:
+		fg, _, attrs := span.Style.Decompose()
+		if fg == tcell.ColorDefault {
+			fg = theme.Foreground
+		}
+		style = tcell.StyleDefault.Background(theme.DialogInputBg).Foreground(fg).
+			Bold(attrs&tcell.AttrBold != 0).Italic(attrs&tcell.AttrItalic != 0)
+	case hoverMarker:
+		style = style.Foreground(theme.LineNumber)
+	}
+	if span.Bold {
+		style = style.Bold(true)
+	}
+	if span.Italic {
+		style = style.Italic(true)
+	}
+	return style
+}
+
+func (h *HoverPopup) scroll(delta int) {
+	h.scrollOff += delta
+	if maxScroll := len(h.rows) - h.pageSize; h.scrollOff > maxScroll {
+		h.scrollOff = maxScroll
+	}
+	if h.scrollOff < 0 {
+		h.scrollOff = 0
+	}
+}
+
+func (h *HoverPopup) close() {
+	h.Visible = false
+	if h.OnClose != nil {
+		h.OnClose()
+	}
+}
+
+// HandleKey scrolls the popup; Escape closes it. Any other key is left for
+// the caller, which normally dismisses the popup and processes the key.
+func (h *HoverPopup) HandleKey(ev *tcell.EventKey) bool {
+	if !h.Visible {
+		return false
+	}
+	page := h.pageSize
+	if page < 1 {
+		page = 1
+	}
+	switch ev.Key() {
+	case tcell.KeyUp:
+		h.scroll(-1)
+		return true
+	case tcell.KeyDown:
+		h.scroll(1)
+		return true
+	case tcell.KeyPgUp:
+		h.scroll(-page)
+		return true
+	case tcell.KeyPgDn:
+		h.scroll(page)
+		return true
+	case tcell.KeyEscape:
+		h.close()
+		return true
+	}
+	return false
+}
+
+// HandleMouse scrolls with the wheel and swallows clicks inside the popup.
+func (h *HoverPopup) HandleMouse(ev *tcell.EventMouse) bool {
+	if !h.Visible {
+		return false
+	}
+	mx, my := ev.Position()
+	if mx < h.boxX || mx >= h.boxX+h.boxW || my < h.boxY || my >= h.boxY+h.boxH {
+		return false
+	}
+	switch ev.Buttons() {
+	case tcell.WheelUp:
+		h.scroll(-3)
+	case tcell.WheelDown:
+		h.scroll(3)
+	}
+	return true
+}
+
+func (h *HoverPopup) IsFocused() bool   { return h.Visible }
+func (h *HoverPopup) SetFocused(f bool) { h.Visible = f }
@@ -0,0 +1,75 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"editor/highlight"
+)
+
+func hoverRowText(row hoverRow) string {
+	var b strings.Builder
+	for _, s := range row.Spans {
+		b.WriteString(s.Text)
+	}
+	return b.String()
+}
+
+func TestParseHoverMarkdownBlocks(t *testing.T) {
+	md := "```go\nfunc Foo(x int) error\n```\n\n# Title\n\nFoo does **bold** and *italic* things with `code`.\n\n- first\n- second"
+	blocks := parseHoverMarkdown(md, "Go", highlight.New())
+
+	if len(blocks) < 7 {
+		t.Fatalf("expected at least 7 blocks, got %d", len(blocks))
+	}
+	if !blocks[0].Code {
+		t.Fatalf("expected fenced code block first")
+	}
+	for _, s := range blocks[0].Spans {
+		if s.Kind != hoverSyntax {
+			t.Fatalf("expected highlighted code spans, got kind %v for %q", s.Kind, s.Text)
+		}
+	}
+	if blocks[2].Spans[0].Kind != hoverHeading || blocks[2].Spans[0].Text != "Title" {
+		t.Fatalf("expected heading block, got %+v", blocks[2])
+	}
+
+	var sawBold, sawItalic, sawCode bool
+	for _, s := range blocks[4].Spans {
+		sawBold = sawBold || (s.Bold && s.Text == "bold")
+		sawItalic = sawItalic || (s.Italic && s.Text == "italic")
+		sawCode = sawCode || (s.Kind == hoverCode && s.Text == "code")
+	}
+	if !sawBold || !sawItalic || !sawCode {
+		t.Fatalf("inline styles not parsed: %+v", blocks[4].Spans)
+	}
+
+	if blocks[6].Prefix != "• " || blocks[7].Prefix != "• " {
+		t.Fatalf("expected bullet list items, got %q and %q", blocks[6].Prefix, blocks[7].Prefix)
+	}
+}
+
+func TestParseHoverInlineKeepsSnakeCaseAndEscapes(t *testing.T) {
+	spans := parseHoverInline(`use snake_case_name and 2 \* 3`)
+	if len(spans) != 1 || spans[0].Italic {
+		t.Fatalf("expected one plain span, got %+v", spans)
+	}
+	if spans[0].Text != "use snake_case_name and 2 * 3" {
+		t.Fatalf("unexpected text %q", spans[0].Text)
+	}
+}
+
+func TestHoverLayoutWrapsParagraphsAndIndentsListContinuation(t *testing.T) {
+	h := NewHoverPopup("- alpha beta gamma delta", "", 0, 0, nil, nil)
+	h.layout(12)
+
+	if len(h.rows) != 3 {
+		t.Fatalf("expected 3 wrapped rows, got %d", len(h.rows))
+	}
+	if got := hoverRowText(h.rows[0]); got != "• alpha beta" {
+		t.Fatalf("unexpected first row %q", got)
+	}
+	if got := hoverRowText(h.rows[1]); got != "  gamma" {
+		t.Fatalf("expected continuation indented under bullet, got %q", got)
+	}
+}
@@ -0,0 +1,538 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"editor/config"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// Input fields of the search panel, in Tab order. Focus moves to the result
+// list after the last one.
+const (
+	SearchFieldFind = iota
+	SearchFieldReplace
+	SearchFieldInclude
+	SearchFieldExclude
+	searchFieldCount
+)
+
+var searchFieldLabels = [searchFieldCount]string{"Find", "Replace", "Include", "Exclude"}
+
+// SearchPanelResult is one match listed in the search panel.
+type SearchPanelResult struct {
+	File        string // display path the result is grouped under
+	Line        int    // 0-based
+	Col, EndCol int    // rune range of the match in Text
+	Text        string
+	Replacement string // what the match becomes when replaced
+	Enabled     bool
+}
+
+// SearchPanel is a project-wide find and replace overlay. The editor runs the
+// search in OnSearch and fills Results; the panel only handles input and
+// shows each match with its replacement.
+type SearchPanel struct {
+	Fields        [searchFieldCount]string
+	CaseSensitive bool
+	WholeWord     bool
+	Regex         bool
+	Results       []SearchPanelResult
+	Status        string // summary line, or the error of an invalid pattern
+	Theme         *config.ColorScheme
+
+	OnSearch        func()                            // query, globs or toggles changed
+	OnReplaceChange func()                            // replacement text changed
+	OnOpen          func(r SearchPanelResult)         // Enter on a result
+	OnReplace       func(results []SearchPanelResult) // Alt+Enter
+	OnClose         func()
+
+	focus     int // a SearchField*, or searchFieldCount for the result list
+	cursors   [searchFieldCount]int
+	rows      []previewRow
+	selected  int
+	scrollOff int
+	listH     int
+}
+
+func NewSearchPanel(theme *config.ColorScheme) *SearchPanel {
+	return &SearchPanel{Theme: theme, Status: "Type to search, Enter to run"}
+}
+
+// SetQuery prefills the find field, e.g. with the editor selection.
+func (p *SearchPanel) SetQuery(q string) {
+	p.Fields[SearchFieldFind] = q
+	p.cursors[SearchFieldFind] = len([]rune(q))
+}
+
+// SetResults replaces the result list, keeping the selection in range.
+func (p *SearchPanel) SetResults(results []SearchPanelResult) {
+	p.Results = results
+	p.rows = p.rows[:0]
+	lastFile := ""
+	for i, r := range results {
+		if i == 0 || r.File != lastFile {
+			p.rows = append(p.rows, previewRow{header: true, file: r.File})
+			lastFile = r.File
+		}
+		p.rows = append(p.rows, previewRow{file: r.File, item: i})
+	}
+	if p.selected >= len(p.rows) {
+		p.selected = len(p.rows) - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+	if p.scrollOff > p.selected {
+		p.scrollOff = p.selected
+	}
+}
+
+func (p *SearchPanel) enabledCount() int {
+	n := 0
+	for _, r := range p.Results {
+		if r.Enabled {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *SearchPanel) fileCounts(file string) (enabled, total int) {
+	for _, r := range p.Results {
+		if r.File == file {
+			total++
+			if r.Enabled {
+				enabled++
+			}
+		}
+	}
+	return enabled, total
+}
+
+func (p *SearchPanel) toggleSelected() {
+	if p.selected < 0 || p.selected >= len(p.rows) {
+		return
+	}
+	row := p.rows[p.selected]
+	if !row.header {
+		p.Results[row.item].Enabled = !p.Results[row.item].Enabled
+		return
+	}
+	enabled, total := p.fileCounts(row.file)
+	on := enabled < total
+	for i := range p.Results {
+		if p.Results[i].File == row.file {
+			p.Results[i].Enabled = on
+		}
+	}
+}
+
+func (p *SearchPanel) ensureVisible() {
+	if p.selected < p.scrollOff {
+		p.scrollOff = p.selected
+	}
+	if p.listH > 0 && p.selected >= p.scrollOff+p.listH {
+		p.scrollOff = p.selected - p.listH + 1
+	}
+}
+
+func (p *SearchPanel) Render(screen tcell.Screen, x, y, width, height int) {
+	theme := p.Theme
+	if theme == nil {
+		theme = config.Themes["monokai"]
+	}
+
+	dialogW := width * 80 / 100
+	if dialogW < 60 {
+		dialogW = 60
+	}
+	if dialogW > width-2 {
+		dialogW = width - 2
+	}
+	dialogH := height - 4
+	if dialogH < 10 {
+		dialogH = 10
+	}
+	dialogX := x + (width-dialogW)/2
+	dialogY := y + 2
+	listTop := dialogY + 1 + searchFieldCount + 1
+	bottom := dialogY + dialogH - 2 // last row holds the key hints
+	p.listH = bottom - listTop
+	p.ensureVisible()
+
+	bgStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.DialogFg)
+	titleStyle := tcell.StyleDefault.Background(theme.StatusBarModeBg).Foreground(tcell.ColorWhite).Bold(true)
+	inputStyle := tcell.StyleDefault.Background(theme.DialogInputBg).Foreground(theme.Foreground)
+	dimStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.LineNumber)
+	errorStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(tcell.ColorRed)
+
+	for dy := 0; dy < dialogH; dy++ {
+		for dx := 0; dx < dialogW; dx++ {
+			screen.SetContent(dialogX+dx, dialogY+dy, ' ', nil, bgStyle)
+		}
+	}
+	for dx := 0; dx < dialogW; dx++ {
+		screen.SetContent(dialogX+dx, dialogY, '─', nil, bgStyle)
+		screen.SetContent(dialogX+dx, dialogY+dialogH-1, '─', nil, bgStyle)
+		screen.SetContent(dialogX+dx, listTop-1, '─', nil, bgStyle)
+	}
+	for dy := 0; dy < dialogH; dy++ {
+		screen.SetContent(dialogX, dialogY+dy, '│', nil, bgStyle)
+		screen.SetContent(dialogX+dialogW-1, dialogY+dy, '│', nil, bgStyle)
+	}
+	screen.SetContent(dialogX, dialogY, '┌', nil, bgStyle)
+	screen.SetContent(dialogX+dialogW-1, dialogY, '┐', nil, bgStyle)
+	screen.SetContent(dialogX, dialogY+dialogH-1, '└', nil, bgStyle)
+	screen.SetContent(dialogX+dialogW-1, dialogY+dialogH-1, '┘', nil, bgStyle)
+	screen.SetContent(dialogX, listTop-1, '├', nil, bgStyle)
+	screen.SetContent(dialogX+dialogW-1, listTop-1, '┤', nil, bgStyle)
+
+	title := " Find in Files "
+	drawPreviewText(screen, dialogX+(dialogW-len(title))/2, dialogY, dialogX+dialogW-1, title, titleStyle)
+
+	left := dialogX + 2
+	right := dialogX + dialogW - 2
+
+	// Toggles sit to the right of the find field
+	toggles := []struct {
+		label string
+		on    bool
+	}{{"Aa", p.CaseSensitive}, {"W", p.WholeWord}, {".*", p.Regex}}
+	togglesW := 0
+	for _, t := range toggles {
+		togglesW += len(t.label) + 3
+	}
+
+	for i := 0; i < searchFieldCount; i++ {
+		rowY := dialogY + 1 + i
+		label := fmt.Sprintf("%-8s", searchFieldLabels[i])
+		labelStyle := dimStyle
+		if p.focus == i {
+			labelStyle = bgStyle.Bold(true)
+		}
+		col := drawPreviewText(screen, left, rowY, right, label, labelStyle)
+		inputRight := right
+		if i == SearchFieldFind {
+			inputRight = right - togglesW
+		}
+		for cx := col; cx < inputRight; cx++ {
+			screen.SetContent(cx, rowY, ' ', nil, inputStyle)
+		}
+		runes := []rune(p.Fields[i])
+		// Scroll long input so the cursor stays visible
+		start := 0
+		if avail := inputRight - col - 2; avail > 0 && p.cursors[i] > avail {
+			start = p.cursors[i] - avail
+		}
+		cx := col + 1
+		for j := start; j < len(runes) && cx < inputRight; j++ {
+			style := inputStyle
+			if p.focus == i && j == p.cursors[i] {
+				style = style.Reverse(true)
+			}
+			screen.SetContent(cx, rowY, runes[j], nil, style)
+			cx += runewidth.RuneWidth(runes[j])
+		}
+		if p.focus == i && p.cursors[i] >= len(runes) && cx < inputRight {
+			screen.SetContent(cx, rowY, ' ', nil, inputStyle.Reverse(true))
+		}
+		if i == SearchFieldFind {
+			tx := inputRight + 1
+			for _, t := range toggles {
+				style := dimStyle
+				if t.on {
+					style = titleStyle
+				}
+				tx = drawPreviewText(screen, tx, rowY, right+1, "["+t.label+"]", style) + 1
+			}
+		}
+	}
+
+	statusStyle := dimStyle
+	if strings.HasPrefix(p.Status, "Invalid") {
+		statusStyle = errorStyle
+	}
+	summary := p.Status
+	if len(p.Results) > 0 && p.Fields[SearchFieldReplace] != "" {
+		summary += fmt.Sprintf(" · %d selected", p.enabledCount())
+	}
+	drawPreviewText(screen, left, listTop-1, right, " "+summary+" ", statusStyle)
+
+	p.renderResults(screen, dialogX+1, dialogX+dialogW-1, listTop, bottom, theme)
+
+	hint := "Tab next · Enter search/open · Space toggle · Alt+Enter replace · Alt+C/W/R case/word/regex · Esc close"
+	drawPreviewText(screen, left, dialogY+dialogH-2, right, hint, dimStyle)
+}
+
+func (p *SearchPanel) renderResults(screen tcell.Screen, left, right, top, bottom int, theme *config.ColorScheme) {
+	replacing := p.Fields[SearchFieldReplace] != ""
+	for i, rowY := p.scrollOff, top; i < len(p.rows) && rowY < bottom; i, rowY = i+1, rowY+1 {
+		row := p.rows[i]
+		selected := i == p.selected && p.focus == searchFieldCount
+		bg := theme.DialogBg
+		if selected {
+			bg = theme.Selection
+		}
+		base := tcell.StyleDefault.Background(bg).Foreground(theme.DialogFg)
+		for cx := left; cx < right; cx++ {
+			screen.SetContent(cx, rowY, ' ', nil, base)
+		}
+
+		if row.header {
+			enabled, total := p.fileCounts(row.file)
+			mark := ""
+			if replacing {
+				mark = checkMark(enabled == total, enabled > 0) + " "
+			}
+			drawPreviewText(screen, left+1, rowY, right, fmt.Sprintf("%s%s (%d)", mark, row.file, total), base.Bold(true))
+			continue
+		}
+
+		r := p.Results[row.item]
+		col := left + 3
+		if replacing {
+			col = drawPreviewText(screen, col, rowY, right, checkMark(r.Enabled, false)+" ", base)
+		}
+		col = drawPreviewText(screen, col, rowY, right, fmt.Sprintf("%5d  ", r.Line+1), base.Foreground(theme.LineNumber))
+
+		before, match, after := searchResultContext(r, right-col)
+		col = drawPreviewText(screen, col, rowY, right, before, base)
+		matchStyle := base.Foreground(theme.Foreground).Reverse(!replacing)
+		if replacing {
+			matchStyle = base.Foreground(tcell.ColorRed).StrikeThrough(true)
+		}
+		col = drawPreviewText(screen, col, rowY, right, match, matchStyle)
+		if replacing {
+			col = drawPreviewText(screen, col, rowY, right, r.Replacement, base.Foreground(tcell.ColorGreen))
+		}
+		drawPreviewText(screen, col, rowY, right, after, base)
+	}
+}
+
+// searchResultContext splits a result line around its match, dropping
+// indentation and as much leading text as needed to keep the match in view.
+func searchResultContext(r SearchPanelResult, width int) (before, match, after string) {
+	runes := []rune(r.Text)
+	col, end := r.Col, r.EndCol
+	if col > len(runes) {
+		col = len(runes)
+	}
+	if end > len(runes) {
+		end = len(runes)
+	}
+	before = strings.TrimLeft(string(runes[:col]), " \t")
+	match = string(runes[col:end])
+	after = string(runes[end:])
+
+	maxBefore := width / 3
+	if maxBefore < 8 {
+		maxBefore = 8
+	}
+	if b := []rune(before); len(b) > maxBefore {
+		before = "…" + string(b[len(b)-maxBefore+1:])
+	}
+	return before, match, after
+}
+
+func (p *SearchPanel) HandleKey(ev *tcell.EventKey) bool {
+	alt := ev.Modifiers()&tcell.ModAlt != 0
+
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		if p.OnClose != nil {
+			p.OnClose()
+		}
+		return true
+	case tcell.KeyTab:
+		p.focus = (p.focus + 1) % (searchFieldCount + 1)
+		if p.focus == searchFieldCount && len(p.rows) == 0 {
+			p.focus = SearchFieldFind
+		}
+		return true
+	case tcell.KeyBacktab:
+		p.focus = (p.focus + searchFieldCount) % (searchFieldCount + 1)
+		if p.focus == searchFieldCount && len(p.rows) == 0 {
+			p.focus--
+		}
+		return true
+	case tcell.KeyEnter:
+		if alt {
+			if p.OnReplace != nil && len(p.Results) > 0 {
+				p.OnReplace(p.Results)
+			}
+			return true
+		}
+		if p.focus < searchFieldCount {
+			p.search()
+			return true
+		}
+		if p.selected >= 0 && p.selected < len(p.rows) && p.OnOpen != nil {
+			row := p.rows[p.selected]
+			if row.header && p.selected+1 < len(p.rows) {
+				row = p.rows[p.selected+1]
+			}
+			p.OnOpen(p.Results[row.item])
+		}
+		return true
+	case tcell.KeyUp:
+		if p.focus == searchFieldCount {
+			if p.selected > 0 {
+				p.selected--
+			} else {
+				p.focus = SearchFieldExclude
+			}
+		} else if p.focus > 0 {
+			p.focus--
+		}
+		return true
+	case tcell.KeyDown:
+		if p.focus == searchFieldCount {
+			if p.selected < len(p.rows)-1 {
+				p.selected++
+			}
+		} else if p.focus < searchFieldCount-1 {
+			p.focus++
+		} else if len(p.rows) > 0 {
+			p.focus = searchFieldCount
+		}
+		return true
+	case tcell.KeyPgUp:
+		if p.focus == searchFieldCount {
+			p.selected -= p.listH / 2
+			if p.selected < 0 {
+				p.selected = 0
+			}
+		}
+		return true
+	case tcell.KeyPgDn:
+		if p.focus == searchFieldCount {
+			p.selected += p.listH / 2
+			if p.selected > len(p.rows)-1 {
+				p.selected = len(p.rows) - 1
+			}
+		}
+		return true
+	case tcell.KeyRune:
+		if alt {
+			switch ev.Rune() {
+			case 'c', 'C':
+				p.CaseSensitive = !p.CaseSensitive
+			case 'w', 'W':
+				p.WholeWord = !p.WholeWord
+			case 'r', 'R':
+				p.Regex = !p.Regex
+			default:
+				return false
+			}
+			p.search()
+			return true
+		}
+		if p.focus == searchFieldCount {
+			if ev.Rune() == ' ' {
+				p.toggleSelected()
+			}
+			return true
+		}
+		p.insert(ev.Rune())
+		return true
+	}
+
+	if p.focus < searchFieldCount {
+		return p.editField(ev)
+	}
+	return false
+}
+
+func (p *SearchPanel) editField(ev *tcell.EventKey) bool {
+	runes := []rune(p.Fields[p.focus])
+	cur := p.cursors[p.focus]
+	switch ev.Key() {
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if cur == 0 {
+			return true
+		}
+		runes = append(runes[:cur-1], runes[cur:]...)
+		cur--
+	case tcell.KeyDelete:
+		if cur >= len(runes) {
+			return true
+		}
+		runes = append(runes[:cur], runes[cur+1:]...)
+	case tcell.KeyLeft:
+		if cur > 0 {
+			p.cursors[p.focus]--
+		}
+		return true
+	case tcell.KeyRight:
+		if cur < len(runes) {
+			p.cursors[p.focus]++
+		}
+		return true
+	case tcell.KeyHome, tcell.KeyCtrlA:
+		p.cursors[p.focus] = 0
+		return true
+	case tcell.KeyEnd, tcell.KeyCtrlE:
+		p.cursors[p.focus] = len(runes)
+		return true
+	default:
+		return false
+	}
+	p.Fields[p.focus] = string(runes)
+	p.cursors[p.focus] = cur
+	p.changed()
+	return true
+}
+
+func (p *SearchPanel) insert(r rune) {
+	runes := []rune(p.Fields[p.focus])
+	cur := p.cursors[p.focus]
+	runes = append(runes[:cur], append([]rune{r}, runes[cur:]...)...)
+	p.Fields[p.focus] = string(runes)
+	p.cursors[p.focus] = cur + 1
+	p.changed()
+}
+
+// changed refreshes the replacement preview as it's typed. Searching walks
+// the project, so it waits for Enter.
+func (p *SearchPanel) changed() {
+	if p.focus == SearchFieldReplace && p.OnReplaceChange != nil {
+		p.OnReplaceChange()
+	}
+}
+
+func (p *SearchPanel) search() {
+	if p.OnSearch != nil {
+		p.OnSearch()
+	}
+	if len(p.rows) > 0 && p.focus == searchFieldCount {
+		return
+	}
+	p.selected = 0
+	p.scrollOff = 0
+}
+
+func (p *SearchPanel) HandleMouse(ev *tcell.EventMouse) bool {
+	if len(p.rows) > 0 && (ev.Buttons() == tcell.WheelUp || ev.Buttons() == tcell.WheelDown) {
+		p.focus = searchFieldCount
+	}
+	switch ev.Buttons() {
+	case tcell.WheelUp:
+		if p.selected > 0 {
+			p.selected--
+		}
+		return true
+	case tcell.WheelDown:
+		if p.selected < len(p.rows)-1 {
+			p.selected++
+		}
+		return true
+	}
+	return false
+}
+
+func (p *SearchPanel) IsFocused() bool   { return true }
+func (p *SearchPanel) SetFocused(f bool) {}
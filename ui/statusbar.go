@@ -22,6 +22,16 @@ type StatusBar struct {
 	SelLines  int    // number of selected lines
 	DiagErrors   int // number of LSP diagnostic errors
 	DiagWarnings int // number of LSP diagnostic warnings
+
+	OnEncodingClick func() // called when the encoding is clicked
+	OnLineEndClick  func() // called when the line ending is clicked
+
+	// Screen columns of the clickable segments from the last Render, end
+	// exclusive; zero when not drawn
+	encodingX [2]int
+	lineEndX  [2]int
+	y         int
+	down      bool // Button1 is held; a click fires once per press
 }
 
 func NewStatusBar() *StatusBar {
@@ -41,6 +51,10 @@ func (s *StatusBar) Render(screen tcell.Screen, x, y, width, height int) {
 	style := tcell.StyleDefault.Background(theme.StatusBarBg).Foreground(theme.StatusBarFg)
 	modeStyle := tcell.StyleDefault.Background(theme.StatusBarModeBg).Foreground(tcell.ColorWhite).Bold(true)
 
+	s.encodingX = [2]int{}
+	s.lineEndX = [2]int{}
+	s.y = y
+
 	// Clear the line
 	for cx := x; cx < x+width; cx++ {
 		screen.SetContent(cx, y, ' ', nil, style)
@@ -96,14 +110,20 @@ func (s *StatusBar) Render(screen tcell.Screen, x, y, width, height int) {
 	if tabInfo == "" {
 		tabInfo = "Spaces: 4"
 	}
+	var head string
 	if s.SelChars > 0 {
-		right = fmt.Sprintf("%sSel: %d chars, %d lines │ Ln %d, Col %d │ %s │ %s │ %s │ %s ", diagPart, s.SelChars, s.SelLines, s.Line+1, s.Col+1, s.Language, s.Encoding, s.LineEnd, tabInfo)
+		head = fmt.Sprintf("%sSel: %d chars, %d lines │ Ln %d, Col %d │ %s │ ", diagPart, s.SelChars, s.SelLines, s.Line+1, s.Col+1, s.Language)
 	} else {
-		right = fmt.Sprintf("%sLn %d, Col %d │ %s │ %s │ %s │ %s ", diagPart, s.Line+1, s.Col+1, s.Language, s.Encoding, s.LineEnd, tabInfo)
+		head = fmt.Sprintf("%sLn %d, Col %d │ %s │ ", diagPart, s.Line+1, s.Col+1, s.Language)
 	}
+	right = fmt.Sprintf("%s%s │ %s │ %s ", head, s.Encoding, s.LineEnd, tabInfo)
 	rightRunes := []rune(right)
 	rightStart := x + width - len(rightRunes)
 	if rightStart > col+2 {
+		encStart := rightStart + len([]rune(head))
+		s.encodingX = [2]int{encStart, encStart + len([]rune(s.Encoding))}
+		leStart := s.encodingX[1] + len([]rune(" │ "))
+		s.lineEndX = [2]int{leStart, leStart + len([]rune(s.LineEnd))}
 		// Render diagnostic counts with colors if present
 		diagRuneLen := len([]rune(diagPart))
 		for i, ch := range rightRunes {
@@ -119,6 +139,27 @@ func (s *StatusBar) Render(screen tcell.Screen, x, y, width, height int) {
 }
 
 func (s *StatusBar) HandleKey(ev *tcell.EventKey) bool   { return false }
-func (s *StatusBar) HandleMouse(ev *tcell.EventMouse) bool { return false }
 func (s *StatusBar) IsFocused() bool                      { return false }
 func (s *StatusBar) SetFocused(f bool)                    {}
+
+// HandleMouse runs the click callback of the segment under a left click.
+func (s *StatusBar) HandleMouse(ev *tcell.EventMouse) bool {
+	wasDown := s.down
+	s.down = ev.Buttons()&tcell.Button1 != 0
+	if !s.down || wasDown {
+		return false
+	}
+	mx, my := ev.Position()
+	if my != s.y {
+		return false
+	}
+	switch {
+	case s.OnEncodingClick != nil && mx >= s.encodingX[0] && mx < s.encodingX[1]:
+		s.OnEncodingClick()
+	case s.OnLineEndClick != nil && mx >= s.lineEndX[0] && mx < s.lineEndX[1]:
+		s.OnLineEndClick()
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,246 @@
+package ui
+
+import (
+	"strings"
+
+	"editor/config"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// TimelineItem is one version of the text listed in a TimelinePanel.
+type TimelineItem struct {
+	ID      int
+	Indent  int    // how many branches deep the version is
+	Label   string // when the version was made
+	Summary string // how it differs, in a few words
+	Current bool
+	Diff    []TimelineDiffLine
+}
+
+// TimelineDiffLine is a line of a TimelineItem's diff: text removed
+// (Kind < 0), added (Kind > 0), or a heading.
+type TimelineDiffLine struct {
+	Text string
+	Kind int
+}
+
+// TimelinePanel lists versions of a text, newest first, such as the
+// states of a buffer's undo tree or the saved versions of a file. The list
+// is drawn down the left and the diff of the selected version on the right.
+type TimelinePanel struct {
+	Title    string
+	Hint     string
+	Items    []TimelineItem
+	Selected int
+	Theme    *config.ColorScheme
+	OnSelect func(item TimelineItem)
+	OnCancel func()
+	// LoadDiff, when set, makes the diff of an item the first time it is
+	// shown, for items whose Diff is nil.
+	LoadDiff func(item TimelineItem) []TimelineDiffLine
+
+	scrollOff int
+	listH     int
+}
+
+func NewTimelinePanel(title string, items []TimelineItem) *TimelinePanel {
+	p := &TimelinePanel{Title: title, Hint: "↑↓ select · Enter go to version · Esc close", Items: items}
+	for i, item := range items {
+		if item.Current {
+			p.Selected = i
+		}
+	}
+	return p
+}
+
+func (p *TimelinePanel) ensureVisible() {
+	if p.Selected < p.scrollOff {
+		p.scrollOff = p.Selected
+	}
+	if p.listH > 0 && p.Selected >= p.scrollOff+p.listH {
+		p.scrollOff = p.Selected - p.listH + 1
+	}
+}
+
+func (p *TimelinePanel) Render(screen tcell.Screen, x, y, width, height int) {
+	theme := p.Theme
+	if theme == nil {
+		theme = config.Themes["monokai"]
+	}
+
+	dialogW := width * 80 / 100
+	if dialogW < 60 {
+		dialogW = 60
+	}
+	if dialogW > width-2 {
+		dialogW = width - 2
+	}
+	dialogH := height - 4
+	if dialogH < 6 {
+		dialogH = 6
+	}
+	dialogX := x + (width-dialogW)/2
+	dialogY := y + 2
+	p.listH = dialogH - 4
+	p.ensureVisible()
+
+	borderStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.DialogFg)
+	bgStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.DialogFg)
+	titleStyle := tcell.StyleDefault.Background(theme.StatusBarModeBg).Foreground(tcell.ColorWhite).Bold(true)
+	selectedStyle := tcell.StyleDefault.Background(theme.Selection).Foreground(theme.Foreground)
+	dimStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(theme.LineNumber)
+	removedStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(tcell.ColorRed)
+	addedStyle := tcell.StyleDefault.Background(theme.DialogBg).Foreground(tcell.ColorGreen)
+
+	// Background and border
+	for dy := 0; dy < dialogH; dy++ {
+		for dx := 0; dx < dialogW; dx++ {
+			screen.SetContent(dialogX+dx, dialogY+dy, ' ', nil, bgStyle)
+		}
+	}
+	for dx := 0; dx < dialogW; dx++ {
+		screen.SetContent(dialogX+dx, dialogY, '─', nil, borderStyle)
+		screen.SetContent(dialogX+dx, dialogY+dialogH-1, '─', nil, borderStyle)
+	}
+	for dy := 0; dy < dialogH; dy++ {
+		screen.SetContent(dialogX, dialogY+dy, '│', nil, borderStyle)
+		screen.SetContent(dialogX+dialogW-1, dialogY+dy, '│', nil, borderStyle)
+	}
+	screen.SetContent(dialogX, dialogY, '┌', nil, borderStyle)
+	screen.SetContent(dialogX+dialogW-1, dialogY, '┐', nil, borderStyle)
+	screen.SetContent(dialogX, dialogY+dialogH-1, '└', nil, borderStyle)
+	screen.SetContent(dialogX+dialogW-1, dialogY+dialogH-1, '┘', nil, borderStyle)
+
+	title := " " + p.Title + " "
+	titleX := dialogX + (dialogW-runewidth.StringWidth(title))/2
+	if titleX <= dialogX {
+		titleX = dialogX + 1
+	}
+	drawPreviewText(screen, titleX, dialogY, dialogX+dialogW-1, title, titleStyle)
+
+	drawPreviewText(screen, dialogX+2, dialogY+1, dialogX+dialogW-2, p.Hint, dimStyle)
+
+	// The list takes the left part, the diff the rest
+	splitX := dialogX + dialogW*45/100
+	for dx := 1; dx < dialogW-1; dx++ {
+		screen.SetContent(dialogX+dx, dialogY+2, '─', nil, borderStyle)
+	}
+	screen.SetContent(dialogX, dialogY+2, '├', nil, borderStyle)
+	screen.SetContent(dialogX+dialogW-1, dialogY+2, '┤', nil, borderStyle)
+	screen.SetContent(splitX, dialogY+2, '┬', nil, borderStyle)
+	for dy := 3; dy < dialogH-1; dy++ {
+		screen.SetContent(splitX, dialogY+dy, '│', nil, borderStyle)
+	}
+	screen.SetContent(splitX, dialogY+dialogH-1, '┴', nil, borderStyle)
+
+	left := dialogX + 1
+	bottom := dialogY + dialogH - 1
+	rowY := dialogY + 3
+	for i := p.scrollOff; i < len(p.Items) && rowY < bottom; i++ {
+		item := p.Items[i]
+		style := bgStyle
+		if i == p.Selected {
+			style = selectedStyle
+			for cx := left; cx < splitX; cx++ {
+				screen.SetContent(cx, rowY, ' ', nil, style)
+			}
+		}
+		mark := "○ "
+		if item.Current {
+			mark = "● "
+		}
+		text := " " + strings.Repeat("│ ", item.Indent) + mark + item.Label
+		col := drawPreviewText(screen, left, rowY, splitX, text, style)
+		if item.Summary != "" {
+			sumStyle := dimStyle
+			if i == p.Selected {
+				sumStyle = sumStyle.Background(theme.Selection)
+			}
+			drawPreviewText(screen, col, rowY, splitX, "  "+item.Summary, sumStyle)
+		}
+		rowY++
+	}
+
+	if p.Selected < 0 || p.Selected >= len(p.Items) {
+		return
+	}
+	item := &p.Items[p.Selected]
+	if item.Diff == nil && p.LoadDiff != nil {
+		item.Diff = p.LoadDiff(*item)
+		if item.Diff == nil {
+			item.Diff = []TimelineDiffLine{}
+		}
+	}
+	rowY = dialogY + 3
+	for _, line := range item.Diff {
+		if rowY >= bottom {
+			break
+		}
+		style := dimStyle
+		prefix := ""
+		switch {
+		case line.Kind < 0:
+			style, prefix = removedStyle, "- "
+		case line.Kind > 0:
+			style, prefix = addedStyle, "+ "
+		}
+		drawPreviewText(screen, splitX+2, rowY, dialogX+dialogW-1, prefix+line.Text, style)
+		rowY++
+	}
+}
+
+func (p *TimelinePanel) HandleKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		if p.OnCancel != nil {
+			p.OnCancel()
+		}
+		return true
+	case tcell.KeyEnter:
+		if p.OnSelect != nil && p.Selected >= 0 && p.Selected < len(p.Items) {
+			p.OnSelect(p.Items[p.Selected])
+		}
+		return true
+	case tcell.KeyUp:
+		if p.Selected > 0 {
+			p.Selected--
+		}
+		return true
+	case tcell.KeyDown:
+		if p.Selected < len(p.Items)-1 {
+			p.Selected++
+		}
+		return true
+	case tcell.KeyPgUp:
+		p.Selected = max(p.Selected-p.listH/2, 0)
+		return true
+	case tcell.KeyPgDn:
+		p.Selected = min(p.Selected+p.listH/2, len(p.Items)-1)
+		return true
+	case tcell.KeyHome:
+		p.Selected = 0
+		return true
+	case tcell.KeyEnd:
+		p.Selected = len(p.Items) - 1
+		return true
+	}
+	return false
+}
+
+func (p *TimelinePanel) HandleMouse(ev *tcell.EventMouse) bool {
+	switch ev.Buttons() {
+	case tcell.WheelUp:
+		if p.Selected > 0 {
+			p.Selected--
+		}
+		return true
+	case tcell.WheelDown:
+		if p.Selected < len(p.Items)-1 {
+			p.Selected++
+		}
+		return true
+	}
+	return false
+}